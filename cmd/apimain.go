@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"log"
 	"os"
 	"strconv"
 	"time"
@@ -11,19 +13,22 @@ import (
 	"github.com/lejianwen/rustdesk-api/v2/global"
 	"github.com/lejianwen/rustdesk-api/v2/http"
 	"github.com/lejianwen/rustdesk-api/v2/lib/cache"
+	"github.com/lejianwen/rustdesk-api/v2/lib/cmdproxy"
+	"github.com/lejianwen/rustdesk-api/v2/lib/fieldcrypt"
 	"github.com/lejianwen/rustdesk-api/v2/lib/jwt"
 	"github.com/lejianwen/rustdesk-api/v2/lib/lock"
 	"github.com/lejianwen/rustdesk-api/v2/lib/logger"
 	"github.com/lejianwen/rustdesk-api/v2/lib/orm"
 	"github.com/lejianwen/rustdesk-api/v2/lib/upload"
 	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/model/custom_types"
 	"github.com/lejianwen/rustdesk-api/v2/service"
 	"github.com/lejianwen/rustdesk-api/v2/utils"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"github.com/spf13/cobra"
 )
 
-const DatabaseVersion = 266
+const DatabaseVersion = 292
 
 // @title 管理系统API
 // @version 1.0
@@ -44,6 +49,11 @@ var rootCmd = &cobra.Command{
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		global.Logger.Info("API SERVER START")
+		service.AllService.IpBlockService.StartReconcile(global.Config.Admin.IpBlockSyncInterval)
+		service.AllService.RelayUsageService.StartCollect(global.Config.Admin.RelayUsageInterval, global.Config.Admin.RelayUsageRetention)
+		service.AllService.ServerHealthService.StartProbe(global.Config.Admin.ServerHealthInterval, global.Config.Admin.ServerHealthRetention)
+		service.AllService.SmartCollectionService.StartSync(global.Config.Admin.SmartCollectionSyncInterval)
+		service.AllService.AddressBookAccessService.StartExpire(global.Config.Admin.AbRuleExpireInterval)
 		http.ApiInit()
 	},
 }
@@ -98,10 +108,54 @@ var resetUserPwdCmd = &cobra.Command{
 		global.Logger.Info("reset password success!")
 	},
 }
+var encryptFieldsDecrypt bool
+var encryptFieldsCmd = &cobra.Command{
+	Use:     "encrypt-fields",
+	Example: "encrypt-fields\n  encrypt-fields --decrypt",
+	Short:   "Encrypt Secret Fields With The Current Key",
+	Long:    "Encrypt plaintext secret fields in place and re-encrypt values written with an older key. With --decrypt, restore them to plaintext.",
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		res, err := service.AllService.FieldEncryptionService.Rewrite(encryptFieldsDecrypt)
+		for _, r := range res {
+			global.Logger.Info(fmt.Sprintf("%s.%s: %d rows, %d rewritten", r.Table, r.Column, r.Total, r.Rewritten))
+		}
+		if err != nil {
+			global.Logger.Error("encrypt fields fail! ", err)
+			return
+		}
+		global.Logger.Info("encrypt fields success!")
+	},
+}
+var cmdProxy = &cmdproxy.Proxy{}
+var cmdProxyCmd = &cobra.Command{
+	Use:     "cmd-proxy",
+	Example: "cmd-proxy --listen :21120 --target 127.0.0.1:21117 --secret xxx",
+	Short:   "Proxy Commands From The API Server To The Local hbbs/hbbr",
+	Long:    "Run on a remote hbbs/hbbr host. Accepts commands from a remote command endpoint, checks the secret sent as the first line and forwards the rest to the local command port. The secret can also be set with RUSTDESK_API_CMD_PROXY_SECRET.",
+	Args:    cobra.NoArgs,
+	// 代理不需要数据库和配置文件
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if cmdProxy.Secret == "" {
+			cmdProxy.Secret = os.Getenv("RUSTDESK_API_CMD_PROXY_SECRET")
+		}
+		if cmdProxy.Secret == "" {
+			log.Println("cmd proxy: no secret set, any client that can reach the listen address can send commands")
+		}
+		cmdProxy.Logf = log.Printf
+		log.Printf("cmd proxy: %s -> %s", cmdProxy.Listen, cmdProxy.Target)
+		return cmdProxy.ListenAndServe()
+	},
+}
 
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&global.ConfigPath, "config", "c", "./conf/config.yaml", "choose config file")
-	rootCmd.AddCommand(resetPwdCmd, resetUserPwdCmd)
+	encryptFieldsCmd.Flags().BoolVar(&encryptFieldsDecrypt, "decrypt", false, "decrypt fields to plaintext")
+	cmdProxyCmd.Flags().StringVar(&cmdProxy.Listen, "listen", ":"+strconv.Itoa(cmdproxy.DefaultPort), "listen address")
+	cmdProxyCmd.Flags().StringVar(&cmdProxy.Target, "target", "127.0.0.1:21117", "local hbbs/hbbr command address")
+	cmdProxyCmd.Flags().StringVar(&cmdProxy.Secret, "secret", "", "shared secret, same as the endpoint secret")
+	rootCmd.AddCommand(resetPwdCmd, resetUserPwdCmd, encryptFieldsCmd, cmdProxyCmd)
 }
 func main() {
 	if err := rootCmd.Execute(); err != nil {
@@ -200,6 +254,9 @@ func InitGlobal() {
 	//locker
 	global.Lock = lock.NewLocal()
 
+	//敏感字段加密, 需要在读写数据库之前设置
+	InitFieldCrypt()
+
 	//service
 	service.New(&global.Config, global.DB, global.Logger, global.Jwt, global.Lock)
 
@@ -210,9 +267,53 @@ func InitGlobal() {
 		BanDuration:      30 * time.Minute,
 	})
 	global.LoginLimiter.RegisterProvider(utils.B64StringCaptchaProvider{})
+	global.LoginLimiter.RegisterBanHandler(func(ip string, record utils.BanRecord) {
+		service.AllService.IpBlockService.BlockFromLimiter(ip, record.Reason, record.ExpiresAt)
+	})
 	DatabaseAutoUpdate()
 }
 
+// InitFieldCrypt 按配置加载敏感字段加密密钥
+func InitFieldCrypt() {
+	c := global.Config.Crypto
+	var keys []*fieldcrypt.Key
+	if c.Key != "" {
+		id := c.KeyId
+		if id == "" {
+			id = "default"
+		}
+		k, err := fieldcrypt.NewKey(id, c.Key)
+		if err != nil {
+			global.Logger.Fatal("invalid crypto key: ", err)
+		}
+		keys = append(keys, k)
+	}
+	if c.KeyFile != "" {
+		data, err := os.ReadFile(c.KeyFile)
+		if err != nil {
+			global.Logger.Fatal("read crypto key file fail: ", err)
+		}
+		fks, err := fieldcrypt.ParseKeyFile(data)
+		if err != nil {
+			global.Logger.Fatal("invalid crypto key file: ", err)
+		}
+		for _, k := range fks {
+			if len(keys) > 0 && k.Id == keys[0].Id && bytes.Equal(k.Secret, keys[0].Secret) {
+				continue
+			}
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	kr, err := fieldcrypt.NewKeyring(keys...)
+	if err != nil {
+		global.Logger.Fatal(err)
+	}
+	custom_types.SetKeyring(kr)
+}
+
 func DatabaseAutoUpdate() {
 	version := DatabaseVersion
 
@@ -311,6 +412,43 @@ func DatabaseAutoUpdate() {
 				db.Exec("ALTER TABLE user_tokens ADD COLUMN last_active_at BIGINT DEFAULT 0")
 			}
 		}
+		// 289迁移: 修订差异中的明文密钥改为指纹
+		if v.Version < 289 {
+			var revs []*model.ServerConfigRevision
+			db.Select("id", "diff").Where("diff like ?", `%"key"%`).Find(&revs)
+			for _, r := range revs {
+				d, ok := r.Diff["key"]
+				if !ok {
+					continue
+				}
+				o, _ := d[0].(string)
+				n, _ := d[1].(string)
+				r.Diff["key"] = [2]interface{}{model.KeyFingerprint(o), model.KeyFingerprint(n)}
+				db.Model(r).Select("diff").Updates(r)
+			}
+		}
+		// 291迁移: 限定接收人的分享链接绑定到接收人邮箱对应的用户, 无法确定用户的需要重新分享
+		if v.Version < 291 {
+			var srs []*model.ShareRecord
+			db.Select("id", "recipient_email").Where("recipient_email <> '' and recipient_user_id = 0").Find(&srs)
+			for _, sr := range srs {
+				if uid, err := service.AllService.ShareRecordService.ResolveRecipient(sr.RecipientEmail); err == nil {
+					db.Model(sr).Update("recipient_user_id", uid)
+				}
+			}
+		}
+		// 292迁移: 旧签名配置码的载荷带有服务器配置和密钥, 重新签名为只含标识的配置码
+		if v.Version < 292 {
+			var ccs []*model.ConfigCode
+			db.Where("signed_code <> ''").Find(&ccs)
+			for _, cc := range ccs {
+				if err := service.AllService.ConfigSigningService.Sign(cc); err != nil {
+					global.Logger.Error("re-sign config code fail! ", cc.Id, " ", err)
+					continue
+				}
+				db.Model(cc).Select("kid", "audience", "signed_code").Updates(cc)
+			}
+		}
 	}
 
 }
@@ -337,6 +475,28 @@ func Migrate(version uint) {
 		&model.ServerConfig{},
 		&model.ConfigCode{},
 		&model.ConfigCodeUsage{},
+		&model.IpBlock{},
+		&model.ServerCmdEndpoint{},
+		&model.RelayUsage{},
+		&model.ConfigSigningKey{},
+		&model.ServerHealthCheck{},
+		&model.ServerConfigRevision{},
+		&model.EnrollmentLink{},
+		&model.Enrollment{},
+		&model.PeerInventoryChange{},
+		&model.DeviceGroupRule{},
+		&model.PeerAttributeDefinition{},
+		&model.PeerAttribute{},
+		&model.PeerLabel{},
+		&model.AddressBookSync{},
+		&model.AddressBookTombstone{},
+		&model.AddressBookChange{},
+		&model.AddressBookAccessRequest{},
+		&model.ShareRecordUse{},
+		&model.Notification{},
+		&model.TagDefinition{},
+		&model.TagRule{},
+		&model.PeerAlias{},
 	)
 	if err != nil {
 		global.Logger.Error("migrate err :=>", err)
@@ -26,6 +26,11 @@ type App struct {
 	
 	// 新增配置：多端登录限制
 	MaxConcurrentDevices int `mapstructure:"max-concurrent-devices"` // 同一用户最大同时登录设备数
+
+	// 地址簿条目配额, 0表示不限制; 用户和地址簿可单独设置
+	AbMaxPeersPerUser       int `mapstructure:"ab-max-peers-per-user"`       // 每个用户所有地址簿的条目总数
+	AbMaxPeersPerCollection int `mapstructure:"ab-max-peers-per-collection"` // 每个地址簿的条目数
+	AbMaxPageSize           int `mapstructure:"ab-max-page-size"`            // 客户端分页读取地址簿时每页最大条数, 0为1000
 }
 type Admin struct {
 	Title           string `mapstructure:"title"`
@@ -33,6 +38,21 @@ type Admin struct {
 	HelloFile       string `mapstructure:"hello-file"`
 	IdServerPort    int    `mapstructure:"id-server-port"`
 	RelayServerPort int    `mapstructure:"relay-server-port"`
+	// IP黑名单与 hbbs/hbbr 的对账间隔, 小于0表示不对账
+	IpBlockSyncInterval time.Duration `mapstructure:"ip-block-sync-interval"`
+	// hbbr 负载采集间隔和采样保留时长, 小于0表示不采集/不清理
+	RelayUsageInterval  time.Duration `mapstructure:"relay-usage-interval"`
+	RelayUsageRetention time.Duration `mapstructure:"relay-usage-retention"`
+	// ServerConfig 健康检查间隔、判定不可用的连续失败次数和记录保留时长
+	ServerHealthInterval      time.Duration `mapstructure:"server-health-interval"`
+	ServerHealthFailThreshold int           `mapstructure:"server-health-fail-threshold"`
+	ServerHealthRetention     time.Duration `mapstructure:"server-health-retention"`
+	// 智能地址簿定时同步间隔, 小于0表示只在保存和读取时同步
+	SmartCollectionSyncInterval time.Duration `mapstructure:"smart-collection-sync-interval"`
+	// 旧版地址簿每个用户保留的同步历史数, 小于0表示不清理
+	AbSyncHistoryLimit int `mapstructure:"ab-sync-history-limit"`
+	// 清理到期地址簿规则的间隔, 规则到期即失效, 小于0表示不清理
+	AbRuleExpireInterval time.Duration `mapstructure:"ab-rule-expire-interval"`
 }
 type Config struct {
 	Lang       string `mapstructure:"lang"`
@@ -50,6 +70,8 @@ type Config struct {
 	Rustdesk   Rustdesk
 	Proxy      Proxy
 	Ldap       Ldap
+	Geo        Geo
+	Crypto     Crypto
 }
 
 func (a *Admin) Init() {
@@ -59,6 +81,33 @@ func (a *Admin) Init() {
 	if a.RelayServerPort == 0 {
 		a.RelayServerPort = DefaultRelayServerPort
 	}
+	if a.IpBlockSyncInterval == 0 {
+		a.IpBlockSyncInterval = 5 * time.Minute
+	}
+	if a.RelayUsageInterval == 0 {
+		a.RelayUsageInterval = time.Minute
+	}
+	if a.RelayUsageRetention == 0 {
+		a.RelayUsageRetention = 7 * 24 * time.Hour
+	}
+	if a.ServerHealthInterval == 0 {
+		a.ServerHealthInterval = time.Minute
+	}
+	if a.ServerHealthFailThreshold == 0 {
+		a.ServerHealthFailThreshold = 2
+	}
+	if a.ServerHealthRetention == 0 {
+		a.ServerHealthRetention = 7 * 24 * time.Hour
+	}
+	if a.SmartCollectionSyncInterval == 0 {
+		a.SmartCollectionSyncInterval = 5 * time.Minute
+	}
+	if a.AbSyncHistoryLimit == 0 {
+		a.AbSyncHistoryLimit = 100
+	}
+	if a.AbRuleExpireInterval == 0 {
+		a.AbRuleExpireInterval = time.Minute
+	}
 }
 
 // Init 初始化配置
@@ -0,0 +1,9 @@
+package config
+
+// Crypto 敏感字段(地址簿密码、OAuth 密钥、服务器密钥)加密存储的主密钥
+// key 和 key-file 都未配置时不加密; 都配置时 key 为当前密钥, key-file 中的密钥只用于解密
+type Crypto struct {
+	Key     string `mapstructure:"key"`      // base64 编码的 16/24/32 字节密钥
+	KeyId   string `mapstructure:"key-id"`   // key 的密钥ID, 默认 default
+	KeyFile string `mapstructure:"key-file"` // 每行 "<密钥ID>:<base64密钥>", 第一行为当前密钥, 其余用于解密轮换前的数据
+}
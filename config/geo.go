@@ -0,0 +1,8 @@
+package config
+
+// Geo 客户端地域识别, 用于选择 ServerConfig
+type Geo struct {
+	MmdbFile       string              `mapstructure:"mmdb-file"`       // GeoIP 数据库文件, 为空不启用
+	CidrRegions    map[string][]string `mapstructure:"cidr-regions"`    // 地域 => 网段, 优先于 GeoIP
+	CountryRegions map[string]string   `mapstructure:"country-regions"` // 国家代码 => 地域, 未配置时地域即国家代码
+}
@@ -3,12 +3,15 @@ package admin
 import (
 	"encoding/json"
 	_ "encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/lejianwen/rustdesk-api/v2/global"
 	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
 	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/model"
 	"github.com/lejianwen/rustdesk-api/v2/service"
 	"gorm.io/gorm"
+	"net/http"
 	"strconv"
 )
 
@@ -76,7 +79,11 @@ func (ct *AddressBook) Create(c *gin.Context) {
 		return
 	}
 
-	err := service.AllService.AddressBookService.Create(t)
+	err := service.AllService.AddressBookService.Create(t, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin))
+	if errors.Is(err, service.ErrAbQuotaExceeded) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
 	if err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
@@ -135,13 +142,14 @@ func (ct *AddressBook) BatchCreate(c *gin.Context) {
 		}
 	}*/
 	ts := f.ToAddressBooks()
+	actor := service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin)
 	for _, t := range ts {
 		if t.UserId == 0 {
 			continue
 		}
 		ex := service.AllService.AddressBookService.InfoByUserIdAndIdAndCid(t.UserId, t.Id, t.CollectionId)
 		if ex.RowId == 0 {
-			service.AllService.AddressBookService.Create(t)
+			service.AllService.AddressBookService.Create(t, actor)
 		}
 	}
 
@@ -232,7 +240,11 @@ func (ct *AddressBook) Update(c *gin.Context) {
 		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
 		return
 	}
-	err := service.AllService.AddressBookService.UpdateAll(t)
+	err := service.AllService.AddressBookService.UpdateAll(t, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin))
+	if errors.Is(err, service.ErrAbQuotaExceeded) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
 	if err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
@@ -268,7 +280,7 @@ func (ct *AddressBook) Delete(c *gin.Context) {
 		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
 		return
 	}
-	err := service.AllService.AddressBookService.Delete(t)
+	err := service.AllService.AddressBookService.Delete(t, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin))
 	if err == nil {
 		response.Success(c, nil)
 		return
@@ -308,6 +320,10 @@ func (ct *AddressBook) ShareByWebClient(c *gin.Context) {
 	m := f.ToShareRecord()
 	m.UserId = u.Id
 	err := service.AllService.AddressBookService.ShareByWebClient(m)
+	if errors.Is(err, service.ErrShareRecipientUnknown) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
 	if err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
@@ -335,6 +351,10 @@ func (ct *AddressBook) BatchCreateFromPeers(c *gin.Context) {
 			response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
 			return
 		}
+		if collection.IsSmart() {
+			response.Fail(c, 101, response.TranslateMsg(c, "SmartCollectionReadOnly"))
+			return
+		}
 	}
 
 	pl := int64(len(f.PeerIds))
@@ -347,6 +367,7 @@ func (ct *AddressBook) BatchCreateFromPeers(c *gin.Context) {
 	}
 
 	tags, _ := json.Marshal(f.Tags)
+	actor := service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin)
 	for _, peer := range peers.Peers {
 		ab := service.AllService.AddressBookService.FromPeer(peer)
 		ab.Tags = tags
@@ -356,7 +377,149 @@ func (ct *AddressBook) BatchCreateFromPeers(c *gin.Context) {
 		if ex.RowId != 0 {
 			continue
 		}
-		service.AllService.AddressBookService.Create(ab)
+		service.AllService.AddressBookService.Create(ab, actor)
 	}
 	response.Success(c, nil)
 }
+
+// Export 导出地址簿
+// @Tags 地址簿
+// @Summary 导出地址簿
+// @Description 导出用户的地址簿, format 为 csv、json 或 rustdesk(客户端地址簿数据)
+// @Produce text/csv
+// @Produce json
+// @Param user_id query int true "用户id"
+// @Param collection_id query int false "地址簿id, 0 为默认地址簿"
+// @Param format query string true "csv, json 或 rustdesk"
+// @Param secrets query bool false "是否包含密码和 hash"
+// @Success 200 {file} binary
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book/export [get]
+// @Security token
+func (ct *AddressBook) Export(c *gin.Context) {
+	q := &admin.AddressBookExportQuery{}
+	if err := c.ShouldBindQuery(q); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, q)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	if q.UserId == 0 || (q.CollectionId > 0 && !service.AllService.AddressBookService.CheckCollectionOwner(q.UserId, q.CollectionId)) {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
+		return
+	}
+	b, err := service.AllService.AddressBookTransferService.Export(q.UserId, q.CollectionId, q.Format, q.Secrets)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	WriteAddressBookExport(c, q.Format, b)
+}
+
+// WriteAddressBookExport 以附件形式输出导出文件, 我的地址簿也使用
+func WriteAddressBookExport(c *gin.Context, format string, b []byte) {
+	contentType, ext := "application/json", "json"
+	if format == model.AddressBookFormatCsv {
+		contentType, ext = "text/csv; charset=utf-8", "csv"
+	}
+	c.Header("Content-Disposition", `attachment; filename="address_book_`+format+`.`+ext+`"`)
+	c.Data(http.StatusOK, contentType, b)
+}
+
+// ImportPreview 导入预览
+// @Tags 地址簿
+// @Summary 导入预览
+// @Description 解析文件, 返回识别的列、字段映射以及每行的校验结果和将要执行的操作, 不修改数据
+// @Accept  json
+// @Produce  json
+// @Param body body admin.AddressBookImportForm true "导入信息"
+// @Success 200 {object} response.Response{data=model.AddressBookImportReport}
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book/import/preview [post]
+// @Security token
+func (ct *AddressBook) ImportPreview(c *gin.Context) {
+	f, opt := BindAddressBookImport(c, 0)
+	if f == nil {
+		return
+	}
+	res, err := service.AllService.AddressBookTransferService.Preview(f.UserId, f.CollectionId, opt)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	response.Success(c, res)
+}
+
+// Import 导入
+// @Tags 地址簿
+// @Summary 导入地址簿
+// @Description 按字段映射和合并方式导入, 校验失败的行跳过, 超出配额时整体失败
+// @Accept  json
+// @Produce  json
+// @Param body body admin.AddressBookImportForm true "导入信息"
+// @Success 200 {object} response.Response{data=model.AddressBookImportReport}
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book/import [post]
+// @Security token
+func (ct *AddressBook) Import(c *gin.Context) {
+	f, opt := BindAddressBookImport(c, 0)
+	if f == nil {
+		return
+	}
+	res, err := service.AllService.AddressBookTransferService.Import(f.UserId, f.CollectionId, opt, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceImport))
+	if errors.Is(err, service.ErrAbQuotaExceeded) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, res)
+}
+
+// BindAddressBookImport 绑定导入表单并校验目标地址簿, 失败时已输出响应
+// ownerId 非 0 时只能导入到该用户自己的地址簿(我的地址簿), 忽略表单中的 user_id
+func BindAddressBookImport(c *gin.Context, ownerId uint) (*admin.AddressBookImportForm, *service.AddressBookImportOptions) {
+	f := &admin.AddressBookImportForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return nil, nil
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return nil, nil
+	}
+	if ownerId > 0 {
+		f.UserId = ownerId
+	}
+	if f.UserId == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
+		return nil, nil
+	}
+	if f.CollectionId != 0 {
+		collection := service.AllService.AddressBookService.CollectionInfoById(f.CollectionId)
+		if collection.Id == 0 || (ownerId == 0 && collection.UserId != f.UserId) {
+			response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+			return nil, nil
+		}
+		if collection.UserId != f.UserId {
+			response.Fail(c, 101, response.TranslateMsg(c, "NoAccess"))
+			return nil, nil
+		}
+		if collection.IsSmart() {
+			response.Fail(c, 101, response.TranslateMsg(c, "SmartCollectionReadOnly"))
+			return nil, nil
+		}
+	}
+	return f, &service.AddressBookImportOptions{
+		Format:   f.Format,
+		Content:  f.Content,
+		Mapping:  f.Mapping,
+		Strategy: f.Strategy,
+	}
+}
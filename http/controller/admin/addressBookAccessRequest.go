@@ -0,0 +1,124 @@
+package admin
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/service"
+	"gorm.io/gorm"
+)
+
+type AddressBookAccessRequest struct {
+}
+
+// List 列表
+// @Tags 地址簿访问申请
+// @Summary 地址簿访问申请列表
+// @Description 地址簿访问申请列表, 包含审批结果
+// @Accept  json
+// @Produce  json
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Param user_id query int false "申请人"
+// @Param owner_id query int false "地址簿所有者"
+// @Param collection_id query int false "地址簿id"
+// @Param status query string false "pending, approved, denied, cancelled, expired"
+// @Success 200 {object} response.Response{data=model.AddressBookAccessRequestList}
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book_access_request/list [get]
+// @Security token
+func (ct *AddressBookAccessRequest) List(c *gin.Context) {
+	query := &admin.AddressBookAccessRequestQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	res := service.AllService.AddressBookAccessService.List(query.Page, query.PageSize, func(tx *gorm.DB) {
+		if query.UserId > 0 {
+			tx.Where("user_id = ?", query.UserId)
+		}
+		if query.OwnerId > 0 {
+			tx.Where("owner_id = ?", query.OwnerId)
+		}
+		if query.CollectionId > 0 {
+			tx.Where("collection_id = ?", query.CollectionId)
+		}
+		if query.Status != "" {
+			tx.Where("status = ?", query.Status)
+		}
+	})
+	response.Success(c, res)
+}
+
+// Approve 批准
+// @Tags 地址簿访问申请
+// @Summary 批准地址簿访问申请
+// @Description 批准后为申请人生成个人规则, 可以调整权限和有效期
+// @Accept  json
+// @Produce  json
+// @Param body body admin.AddressBookAccessDecisionForm true "审批信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book_access_request/approve [post]
+// @Security token
+func (ct *AddressBookAccessRequest) Approve(c *gin.Context) {
+	ct.decide(c, true)
+}
+
+// Deny 拒绝
+// @Tags 地址簿访问申请
+// @Summary 拒绝地址簿访问申请
+// @Description 拒绝地址簿访问申请
+// @Accept  json
+// @Produce  json
+// @Param body body admin.AddressBookAccessDecisionForm true "审批信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book_access_request/deny [post]
+// @Security token
+func (ct *AddressBookAccessRequest) Deny(c *gin.Context) {
+	ct.decide(c, false)
+}
+
+func (ct *AddressBookAccessRequest) decide(c *gin.Context, approve bool) {
+	f := &admin.AddressBookAccessDecisionForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	r := service.AllService.AddressBookAccessService.InfoById(f.Id)
+	if r.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	d := &service.AddressBookAccessDecision{
+		DeciderId: service.AllService.UserService.CurUser(c).Id,
+		Rule:      f.Rule,
+		StartAt:   f.StartAt,
+		EndAt:     f.EndAt,
+		Note:      f.Note,
+	}
+	var err error
+	if approve {
+		err = service.AllService.AddressBookAccessService.Approve(r, d)
+	} else {
+		err = service.AllService.AddressBookAccessService.Deny(r, d)
+	}
+	if errors.Is(err, service.ErrAbAccessPeriod) || errors.Is(err, service.ErrAbAccessDecided) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
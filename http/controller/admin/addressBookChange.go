@@ -0,0 +1,108 @@
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/service"
+	"gorm.io/gorm"
+)
+
+type AddressBookChange struct {
+}
+
+// List 地址簿变更日志
+// @Tags 地址簿变更
+// @Summary 变更日志
+// @Description 地址簿条目、标签和地址簿本身的变更时间线, 按时间倒序
+// @Accept  json
+// @Produce  json
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Param user_id query int false "地址簿所有者"
+// @Param collection_id query int false "地址簿id, 0为个人地址簿"
+// @Param target query string false "peer tag collection"
+// @Param target_key query string false "设备id或标签名称"
+// @Param source query string false "来源 api admin my sync smart restore"
+// @Param actor_id query int false "操作用户"
+// @Param since query int false "开始时间"
+// @Param until query int false "结束时间"
+// @Success 200 {object} response.Response{data=model.AddressBookChangeList}
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book_change/list [get]
+// @Security token
+func (ct *AddressBookChange) List(c *gin.Context) {
+	query := &admin.AddressBookChangeQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	res := service.AllService.AddressBookChangeService.List(query.Page, query.PageSize, addressBookChangeWhere(query))
+	response.Success(c, res)
+}
+
+// Restore 按时间点恢复地址簿
+// @Tags 地址簿变更
+// @Summary 按时间点恢复
+// @Description 按变更日志将地址簿的条目、标签和名称恢复到指定时间点, 恢复产生的修改记入变更日志
+// @Accept  json
+// @Produce  json
+// @Param body body admin.AddressBookRestoreForm true "恢复"
+// @Success 200 {object} response.Response{data=model.AddressBookRestoreResult}
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book_change/restore [post]
+// @Security token
+func (ct *AddressBookChange) Restore(c *gin.Context) {
+	f := &admin.AddressBookRestoreForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	if f.UserId == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
+		return
+	}
+	actor := service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin)
+	res, err := service.AllService.AddressBookChangeService.Restore(f.UserId, f.CollectionId, f.At, actor)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	response.Success(c, res)
+}
+
+func addressBookChangeWhere(query *admin.AddressBookChangeQuery) func(tx *gorm.DB) {
+	return func(tx *gorm.DB) {
+		if query.UserId > 0 {
+			tx.Where("user_id = ?", query.UserId)
+		}
+		if query.CollectionId != nil {
+			tx.Where("collection_id = ?", *query.CollectionId)
+		}
+		if query.Target != "" {
+			tx.Where("target = ?", query.Target)
+		}
+		if query.TargetKey != "" {
+			tx.Where("target_key = ?", query.TargetKey)
+		}
+		if query.Source != "" {
+			tx.Where("source = ?", query.Source)
+		}
+		if query.ActorId > 0 {
+			tx.Where("actor_id = ?", query.ActorId)
+		}
+		if query.Since > 0 {
+			tx.Where("changed_at >= ?", query.Since)
+		}
+		if query.Until > 0 {
+			tx.Where("changed_at <= ?", query.Until)
+		}
+	}
+}
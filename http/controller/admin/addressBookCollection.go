@@ -1,6 +1,8 @@
 package admin
 
 import (
+	"errors"
+
 	"github.com/gin-gonic/gin"
 	"github.com/lejianwen/rustdesk-api/v2/global"
 	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
@@ -64,7 +66,11 @@ func (abc *AddressBookCollection) Create(c *gin.Context) {
 		return
 	}
 	t := f
-	err := service.AllService.AddressBookService.CreateCollection(t)
+	err := service.AllService.AddressBookService.CreateCollection(t, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin))
+	if errors.Is(err, service.ErrAbCollectionParent) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
 	if err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
@@ -127,7 +133,7 @@ func (abc *AddressBookCollection) Update(c *gin.Context) {
 		return
 	}
 	t := f //f.ToAddressBookCollection()
-	err := service.AllService.AddressBookService.UpdateCollection(t)
+	err := service.AllService.AddressBookService.UpdateCollection(t, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin))
 	if err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
@@ -141,19 +147,18 @@ func (abc *AddressBookCollection) Update(c *gin.Context) {
 // @Description 地址簿名称删除
 // @Accept  json
 // @Produce  json
-// @Param body body model.AddressBookCollection true "地址簿名称信息"
+// @Param body body admin.AddressBookCollectionDeleteForm true "地址簿名称信息"
 // @Success 200 {object} response.Response
 // @Failure 500 {object} response.Response
 // @Router /admin/address_book_collection/delete [post]
 // @Security token
 func (abc *AddressBookCollection) Delete(c *gin.Context) {
-	f := &model.AddressBookCollection{}
+	f := &admin.AddressBookCollectionDeleteForm{}
 	if err := c.ShouldBindJSON(f); err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
 		return
 	}
-	id := f.Id
-	errList := global.Validator.ValidVar(c, id, "required,gt=0")
+	errList := global.Validator.ValidStruct(c, f)
 	if len(errList) > 0 {
 		response.Fail(c, 101, errList[0])
 		return
@@ -163,10 +168,137 @@ func (abc *AddressBookCollection) Delete(c *gin.Context) {
 		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
 		return
 	}
-	err := service.AllService.AddressBookService.DeleteCollection(ex)
+	err := service.AllService.AddressBookService.DeleteCollection(ex, f.Policy, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin))
 	if err == nil {
 		response.Success(c, nil)
 		return
 	}
+	if errors.Is(err, service.ErrAbCollectionHasChildren) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
 	response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
 }
+
+// Sync 立即同步智能地址簿
+// @Tags 地址簿名称
+// @Summary 同步智能地址簿
+// @Description 按设备查询立即同步地址簿条目, 普通地址簿不做处理
+// @Accept  json
+// @Produce  json
+// @Param id path int true "ID"
+// @Success 200 {object} response.Response{data=model.SmartCollectionSyncResult}
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book_collection/sync/{id} [post]
+// @Security token
+func (abc *AddressBookCollection) Sync(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	col := service.AllService.AddressBookService.CollectionInfoById(uint(id))
+	if col.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	res, err := service.AllService.SmartCollectionService.Sync(col)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, res)
+}
+
+// Preview 预览设备查询
+// @Tags 地址簿名称
+// @Summary 预览设备查询
+// @Description 保存智能地址簿前预览匹配的设备, user_id 为地址簿所属用户, 非管理员只匹配自己的设备
+// @Accept  json
+// @Produce  json
+// @Param body body admin.SmartCollectionPreviewForm true "设备查询"
+// @Success 200 {object} response.Response{data=model.PeerList}
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book_collection/preview [post]
+// @Security token
+func (abc *AddressBookCollection) Preview(c *gin.Context) {
+	f := &admin.SmartCollectionPreviewForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	owner := service.AllService.UserService.InfoById(f.UserId)
+	if owner.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	res, err := service.AllService.SmartCollectionService.Preview(f.PeerQuery, owner, f.Page, f.PageSize)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	response.Success(c, res)
+}
+
+// Tree 地址簿树
+// @Tags 地址簿名称
+// @Summary 地址簿树
+// @Description 按上下级组织的地址簿, 包含组合名称和条目数
+// @Accept  json
+// @Produce  json
+// @Param user_id query int false "用户id, 默认为当前用户"
+// @Success 200 {object} response.Response{data=[]model.AddressBookCollectionNode}
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book_collection/tree [get]
+// @Security token
+func (abc *AddressBookCollection) Tree(c *gin.Context) {
+	query := &admin.AddressBookCollectionTreeQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	if query.UserId == 0 {
+		query.UserId = service.AllService.UserService.CurUser(c).Id
+	}
+	response.Success(c, service.AllService.AddressBookService.CollectionTree(query.UserId))
+}
+
+// Move 修改上级
+// @Tags 地址簿名称
+// @Summary 修改上级地址簿
+// @Description 上级只能是同一用户的地址簿, parent_id 为 0 时移到顶层
+// @Accept  json
+// @Produce  json
+// @Param body body admin.AddressBookCollectionMoveForm true "上级信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book_collection/move [post]
+// @Security token
+func (abc *AddressBookCollection) Move(c *gin.Context) {
+	f := &admin.AddressBookCollectionMoveForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	ex := service.AllService.AddressBookService.CollectionInfoById(f.Id)
+	if ex.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	err := service.AllService.AddressBookService.MoveCollection(ex, f.ParentId, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin))
+	if errors.Is(err, service.ErrAbCollectionParent) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
@@ -0,0 +1,172 @@
+package admin
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/service"
+	"gorm.io/gorm"
+)
+
+type AddressBookSync struct {
+}
+
+// List 旧版地址簿同步历史
+// @Tags 地址簿同步
+// @Summary 同步历史
+// @Description 旧版地址簿(/api/ab)每次同步的修订记录, 列表不含快照
+// @Accept  json
+// @Produce  json
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Param user_id query int false "用户id"
+// @Param action query string false "类型 init sync restore undelete"
+// @Success 200 {object} response.Response{data=model.AddressBookSyncList}
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book_sync/list [get]
+// @Security token
+func (ct *AddressBookSync) List(c *gin.Context) {
+	query := &admin.AddressBookSyncQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	res := service.AllService.AddressBookSyncService.List(query.Page, query.PageSize, func(tx *gorm.DB) {
+		if query.UserId > 0 {
+			tx.Where("user_id = ?", query.UserId)
+		}
+		if query.Action != "" {
+			tx.Where("action = ?", query.Action)
+		}
+	})
+	response.Success(c, res)
+}
+
+// Detail 同步记录详情
+// @Tags 地址簿同步
+// @Summary 同步记录详情
+// @Description 包含该修订的地址簿快照
+// @Accept  json
+// @Produce  json
+// @Param id path int true "ID"
+// @Success 200 {object} response.Response{data=model.AddressBookSync}
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book_sync/detail/{id} [get]
+// @Security token
+func (ct *AddressBookSync) Detail(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	s, err := service.AllService.AddressBookSyncService.InfoById(uint(id))
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	if s.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	response.Success(c, s)
+}
+
+// Restore 恢复到历史修订
+// @Tags 地址簿同步
+// @Summary 恢复到历史修订
+// @Description 用户个人地址簿整体恢复为该修订的快照, 生成新的修订, 被移除的条目记为已删除条目
+// @Accept  json
+// @Produce  json
+// @Param body body admin.AddressBookSyncRestoreForm true "修订"
+// @Success 200 {object} response.Response{data=model.AddressBookSync}
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book_sync/restore [post]
+// @Security token
+func (ct *AddressBookSync) Restore(c *gin.Context) {
+	f := &admin.AddressBookSyncRestoreForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	u := service.AllService.UserService.CurUser(c)
+	s, err := service.AllService.AddressBookSyncService.Restore(f.UserId, f.Revision, u.Id)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	s.Peers = nil
+	response.Success(c, s)
+}
+
+// Tombstones 同步删除的条目
+// @Tags 地址簿同步
+// @Summary 已删除条目
+// @Description 旧版地址簿同步时删除的条目
+// @Accept  json
+// @Produce  json
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Param user_id query int false "用户id"
+// @Param peer_id query string false "设备id"
+// @Param restored query int false "0 全部 1 已恢复 2 未恢复"
+// @Success 200 {object} response.Response{data=model.AddressBookTombstoneList}
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book_sync/tombstones [get]
+// @Security token
+func (ct *AddressBookSync) Tombstones(c *gin.Context) {
+	query := &admin.AddressBookTombstoneQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	res := service.AllService.AddressBookSyncService.Tombstones(query.Page, query.PageSize, func(tx *gorm.DB) {
+		if query.UserId > 0 {
+			tx.Where("user_id = ?", query.UserId)
+		}
+		if query.PeerId != "" {
+			tx.Where("peer_id = ?", query.PeerId)
+		}
+		if query.Restored == 1 {
+			tx.Where("restored_at > 0")
+		} else if query.Restored == 2 {
+			tx.Where("restored_at = 0")
+		}
+	})
+	response.Success(c, res)
+}
+
+// Undelete 恢复同步删除的条目
+// @Tags 地址簿同步
+// @Summary 恢复已删除条目
+// @Description 条目重新加入用户个人地址簿, 生成新的修订
+// @Accept  json
+// @Produce  json
+// @Param body body admin.AddressBookTombstoneForm true "已删除条目"
+// @Success 200 {object} response.Response{data=model.AddressBookSync}
+// @Failure 500 {object} response.Response
+// @Router /admin/address_book_sync/undelete [post]
+// @Security token
+func (ct *AddressBookSync) Undelete(c *gin.Context) {
+	f := &admin.AddressBookTombstoneForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidVar(c, f.Id, "required,gt=0")
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	u := service.AllService.UserService.CurUser(c)
+	s, err := service.AllService.AddressBookSyncService.RestoreTombstone(f.Id, u.Id)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	s.Peers = nil
+	response.Success(c, s)
+}
@@ -58,6 +58,10 @@ func (ct *DeviceGroup) Create(c *gin.Context) {
 		return
 	}
 	u := f.ToDeviceGroup()
+	if err := service.AllService.ClientVersionService.CheckPolicy(u); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
 	err := service.AllService.GroupService.DeviceGroupCreate(u)
 	if err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
@@ -115,6 +119,10 @@ func (ct *DeviceGroup) Update(c *gin.Context) {
 		return
 	}
 	u := f.ToDeviceGroup()
+	if err := service.AllService.ClientVersionService.CheckPolicy(u); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
 	err := service.AllService.GroupService.DeviceGroupUpdate(u)
 	if err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
@@ -158,3 +166,27 @@ func (ct *DeviceGroup) Delete(c *gin.Context) {
 	}
 	response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
 }
+
+// Compliance 客户端版本合规报告
+// @Tags 设备群组
+// @Summary 客户端版本合规报告
+// @Description 按设备组的最低和推荐版本列出需要升级的设备, status 为空时返回 outdated 和 noncompliant
+// @Accept  json
+// @Produce  json
+// @Param device_group_id query int false "设备群组ID"
+// @Param status query string false "compliant/outdated/noncompliant/unknown"
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Success 200 {object} response.Response{data=model.PeerComplianceReport}
+// @Failure 500 {object} response.Response
+// @Router /admin/device_group/compliance [get]
+// @Security token
+func (ct *DeviceGroup) Compliance(c *gin.Context) {
+	query := &admin.ClientComplianceQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	res := service.AllService.ClientVersionService.Report(query.DeviceGroupId, query.Status, query.Page, query.PageSize)
+	response.Success(c, res)
+}
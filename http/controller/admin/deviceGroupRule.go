@@ -0,0 +1,184 @@
+package admin
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/service"
+	"gorm.io/gorm"
+)
+
+type DeviceGroupRule struct {
+}
+
+// List 设备组分配规则列表
+// @Tags 设备群组
+// @Summary 设备组分配规则列表
+// @Description 按优先级从高到低排列
+// @Accept  json
+// @Produce  json
+// @Param device_group_id query int false "设备群组ID"
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Success 200 {object} response.Response{data=model.DeviceGroupRuleList}
+// @Failure 500 {object} response.Response
+// @Router /admin/device_group_rule/list [get]
+// @Security token
+func (ct *DeviceGroupRule) List(c *gin.Context) {
+	query := &admin.DeviceGroupRuleQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	res := service.AllService.DeviceGroupRuleService.List(query.Page, query.PageSize, func(tx *gorm.DB) {
+		if query.DeviceGroupId > 0 {
+			tx.Where("device_group_id = ?", query.DeviceGroupId)
+		}
+	})
+	response.Success(c, res)
+}
+
+// Detail 设备组分配规则详情
+// @Tags 设备群组
+// @Summary 设备组分配规则详情
+// @Description 设备组分配规则详情
+// @Accept  json
+// @Produce  json
+// @Param id path int true "ID"
+// @Success 200 {object} response.Response{data=model.DeviceGroupRule}
+// @Failure 500 {object} response.Response
+// @Router /admin/device_group_rule/detail/{id} [get]
+// @Security token
+func (ct *DeviceGroupRule) Detail(c *gin.Context) {
+	iid, _ := strconv.Atoi(c.Param("id"))
+	r := service.AllService.DeviceGroupRuleService.InfoById(uint(iid))
+	if r.Id > 0 {
+		response.Success(c, r)
+		return
+	}
+	response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+}
+
+// Create 创建设备组分配规则
+// @Tags 设备群组
+// @Summary 创建设备组分配规则
+// @Description 按主机名正则、系统、用户组、来源网段或地址簿标签匹配设备, 非空条件须全部满足
+// @Accept  json
+// @Produce  json
+// @Param body body admin.DeviceGroupRuleForm true "规则信息"
+// @Success 200 {object} response.Response{data=model.DeviceGroupRule}
+// @Failure 500 {object} response.Response
+// @Router /admin/device_group_rule/create [post]
+// @Security token
+func (ct *DeviceGroupRule) Create(c *gin.Context) {
+	f := &admin.DeviceGroupRuleForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	r := f.ToDeviceGroupRule()
+	r.Id = 0
+	if err := service.AllService.DeviceGroupRuleService.Create(r); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, r)
+}
+
+// Update 编辑设备组分配规则
+// @Tags 设备群组
+// @Summary 编辑设备组分配规则
+// @Description 编辑后不会立即生效于已有设备, 需要时调用 reevaluate
+// @Accept  json
+// @Produce  json
+// @Param body body admin.DeviceGroupRuleForm true "规则信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/device_group_rule/update [post]
+// @Security token
+func (ct *DeviceGroupRule) Update(c *gin.Context) {
+	f := &admin.DeviceGroupRuleForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	if f.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	if service.AllService.DeviceGroupRuleService.InfoById(f.Id).Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	if err := service.AllService.DeviceGroupRuleService.Update(f.ToDeviceGroupRule()); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// Delete 删除设备组分配规则
+// @Tags 设备群组
+// @Summary 删除设备组分配规则
+// @Description 已分配的设备保留所在设备组
+// @Accept  json
+// @Produce  json
+// @Param body body admin.DeviceGroupRuleForm true "规则信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/device_group_rule/delete [post]
+// @Security token
+func (ct *DeviceGroupRule) Delete(c *gin.Context) {
+	f := &admin.DeviceGroupRuleForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidVar(c, f.Id, "required,gt=0")
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	r := service.AllService.DeviceGroupRuleService.InfoById(f.Id)
+	if r.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	if err := service.AllService.DeviceGroupRuleService.Delete(r); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// Reevaluate 重新评估所有设备
+// @Tags 设备群组
+// @Summary 重新评估所有设备
+// @Description 按当前规则和设备最后在线的 IP 重新分配, 手动分配过设备组的设备不受影响
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} response.Response{data=model.DeviceGroupRuleResult}
+// @Failure 500 {object} response.Response
+// @Router /admin/device_group_rule/reevaluate [post]
+// @Security token
+func (ct *DeviceGroupRule) Reevaluate(c *gin.Context) {
+	res, err := service.AllService.DeviceGroupRuleService.ReevaluateAll()
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, res)
+}
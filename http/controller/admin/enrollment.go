@@ -0,0 +1,188 @@
+package admin
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/service"
+	"gorm.io/gorm"
+)
+
+type Enrollment struct {
+}
+
+// List 注册链接列表
+// @Tags 自助注册
+// @Summary 注册链接列表
+// @Description 注册链接列表
+// @Accept  json
+// @Produce  json
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Success 200 {object} response.Response{data=model.EnrollmentLinkList}
+// @Failure 500 {object} response.Response
+// @Router /admin/enrollment/list [get]
+// @Security token
+func (ct *Enrollment) List(c *gin.Context) {
+	query := &admin.PageQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	res := service.AllService.EnrollmentService.List(query.Page, query.PageSize, func(tx *gorm.DB) {
+		tx.Order("id desc")
+	})
+	response.Success(c, res)
+}
+
+// Detail 注册链接详情
+// @Tags 自助注册
+// @Summary 注册链接详情
+// @Description 注册链接详情
+// @Accept  json
+// @Produce  json
+// @Param id path int true "ID"
+// @Success 200 {object} response.Response{data=model.EnrollmentLink}
+// @Failure 500 {object} response.Response
+// @Router /admin/enrollment/detail/{id} [get]
+// @Security token
+func (ct *Enrollment) Detail(c *gin.Context) {
+	iid, _ := strconv.Atoi(c.Param("id"))
+	l := service.AllService.EnrollmentService.InfoById(uint(iid))
+	if l.Id > 0 {
+		response.Success(c, l)
+		return
+	}
+	response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+}
+
+// Create 创建注册链接
+// @Tags 自助注册
+// @Summary 创建注册链接
+// @Description 创建绑定用户组、设备组和服务器配置的注册链接
+// @Accept  json
+// @Produce  json
+// @Param body body admin.EnrollmentLinkForm true "注册链接信息"
+// @Success 200 {object} response.Response{data=model.EnrollmentLink}
+// @Failure 500 {object} response.Response
+// @Router /admin/enrollment/create [post]
+// @Security token
+func (ct *Enrollment) Create(c *gin.Context) {
+	f := &admin.EnrollmentLinkForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	l := f.ToEnrollmentLink()
+	l.Id = 0
+	l.CreatedBy = service.AllService.UserService.CurUser(c).Id
+	err := service.AllService.EnrollmentService.Create(l)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, l)
+}
+
+// Update 编辑注册链接
+// @Tags 自助注册
+// @Summary 编辑注册链接
+// @Description 编辑注册链接, 更换服务器配置时重新生成配置码
+// @Accept  json
+// @Produce  json
+// @Param body body admin.EnrollmentLinkForm true "注册链接信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/enrollment/update [post]
+// @Security token
+func (ct *Enrollment) Update(c *gin.Context) {
+	f := &admin.EnrollmentLinkForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	if f.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	err := service.AllService.EnrollmentService.Update(f.ToEnrollmentLink())
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// Delete 删除注册链接
+// @Tags 自助注册
+// @Summary 删除注册链接
+// @Description 删除注册链接并吊销其配置码
+// @Accept  json
+// @Produce  json
+// @Param body body admin.EnrollmentLinkForm true "注册链接信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/enrollment/delete [post]
+// @Security token
+func (ct *Enrollment) Delete(c *gin.Context) {
+	f := &admin.EnrollmentLinkForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidVar(c, f.Id, "required,gt=0")
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	l := service.AllService.EnrollmentService.InfoById(f.Id)
+	if l.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	if err := service.AllService.EnrollmentService.Delete(l); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// Records 注册记录
+// @Tags 自助注册
+// @Summary 注册记录
+// @Description 通过注册链接注册或绑定的用户和设备
+// @Accept  json
+// @Produce  json
+// @Param enrollment_link_id query int false "注册链接ID"
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Success 200 {object} response.Response{data=model.EnrollmentList}
+// @Failure 500 {object} response.Response
+// @Router /admin/enrollment/records [get]
+// @Security token
+func (ct *Enrollment) Records(c *gin.Context) {
+	query := &admin.EnrollmentRecordQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	res := service.AllService.EnrollmentService.Records(query.Page, query.PageSize, func(tx *gorm.DB) {
+		if query.EnrollmentLinkId > 0 {
+			tx.Where("enrollment_link_id = ?", query.EnrollmentLinkId)
+		}
+	})
+	response.Success(c, res)
+}
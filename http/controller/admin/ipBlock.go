@@ -0,0 +1,244 @@
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/service"
+	"gorm.io/gorm"
+	"strconv"
+)
+
+type IpBlock struct {
+}
+
+// Detail IP黑名单
+// @Tags IP黑名单
+// @Summary IP黑名单详情
+// @Description IP黑名单详情
+// @Accept  json
+// @Produce  json
+// @Param id path int true "ID"
+// @Success 200 {object} response.Response{data=model.IpBlock}
+// @Failure 500 {object} response.Response
+// @Router /admin/ip_block/detail/{id} [get]
+// @Security token
+func (ct *IpBlock) Detail(c *gin.Context) {
+	id := c.Param("id")
+	iid, _ := strconv.Atoi(id)
+	b := service.AllService.IpBlockService.InfoById(uint(iid))
+	if b.Id > 0 {
+		response.Success(c, b)
+		return
+	}
+	response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+}
+
+// List 列表
+// @Tags IP黑名单
+// @Summary IP黑名单列表
+// @Description IP黑名单列表
+// @Accept  json
+// @Produce  json
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Param cidr query string false "网段"
+// @Param source query string false "来源 manual,login-limiter,import"
+// @Success 200 {object} response.Response{data=model.IpBlockList}
+// @Failure 500 {object} response.Response
+// @Router /admin/ip_block/list [get]
+// @Security token
+func (ct *IpBlock) List(c *gin.Context) {
+	query := &admin.IpBlockQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	res := service.AllService.IpBlockService.List(query.Page, query.PageSize, func(tx *gorm.DB) {
+		if query.Cidr != "" {
+			tx.Where("cidr like ?", "%"+query.Cidr+"%")
+		}
+		if query.Source != "" {
+			tx.Where("source = ?", query.Source)
+		}
+		tx.Order("id desc")
+	})
+	response.Success(c, res)
+}
+
+// Create 创建
+// @Tags IP黑名单
+// @Summary 创建IP黑名单
+// @Description 创建IP黑名单, 支持单个IP或CIDR, expired_at为0表示永久
+// @Accept  json
+// @Produce  json
+// @Param body body admin.IpBlockForm true "IP黑名单信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/ip_block/create [post]
+// @Security token
+func (ct *IpBlock) Create(c *gin.Context) {
+	f := &admin.IpBlockForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	err := service.AllService.IpBlockService.Create(f.ToIpBlock())
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// Update 编辑
+// @Tags IP黑名单
+// @Summary IP黑名单编辑
+// @Description IP黑名单编辑
+// @Accept  json
+// @Produce  json
+// @Param body body admin.IpBlockForm true "IP黑名单信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/ip_block/update [post]
+// @Security token
+func (ct *IpBlock) Update(c *gin.Context) {
+	f := &admin.IpBlockForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	if f.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	err := service.AllService.IpBlockService.Update(f.ToIpBlock())
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// Delete 删除
+// @Tags IP黑名单
+// @Summary IP黑名单删除
+// @Description IP黑名单删除, 同时从 hbbs/hbbr 解除封禁
+// @Accept  json
+// @Produce  json
+// @Param body body admin.IpBlockForm true "IP黑名单信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/ip_block/delete [post]
+// @Security token
+func (ct *IpBlock) Delete(c *gin.Context) {
+	f := &admin.IpBlockForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidVar(c, f.Id, "required,gt=0")
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	b := service.AllService.IpBlockService.InfoById(f.Id)
+	if b.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	err := service.AllService.IpBlockService.Delete(b)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// BatchDelete 批量删除
+// @Tags IP黑名单
+// @Summary IP黑名单批量删除
+// @Description IP黑名单批量删除
+// @Accept  json
+// @Produce  json
+// @Param body body admin.IpBlockIds true "IP黑名单"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/ip_block/batchDelete [post]
+// @Security token
+func (ct *IpBlock) BatchDelete(c *gin.Context) {
+	f := &admin.IpBlockIds{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	if len(f.Ids) == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
+		return
+	}
+	err := service.AllService.IpBlockService.BatchDelete(f.Ids)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// Import 批量导入
+// @Tags IP黑名单
+// @Summary IP黑名单批量导入
+// @Description IP黑名单批量导入, 已存在的跳过
+// @Accept  json
+// @Produce  json
+// @Param body body admin.IpBlockImportForm true "导入信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/ip_block/import [post]
+// @Security token
+func (ct *IpBlock) Import(c *gin.Context) {
+	f := &admin.IpBlockImportForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	created, invalid := service.AllService.IpBlockService.Import(f.Cidrs, f.Reason, f.ExpiredAt)
+	response.Success(c, gin.H{
+		"created": created,
+		"invalid": invalid,
+	})
+}
+
+// Sync 立即对账
+// @Tags IP黑名单
+// @Summary IP黑名单同步
+// @Description 立即与 hbbs/hbbr 对账
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/ip_block/sync [post]
+// @Security token
+func (ct *IpBlock) Sync(c *gin.Context) {
+	err := service.AllService.IpBlockService.Reconcile()
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
@@ -2,10 +2,13 @@ package my
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/lejianwen/rustdesk-api/v2/global"
+	adminCtl "github.com/lejianwen/rustdesk-api/v2/http/controller/admin"
 	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
 	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/model"
 	"github.com/lejianwen/rustdesk-api/v2/service"
 	"gorm.io/gorm"
 )
@@ -96,7 +99,11 @@ func (ct *AddressBook) Create(c *gin.Context) {
 		return
 	}
 
-	err := service.AllService.AddressBookService.Create(t)
+	err := service.AllService.AddressBookService.Create(t, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceMy))
+	if errors.Is(err, service.ErrAbQuotaExceeded) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
 	if err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
@@ -150,7 +157,11 @@ func (ct *AddressBook) Update(c *gin.Context) {
 		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
 		return
 	}
-	err := service.AllService.AddressBookService.UpdateAll(t)
+	err := service.AllService.AddressBookService.UpdateAll(t, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceMy))
+	if errors.Is(err, service.ErrAbQuotaExceeded) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
 	if err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
@@ -191,7 +202,7 @@ func (ct *AddressBook) Delete(c *gin.Context) {
 		response.Fail(c, 101, response.TranslateMsg(c, "NoAccess"))
 		return
 	}
-	err := service.AllService.AddressBookService.Delete(ex)
+	err := service.AllService.AddressBookService.Delete(ex, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceMy))
 	if err == nil {
 		response.Success(c, nil)
 		return
@@ -217,6 +228,10 @@ func (ct *AddressBook) BatchCreateFromPeers(c *gin.Context) {
 			response.Fail(c, 101, response.TranslateMsg(c, "NoAccess"))
 			return
 		}
+		if collection.IsSmart() {
+			response.Fail(c, 101, response.TranslateMsg(c, "SmartCollectionReadOnly"))
+			return
+		}
 	}
 	if len(f.PeerIds) == 0 {
 		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
@@ -233,6 +248,7 @@ func (ct *AddressBook) BatchCreateFromPeers(c *gin.Context) {
 	}
 
 	tags, _ := json.Marshal(f.Tags)
+	actor := service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceMy)
 	for _, peer := range peers.Peers {
 		ab := service.AllService.AddressBookService.FromPeer(peer)
 		ab.Tags = tags
@@ -241,7 +257,7 @@ func (ct *AddressBook) BatchCreateFromPeers(c *gin.Context) {
 		if ex.RowId != 0 {
 			continue
 		}
-		service.AllService.AddressBookService.Create(ab)
+		service.AllService.AddressBookService.Create(ab, actor)
 	}
 	response.Success(c, nil)
 }
@@ -262,10 +278,99 @@ func (ct *AddressBook) BatchUpdateTags(c *gin.Context) {
 		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
 		return
 	}
-	err := service.AllService.AddressBookService.BatchUpdateTags(abs.AddressBooks, f.Tags)
+	err := service.AllService.AddressBookService.BatchUpdateTags(abs.AddressBooks, f.Tags, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceMy))
 	if err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
 	}
 	response.Success(c, nil)
 }
+
+// Export 导出地址簿
+// @Tags 我的地址簿
+// @Summary 导出地址簿
+// @Description 导出我的地址簿, format 为 csv、json 或 rustdesk(客户端地址簿数据)
+// @Produce text/csv
+// @Produce json
+// @Param collection_id query int false "地址簿id, 0 为默认地址簿"
+// @Param format query string true "csv, json 或 rustdesk"
+// @Param secrets query bool false "是否包含密码和 hash"
+// @Success 200 {file} binary
+// @Failure 500 {object} response.Response
+// @Router /admin/my/address_book/export [get]
+// @Security token
+func (ct *AddressBook) Export(c *gin.Context) {
+	q := &admin.AddressBookExportQuery{}
+	if err := c.ShouldBindQuery(q); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, q)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	u := service.AllService.UserService.CurUser(c)
+	if q.CollectionId > 0 && !service.AllService.AddressBookService.CheckCollectionOwner(u.Id, q.CollectionId) {
+		response.Fail(c, 101, response.TranslateMsg(c, "NoAccess"))
+		return
+	}
+	b, err := service.AllService.AddressBookTransferService.Export(u.Id, q.CollectionId, q.Format, q.Secrets)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	adminCtl.WriteAddressBookExport(c, q.Format, b)
+}
+
+// ImportPreview 导入预览
+// @Tags 我的地址簿
+// @Summary 导入预览
+// @Description 解析文件, 返回识别的列、字段映射以及每行的校验结果和将要执行的操作, 不修改数据
+// @Accept  json
+// @Produce  json
+// @Param body body admin.AddressBookImportForm true "导入信息"
+// @Success 200 {object} response.Response{data=model.AddressBookImportReport}
+// @Failure 500 {object} response.Response
+// @Router /admin/my/address_book/import/preview [post]
+// @Security token
+func (ct *AddressBook) ImportPreview(c *gin.Context) {
+	f, opt := adminCtl.BindAddressBookImport(c, service.AllService.UserService.CurUser(c).Id)
+	if f == nil {
+		return
+	}
+	res, err := service.AllService.AddressBookTransferService.Preview(f.UserId, f.CollectionId, opt)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	response.Success(c, res)
+}
+
+// Import 导入
+// @Tags 我的地址簿
+// @Summary 导入地址簿
+// @Description 按字段映射和合并方式导入, 校验失败的行跳过, 超出配额时整体失败
+// @Accept  json
+// @Produce  json
+// @Param body body admin.AddressBookImportForm true "导入信息"
+// @Success 200 {object} response.Response{data=model.AddressBookImportReport}
+// @Failure 500 {object} response.Response
+// @Router /admin/my/address_book/import [post]
+// @Security token
+func (ct *AddressBook) Import(c *gin.Context) {
+	f, opt := adminCtl.BindAddressBookImport(c, service.AllService.UserService.CurUser(c).Id)
+	if f == nil {
+		return
+	}
+	res, err := service.AllService.AddressBookTransferService.Import(f.UserId, f.CollectionId, opt, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceImport))
+	if errors.Is(err, service.ErrAbQuotaExceeded) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, res)
+}
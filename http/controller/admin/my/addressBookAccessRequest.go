@@ -0,0 +1,218 @@
+package my
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/service"
+	"gorm.io/gorm"
+)
+
+type AddressBookAccessRequest struct {
+}
+
+// List 列表
+// @Tags 我的地址簿访问申请
+// @Summary 地址簿访问申请列表
+// @Description incoming=1 为别人对我的地址簿的申请, 否则为我提交的申请
+// @Accept  json
+// @Produce  json
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Param incoming query int false "是否为待我审批的申请"
+// @Param collection_id query int false "地址簿id"
+// @Param status query string false "pending, approved, denied, cancelled, expired"
+// @Success 200 {object} response.Response{data=model.AddressBookAccessRequestList}
+// @Failure 500 {object} response.Response
+// @Router /admin/my/address_book_access_request/list [get]
+// @Security token
+func (ct *AddressBookAccessRequest) List(c *gin.Context) {
+	query := &admin.AddressBookAccessRequestQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	u := service.AllService.UserService.CurUser(c)
+	res := service.AllService.AddressBookAccessService.List(query.Page, query.PageSize, func(tx *gorm.DB) {
+		if query.Incoming == 1 {
+			tx.Where("owner_id = ?", u.Id)
+		} else {
+			tx.Where("user_id = ?", u.Id)
+		}
+		if query.CollectionId > 0 {
+			tx.Where("collection_id = ?", query.CollectionId)
+		}
+		if query.Status != "" {
+			tx.Where("status = ?", query.Status)
+		}
+	})
+	response.Success(c, res)
+}
+
+// Create 申请
+// @Tags 我的地址簿访问申请
+// @Summary 申请访问地址簿
+// @Description 申请访问他人的地址簿, 由地址簿所有者或管理员审批
+// @Accept  json
+// @Produce  json
+// @Param body body admin.AddressBookAccessRequestForm true "申请信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/my/address_book_access_request/create [post]
+// @Security token
+func (ct *AddressBookAccessRequest) Create(c *gin.Context) {
+	f := &admin.AddressBookAccessRequestForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	collection := service.AllService.AddressBookService.CollectionInfoById(f.CollectionId)
+	if collection.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	u := service.AllService.UserService.CurUser(c)
+	if collection.UserId == u.Id {
+		response.Fail(c, 101, response.TranslateMsg(c, "CannotShareToSelf"))
+		return
+	}
+	err := service.AllService.AddressBookAccessService.Create(&model.AddressBookAccessRequest{
+		UserId:       u.Id,
+		OwnerId:      collection.UserId,
+		CollectionId: collection.Id,
+		Rule:         f.Rule,
+		StartAt:      f.StartAt,
+		EndAt:        f.EndAt,
+		Reason:       f.Reason,
+	})
+	if errors.Is(err, service.ErrAbAccessPeriod) || errors.Is(err, service.ErrAbAccessPending) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// Cancel 撤回
+// @Tags 我的地址簿访问申请
+// @Summary 撤回地址簿访问申请
+// @Description 撤回待审批的申请
+// @Accept  json
+// @Produce  json
+// @Param body body admin.AddressBookAccessDecisionForm true "申请id"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/my/address_book_access_request/cancel [post]
+// @Security token
+func (ct *AddressBookAccessRequest) Cancel(c *gin.Context) {
+	r := ct.bindForm(c, &admin.AddressBookAccessDecisionForm{}, false)
+	if r == nil {
+		return
+	}
+	err := service.AllService.AddressBookAccessService.Cancel(r)
+	if errors.Is(err, service.ErrAbAccessDecided) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// Approve 批准
+// @Tags 我的地址簿访问申请
+// @Summary 批准地址簿访问申请
+// @Description 批准对我的地址簿的申请, 可以调整权限和有效期
+// @Accept  json
+// @Produce  json
+// @Param body body admin.AddressBookAccessDecisionForm true "审批信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/my/address_book_access_request/approve [post]
+// @Security token
+func (ct *AddressBookAccessRequest) Approve(c *gin.Context) {
+	ct.decide(c, true)
+}
+
+// Deny 拒绝
+// @Tags 我的地址簿访问申请
+// @Summary 拒绝地址簿访问申请
+// @Description 拒绝对我的地址簿的申请
+// @Accept  json
+// @Produce  json
+// @Param body body admin.AddressBookAccessDecisionForm true "审批信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/my/address_book_access_request/deny [post]
+// @Security token
+func (ct *AddressBookAccessRequest) Deny(c *gin.Context) {
+	ct.decide(c, false)
+}
+
+func (ct *AddressBookAccessRequest) decide(c *gin.Context, approve bool) {
+	f := &admin.AddressBookAccessDecisionForm{}
+	r := ct.bindForm(c, f, true)
+	if r == nil {
+		return
+	}
+	d := &service.AddressBookAccessDecision{
+		DeciderId: service.AllService.UserService.CurUser(c).Id,
+		Rule:      f.Rule,
+		StartAt:   f.StartAt,
+		EndAt:     f.EndAt,
+		Note:      f.Note,
+	}
+	var err error
+	if approve {
+		err = service.AllService.AddressBookAccessService.Approve(r, d)
+	} else {
+		err = service.AllService.AddressBookAccessService.Deny(r, d)
+	}
+	if errors.Is(err, service.ErrAbAccessPeriod) || errors.Is(err, service.ErrAbAccessDecided) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// bindForm 绑定表单并检查申请归属: owner 为 true 时须为地址簿所有者, 否则须为申请人; 失败时已输出响应
+func (ct *AddressBookAccessRequest) bindForm(c *gin.Context, f *admin.AddressBookAccessDecisionForm, owner bool) *model.AddressBookAccessRequest {
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return nil
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return nil
+	}
+	r := service.AllService.AddressBookAccessService.InfoById(f.Id)
+	if r.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return nil
+	}
+	u := service.AllService.UserService.CurUser(c)
+	if (owner && r.OwnerId != u.Id) || (!owner && r.UserId != u.Id) {
+		response.Fail(c, 101, response.TranslateMsg(c, "NoAccess"))
+		return nil
+	}
+	return r
+}
@@ -0,0 +1,91 @@
+package my
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/service"
+	"gorm.io/gorm"
+)
+
+type AddressBookChange struct{}
+
+// List 我的地址簿变更日志
+// @Tags 我的地址簿
+// @Summary 变更日志
+// @Description 自己的地址簿条目、标签和地址簿的变更时间线, 包括其他用户通过共享规则做的修改
+// @Accept  json
+// @Produce  json
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Param collection_id query int false "地址簿id, 0为个人地址簿"
+// @Param target query string false "peer tag collection"
+// @Param target_key query string false "设备id或标签名称"
+// @Param since query int false "开始时间"
+// @Param until query int false "结束时间"
+// @Success 200 {object} response.Response{data=model.AddressBookChangeList}
+// @Failure 500 {object} response.Response
+// @Router /admin/my/address_book_change/list [get]
+// @Security token
+func (ct *AddressBookChange) List(c *gin.Context) {
+	query := &admin.AddressBookChangeQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	u := service.AllService.UserService.CurUser(c)
+	res := service.AllService.AddressBookChangeService.List(query.Page, query.PageSize, func(tx *gorm.DB) {
+		tx.Where("user_id = ?", u.Id)
+		if query.CollectionId != nil {
+			tx.Where("collection_id = ?", *query.CollectionId)
+		}
+		if query.Target != "" {
+			tx.Where("target = ?", query.Target)
+		}
+		if query.TargetKey != "" {
+			tx.Where("target_key = ?", query.TargetKey)
+		}
+		if query.Since > 0 {
+			tx.Where("changed_at >= ?", query.Since)
+		}
+		if query.Until > 0 {
+			tx.Where("changed_at <= ?", query.Until)
+		}
+	})
+	response.Success(c, res)
+}
+
+// Restore 按时间点恢复我的地址簿
+// @Tags 我的地址簿
+// @Summary 按时间点恢复
+// @Description 将自己的地址簿恢复到指定时间点, 已删除的地址簿也可恢复
+// @Accept  json
+// @Produce  json
+// @Param body body admin.AddressBookRestoreForm true "恢复"
+// @Success 200 {object} response.Response{data=model.AddressBookRestoreResult}
+// @Failure 500 {object} response.Response
+// @Router /admin/my/address_book_change/restore [post]
+// @Security token
+func (ct *AddressBookChange) Restore(c *gin.Context) {
+	f := &admin.AddressBookRestoreForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	u := service.AllService.UserService.CurUser(c)
+	actor := service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceMy)
+	//变更日志按所有者记录, 只能恢复自己的地址簿
+	res, err := service.AllService.AddressBookChangeService.Restore(u.Id, f.CollectionId, f.At, actor)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	response.Success(c, res)
+}
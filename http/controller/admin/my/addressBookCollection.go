@@ -1,6 +1,8 @@
 package my
 
 import (
+	"errors"
+
 	"github.com/gin-gonic/gin"
 	"github.com/lejianwen/rustdesk-api/v2/global"
 	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
@@ -37,7 +39,13 @@ func (abc *AddressBookCollection) Create(c *gin.Context) {
 	}
 	u := service.AllService.UserService.CurUser(c)
 	f.UserId = u.Id
-	err := service.AllService.AddressBookService.CreateCollection(f)
+	//配额只能由管理员设置
+	f.MaxPeers = nil
+	err := service.AllService.AddressBookService.CreateCollection(f, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceMy))
+	if errors.Is(err, service.ErrAbCollectionParent) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
 	if err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
@@ -111,8 +119,9 @@ func (abc *AddressBookCollection) Update(c *gin.Context) {
 		response.Fail(c, 101, response.TranslateMsg(c, "NoAccess"))
 		return
 	}
+	f.MaxPeers = ex.MaxPeers
 
-	err := service.AllService.AddressBookService.UpdateCollection(f)
+	err := service.AllService.AddressBookService.UpdateCollection(f, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceMy))
 	if err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
@@ -126,19 +135,18 @@ func (abc *AddressBookCollection) Update(c *gin.Context) {
 // @Description 地址簿名称删除
 // @Accept  json
 // @Produce  json
-// @Param body body model.AddressBookCollection true "地址簿名称信息"
+// @Param body body admin.AddressBookCollectionDeleteForm true "地址簿名称信息"
 // @Success 200 {object} response.Response
 // @Failure 500 {object} response.Response
 // @Router /admin/my/address_book_collection/delete [post]
 // @Security token
 func (abc *AddressBookCollection) Delete(c *gin.Context) {
-	f := &model.AddressBookCollection{}
+	f := &admin.AddressBookCollectionDeleteForm{}
 	if err := c.ShouldBindJSON(f); err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
 		return
 	}
-	id := f.Id
-	errList := global.Validator.ValidVar(c, id, "required,gt=0")
+	errList := global.Validator.ValidStruct(c, f)
 	if len(errList) > 0 {
 		response.Fail(c, 101, errList[0])
 		return
@@ -153,10 +161,73 @@ func (abc *AddressBookCollection) Delete(c *gin.Context) {
 		response.Fail(c, 101, response.TranslateMsg(c, "NoAccess"))
 		return
 	}
-	err := service.AllService.AddressBookService.DeleteCollection(ex)
+	err := service.AllService.AddressBookService.DeleteCollection(ex, f.Policy, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceMy))
 	if err == nil {
 		response.Success(c, nil)
 		return
 	}
+	if errors.Is(err, service.ErrAbCollectionHasChildren) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
 	response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
 }
+
+// Tree 地址簿树
+// @Tags 我的地址簿名称
+// @Summary 地址簿树
+// @Description 按上下级组织的地址簿, 包含组合名称和条目数
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} response.Response{data=[]model.AddressBookCollectionNode}
+// @Failure 500 {object} response.Response
+// @Router /admin/my/address_book_collection/tree [get]
+// @Security token
+func (abc *AddressBookCollection) Tree(c *gin.Context) {
+	u := service.AllService.UserService.CurUser(c)
+	response.Success(c, service.AllService.AddressBookService.CollectionTree(u.Id))
+}
+
+// Move 修改上级
+// @Tags 我的地址簿名称
+// @Summary 修改上级地址簿
+// @Description 上级只能是同一用户的地址簿, parent_id 为 0 时移到顶层
+// @Accept  json
+// @Produce  json
+// @Param body body admin.AddressBookCollectionMoveForm true "上级信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/my/address_book_collection/move [post]
+// @Security token
+func (abc *AddressBookCollection) Move(c *gin.Context) {
+	f := &admin.AddressBookCollectionMoveForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	ex := service.AllService.AddressBookService.CollectionInfoById(f.Id)
+	if ex.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	u := service.AllService.UserService.CurUser(c)
+	if ex.UserId != u.Id {
+		response.Fail(c, 101, response.TranslateMsg(c, "NoAccess"))
+		return
+	}
+	err := service.AllService.AddressBookService.MoveCollection(ex, f.ParentId, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceMy))
+	if errors.Is(err, service.ErrAbCollectionParent) {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
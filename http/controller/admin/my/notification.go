@@ -0,0 +1,65 @@
+package my
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/service"
+	"gorm.io/gorm"
+)
+
+type Notification struct {
+}
+
+// List 我的通知
+// @Tags 我的通知
+// @Summary 通知列表
+// @Description 通知列表, 同时返回未读数
+// @Accept  json
+// @Produce  json
+// @Param unread query int false "只看未读"
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Success 200 {object} response.Response{data=model.NotificationList}
+// @Failure 500 {object} response.Response
+// @Router /admin/my/notification/list [get]
+// @Security token
+func (ct *Notification) List(c *gin.Context) {
+	query := &admin.NotificationQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	u := service.AllService.UserService.CurUser(c)
+	res := service.AllService.NotificationService.List(u.Id, query.Page, query.PageSize, func(tx *gorm.DB) {
+		if query.Unread == 1 {
+			tx.Where("read_at = 0")
+		}
+	})
+	response.Success(c, res)
+}
+
+// Read 标记已读
+// @Tags 我的通知
+// @Summary 标记已读
+// @Description ids 为空时标记全部通知
+// @Accept  json
+// @Produce  json
+// @Param body body admin.NotificationReadForm true "通知id"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/my/notification/read [post]
+// @Security token
+func (ct *Notification) Read(c *gin.Context) {
+	f := &admin.NotificationReadForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	u := service.AllService.UserService.CurUser(c)
+	if err := service.AllService.NotificationService.MarkRead(u.Id, f.Ids); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
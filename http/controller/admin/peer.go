@@ -5,9 +5,11 @@ import (
 	"github.com/lejianwen/rustdesk-api/v2/global"
 	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
 	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/model"
 	"github.com/lejianwen/rustdesk-api/v2/service"
 	"gorm.io/gorm"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -30,6 +32,7 @@ func (ct *Peer) Detail(c *gin.Context) {
 	iid, _ := strconv.Atoi(id)
 	u := service.AllService.PeerService.InfoByRowId(uint(iid))
 	if u.RowId > 0 {
+		service.AllService.PeerAttributeService.Fill([]*model.Peer{u})
 		response.Success(c, u)
 		return
 	}
@@ -80,6 +83,8 @@ func (ct *Peer) Create(c *gin.Context) {
 // @Param id query string false "ID"
 // @Param hostname query string false "主机名"
 // @Param uuids query string false "uuids 用逗号分隔"
+// @Param labels query string false "标签 用逗号分隔, 须全部带有"
+// @Param attr query []string false "属性筛选 name=value 或 name~value, 可重复"
 // @Success 200 {object} response.Response{data=model.PeerList}
 // @Failure 500 {object} response.Response
 // @Router /admin/peer/list [get]
@@ -90,6 +95,11 @@ func (ct *Peer) List(c *gin.Context) {
 		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
 		return
 	}
+	filters, err := service.AllService.PeerAttributeService.ParseFilters(query.Attrs)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
 	res := service.AllService.PeerService.List(query.Page, query.PageSize, func(tx *gorm.DB) {
 		if query.TimeAgo > 0 {
 			lt := time.Now().Unix() - int64(query.TimeAgo)
@@ -117,7 +127,11 @@ func (ct *Peer) List(c *gin.Context) {
 		if query.Alias != "" {
 			tx.Where("alias like ?", "%"+query.Alias+"%")
 		}
+		if query.Labels != "" || len(filters) > 0 {
+			service.AllService.PeerAttributeService.Where(tx, strings.Split(query.Labels, ","), filters)
+		}
 	})
+	service.AllService.PeerAttributeService.Fill(res.Peers)
 	response.Success(c, res)
 }
 
@@ -148,11 +162,16 @@ func (ct *Peer) Update(c *gin.Context) {
 		return
 	}
 	u := f.ToPeer()
+	old := service.AllService.PeerService.InfoByRowId(u.RowId)
 	err := service.AllService.PeerService.Update(u)
 	if err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
 	}
+	//手动修改设备组后不再由规则覆盖
+	if u.GroupId > 0 && u.GroupId != old.GroupId {
+		_ = service.AllService.DeviceGroupRuleService.MarkManual(u.RowId)
+	}
 	response.Success(c, nil)
 }
 
@@ -0,0 +1,263 @@
+package admin
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/service"
+)
+
+type PeerAttribute struct {
+}
+
+// List 自定义属性定义列表
+// @Tags 设备
+// @Summary 自定义属性定义列表
+// @Description 自定义属性定义列表
+// @Accept  json
+// @Produce  json
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Success 200 {object} response.Response{data=model.PeerAttributeDefinitionList}
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_attribute/list [get]
+// @Security token
+func (ct *PeerAttribute) List(c *gin.Context) {
+	query := &admin.PageQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	res := service.AllService.PeerAttributeService.DefinitionList(query.Page, query.PageSize, nil)
+	response.Success(c, res)
+}
+
+// Create 创建自定义属性
+// @Tags 设备
+// @Summary 创建自定义属性
+// @Description 类型为 string/number/bool/date/email, 设置值时按类型校验
+// @Accept  json
+// @Produce  json
+// @Param body body admin.PeerAttributeDefinitionForm true "属性定义"
+// @Success 200 {object} response.Response{data=model.PeerAttributeDefinition}
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_attribute/create [post]
+// @Security token
+func (ct *PeerAttribute) Create(c *gin.Context) {
+	f := &admin.PeerAttributeDefinitionForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	d := f.ToPeerAttributeDefinition()
+	d.Id = 0
+	if err := service.AllService.PeerAttributeService.DefinitionCreate(d); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, d)
+}
+
+// Update 编辑自定义属性
+// @Tags 设备
+// @Summary 编辑自定义属性
+// @Description 属性键不可修改, 修改类型时已有的值须能转换为新类型
+// @Accept  json
+// @Produce  json
+// @Param body body admin.PeerAttributeDefinitionForm true "属性定义"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_attribute/update [post]
+// @Security token
+func (ct *PeerAttribute) Update(c *gin.Context) {
+	f := &admin.PeerAttributeDefinitionForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	if f.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	if err := service.AllService.PeerAttributeService.DefinitionUpdate(f.ToPeerAttributeDefinition()); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// Delete 删除自定义属性
+// @Tags 设备
+// @Summary 删除自定义属性
+// @Description 同时删除所有设备上的该属性值
+// @Accept  json
+// @Produce  json
+// @Param body body admin.PeerAttributeDefinitionForm true "属性定义"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_attribute/delete [post]
+// @Security token
+func (ct *PeerAttribute) Delete(c *gin.Context) {
+	f := &admin.PeerAttributeDefinitionForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidVar(c, f.Id, "required,gt=0")
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	d := service.AllService.PeerAttributeService.DefinitionInfoById(f.Id)
+	if d.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	if err := service.AllService.PeerAttributeService.DefinitionDelete(d); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// Labels 在用的设备标签
+// @Tags 设备
+// @Summary 在用的设备标签
+// @Description 所有设备标签及带有该标签的设备数
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} response.Response{data=[]model.PeerInventoryCount}
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_attribute/labels [get]
+// @Security token
+func (ct *PeerAttribute) Labels(c *gin.Context) {
+	response.Success(c, service.AllService.PeerAttributeService.AllLabels())
+}
+
+// Peer 设备的标签和属性
+// @Tags 设备
+// @Summary 设备的标签和属性
+// @Description 设备的标签和属性
+// @Accept  json
+// @Produce  json
+// @Param row_id path int true "设备row_id"
+// @Success 200 {object} response.Response{data=model.PeerAttributeSet}
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_attribute/peer/{row_id} [get]
+// @Security token
+func (ct *PeerAttribute) Peer(c *gin.Context) {
+	iid, _ := strconv.Atoi(c.Param("row_id"))
+	if service.AllService.PeerService.InfoByRowId(uint(iid)).RowId == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	response.Success(c, service.AllService.PeerAttributeService.Get(uint(iid)))
+}
+
+// SetLabels 设置设备标签
+// @Tags 设备
+// @Summary 设置设备标签
+// @Description 用提交的标签替换设备原有标签
+// @Accept  json
+// @Produce  json
+// @Param body body admin.PeerLabelsForm true "设备标签"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_attribute/set_labels [post]
+// @Security token
+func (ct *PeerAttribute) SetLabels(c *gin.Context) {
+	f := &admin.PeerLabelsForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	if service.AllService.PeerService.InfoByRowId(f.RowId).RowId == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	if err := service.AllService.PeerAttributeService.SetLabels(f.RowId, f.Labels); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// BatchLabels 批量添加和移除设备标签
+// @Tags 设备
+// @Summary 批量添加和移除设备标签
+// @Description 批量添加和移除设备标签
+// @Accept  json
+// @Produce  json
+// @Param body body admin.PeerBatchLabelsForm true "设备标签"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_attribute/batch_labels [post]
+// @Security token
+func (ct *PeerAttribute) BatchLabels(c *gin.Context) {
+	f := &admin.PeerBatchLabelsForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	if err := service.AllService.PeerAttributeService.BatchLabels(f.RowIds, f.Add, f.Remove); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// SetAttributes 设置设备属性
+// @Tags 设备
+// @Summary 设置设备属性
+// @Description 只修改提交的属性, 值为空时删除该属性
+// @Accept  json
+// @Produce  json
+// @Param body body admin.PeerAttributesForm true "设备属性"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_attribute/set_attributes [post]
+// @Security token
+func (ct *PeerAttribute) SetAttributes(c *gin.Context) {
+	f := &admin.PeerAttributesForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	if service.AllService.PeerService.InfoByRowId(f.RowId).RowId == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	if err := service.AllService.PeerAttributeService.SetAttributes(f.RowId, f.Attributes); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
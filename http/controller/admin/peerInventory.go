@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/service"
+	"gorm.io/gorm"
+)
+
+type PeerInventory struct {
+}
+
+// History 设备 SysInfo 变更历史
+// @Tags 设备清单
+// @Summary 设备变更历史
+// @Description 设备 SysInfo 字段的变更记录, 可按设备、字段和时间过滤
+// @Accept  json
+// @Produce  json
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Param peer_row_id query int false "设备行ID"
+// @Param peer_id query string false "设备ID"
+// @Param field query string false "字段 cpu memory os hostname username version"
+// @Param since query int false "开始时间戳"
+// @Param until query int false "结束时间戳"
+// @Success 200 {object} response.Response{data=model.PeerInventoryChangeList}
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_inventory/history [get]
+// @Security token
+func (ct *PeerInventory) History(c *gin.Context) {
+	query := &admin.PeerInventoryQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	res := service.AllService.PeerInventoryService.History(query.Page, query.PageSize, func(tx *gorm.DB) {
+		if query.PeerRowId > 0 {
+			tx.Where("peer_row_id = ?", query.PeerRowId)
+		}
+		if query.PeerId != "" {
+			tx.Where("peer_id = ?", query.PeerId)
+		}
+		if query.Field != "" {
+			tx.Where("field = ?", query.Field)
+		}
+		if query.Since > 0 {
+			tx.Where("changed_at >= ?", query.Since)
+		}
+		if query.Until > 0 {
+			tx.Where("changed_at <= ?", query.Until)
+		}
+	})
+	response.Success(c, res)
+}
+
+// Fleet 按 SysInfo 字段查询设备
+// @Tags 设备清单
+// @Summary 设备清单查询
+// @Description 按字段当前值查询设备(如仍在使用某客户端版本的设备), 或查询时间范围内字段发生过变更的设备(如本周改过主机名的设备)
+// @Accept  json
+// @Produce  json
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Param field query string true "字段 cpu memory os hostname username version"
+// @Param value query string false "当前值"
+// @Param changed_since query int false "变更开始时间戳"
+// @Param changed_until query int false "变更结束时间戳"
+// @Success 200 {object} response.Response{data=model.PeerList}
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_inventory/fleet [get]
+// @Security token
+func (ct *PeerInventory) Fleet(c *gin.Context) {
+	query := &admin.PeerFleetQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	where := func(tx *gorm.DB) {
+		if query.Value != "" {
+			tx.Where(query.Field+" = ?", query.Value)
+		}
+	}
+	is := service.AllService.PeerInventoryService
+	if query.ChangedSince > 0 || query.ChangedUntil > 0 {
+		response.Success(c, is.ChangedPeers(query.Field, query.ChangedSince, query.ChangedUntil, query.Page, query.PageSize, where))
+		return
+	}
+	response.Success(c, service.AllService.PeerService.List(query.Page, query.PageSize, where))
+}
+
+// Summary 按字段当前值统计设备数
+// @Tags 设备清单
+// @Summary 设备清单统计
+// @Description 按字段当前值统计设备数, 如各客户端版本、操作系统的设备数量
+// @Accept  json
+// @Produce  json
+// @Param field query string true "字段 cpu memory os hostname username version"
+// @Success 200 {object} response.Response{data=[]model.PeerInventoryCount}
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_inventory/summary [get]
+// @Security token
+func (ct *PeerInventory) Summary(c *gin.Context) {
+	query := &admin.PeerInventorySummaryQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	response.Success(c, service.AllService.PeerInventoryService.Summary(query.Field))
+}
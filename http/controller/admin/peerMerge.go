@@ -0,0 +1,154 @@
+package admin
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/service"
+	"gorm.io/gorm"
+)
+
+type PeerMerge struct {
+}
+
+// Duplicates 疑似重复的设备
+// @Tags 设备
+// @Summary 疑似重复的设备
+// @Description 按 uuid、主机名、用户名、IP 和硬件信息评分, 只在主机名或 uuid 相同的记录之间比较; duplicate.row_id 为 0 表示只在地址簿中引用的 id
+// @Accept  json
+// @Produce  json
+// @Param min_score query int false "最低分数, 默认 40"
+// @Success 200 {object} response.Response{data=[]model.PeerDuplicate}
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_merge/duplicates [get]
+// @Security token
+func (ct *PeerMerge) Duplicates(c *gin.Context) {
+	query := &admin.PeerDuplicateQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	response.Success(c, service.AllService.PeerMergeService.Duplicates(query.MinScore))
+}
+
+// Merge 合并设备
+// @Tags 设备
+// @Summary 合并设备
+// @Description 地址簿条目、审计记录、分享链接和用户绑定迁到保留的设备, 删除重复设备, 旧 id 作为别名仍能解析到保留的设备
+// @Accept  json
+// @Produce  json
+// @Param body body admin.PeerMergeForm true "合并信息"
+// @Success 200 {object} response.Response{data=model.PeerMergeResult}
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_merge/merge [post]
+// @Security token
+func (ct *PeerMerge) Merge(c *gin.Context) {
+	f := &admin.PeerMergeForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	survivor := service.AllService.PeerService.InfoByRowId(f.RowId)
+	if survivor.RowId == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	res, err := service.AllService.PeerMergeService.Merge(survivor, f.Ids, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceMerge))
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	response.Success(c, res)
+}
+
+// Aliases 合并留下的别名
+// @Tags 设备
+// @Summary 设备别名列表
+// @Description 被合并设备的旧 id 及其指向的设备
+// @Accept  json
+// @Produce  json
+// @Param alias_id query string false "旧 id"
+// @Param peer_row_id query int false "设备行ID"
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Success 200 {object} response.Response{data=model.PeerAliasList}
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_merge/aliases [get]
+// @Security token
+func (ct *PeerMerge) Aliases(c *gin.Context) {
+	query := &admin.PeerAliasQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	res := service.AllService.PeerMergeService.Aliases(query.Page, query.PageSize, func(tx *gorm.DB) {
+		if query.AliasId != "" {
+			tx.Where("alias_id like ?", "%"+query.AliasId+"%")
+		}
+		if query.PeerRowId > 0 {
+			tx.Where("peer_row_id = ?", query.PeerRowId)
+		}
+	})
+	response.Success(c, res)
+}
+
+// DeleteAlias 删除别名
+// @Tags 设备
+// @Summary 删除设备别名
+// @Description 删除后旧 id 不再解析到保留的设备, 已迁移的记录不会恢复
+// @Accept  json
+// @Produce  json
+// @Param body body admin.PeerAliasForm true "别名"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_merge/delete_alias [post]
+// @Security token
+func (ct *PeerMerge) DeleteAlias(c *gin.Context) {
+	f := &admin.PeerAliasForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	a := service.AllService.PeerMergeService.AliasInfoById(f.Id)
+	if a.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	if err := service.AllService.PeerMergeService.DeleteAlias(a); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// Resolve 按 id 查找设备, 包括合并留下的别名
+// @Tags 设备
+// @Summary 按 id 查找设备
+// @Description id 为被合并设备的旧 id 时返回保留的设备
+// @Accept  json
+// @Produce  json
+// @Param id query string true "设备 id"
+// @Success 200 {object} response.Response{data=model.Peer}
+// @Failure 500 {object} response.Response
+// @Router /admin/peer_merge/resolve [get]
+// @Security token
+func (ct *PeerMerge) Resolve(c *gin.Context) {
+	p := service.AllService.PeerService.Resolve(c.Query("id"))
+	if p.RowId == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	response.Success(c, p)
+}
@@ -0,0 +1,103 @@
+package admin
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/service"
+	"gorm.io/gorm"
+)
+
+type RelayUsage struct {
+}
+
+// List 采样列表
+// @Tags 中继负载
+// @Summary 中继负载采样列表
+// @Description 中继负载采样列表
+// @Accept  json
+// @Produce  json
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Param endpoint_id query int false "端点ID, 0为本机"
+// @Success 200 {object} response.Response{data=model.RelayUsageList}
+// @Failure 500 {object} response.Response
+// @Router /admin/relay_usage/list [get]
+// @Security token
+func (ct *RelayUsage) List(c *gin.Context) {
+	query := &admin.RelayUsageQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	res := service.AllService.RelayUsageService.List(query.Page, query.PageSize, func(tx *gorm.DB) {
+		if query.EndpointId != nil {
+			tx.Where("endpoint_id = ?", *query.EndpointId)
+		}
+		tx.Order("collected_at desc")
+	})
+	response.Success(c, res)
+}
+
+// Latest 最新负载
+// @Tags 中继负载
+// @Summary 各中继最新负载
+// @Description 各中继最近一次采样和当前连接明细
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/relay_usage/latest [get]
+// @Security token
+func (ct *RelayUsage) Latest(c *gin.Context) {
+	response.Success(c, service.AllService.RelayUsageService.Latest())
+}
+
+// Series 时间序列
+// @Tags 中继负载
+// @Summary 中继负载时间序列
+// @Description 中继负载时间序列, 默认最近24小时, 每5分钟一个点
+// @Accept  json
+// @Produce  json
+// @Param endpoint_id query int false "端点ID, 不传为全部"
+// @Param since query int false "开始时间戳"
+// @Param until query int false "结束时间戳"
+// @Param step query int false "间隔秒数"
+// @Success 200 {object} response.Response{data=[]model.RelayUsagePoint}
+// @Failure 500 {object} response.Response
+// @Router /admin/relay_usage/series [get]
+// @Security token
+func (ct *RelayUsage) Series(c *gin.Context) {
+	query := &admin.RelayUsageSeriesQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	now := time.Now().Unix()
+	if query.Until == 0 {
+		query.Until = now
+	}
+	if query.Since == 0 {
+		query.Since = query.Until - 86400
+	}
+	if query.Step == 0 {
+		query.Step = 300
+	}
+	response.Success(c, service.AllService.RelayUsageService.Series(query.EndpointId, query.Since, query.Until, query.Step))
+}
+
+// Collect 立即采集
+// @Tags 中继负载
+// @Summary 立即采集中继负载
+// @Description 立即采集全部中继负载
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} response.Response{data=[]model.RelayUsage}
+// @Failure 500 {object} response.Response
+// @Router /admin/relay_usage/collect [post]
+// @Security token
+func (ct *RelayUsage) Collect(c *gin.Context) {
+	response.Success(c, service.AllService.RelayUsageService.Collect())
+}
@@ -1,21 +1,26 @@
 package admin
 
 import (
+	"strings"
+
 	"github.com/gin-gonic/gin"
 	"github.com/lejianwen/rustdesk-api/v2/global"
 	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
 	"github.com/lejianwen/rustdesk-api/v2/http/response"
 	"github.com/lejianwen/rustdesk-api/v2/model"
 	"github.com/lejianwen/rustdesk-api/v2/service"
+	"github.com/lejianwen/rustdesk-api/v2/utils"
+	"gorm.io/gorm"
 )
 
 type Rustdesk struct {
 }
 
 type RustdeskCmd struct {
-	Cmd    string `json:"cmd"`
-	Option string `json:"option"`
-	Target string `json:"target"`
+	Cmd        string `json:"cmd"`
+	Option     string `json:"option"`
+	Target     string `json:"target"`
+	EndpointId uint   `json:"endpoint_id"` // 0 表示本机
 }
 
 func (r *Rustdesk) CmdList(c *gin.Context) {
@@ -120,18 +125,181 @@ func (r *Rustdesk) SendCmd(c *gin.Context) {
 		return
 	}
 
-	port := 0
-	switch rc.Target {
-	case model.ServerCmdTargetIdServer:
-		port = global.Config.Admin.IdServerPort - 1
-	case model.ServerCmdTargetRelayServer:
-		port = global.Config.Admin.RelayServerPort
+	ep := service.AllService.ServerCmdService.LocalEndpoint(rc.Target)
+	if rc.EndpointId > 0 {
+		ep = service.AllService.ServerCmdService.EndpointInfo(rc.EndpointId)
+		if ep.Id == 0 || ep.Target != rc.Target {
+			response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+			return
+		}
+	}
+	if rc.Target == model.ServerCmdTargetRelayServer && r.handleBlocklistCmd(c, rc, ep) {
+		return
+	}
+
+	res, err := service.AllService.ServerCmdService.SendCmdToEndpoint(ep, rc.Cmd, rc.Option)
+	if err != nil {
+		response.Fail(c, 101, err.Error())
+		return
+	}
+	response.Success(c, res)
+}
+
+// SendCmdAll 向某类服务的全部端点发送命令
+func (r *Rustdesk) SendCmdAll(c *gin.Context) {
+	rc := &RustdeskCmd{}
+	if err := c.ShouldBindJSON(rc); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	if rc.Cmd == "" {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
+		return
+	}
+	if rc.Target != model.ServerCmdTargetIdServer && rc.Target != model.ServerCmdTargetRelayServer {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
+		return
+	}
+	if rc.Target == model.ServerCmdTargetRelayServer && r.handleBlocklistCmd(c, rc, nil) {
+		return
+	}
+	res := service.AllService.ServerCmdService.SendCmdToAll(rc.Target, rc.Cmd, rc.Option)
+	response.Success(c, res)
+}
+
+func (r *Rustdesk) EndpointList(c *gin.Context) {
+	q := &admin.PageQuery{}
+	if err := c.ShouldBindQuery(q); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	target := c.Query("target")
+	res := service.AllService.ServerCmdService.EndpointList(q.Page, q.PageSize, func(tx *gorm.DB) {
+		if target != "" {
+			tx.Where("target = ?", target)
+		}
+		tx.Order("id asc")
+	})
+	response.Success(c, res)
+}
+
+func (r *Rustdesk) EndpointCreate(c *gin.Context) {
+	f := &admin.ServerCmdEndpointForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	e := f.ToServerCmdEndpoint()
+	if e.Status == 0 {
+		e.Status = model.COMMON_STATUS_ENABLE
+	}
+	err := service.AllService.ServerCmdService.EndpointCreate(e)
+	if err != nil {
+		response.Fail(c, 101, err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+func (r *Rustdesk) EndpointUpdate(c *gin.Context) {
+	f := &admin.ServerCmdEndpointForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	ex := service.AllService.ServerCmdService.EndpointInfo(f.Id)
+	if ex.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	err := service.AllService.ServerCmdService.EndpointUpdate(f.ToServerCmdEndpoint(), f.UpdateSecret())
+	if err != nil {
+		response.Fail(c, 101, err.Error())
+		return
 	}
+	response.Success(c, nil)
+}
 
-	res, err := service.AllService.ServerCmdService.SendCmd(port, rc.Cmd, rc.Option)
+func (r *Rustdesk) EndpointDelete(c *gin.Context) {
+	f := &model.ServerCmdEndpoint{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	ex := service.AllService.ServerCmdService.EndpointInfo(f.Id)
+	if ex.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	err := service.AllService.ServerCmdService.EndpointDelete(ex)
 	if err != nil {
 		response.Fail(c, 101, err.Error())
 		return
 	}
+	response.Success(c, nil)
+}
+
+// handleBlocklistCmd hbbr 的 blocklist 增删命令与IP黑名单保持一致, ep 为 nil 表示全部端点
+// 发往全部端点的封禁记入黑名单并由黑名单下发; 发往单个端点的封禁直接发给该端点, 由对账导入黑名单
+// 解除时黑名单中有记录的网段从全部端点解除, 没有记录的IP照常发给目标端点
+func (r *Rustdesk) handleBlocklistCmd(c *gin.Context, rc *RustdeskCmd, ep *model.ServerCmdEndpoint) bool {
+	var add bool
+	switch rc.Cmd {
+	case "blocklist-add", "Ba":
+		add = true
+	case "blocklist-remove", "Br":
+		add = false
+	default:
+		return false
+	}
+	if add && ep != nil {
+		return false
+	}
+	var rest []string
+	for _, ip := range strings.Split(strings.TrimSpace(rc.Option), "|") {
+		cidr, err := utils.NormalizeCidr(ip)
+		if err != nil {
+			response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+			return true
+		}
+		ex := service.AllService.IpBlockService.InfoByCidr(cidr)
+		switch {
+		case add && ex.Id == 0:
+			err = service.AllService.IpBlockService.Create(&model.IpBlock{Cidr: cidr, Source: model.IpBlockSourceManual})
+		case !add && ex.Id > 0:
+			err = service.AllService.IpBlockService.Delete(ex)
+		case !add:
+			rest = append(rest, strings.TrimSpace(ip))
+		}
+		if err != nil {
+			response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+			return true
+		}
+	}
+	if len(rest) == 0 {
+		response.Success(c, response.TranslateMsg(c, "OperationSuccess"))
+		return true
+	}
+	//可能是直接在 hbbr 上封禁的IP
+	if ep == nil {
+		response.Success(c, service.AllService.ServerCmdService.SendCmdToAll(rc.Target, rc.Cmd, strings.Join(rest, "|")))
+		return true
+	}
+	res, err := service.AllService.ServerCmdService.SendCmdToEndpoint(ep, rc.Cmd, strings.Join(rest, "|"))
+	if err != nil {
+		response.Fail(c, 101, err.Error())
+		return true
+	}
 	response.Success(c, res)
+	return true
 }
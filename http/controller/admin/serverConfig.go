@@ -1,6 +1,9 @@
 package admin
 
 import (
+	"fmt"
+	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 
@@ -9,6 +12,7 @@ import (
 	"github.com/lejianwen/rustdesk-api/v2/http/response"
 	adResp "github.com/lejianwen/rustdesk-api/v2/http/response/admin"
 	"github.com/lejianwen/rustdesk-api/v2/service"
+	"gorm.io/gorm"
 )
 
 type ServerConfig struct{}
@@ -64,6 +68,13 @@ func (ct *ServerConfig) List(c *gin.Context) {
 			IsEnabled:   config.IsEnabled != nil && *config.IsEnabled,
 		IsDefault:   config.IsDefault != nil && *config.IsDefault,
 		Priority:    config.Priority,
+		GroupIds:    config.GroupIds,
+		HealthStatus:    config.HealthStatus,
+		HealthLatencyMs: config.HealthLatencyMs,
+		HealthError:     config.HealthError,
+		HealthCheckedAt: config.HealthCheckedAt,
+		Revision:         config.Revision,
+		PreviousKeyUntil: config.PreviousKeyUntil,
 		Status:      int(config.Status),
 		CreatedAt:   time.Time(config.CreatedAt),
 		UpdatedAt:   time.Time(config.UpdatedAt),
@@ -97,7 +108,7 @@ func (ct *ServerConfig) Create(c *gin.Context) {
 		return
 	}
 
-	config, err := service.AllService.ServerConfigService.Create(&form)
+	config, err := service.AllService.ServerConfigService.Create(&form, service.AllService.UserService.CurUser(c).Id)
 	if err != nil {
 		response.Fail(c, 500, err.Error())
 		return
@@ -115,6 +126,13 @@ func (ct *ServerConfig) Create(c *gin.Context) {
 		IsEnabled:   config.IsEnabled != nil && *config.IsEnabled,
 		IsDefault:   config.IsDefault != nil && *config.IsDefault,
 		Priority:    config.Priority,
+		GroupIds:    config.GroupIds,
+		HealthStatus:    config.HealthStatus,
+		HealthLatencyMs: config.HealthLatencyMs,
+		HealthError:     config.HealthError,
+		HealthCheckedAt: config.HealthCheckedAt,
+		Revision:         config.Revision,
+		PreviousKeyUntil: config.PreviousKeyUntil,
 		Status:      int(config.Status),
 		CreatedAt:   time.Time(config.CreatedAt),
 		UpdatedAt:   time.Time(config.UpdatedAt),
@@ -151,7 +169,7 @@ func (ct *ServerConfig) Update(c *gin.Context) {
 		return
 	}
 
-	config, err := service.AllService.ServerConfigService.Update(uint(iid), &form)
+	config, err := service.AllService.ServerConfigService.Update(uint(iid), &form, service.AllService.UserService.CurUser(c).Id)
 	if err != nil {
 		response.Fail(c, 500, err.Error())
 		return
@@ -169,6 +187,13 @@ func (ct *ServerConfig) Update(c *gin.Context) {
 		IsEnabled:   config.IsEnabled != nil && *config.IsEnabled,
 		IsDefault:   config.IsDefault != nil && *config.IsDefault,
 		Priority:    config.Priority,
+		GroupIds:    config.GroupIds,
+		HealthStatus:    config.HealthStatus,
+		HealthLatencyMs: config.HealthLatencyMs,
+		HealthError:     config.HealthError,
+		HealthCheckedAt: config.HealthCheckedAt,
+		Revision:         config.Revision,
+		PreviousKeyUntil: config.PreviousKeyUntil,
 		Status:      int(config.Status),
 		CreatedAt:   time.Time(config.CreatedAt),
 		UpdatedAt:   time.Time(config.UpdatedAt),
@@ -245,6 +270,13 @@ func (ct *ServerConfig) Detail(c *gin.Context) {
 		IsEnabled:   config.IsEnabled != nil && *config.IsEnabled,
 		IsDefault:   config.IsDefault != nil && *config.IsDefault,
 		Priority:    config.Priority,
+		GroupIds:    config.GroupIds,
+		HealthStatus:    config.HealthStatus,
+		HealthLatencyMs: config.HealthLatencyMs,
+		HealthError:     config.HealthError,
+		HealthCheckedAt: config.HealthCheckedAt,
+		Revision:         config.Revision,
+		PreviousKeyUntil: config.PreviousKeyUntil,
 		Status:      int(config.Status),
 		CreatedAt:   time.Time(config.CreatedAt),
 		UpdatedAt:   time.Time(config.UpdatedAt),
@@ -300,13 +332,7 @@ func (ct *ServerConfig) GenerateConfigCode(c *gin.Context) {
 		return
 	}
 
-	// 获取当前用户ID（假设从JWT中获取）
-	userIdInterface, exists := c.Get("user_id")
-	if !exists {
-		response.Fail(c, 401, "Unauthorized")
-		return
-	}
-	userId := userIdInterface.(uint)
+	userId := service.AllService.UserService.CurUser(c).Id
 
 	configCode, err := service.AllService.ServerConfigService.GenerateConfigCode(&form, userId)
 	if err != nil {
@@ -316,9 +342,12 @@ func (ct *ServerConfig) GenerateConfigCode(c *gin.Context) {
 
 	resp := &adResp.ConfigCodeGenerateResponse{
 		Id:        configCode.Id,
-		Code:      configCode.Code,
-		ExpiresAt: configCode.ExpiresAt,
-		MaxUsage:  configCode.MaxUsage,
+		Code:       configCode.Code,
+		ExpiresAt:  configCode.ExpiresAt,
+		MaxUsage:   configCode.MaxUsage,
+		QrCodeUrl:  fmt.Sprintf("/api/admin/config-code/qr/%d", configCode.Id),
+		SignedCode: configCode.SignedCode,
+		Kid:        configCode.Kid,
 	}
 
 	response.Success(c, resp)
@@ -343,13 +372,7 @@ func (ct *ServerConfig) BatchGenerateConfigCode(c *gin.Context) {
 		return
 	}
 
-	// 获取当前用户ID
-	userIdInterface, exists := c.Get("user_id")
-	if !exists {
-		response.Fail(c, 401, "Unauthorized")
-		return
-	}
-	userId := userIdInterface.(uint)
+	userId := service.AllService.UserService.CurUser(c).Id
 
 	codes, err := service.AllService.ServerConfigService.BatchGenerateConfigCode(&form, userId)
 	if err != nil {
@@ -358,18 +381,24 @@ func (ct *ServerConfig) BatchGenerateConfigCode(c *gin.Context) {
 	}
 
 	var respCodes []*adResp.ConfigCodeGenerateResponse
+	sheet := url.Values{}
 	for _, code := range codes {
 		respCodes = append(respCodes, &adResp.ConfigCodeGenerateResponse{
 			Id:        code.Id,
-			Code:      code.Code,
-			ExpiresAt: code.ExpiresAt,
-			MaxUsage:  code.MaxUsage,
+			Code:       code.Code,
+			ExpiresAt:  code.ExpiresAt,
+			MaxUsage:   code.MaxUsage,
+			QrCodeUrl:  fmt.Sprintf("/api/admin/config-code/qr/%d", code.Id),
+			SignedCode: code.SignedCode,
+			Kid:        code.Kid,
 		})
+		sheet.Add("ids", strconv.FormatUint(uint64(code.Id), 10))
 	}
 
 	resp := &adResp.ConfigCodeBatchGenerateResponse{
 		Count:       len(codes),
 		ConfigCodes: respCodes,
+		DownloadUrl: "/api/admin/config-code/sheet?" + sheet.Encode(),
 	}
 
 	response.Success(c, resp)
@@ -414,16 +443,20 @@ func (ct *ServerConfig) ConfigCodeList(c *gin.Context) {
 	var respList []*adResp.ConfigCodeResponse
 	for _, code := range list.ConfigCodes {
 		respCode := &adResp.ConfigCodeResponse{
-			Id:             code.Id,
-			Code:           code.Code,
-			ServerConfigId: code.ServerConfigId,
-			ExpiresAt:      code.ExpiresAt,
-			UsageCount:     code.UsageCount,
-			MaxUsage:       code.MaxUsage,
-			CreatedBy:      code.CreatedBy,
-			Status:         int(code.Status),
-			CreatedAt:      time.Time(code.CreatedAt),
-			UpdatedAt:      time.Time(code.UpdatedAt),
+			Id:                code.Id,
+			Code:              code.Code,
+			ServerConfigId:    code.ServerConfigId,
+			ExpiresAt:         code.ExpiresAt,
+			UsageCount:        code.UsageCount,
+			MaxUsage:          code.MaxUsage,
+			CreatedBy:         code.CreatedBy,
+			Status:            int(code.Status),
+			ConfigCodeBinding: code.ConfigCodeBinding,
+			BoundUuid:         code.BoundUuid,
+			RevokedAt:         code.RevokedAt,
+			RevokeReason:      code.RevokeReason,
+			CreatedAt:         time.Time(code.CreatedAt),
+			UpdatedAt:         time.Time(code.UpdatedAt),
 		}
 
 		// 添加服务器配置信息
@@ -504,3 +537,342 @@ func (ct *ServerConfig) GetConfigCodeStats(c *gin.Context) {
 
 	response.Success(c, stats)
 }
+
+// SigningKeys 配置码签名密钥
+// @Tags 配置码
+// @Summary 配置码签名密钥列表
+// @Description 当前和轮换后仍在有效期内的签名公钥
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response{data=[]model.ConfigSigningKey}
+// @Failure 500 {object} response.Response
+// @Router /admin/config-code/keys [get]
+// @Security token
+func (ct *ServerConfig) SigningKeys(c *gin.Context) {
+	if _, err := service.AllService.ConfigSigningService.ActiveKey(); err != nil {
+		response.Fail(c, 500, err.Error())
+		return
+	}
+	response.Success(c, service.AllService.ConfigSigningService.Keys())
+}
+
+// RotateSigningKey 轮换签名密钥
+// @Tags 配置码
+// @Summary 轮换配置码签名密钥
+// @Description 生成新的签名密钥, 旧密钥签发的配置码在过期前仍可校验
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response{data=model.ConfigSigningKey}
+// @Failure 500 {object} response.Response
+// @Router /admin/config-code/rotate-key [post]
+// @Security token
+func (ct *ServerConfig) RotateSigningKey(c *gin.Context) {
+	k, err := service.AllService.ConfigSigningService.Rotate()
+	if err != nil {
+		response.Fail(c, 500, err.Error())
+		return
+	}
+	response.Success(c, k)
+}
+
+// RevokeConfigCode 吊销配置码
+// @Tags 配置码
+// @Summary 吊销配置码
+// @Description 吊销配置码, 已兑换的设备在下次心跳时收到通知
+// @Accept json
+// @Produce json
+// @Param id path int true "配置码ID"
+// @Param body body admin.ConfigCodeRevokeForm false "吊销原因"
+// @Success 200 {object} response.Response
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/config-code/revoke/{id} [post]
+// @Security token
+func (ct *ServerConfig) RevokeConfigCode(c *gin.Context) {
+	iid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Fail(c, 400, "Invalid ID")
+		return
+	}
+	var form admin.ConfigCodeRevokeForm
+	_ = c.ShouldBindJSON(&form)
+
+	err = service.AllService.ServerConfigService.RevokeConfigCode(uint(iid), form.Reason)
+	if err != nil {
+		response.Fail(c, 500, err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// ConfigCodeUsageList 配置码使用记录
+// @Tags 配置码
+// @Summary 配置码使用记录
+// @Description 配置码兑换记录, 包含设备ID和UUID
+// @Accept json
+// @Produce json
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Param config_code_id query int false "配置码ID"
+// @Param device_id query string false "设备ID"
+// @Param uuid query string false "设备UUID"
+// @Success 200 {object} response.Response{data=model.ConfigCodeUsageList}
+// @Failure 500 {object} response.Response
+// @Router /admin/config-code/usages [get]
+// @Security token
+func (ct *ServerConfig) ConfigCodeUsageList(c *gin.Context) {
+	var query admin.ConfigCodeUsageQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		response.Fail(c, 400, err.Error())
+		return
+	}
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+	if query.PageSize <= 0 {
+		query.PageSize = 20
+	}
+	response.Success(c, service.AllService.ServerConfigService.ConfigCodeUsageList(&query))
+}
+
+// HealthHistory 健康检查历史
+// @Tags 服务器配置
+// @Summary 健康检查历史
+// @Description 服务器配置的端口探测历史
+// @Accept json
+// @Produce json
+// @Param id path int true "配置ID"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} response.Response{data=model.ServerHealthCheckList}
+// @Failure 400 {object} response.Response
+// @Router /admin/server-config/health/{id} [get]
+// @Security token
+func (ct *ServerConfig) HealthHistory(c *gin.Context) {
+	iid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Fail(c, 400, "Invalid ID")
+		return
+	}
+	q := &admin.PageQuery{}
+	if err := c.ShouldBindQuery(q); err != nil {
+		response.Fail(c, 400, err.Error())
+		return
+	}
+	res := service.AllService.ServerHealthService.History(q.Page, q.PageSize, func(tx *gorm.DB) {
+		tx.Where("server_config_id = ?", iid)
+		tx.Order("id desc")
+	})
+	response.Success(c, res)
+}
+
+// HealthCheck 立即健康检查
+// @Tags 服务器配置
+// @Summary 立即健康检查
+// @Description 立即探测服务器配置的ID、中继和API端口
+// @Accept json
+// @Produce json
+// @Param id path int true "配置ID"
+// @Success 200 {object} response.Response{data=[]model.ServerHealthCheck}
+// @Failure 400 {object} response.Response
+// @Failure 404 {object} response.Response
+// @Router /admin/server-config/health-check/{id} [post]
+// @Security token
+func (ct *ServerConfig) HealthCheck(c *gin.Context) {
+	iid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Fail(c, 400, "Invalid ID")
+		return
+	}
+	config, err := service.AllService.ServerConfigService.Detail(uint(iid))
+	if err != nil {
+		response.Fail(c, 404, "Server config not found")
+		return
+	}
+	response.Success(c, service.AllService.ServerHealthService.Check(config))
+}
+
+// Revisions 配置修订历史
+// @Tags 服务器配置
+// @Summary 配置修订历史
+// @Description 服务器配置的修订历史, 包含作者、差异和时间
+// @Accept json
+// @Produce json
+// @Param id path int true "配置ID"
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(20)
+// @Success 200 {object} response.Response{data=model.ServerConfigRevisionList}
+// @Failure 400 {object} response.Response
+// @Router /admin/server-config/revisions/{id} [get]
+// @Security token
+func (ct *ServerConfig) Revisions(c *gin.Context) {
+	iid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Fail(c, 400, "Invalid ID")
+		return
+	}
+	q := &admin.PageQuery{}
+	if err := c.ShouldBindQuery(q); err != nil {
+		response.Fail(c, 400, err.Error())
+		return
+	}
+	response.Success(c, service.AllService.ServerConfigService.Revisions(uint(iid), q.Page, q.PageSize))
+}
+
+// Rollback 回滚配置
+// @Tags 服务器配置
+// @Summary 回滚配置
+// @Description 将服务器配置回滚到指定修订, 回滚本身生成新修订
+// @Accept json
+// @Produce json
+// @Param id path int true "配置ID"
+// @Param body body admin.ServerConfigRollbackForm true "修订号"
+// @Success 200 {object} response.Response{data=model.ServerConfig}
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/server-config/rollback/{id} [post]
+// @Security token
+func (ct *ServerConfig) Rollback(c *gin.Context) {
+	iid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Fail(c, 400, "Invalid ID")
+		return
+	}
+	var form admin.ServerConfigRollbackForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		response.Fail(c, 400, err.Error())
+		return
+	}
+	u := service.AllService.UserService.CurUser(c)
+	grace := time.Duration(form.GracePeriod) * time.Second
+	config, err := service.AllService.ServerConfigService.Rollback(uint(iid), form.Revision, grace, u.Id)
+	if err != nil {
+		response.Fail(c, 500, err.Error())
+		return
+	}
+	response.Success(c, config)
+}
+
+// RotateKey 分阶段轮换密钥
+// @Tags 服务器配置
+// @Summary 分阶段轮换密钥
+// @Description 更换服务器密钥, 宽限期内客户端配置同时携带旧密钥
+// @Accept json
+// @Produce json
+// @Param id path int true "配置ID"
+// @Param body body admin.ServerConfigRotateKeyForm true "新密钥"
+// @Success 200 {object} response.Response{data=model.ServerConfig}
+// @Failure 400 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/server-config/rotate-key/{id} [post]
+// @Security token
+func (ct *ServerConfig) RotateKey(c *gin.Context) {
+	iid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Fail(c, 400, "Invalid ID")
+		return
+	}
+	var form admin.ServerConfigRotateKeyForm
+	if err := c.ShouldBindJSON(&form); err != nil {
+		response.Fail(c, 400, err.Error())
+		return
+	}
+	u := service.AllService.UserService.CurUser(c)
+	grace := time.Duration(form.GracePeriod) * time.Second
+	config, err := service.AllService.ServerConfigService.RotateKey(uint(iid), form.Key, grace, u.Id)
+	if err != nil {
+		response.Fail(c, 500, err.Error())
+		return
+	}
+	response.Success(c, config)
+}
+
+// ConfigCodeQr 配置码二维码
+// @Tags 配置码
+// @Summary 配置码二维码
+// @Description 渲染配置码二维码. content=code 为配置码(默认), config 为移动端扫码导入的服务器配置, link 为深度链接. 已撤销、停用、过期或次数用尽的配置码不能生成
+// @Produce png
+// @Produce image/svg+xml
+// @Param id path int true "配置码ID"
+// @Param format query string false "png 或 svg" default(png)
+// @Param content query string false "code, config 或 link" default(code)
+// @Param scale query int false "每模块像素" default(8)
+// @Success 200 {file} binary
+// @Failure 400 {object} response.Response
+// @Router /admin/config-code/qr/{id} [get]
+// @Security token
+func (ct *ServerConfig) ConfigCodeQr(c *gin.Context) {
+	iid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Fail(c, 400, "Invalid ID")
+		return
+	}
+	q := &admin.ConfigCodeQrQuery{}
+	if err := c.ShouldBindQuery(q); err != nil {
+		response.Fail(c, 400, err.Error())
+		return
+	}
+	b, contentType, err := service.AllService.ServerConfigService.ConfigCodeQr(uint(iid), q.Content, q.Format, q.Scale)
+	if err != nil {
+		response.Fail(c, 400, err.Error())
+		return
+	}
+	c.Data(http.StatusOK, contentType, b)
+}
+
+// ConfigCodeLink 配置码导入字符串和深度链接
+// @Tags 配置码
+// @Summary 配置码导入字符串和深度链接
+// @Description RustDesk 客户端可直接导入的配置字符串、扫码内容、深度链接和命令行, 需要 embed=true. 有绑定限制的配置码只返回配置码
+// @Accept json
+// @Produce json
+// @Param id path int true "配置码ID"
+// @Param embed query bool false "携带服务器配置" default(false)
+// @Success 200 {object} response.Response{data=model.ConfigCodeLink}
+// @Failure 400 {object} response.Response
+// @Router /admin/config-code/link/{id} [get]
+// @Security token
+func (ct *ServerConfig) ConfigCodeLink(c *gin.Context) {
+	iid, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		response.Fail(c, 400, "Invalid ID")
+		return
+	}
+	q := &admin.ConfigCodeLinkQuery{}
+	if err := c.ShouldBindQuery(q); err != nil {
+		response.Fail(c, 400, err.Error())
+		return
+	}
+	l, err := service.AllService.ServerConfigService.ConfigCodeLink(uint(iid), q.Embed)
+	if err != nil {
+		response.Fail(c, 400, err.Error())
+		return
+	}
+	response.Success(c, l)
+}
+
+// ConfigCodeSheet 打印配置码
+// @Tags 配置码
+// @Summary 打印配置码
+// @Description 生成 A4 PDF, 每页 12 个配置码二维码
+// @Produce application/pdf
+// @Param ids query []int true "配置码ID" collectionFormat(multi)
+// @Param content query string false "code, config 或 link" default(code)
+// @Success 200 {file} binary
+// @Failure 400 {object} response.Response
+// @Router /admin/config-code/sheet [get]
+// @Security token
+func (ct *ServerConfig) ConfigCodeSheet(c *gin.Context) {
+	q := &admin.ConfigCodeSheetQuery{}
+	if err := c.ShouldBindQuery(q); err != nil {
+		response.Fail(c, 400, err.Error())
+		return
+	}
+	b, err := service.AllService.ServerConfigService.ConfigCodeSheet(q.Ids, q.Content)
+	if err != nil {
+		response.Fail(c, 400, err.Error())
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="config-codes.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", b)
+}
@@ -103,3 +103,67 @@ func (sr *ShareRecord) BatchDelete(c *gin.Context) {
 	}
 	response.Success(c, nil)
 }
+
+// Revoke 吊销
+// @Tags 分享记录
+// @Summary 分享记录吊销
+// @Description 吊销后链接不能再打开
+// @Accept  json
+// @Produce  json
+// @Param body body admin.ShareRecordForm true "分享记录信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/share_record/revoke [post]
+// @Security token
+func (sr *ShareRecord) Revoke(c *gin.Context) {
+	f := &admin.ShareRecordForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	i := service.AllService.ShareRecordService.InfoById(f.Id)
+	if i.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	if err := service.AllService.ShareRecordService.Revoke(i); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// Uses 访问记录
+// @Tags 分享记录
+// @Summary 分享链接访问记录
+// @Description 分享链接访问记录, 包含被拒绝的访问
+// @Accept  json
+// @Produce  json
+// @Param share_record_id query int false "分享记录ID"
+// @Param user_id query int false "分享者ID"
+// @Param result query string false "访问结果"
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Success 200 {object} response.Response{data=model.ShareRecordUseList}
+// @Failure 500 {object} response.Response
+// @Router /admin/share_record/uses [get]
+// @Security token
+func (sr *ShareRecord) Uses(c *gin.Context) {
+	query := &admin.ShareRecordUseQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	res := service.AllService.ShareRecordService.ListUses(query.Page, query.PageSize, func(tx *gorm.DB) {
+		if query.ShareRecordId > 0 {
+			tx.Where("share_record_id = ?", query.ShareRecordId)
+		}
+		if query.UserId > 0 {
+			tx.Where("user_id = ?", query.UserId)
+		}
+		if query.Result != "" {
+			tx.Where("result = ?", query.Result)
+		}
+	})
+	response.Success(c, res)
+}
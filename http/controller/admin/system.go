@@ -5,6 +5,7 @@ import (
 	"github.com/lejianwen/rustdesk-api/v2/global"
 	"github.com/lejianwen/rustdesk-api/v2/http/response"
 	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/service"
 	"time"
 )
 
@@ -130,6 +131,22 @@ func (sc *SystemController) GetUserStatistics(c *gin.Context) {
 	response.Success(c, stats)
 }
 
+// RelayStatistics 中继负载统计
+type RelayStatistics struct {
+	Relays []map[string]interface{} `json:"relays"`
+	Series []*model.RelayUsagePoint  `json:"series"`
+}
+
+// GetRelayStatistics 获取中继负载统计, 包含各中继最新负载和最近24小时趋势
+func (sc *SystemController) GetRelayStatistics(c *gin.Context) {
+	now := time.Now().Unix()
+	stats := RelayStatistics{
+		Relays: service.AllService.RelayUsageService.Latest(),
+		Series: service.AllService.RelayUsageService.Series(nil, now-86400, now, 300),
+	}
+	response.Success(c, stats)
+}
+
 // GetDeviceStatistics 获取设备统计信息
 func (sc *SystemController) GetDeviceStatistics(c *gin.Context) {
 	var stats DeviceStatistics
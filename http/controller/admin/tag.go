@@ -5,6 +5,7 @@ import (
 	"github.com/lejianwen/rustdesk-api/v2/global"
 	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
 	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/model"
 	"github.com/lejianwen/rustdesk-api/v2/service"
 	"gorm.io/gorm"
 	"strconv"
@@ -68,7 +69,7 @@ func (ct *Tag) Create(c *gin.Context) {
 		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
 		return
 	}
-	err := service.AllService.TagService.Create(t)
+	err := service.AllService.TagService.Create(t, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin))
 	if err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
@@ -142,7 +143,7 @@ func (ct *Tag) Update(c *gin.Context) {
 		return
 	}
 	t := f.ToTag()
-	err := service.AllService.TagService.Update(t)
+	err := service.AllService.TagService.Update(t, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin))
 	if err != nil {
 		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
@@ -178,10 +179,46 @@ func (ct *Tag) Delete(c *gin.Context) {
 		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
 		return
 	}
-	err := service.AllService.TagService.Delete(ex)
+	err := service.AllService.TagService.Delete(ex, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin))
 	if err == nil {
 		response.Success(c, nil)
 		return
 	}
 	response.Fail(c, 101, err.Error())
 }
+
+// Merge 合并
+// @Tags 标签
+// @Summary 标签合并
+// @Description 把同一地址簿中的标签合并到目标标签, 引用这些标签的地址簿条目一起替换
+// @Accept  json
+// @Produce  json
+// @Param body body admin.TagMergeForm true "合并信息"
+// @Success 200 {object} response.Response{data=model.TagRenameResult}
+// @Failure 500 {object} response.Response
+// @Router /admin/tag/merge [post]
+// @Security token
+func (ct *Tag) Merge(c *gin.Context) {
+	f := &admin.TagMergeForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	target := service.AllService.TagService.InfoById(f.TargetId)
+	sources := service.AllService.TagService.ListByIds(f.Ids)
+	if target.Id == 0 || len(sources) == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	res, err := service.AllService.TagService.Merge(sources, target, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin))
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	response.Success(c, res)
+}
@@ -0,0 +1,239 @@
+package admin
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/service"
+	"gorm.io/gorm"
+)
+
+type TagDefinition struct {
+}
+
+// List 全局标签列表
+// @Tags 标签
+// @Summary 全局标签列表
+// @Description 全局标签列表
+// @Accept  json
+// @Produce  json
+// @Param name query string false "名称"
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Success 200 {object} response.Response{data=model.TagDefinitionList}
+// @Failure 500 {object} response.Response
+// @Router /admin/tag_definition/list [get]
+// @Security token
+func (ct *TagDefinition) List(c *gin.Context) {
+	query := &admin.TagDefinitionQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	res := service.AllService.TagDefinitionService.List(query.Page, query.PageSize, func(tx *gorm.DB) {
+		if query.Name != "" {
+			tx.Where("name like ?", "%"+query.Name+"%")
+		}
+	})
+	response.Success(c, res)
+}
+
+// Detail 全局标签详情
+// @Tags 标签
+// @Summary 全局标签详情
+// @Description 全局标签详情
+// @Accept  json
+// @Produce  json
+// @Param id path int true "ID"
+// @Success 200 {object} response.Response{data=model.TagDefinition}
+// @Failure 500 {object} response.Response
+// @Router /admin/tag_definition/detail/{id} [get]
+// @Security token
+func (ct *TagDefinition) Detail(c *gin.Context) {
+	iid, _ := strconv.Atoi(c.Param("id"))
+	d := service.AllService.TagDefinitionService.InfoById(uint(iid))
+	if d.Id > 0 {
+		response.Success(c, d)
+		return
+	}
+	response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+}
+
+// Create 创建全局标签
+// @Tags 标签
+// @Summary 创建全局标签
+// @Description 创建后需要推送到地址簿
+// @Accept  json
+// @Produce  json
+// @Param body body admin.TagDefinitionForm true "标签信息"
+// @Success 200 {object} response.Response{data=model.TagDefinition}
+// @Failure 500 {object} response.Response
+// @Router /admin/tag_definition/create [post]
+// @Security token
+func (ct *TagDefinition) Create(c *gin.Context) {
+	f := &admin.TagDefinitionForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	d := f.ToTagDefinition()
+	d.Id = 0
+	if err := service.AllService.TagDefinitionService.Create(d); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	response.Success(c, d)
+}
+
+// Update 编辑全局标签
+// @Tags 标签
+// @Summary 编辑全局标签
+// @Description 改名时所有地址簿中的同名标签及引用它的条目一起改名, 颜色需要重新推送
+// @Accept  json
+// @Produce  json
+// @Param body body admin.TagDefinitionForm true "标签信息"
+// @Success 200 {object} response.Response{data=model.TagRenameResult}
+// @Failure 500 {object} response.Response
+// @Router /admin/tag_definition/update [post]
+// @Security token
+func (ct *TagDefinition) Update(c *gin.Context) {
+	f := &admin.TagDefinitionForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	if f.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	res, err := service.AllService.TagDefinitionService.Update(f.ToTagDefinition(), service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin))
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	response.Success(c, res)
+}
+
+// Delete 删除全局标签
+// @Tags 标签
+// @Summary 删除全局标签
+// @Description 地址簿中已推送的标签保留
+// @Accept  json
+// @Produce  json
+// @Param body body admin.TagDefinitionForm true "标签信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/tag_definition/delete [post]
+// @Security token
+func (ct *TagDefinition) Delete(c *gin.Context) {
+	f := &admin.TagDefinitionForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidVar(c, f.Id, "required,gt=0")
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	d := service.AllService.TagDefinitionService.InfoById(f.Id)
+	if d.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	if err := service.AllService.TagDefinitionService.Delete(d); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// Push 推送全局标签
+// @Tags 标签
+// @Summary 推送全局标签
+// @Description 推送到共享地址簿和用户的个人地址簿, 没有的标签创建, overwrite 时覆盖已有同名标签的颜色
+// @Accept  json
+// @Produce  json
+// @Param body body admin.TagDefinitionPushForm true "推送信息"
+// @Success 200 {object} response.Response{data=model.TagPushResult}
+// @Failure 500 {object} response.Response
+// @Router /admin/tag_definition/push [post]
+// @Security token
+func (ct *TagDefinition) Push(c *gin.Context) {
+	f := &admin.TagDefinitionPushForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	if len(f.CollectionIds) == 0 && len(f.UserIds) == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
+		return
+	}
+	defs := service.AllService.TagDefinitionService.ListByIds(f.Ids)
+	if len(defs) == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	opts := &service.TagPushOptions{CollectionIds: f.CollectionIds, UserIds: f.UserIds, Overwrite: f.Overwrite}
+	res, err := service.AllService.TagDefinitionService.Push(defs, opts, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin))
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	response.Success(c, res)
+}
+
+// Merge 合并全局标签
+// @Tags 标签
+// @Summary 合并全局标签
+// @Description 把 ids 合并到 target_id, 所有地址簿中的同名标签及引用它们的条目一起合并, 然后删除被合并的定义
+// @Accept  json
+// @Produce  json
+// @Param body body admin.TagMergeForm true "合并信息"
+// @Success 200 {object} response.Response{data=model.TagRenameResult}
+// @Failure 500 {object} response.Response
+// @Router /admin/tag_definition/merge [post]
+// @Security token
+func (ct *TagDefinition) Merge(c *gin.Context) {
+	f := &admin.TagMergeForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	target := service.AllService.TagDefinitionService.InfoById(f.TargetId)
+	sources := service.AllService.TagDefinitionService.ListByIds(f.Ids)
+	if target.Id == 0 || len(sources) == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	res, err := service.AllService.TagDefinitionService.Merge(sources, target, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceAdmin))
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	response.Success(c, res)
+}
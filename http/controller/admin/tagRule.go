@@ -0,0 +1,165 @@
+package admin
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/service"
+	"gorm.io/gorm"
+)
+
+type TagRule struct {
+}
+
+// List 自动标签规则列表
+// @Tags 标签
+// @Summary 自动标签规则列表
+// @Description 按创建顺序排列
+// @Accept  json
+// @Produce  json
+// @Param status query int false "状态"
+// @Param page query int false "页码"
+// @Param page_size query int false "页大小"
+// @Success 200 {object} response.Response{data=model.TagRuleList}
+// @Failure 500 {object} response.Response
+// @Router /admin/tag_rule/list [get]
+// @Security token
+func (ct *TagRule) List(c *gin.Context) {
+	query := &admin.TagRuleQuery{}
+	if err := c.ShouldBindQuery(query); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	res := service.AllService.TagRuleService.List(query.Page, query.PageSize, func(tx *gorm.DB) {
+		if query.Status > 0 {
+			tx.Where("status = ?", query.Status)
+		}
+	})
+	response.Success(c, res)
+}
+
+// Detail 自动标签规则详情
+// @Tags 标签
+// @Summary 自动标签规则详情
+// @Description 自动标签规则详情
+// @Accept  json
+// @Produce  json
+// @Param id path int true "ID"
+// @Success 200 {object} response.Response{data=model.TagRule}
+// @Failure 500 {object} response.Response
+// @Router /admin/tag_rule/detail/{id} [get]
+// @Security token
+func (ct *TagRule) Detail(c *gin.Context) {
+	iid, _ := strconv.Atoi(c.Param("id"))
+	r := service.AllService.TagRuleService.InfoById(uint(iid))
+	if r.Id > 0 {
+		response.Success(c, r)
+		return
+	}
+	response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+}
+
+// Create 创建自动标签规则
+// @Tags 标签
+// @Summary 创建自动标签规则
+// @Description 地址簿条目创建时按主机名正则、系统或设备组匹配, 非空条件须全部满足
+// @Accept  json
+// @Produce  json
+// @Param body body admin.TagRuleForm true "规则信息"
+// @Success 200 {object} response.Response{data=model.TagRule}
+// @Failure 500 {object} response.Response
+// @Router /admin/tag_rule/create [post]
+// @Security token
+func (ct *TagRule) Create(c *gin.Context) {
+	f := &admin.TagRuleForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	r := f.ToTagRule()
+	r.Id = 0
+	if err := service.AllService.TagRuleService.Create(r); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, r)
+}
+
+// Update 编辑自动标签规则
+// @Tags 标签
+// @Summary 编辑自动标签规则
+// @Description 只对之后创建的地址簿条目生效
+// @Accept  json
+// @Produce  json
+// @Param body body admin.TagRuleForm true "规则信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/tag_rule/update [post]
+// @Security token
+func (ct *TagRule) Update(c *gin.Context) {
+	f := &admin.TagRuleForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	if f.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError"))
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	if service.AllService.TagRuleService.InfoById(f.Id).Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	if err := service.AllService.TagRuleService.Update(f.ToTagRule()); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
+
+// Delete 删除自动标签规则
+// @Tags 标签
+// @Summary 删除自动标签规则
+// @Description 已打上的标签保留
+// @Accept  json
+// @Produce  json
+// @Param body body admin.TagRuleForm true "规则信息"
+// @Success 200 {object} response.Response
+// @Failure 500 {object} response.Response
+// @Router /admin/tag_rule/delete [post]
+// @Security token
+func (ct *TagRule) Delete(c *gin.Context) {
+	f := &admin.TagRuleForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidVar(c, f.Id, "required,gt=0")
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	r := service.AllService.TagRuleService.InfoById(f.Id)
+	if r.Id == 0 {
+		response.Fail(c, 101, response.TranslateMsg(c, "ItemNotFound"))
+		return
+	}
+	if err := service.AllService.TagRuleService.Delete(r); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
+	response.Success(c, nil)
+}
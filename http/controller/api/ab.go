@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/lejianwen/rustdesk-api/v2/global"
 	requstform "github.com/lejianwen/rustdesk-api/v2/http/request/api"
@@ -14,6 +15,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Ab struct {
@@ -22,7 +24,7 @@ type Ab struct {
 // Ab
 // @Tags 地址
 // @Summary 地址列表
-// @Description 地址列表
+// @Description 地址列表, 返回全部条目, 条目较多时分批读取并流式输出
 // @Accept  json
 // @Produce  json
 // @Success 200 {object} response.Response
@@ -31,36 +33,92 @@ type Ab struct {
 // @Security BearerAuth
 func (a *Ab) Ab(c *gin.Context) {
 	user := service.AllService.UserService.CurUser(c)
+	rev, err := service.AllService.AddressBookSyncService.Ensure(user.Id)
+	if err != nil {
+		response.Error(c, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
+	}
 
-	al := service.AllService.AddressBookService.ListByUserIdAndCollectionId(user.Id, 0, 1, 1000)
 	tags := service.AllService.TagService.ListByUserIdAndCollectionId(user.Id, 0)
 
 	tagColors := map[string]uint{}
 	//将tags中的name转成一个以逗号分割的字符串
-	var tagNames []string
+	tagNames := []string{}
 	for _, tag := range tags.Tags {
 		tagNames = append(tagNames, tag.Name)
 		tagColors[tag.Name] = tag.Color
 	}
 	tgc, _ := json.Marshal(tagColors)
-	res := &api.AbList{
-		Peers:     al.AddressBooks,
-		Tags:      tagNames,
-		TagColors: string(tgc),
-	}
-	data, _ := json.Marshal(res)
-	c.JSON(http.StatusOK, gin.H{
-		"data": string(data),
-		//"licensed_devices": 999,
+	//记录设备看到的修订, 作为下次上传合并的基线
+	service.AllService.AddressBookSyncService.SetTokenRevision(c.GetString("token"), rev)
+	c.Header("ETag", abETag(rev))
+
+	//data 是 api.AbList 序列化后的字符串, 逐段转义写出
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+	w := &abDataWriter{w: c.Writer}
+	w.raw(`{"data":"`)
+	w.inner([]byte(`{"peers":[`))
+	n := 0
+	err = service.AllService.AddressBookService.EachByUserIdAndCollectionId(user.Id, 0, int(service.AllService.AddressBookService.MaxPageSize()), func(abs []*model.AddressBook) error {
+		service.AllService.ClientVersionService.MarkAddressBooks(abs)
+		for _, ab := range abs {
+			b, err := json.Marshal(ab)
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				w.inner([]byte(","))
+			}
+			w.inner(b)
+			n++
+		}
+		w.w.Flush()
+		return w.err
 	})
+	if err != nil {
+		//已经开始输出, 只能中断, 客户端解析失败后会重试而不是拿到不完整的列表
+		global.Logger.Warn("stream address book failed: " + err.Error())
+		return
+	}
+	tn, _ := json.Marshal(tagNames)
+	tcs, _ := json.Marshal(string(tgc))
+	w.inner([]byte(`],"tags":`))
+	w.inner(tn)
+	w.inner([]byte(`,"tag_colors":`))
+	w.inner(tcs)
+	w.inner([]byte(`}`))
+	w.raw(`"}`)
+}
+
+// abDataWriter 输出 {"data": "<json>"} 形式的响应, 内层 JSON 转义为字符串内容
+type abDataWriter struct {
+	w   gin.ResponseWriter
+	err error
+}
+
+func (aw *abDataWriter) raw(s string) {
+	if aw.err == nil {
+		_, aw.err = aw.w.WriteString(s)
+	}
+}
+
+// inner 写入内层 JSON 片段
+func (aw *abDataWriter) inner(b []byte) {
+	if aw.err != nil {
+		return
+	}
+	s, _ := json.Marshal(string(b))
+	_, aw.err = aw.w.Write(s[1 : len(s)-1])
 }
 
 // UpAb
 // @Tags 地址
 // @Summary 地址更新
-// @Description 地址更新
+// @Description 地址更新, 与设备上次读取的修订(If-Match 或令牌记录的修订)及服务端当前数据三方合并, 基线修订已不存在时拒绝
 // @Accept  json
 // @Produce  json
+// @Param If-Match header string false "上次读取时的 ETag"
 // @Param body body requstform.AddressBookForm true "地址表单"
 // @Success 200 {string} string "null"
 // @Failure 500 {object} response.ErrorResponse
@@ -86,18 +144,54 @@ func (a *Ab) UpAb(c *gin.Context) {
 		return
 	}
 	user := service.AllService.UserService.CurUser(c)
-
-	err = service.AllService.AddressBookService.UpdateAddressBook(abd.Peers, user.Id)
+	token := c.GetString("token")
+	_, ut := service.AllService.UserService.InfoByAccessToken(token)
+	base, ok := abRevisionFromETag(c.GetHeader("If-Match"))
+	if !ok {
+		base = ut.AbRevision
+	}
+	s, err := service.AllService.AddressBookSyncService.Sync(user.Id, base, abd.Peers, tc, &service.AddressBookSyncMeta{
+		DeviceId:   ut.DeviceId,
+		DeviceUuid: ut.DeviceUuid,
+		ClientIp:   c.ClientIP(),
+	})
 	if err != nil {
+		if errors.Is(err, service.ErrAbSyncConflict) {
+			c.Header("ETag", abETag(service.AllService.AddressBookSyncService.Latest(user.Id).Revision))
+			response.Error(c, response.TranslateMsg(c, err.Error()))
+			return
+		}
+		if errors.Is(err, service.ErrAbQuotaExceeded) {
+			response.Error(c, response.TranslateMsg(c, err.Error()))
+			return
+		}
 		response.Error(c, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
 	}
-
-	service.AllService.TagService.UpdateTags(user.Id, tc)
+	c.Header("ETag", abETag(s.Revision))
+	//保留了服务端修改时设备的数据不是最新, 基线不前移, 等设备重新读取
+	if !s.Merged {
+		service.AllService.AddressBookSyncService.SetTokenRevision(token, s.Revision)
+	}
 
 	c.JSON(http.StatusOK, nil)
 }
 
+// abETag 旧版地址簿修订号对应的 ETag
+func abETag(rev uint) string {
+	return fmt.Sprintf("\"%d\"", rev)
+}
+
+// abRevisionFromETag 解析 If-Match 中的修订号
+func abRevisionFromETag(v string) (uint, bool) {
+	v = strings.Trim(strings.TrimPrefix(strings.TrimSpace(v), "W/"), "\"")
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return uint(n), true
+}
+
 // PTags
 // @Tags 地址[Personal]
 // @Summary 标签
@@ -168,7 +262,7 @@ func (a *Ab) TagAdd(c *gin.Context) {
 	}
 	t.UserId = uid
 	t.CollectionId = cid
-	err = service.AllService.TagService.Create(t)
+	err = service.AllService.TagService.Create(t, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceApi))
 	if err != nil {
 		response.Error(c, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
@@ -220,7 +314,7 @@ func (a *Ab) TagRename(c *gin.Context) {
 		return
 	}
 	tag.Name = t.New
-	err = service.AllService.TagService.Update(tag)
+	err = service.AllService.TagService.Update(tag, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceApi))
 	if err != nil {
 		response.Error(c, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
@@ -266,7 +360,7 @@ func (a *Ab) TagUpdate(c *gin.Context) {
 		return
 	}
 	tag.Color = t.Color
-	err = service.AllService.TagService.Update(tag)
+	err = service.AllService.TagService.Update(tag, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceApi))
 	if err != nil {
 		response.Error(c, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
@@ -308,13 +402,14 @@ func (a *Ab) TagDel(c *gin.Context) {
 		return
 	}
 
+	actor := service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceApi)
 	for _, name := range *t {
 		tag := service.AllService.TagService.InfoByUserIdAndNameAndCollectionId(uid, name, cid)
 		if tag == nil || tag.Id == 0 {
 			response.Error(c, response.TranslateMsg(c, "ItemNotFound"))
 			return
 		}
-		err = service.AllService.TagService.Delete(tag)
+		err = service.AllService.TagService.Delete(tag, actor)
 		if err != nil {
 			response.Error(c, response.TranslateMsg(c, "OperationFailed")+err.Error())
 			return
@@ -370,7 +465,7 @@ func (a *Ab) Personal(c *gin.Context) {
 // @Security BearerAuth
 func (a *Ab) Settings(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
-		"max_peer_one_ab": 0, //最大peer数，0表示不限制
+		"max_peer_one_ab": max(global.Config.App.AbMaxPeersPerCollection, 0), //最大peer数，0表示不限制; 各地址簿的实际上限见 peers 的 licensed_devices
 	})
 }
 
@@ -391,50 +486,45 @@ func (a *Ab) SharedProfiles(c *gin.Context) {
 	var res []*api.SharedProfilesPayload
 
 	user := service.AllService.UserService.CurUser(c)
-	myAbCollectionList := service.AllService.AddressBookService.ListCollectionByUserId(user.Id)
-	for _, ab := range myAbCollectionList.AddressBookCollection {
+	//下级地址簿以 "上级 / 下级" 的组合名称返回, 客户端不支持层级
+	myCollections := service.AllService.AddressBookService.CollectionsByUserId(user.Id)
+	myPaths := service.AllService.AddressBookService.CollectionPaths(user.Id)
+	for _, ab := range myCollections {
 		res = append(res, &api.SharedProfilesPayload{
 			Guid:  a.ComposeGuid(user.GroupId, user.Id, ab.Id),
-			Name:  ab.Name,
+			Name:  myPaths[ab.Id],
 			Owner: user.Username,
 			Rule:  model.ShareAddressBookRuleRuleFullControl,
 		})
 	}
 
-	allAbIds := make(map[uint]int) //用map去重，并保留最大Rule
-	allUserIds := make(map[uint]*model.User)
-	rules := service.AllService.AddressBookService.CollectionReadRules(user)
-	for _, rule := range rules {
-		//先判断是否存在
-		r, ok := allAbIds[rule.CollectionId]
-		if ok {
-			//再判断权限大小
-			if r < rule.Rule {
-				allAbIds[rule.CollectionId] = rule.Rule
-			}
-		} else {
-			allAbIds[rule.CollectionId] = rule.Rule
-			allUserIds[rule.UserId] = nil
-		}
-
-	}
+	//包含通过上级地址簿继承的权限
+	allAbIds := service.AllService.AddressBookService.SharedCollectionRules(user)
 	abids := utils.Keys(allAbIds)
 	collections := service.AllService.AddressBookService.ListCollectionByIds(abids)
 
+	allUserIds := make(map[uint]*model.User)
+	for _, collection := range collections {
+		allUserIds[collection.UserId] = nil
+	}
 	ids := utils.Keys(allUserIds)
 	allUsers := service.AllService.UserService.ListByIds(ids)
 	for _, u := range allUsers {
 		allUserIds[u.Id] = u
 	}
 
+	paths := make(map[uint]map[uint]string)
 	for _, collection := range collections {
 		_u, ok := allUserIds[collection.UserId]
-		if !ok {
+		if !ok || _u == nil {
 			continue
 		}
+		if _, ok := paths[_u.Id]; !ok {
+			paths[_u.Id] = service.AllService.AddressBookService.CollectionPaths(_u.Id)
+		}
 		res = append(res, &api.SharedProfilesPayload{
 			Guid:  a.ComposeGuid(_u.GroupId, _u.Id, collection.Id),
-			Name:  collection.Name,
+			Name:  paths[_u.Id][collection.Id],
 			Owner: _u.Username,
 			Rule:  allAbIds[collection.Id],
 		})
@@ -528,15 +618,20 @@ func (a *Ab) CheckGuid(cu *model.User, guid string) (gid, uid, cid uint, err err
 // @Produce  json
 // @Param current query int false "页码"
 // @Param pageSize query int false "每页数量"
+// @Param cursor query int false "游标, 上一页返回的 next_cursor, 传入时忽略页码"
 // @Param ab query string false "guid"
 // @Success 200 {object} response.Response
 // @Failure 500 {object} response.Response
 // @Router /ab/peers [post]
 // @Security BearerAuth
 func (a *Ab) Peers(c *gin.Context) {
+	q := &requstform.AbPeersQuery{}
+	if err := c.ShouldBindQuery(q); err != nil {
+		response.Error(c, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
 	u := service.AllService.UserService.CurUser(c)
-	guid := c.Query("ab")
-	_, uid, cid, err := a.CheckGuid(u, guid)
+	_, uid, cid, err := a.CheckGuid(u, q.Ab)
 	if err != nil {
 		response.Error(c, response.TranslateMsg(c, err.Error()))
 		return
@@ -548,12 +643,33 @@ func (a *Ab) Peers(c *gin.Context) {
 		return
 	}
 
-	al := service.AllService.AddressBookService.ListByUserIdAndCollectionId(uid, cid, 1, 1000)
-	c.JSON(http.StatusOK, gin.H{
-		"total":            al.Total,
-		"data":             al.AddressBooks,
-		"licensed_devices": 99999,
-	})
+	//智能地址簿超过1分钟未同步时先同步
+	service.AllService.SmartCollectionService.SyncIfStale(cid, time.Minute)
+	pageSize := q.PageSize
+	if pageSize == 0 || pageSize > service.AllService.AddressBookService.MaxPageSize() {
+		pageSize = service.AllService.AddressBookService.MaxPageSize()
+	}
+	res := gin.H{
+		"licensed_devices": service.AllService.AddressBookService.LicensedDevices(uid, cid),
+	}
+	if q.Cursor > 0 {
+		abs, next := service.AllService.AddressBookService.ListByUserIdAndCollectionIdAfter(uid, cid, q.Cursor, pageSize)
+		service.AllService.ClientVersionService.MarkAddressBooks(abs)
+		res["data"] = abs
+		res["next_cursor"] = next
+		c.JSON(http.StatusOK, res)
+		return
+	}
+	current := max(q.Current, 1)
+	al := service.AllService.AddressBookService.ListByUserIdAndCollectionId(uid, cid, current, pageSize)
+	service.AllService.ClientVersionService.MarkAddressBooks(al.AddressBooks)
+	res["total"] = al.Total
+	res["data"] = al.AddressBooks
+	//客户端按 total 翻页, 也可改用游标继续读取
+	if n := len(al.AddressBooks); n > 0 && int64(current)*int64(pageSize) < al.Total {
+		res["next_cursor"] = al.AddressBooks[n-1].RowId
+	}
+	c.JSON(http.StatusOK, res)
 }
 
 // PeerAdd
@@ -590,22 +706,37 @@ func (a *Ab) PeerAdd(c *gin.Context) {
 		response.Error(c, response.TranslateMsg(c, "NoAccess"))
 		return
 	}
+	//智能地址簿的成员由查询决定
+	if service.AllService.SmartCollectionService.IsSmart(cid) {
+		response.Error(c, response.TranslateMsg(c, "SmartCollectionReadOnly"))
+		return
+	}
 
 	//fmt.Println(f)
 	f.UserId = uid
 	ab := f.ToAddressBook()
 	ab.CollectionId = cid
-	if ab.Platform == "" || ab.Username == "" || ab.Hostname == "" {
-		peer := service.AllService.PeerService.FindById(ab.Id)
-		if peer.RowId != 0 {
-			ab.Platform = service.AllService.AddressBookService.PlatformFromOs(peer.Os)
-			ab.Username = peer.Username
-			ab.Hostname = peer.Hostname
+	peer := service.AllService.PeerService.Resolve(ab.Id)
+	if peer.RowId != 0 && peer.Id != ab.Id {
+		// 旧ID已合并, 按合并后的ID保存, 已有该设备时不再重复添加
+		ab.Id = peer.Id
+		if ex := service.AllService.AddressBookService.InfoByUserIdAndIdAndCid(uid, ab.Id, cid); ex.RowId > 0 {
+			c.String(http.StatusOK, "")
+			return
 		}
 	}
+	if peer.RowId != 0 && (ab.Platform == "" || ab.Username == "" || ab.Hostname == "") {
+		ab.Platform = service.AllService.AddressBookService.PlatformFromOs(peer.Os)
+		ab.Username = peer.Username
+		ab.Hostname = peer.Hostname
+	}
 
-	err = service.AllService.AddressBookService.AddAddressBook(ab)
+	err = service.AllService.AddressBookService.AddAddressBook(ab, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceApi))
 	if err != nil {
+		if errors.Is(err, service.ErrAbQuotaExceeded) {
+			response.Error(c, response.TranslateMsg(c, err.Error()))
+			return
+		}
 		response.Error(c, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
 	}
@@ -644,13 +775,14 @@ func (a *Ab) PeerDel(c *gin.Context) {
 		return
 	}
 
+	actor := service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceApi)
 	for _, id := range *f {
 		ab := service.AllService.AddressBookService.InfoByUserIdAndIdAndCid(uid, id, cid)
 		if ab == nil || ab.RowId == 0 {
 			response.Error(c, response.TranslateMsg(c, "ItemNotFound"))
 			return
 		}
-		err = service.AllService.AddressBookService.Delete(ab)
+		err = service.AllService.AddressBookService.Delete(ab, actor)
 		if err != nil {
 			response.Error(c, response.TranslateMsg(c, "OperationFailed")+err.Error())
 			return
@@ -718,7 +850,7 @@ func (a *Ab) PeerUpdate(c *gin.Context) {
 	if tags, _ok := f["tags"]; _ok {
 		f["tags"], _ = json.Marshal(tags)
 	}
-	err = service.AllService.AddressBookService.UpdateByMap(ab, f)
+	err = service.AllService.AddressBookService.UpdateByMap(ab, f, service.AllService.AddressBookChangeService.Actor(c, model.AddressBookChangeSourceApi))
 	if err != nil {
 		response.Error(c, response.TranslateMsg(c, "OperationFailed")+err.Error())
 		return
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	requstform "github.com/lejianwen/rustdesk-api/v2/http/request/api"
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	apiResp "github.com/lejianwen/rustdesk-api/v2/http/response/api"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/service"
+)
+
+type Enrollment struct {
+}
+
+// Info 注册链接信息
+// @Tags 自助注册
+// @Summary 注册链接信息
+// @Description 注册页面展示用的链接信息和可用的注册方式
+// @Accept  json
+// @Produce  json
+// @Param token path string true "注册链接token"
+// @Success 200 {object} response.Response{data=apiResp.EnrollInfoResponse}
+// @Failure 500 {object} response.Response
+// @Router /enroll/{token} [get]
+func (e *Enrollment) Info(c *gin.Context) {
+	l := service.AllService.EnrollmentService.InfoByToken(c.Param("token"))
+	if err := service.AllService.EnrollmentService.Check(l); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	res := &apiResp.EnrollInfoResponse{
+		Name:           l.Name,
+		AllowRegister:  l.AllowRegister == nil || *l.AllowRegister,
+		AllowOauth:     l.AllowOauth == nil || *l.AllowOauth,
+		OauthProviders: []string{},
+		ExpiresAt:      l.ExpiresAt,
+	}
+	if l.ServerConfig != nil {
+		res.ServerName = l.ServerConfig.Name
+	}
+	if res.AllowOauth {
+		res.OauthProviders = append(res.OauthProviders, service.AllService.OauthService.GetOauthProviders()...)
+	}
+	response.Success(c, res)
+}
+
+// Register 通过注册链接注册
+// @Tags 自助注册
+// @Summary 通过注册链接注册
+// @Description 注册用户到链接的用户组, 登录并返回服务器配置
+// @Accept  json
+// @Produce  json
+// @Param token path string true "注册链接token"
+// @Param body body requstform.EnrollRegisterForm true "注册信息"
+// @Success 200 {object} response.Response{data=apiResp.EnrollResponse}
+// @Failure 500 {object} response.Response
+// @Router /enroll/{token}/register [post]
+func (e *Enrollment) Register(c *gin.Context) {
+	f := &requstform.EnrollRegisterForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	errList := global.Validator.ValidStruct(c, f)
+	if len(errList) > 0 {
+		response.Fail(c, 101, errList[0])
+		return
+	}
+	l := service.AllService.EnrollmentService.InfoByToken(c.Param("token"))
+	r := &service.ConfigCodeRedeemer{
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		DeviceId:  f.Id,
+		Uuid:      f.Uuid,
+	}
+	u, cfg, err := service.AllService.EnrollmentService.Register(l, f.Username, f.Email, f.Password, r)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	ut := service.AllService.UserService.Login(u, &model.LoginLog{
+		UserId:   u.Id,
+		Client:   f.DeviceInfo.Type,
+		DeviceId: f.Id,
+		Uuid:     f.Uuid,
+		Ip:       c.ClientIP(),
+		Type:     model.LoginLogTypeAccount,
+		Platform: f.DeviceInfo.Os,
+	})
+	response.Success(c, &apiResp.EnrollResponse{
+		Type:         "access_token",
+		AccessToken:  ut.Token,
+		User:         (&apiResp.UserPayload{}).FromUser(u),
+		ServerConfig: cfg,
+	})
+}
+
+// Oauth 通过 OAuth 注册
+// @Tags 自助注册
+// @Summary 通过 OAuth 注册
+// @Description 与 /oidc/auth 相同, 授权完成后按链接注册或绑定用户; 客户端通过 /oidc/auth-query 取得令牌后再调用 /enroll/{token}/redeem 获取配置
+// @Accept  json
+// @Produce  json
+// @Param token path string true "注册链接token"
+// @Param body body requstform.OidcAuthRequest true "OAuth 参数"
+// @Success 200 {object} map[string]string
+// @Failure 500 {object} response.Response
+// @Router /enroll/{token}/oauth [post]
+func (e *Enrollment) Oauth(c *gin.Context) {
+	f := &requstform.OidcAuthRequest{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	token := c.Param("token")
+	l := service.AllService.EnrollmentService.InfoByToken(token)
+	if err := service.AllService.EnrollmentService.Check(l); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	if l.AllowOauth != nil && !*l.AllowOauth {
+		response.Fail(c, 101, response.TranslateMsg(c, service.ErrEnrollmentMethod.Error()))
+		return
+	}
+	err, state, verifier, nonce, url := service.AllService.OauthService.BeginAuth(f.Op)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	service.AllService.OauthService.SetOauthCache(state, &service.OauthCacheItem{
+		Action:      service.OauthActionTypeLogin,
+		Id:          f.Id,
+		Op:          f.Op,
+		Uuid:        f.Uuid,
+		DeviceName:  f.DeviceInfo.Name,
+		DeviceOs:    f.DeviceInfo.Os,
+		DeviceType:  f.DeviceInfo.Type,
+		Verifier:    verifier,
+		Nonce:       nonce,
+		EnrollToken: token,
+	}, 5*60)
+	c.JSON(http.StatusOK, gin.H{
+		"code": state,
+		"url":  url,
+	})
+}
+
+// Redeem 已登录用户兑换注册链接
+// @Tags 自助注册
+// @Summary 兑换注册链接
+// @Description 已登录用户(含 OAuth 注册的用户)兑换链接, 返回服务器配置, 设备首次上报时分配设备组
+// @Accept  json
+// @Produce  json
+// @Param token path string true "注册链接token"
+// @Param body body requstform.EnrollRedeemForm true "设备信息"
+// @Success 200 {object} response.Response{data=apiResp.EnrollResponse}
+// @Failure 500 {object} response.Response
+// @Router /enroll/{token}/redeem [post]
+// @Security BearerAuth
+func (e *Enrollment) Redeem(c *gin.Context) {
+	f := &requstform.EnrollRedeemForm{}
+	if err := c.ShouldBindJSON(f); err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "ParamsError")+err.Error())
+		return
+	}
+	u := service.AllService.UserService.CurUser(c)
+	l := service.AllService.EnrollmentService.InfoByToken(c.Param("token"))
+	r := &service.ConfigCodeRedeemer{
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		DeviceId:  f.Id,
+		Uuid:      f.Uuid,
+	}
+	cfg, err := service.AllService.EnrollmentService.Enroll(l, u, model.EnrollmentMethodLogin, false, r)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
+		return
+	}
+	response.Success(c, &apiResp.EnrollResponse{ServerConfig: cfg})
+}
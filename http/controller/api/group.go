@@ -7,7 +7,9 @@ import (
 	apiResp "github.com/lejianwen/rustdesk-api/v2/http/response/api"
 	"github.com/lejianwen/rustdesk-api/v2/model"
 	"github.com/lejianwen/rustdesk-api/v2/service"
+	"gorm.io/gorm"
 	"net/http"
+	"strings"
 )
 
 type Group struct {
@@ -67,6 +69,8 @@ func (g *Group) Users(c *gin.Context) {
 // @Param pageSize query int false "每页数量"
 // @Param status query int false "状态"
 // @Param accessible query string false "accessible"
+// @Param labels query string false "标签 用逗号分隔"
+// @Param attr query []string false "属性筛选 name=value 或 name~value"
 // @Success 200 {object} response.DataResponse
 // @Failure 500 {object} response.Response
 // @Router /peers [get]
@@ -99,7 +103,18 @@ func (g *Group) Peers(c *gin.Context) {
 	for _, group := range allGroup.DeviceGroups {
 		dGroupNameById[group.Id] = group.Name
 	}
-	peerList := service.AllService.PeerService.ListByUserIds(userIds, q.Page, q.PageSize)
+	filters, err := service.AllService.PeerAttributeService.ParseFilters(q.Attrs)
+	if err != nil {
+		response.Error(c, err.Error())
+		return
+	}
+	peerList := service.AllService.PeerService.List(q.Page, q.PageSize, func(tx *gorm.DB) {
+		tx.Where("user_id in (?)", userIds)
+		if q.Labels != "" || len(filters) > 0 {
+			service.AllService.PeerAttributeService.Where(tx, strings.Split(q.Labels, ","), filters)
+		}
+	})
+	service.AllService.PeerAttributeService.Fill(peerList.Peers)
 	data := make([]*apiResp.GroupPeerPayload, 0, len(peerList.Peers))
 	for _, peer := range peerList.Peers {
 		uname, ok := namesById[peer.UserId]
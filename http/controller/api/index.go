@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	requstform "github.com/lejianwen/rustdesk-api/v2/http/request/api"
 	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	apiResp "github.com/lejianwen/rustdesk-api/v2/http/response/api"
 	"github.com/lejianwen/rustdesk-api/v2/model"
 	"github.com/lejianwen/rustdesk-api/v2/service"
 	"net/http"
@@ -58,6 +59,15 @@ func (i *Index) Heartbeat(c *gin.Context) {
 	if time.Now().Unix()-peer.LastOnlineTime >= 30 {
 		upp := &model.Peer{RowId: peer.RowId, LastOnlineTime: time.Now().Unix(), LastOnlineIp: c.ClientIP()}
 		service.AllService.PeerService.Update(upp)
+		//IP变化时按网段规则重新分配设备组
+		if peer.LastOnlineIp != upp.LastOnlineIp {
+			service.AllService.DeviceGroupRuleService.Assign(peer, upp.LastOnlineIp)
+		}
+	}
+	//已兑换配置码被吊销时通知设备
+	if notices := service.AllService.ServerConfigService.TakeRevokeNotices(info.Uuid); len(notices) > 0 {
+		c.JSON(http.StatusOK, gin.H{"config_code_revoked": notices})
+		return
 	}
 	c.JSON(http.StatusOK, gin.H{})
 }
@@ -68,14 +78,22 @@ func (i *Index) Heartbeat(c *gin.Context) {
 // @Description 版本
 // @Accept  json
 // @Produce  json
-// @Success 200 {object} response.Response
+// @Param id query string false "设备ID"
+// @Param uuid query string false "设备uuid"
+// @Success 200 {object} apiResp.VersionResponse
 // @Failure 500 {object} response.Response
 // @Router /version [get]
 func (i *Index) Version(c *gin.Context) {
 	//读取resources/version文件
 	v := service.AllService.AppService.GetAppVersion()
-	response.Success(
-		c,
-		v,
-	)
+	res := &apiResp.VersionResponse{
+		Response: response.Response{Message: "success", Data: v},
+	}
+	//带上设备信息时按设备组给出版本建议
+	peer := service.AllService.ClientVersionService.FindPeer(c.Query("id"), c.Query("uuid"))
+	res.RecommendedClientVersion = service.AllService.ClientVersionService.RecommendedVersion(peer)
+	if peer.GroupId > 0 {
+		res.MinClientVersion = service.AllService.GroupService.DeviceGroupInfoById(peer.GroupId).MinVersion
+	}
+	c.JSON(http.StatusOK, res)
 }
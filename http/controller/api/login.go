@@ -85,9 +85,10 @@ func (l *Login) Login(c *gin.Context) {
 	})
 
 	c.JSON(http.StatusOK, apiResp.LoginRes{
-		AccessToken: ut.Token,
-		Type:        "access_token",
-		User:        *(&apiResp.UserPayload{}).FromUser(u),
+		AccessToken:      ut.Token,
+		Type:             "access_token",
+		User:             *(&apiResp.UserPayload{}).FromUser(u),
+		ClientCompliance: service.AllService.ClientVersionService.EnforcedCompliance(service.AllService.ClientVersionService.FindPeer(f.Id, f.Uuid)),
 	})
 }
 
@@ -222,9 +222,11 @@ func (o *Oauth) OauthCallback(c *gin.Context) {
 			return
 		}
 		user = service.AllService.UserService.InfoByOauthId(op, openid)
+		registered := false
 		if user == nil {
 			oauthConfig := oauthService.InfoByOp(op)
-			if !*oauthConfig.AutoRegister {
+			// 注册链接发起的授权允许自动注册
+			if !*oauthConfig.AutoRegister && oauthCache.EnrollToken == "" {
 				//c.String(http.StatusInternalServerError, "还未绑定用户，请先绑定")
 				oauthCache.UpdateFromOauthUser(oauthUser)
 				c.Redirect(http.StatusFound, "/_admin/#/oauth/bind/"+cacheKey)
@@ -232,6 +234,7 @@ func (o *Oauth) OauthCallback(c *gin.Context) {
 			}
 
 			//自动注册
+			registered = service.AllService.EnrollmentService.IsNewOauthUser(oauthUser)
 			err, user = service.AllService.UserService.RegisterByOauth(oauthUser, op)
 			if err != nil {
 				c.HTML(http.StatusOK, "oauth_fail.html", gin.H{
@@ -240,6 +243,20 @@ func (o *Oauth) OauthCallback(c *gin.Context) {
 				return
 			}
 		}
+		if oauthCache.EnrollToken != "" {
+			err = service.AllService.EnrollmentService.EnrollOauth(oauthCache.EnrollToken, user, registered, &service.ConfigCodeRedeemer{
+				ClientIP:  c.ClientIP(),
+				UserAgent: c.GetHeader("User-Agent"),
+				DeviceId:  oauthCache.Id,
+				Uuid:      oauthCache.Uuid,
+			})
+			if err != nil {
+				c.HTML(http.StatusOK, "oauth_fail.html", gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+		}
 		oauthCache.UserId = user.Id
 		oauthService.SetOauthCache(cacheKey, oauthCache, 0)
 		// 如果是webadmin，登录成功后跳转到webadmin
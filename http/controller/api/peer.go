@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
+	"github.com/lejianwen/rustdesk-api/v2/global"
 	requstform "github.com/lejianwen/rustdesk-api/v2/http/request/api"
 	"github.com/lejianwen/rustdesk-api/v2/http/response"
 	"github.com/lejianwen/rustdesk-api/v2/service"
@@ -35,6 +36,10 @@ func (p *Peer) SysInfo(c *gin.Context) {
 	if pe.RowId == 0 {
 		pe = f.ToPeer()
 		pe.UserId = service.AllService.UserService.FindLatestUserIdFromLoginLogByUuid(pe.Uuid, pe.Id)
+		// 通过注册链接注册的设备首次上报时分配设备组
+		service.AllService.EnrollmentService.ApplyOnSysInfo(pe)
+		// 未被注册链接分配时按规则自动分配设备组
+		service.AllService.DeviceGroupRuleService.Assign(pe, c.ClientIP())
 		err = service.AllService.PeerService.Create(pe)
 		if err != nil {
 			response.Error(c, response.TranslateMsg(c, "OperationFailed")+err.Error())
@@ -46,11 +51,19 @@ func (p *Peer) SysInfo(c *gin.Context) {
 		}
 		fpe.RowId = pe.RowId
 		fpe.UserId = pe.UserId
+		// 记录硬件/软件信息的变更历史
+		if err = service.AllService.PeerInventoryService.Record(pe, fpe); err != nil {
+			global.Logger.Warn("record peer inventory failed: " + err.Error())
+		}
 		err = service.AllService.PeerService.Update(fpe)
 		if err != nil {
 			response.Error(c, response.TranslateMsg(c, "OperationFailed")+err.Error())
 			return
 		}
+		// 主机名、系统等变化后重新匹配设备组规则
+		fpe.GroupId = pe.GroupId
+		fpe.GroupRuleId = pe.GroupRuleId
+		service.AllService.DeviceGroupRuleService.Assign(fpe, c.ClientIP())
 	}
 	//SYSINFO_UPDATED 上传成功
 	//ID_NOT_FOUND 下次心跳会上传
@@ -72,5 +85,9 @@ func (p *Peer) SysInfoVer(c *gin.Context) {
 	v := service.AllService.AppService.GetAppVersion()
 	// 加上启动时间，方便client上传信息
 	v = fmt.Sprintf("%s\n%s", v, service.AllService.AppService.GetStartTime())
+	// 设备组配置了推荐版本时附带在最后一行, 推荐版本变化时客户端会重新上传信息
+	if rv := service.AllService.ClientVersionService.RecommendedVersion(nil); rv != "" {
+		v = fmt.Sprintf("%s\n%s", v, rv)
+	}
 	c.String(http.StatusOK, v)
 }
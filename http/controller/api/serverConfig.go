@@ -1,7 +1,12 @@
 package api
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	requstform "github.com/lejianwen/rustdesk-api/v2/http/request/api"
+	apiResp "github.com/lejianwen/rustdesk-api/v2/http/response/api"
+	"github.com/lejianwen/rustdesk-api/v2/model"
 	"github.com/lejianwen/rustdesk-api/v2/http/response"
 	"github.com/lejianwen/rustdesk-api/v2/service"
 )
@@ -15,6 +20,8 @@ type ServerConfig struct{}
 // @Accept json
 // @Produce json
 // @Param code path string true "配置码"
+// @Param id query string false "设备ID"
+// @Param uuid query string false "设备UUID, 绑定设备的配置码必填"
 // @Success 200 {object} response.Response{data=model.ClientServerConfig}
 // @Failure 400 {object} response.Response
 // @Failure 404 {object} response.Response
@@ -27,22 +34,13 @@ func (ct *ServerConfig) GetConfigByCode(c *gin.Context) {
 		return
 	}
 
-	// 获取客户端信息
-	clientIP := c.ClientIP()
-	userAgent := c.GetHeader("User-Agent")
-
-	// 获取配置
-	config, err := service.AllService.ServerConfigService.GetConfigByCode(code)
+	// 获取配置, 同时记录使用情况
+	config, err := service.AllService.ServerConfigService.GetConfigByCode(code, ct.redeemer(c))
 	if err != nil {
 		response.Fail(c, 404, err.Error())
 		return
 	}
 
-	// 记录使用情况
-	go func() {
-		service.AllService.ServerConfigService.RecordConfigCodeUsage(code, clientIP, userAgent)
-	}()
-
 	response.Success(c, config)
 }
 
@@ -53,6 +51,8 @@ func (ct *ServerConfig) GetConfigByCode(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param code path string true "配置码"
+// @Param id query string false "设备ID"
+// @Param uuid query string false "设备UUID"
 // @Success 200 {object} response.Response{data=map[string]interface{}}
 // @Failure 400 {object} response.Response
 // @Failure 404 {object} response.Response
@@ -65,7 +65,7 @@ func (ct *ServerConfig) ValidateConfigCode(c *gin.Context) {
 	}
 
 	// 只验证配置码，不记录使用
-	_, err := service.AllService.ServerConfigService.GetConfigByCode(code)
+	_, err := service.AllService.ServerConfigService.CheckConfigCode(code, ct.redeemer(c))
 	if err != nil {
 		response.Fail(c, 404, err.Error())
 		return
@@ -76,3 +76,92 @@ func (ct *ServerConfig) ValidateConfigCode(c *gin.Context) {
 		"message": "Config code is valid",
 	})
 }
+
+// SigningKeys 配置码验签公钥
+// @Tags 客户端配置
+// @Summary 配置码验签公钥
+// @Description 返回当前和轮换后仍有效的 Ed25519 公钥, 供安装程序使用 lib/configcode 离线校验
+// @Accept json
+// @Produce json
+// @Success 200 {object} []configcode.PublicKey
+// @Router /api/config-code/keys [get]
+func (ct *ServerConfig) SigningKeys(c *gin.Context) {
+	if _, err := service.AllService.ConfigSigningService.ActiveKey(); err != nil {
+		response.Fail(c, 500, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, service.AllService.ConfigSigningService.PublicKeys())
+}
+
+// VerifyConfigCode 校验签名配置码
+// @Tags 客户端配置
+// @Summary 校验签名配置码
+// @Description 校验签名、有效期和受众, 并返回服务端记录的状态
+// @Accept json
+// @Produce json
+// @Param body body api.ConfigCodeVerifyForm true "签名配置码"
+// @Success 200 {object} response.Response{data=api.ConfigCodeVerifyResponse}
+// @Failure 400 {object} response.Response
+// @Router /api/config-code/verify [post]
+func (ct *ServerConfig) VerifyConfigCode(c *gin.Context) {
+	f := &requstform.ConfigCodeVerifyForm{}
+	if err := c.ShouldBindJSON(f); err != nil || f.Code == "" {
+		response.Fail(c, 400, "Config code is required")
+		return
+	}
+	res := &apiResp.ConfigCodeVerifyResponse{}
+	claims, err := service.AllService.ConfigSigningService.Verify(f.Code, f.Audience)
+	if claims != nil {
+		res.Kid = claims.Kid
+		res.Code = claims.Jti
+		res.Audience = claims.Audience
+		res.ExpiresAt = claims.Expires
+	}
+	if err != nil {
+		res.Error = err.Error()
+		response.Success(c, res)
+		return
+	}
+	// 签名有效时再检查服务端是否已停用
+	cc := service.AllService.ServerConfigService.InfoByCode(claims.Jti)
+	res.Revoked = cc.Id == 0 || cc.Status != model.COMMON_STATUS_ENABLE
+	res.Valid = !res.Revoked
+	response.Success(c, res)
+}
+
+// redeemer 兑换方信息, 带有效 Authorization 时附带登录用户, 用于按用户/用户组限制的配置码
+func (ct *ServerConfig) redeemer(c *gin.Context) *service.ConfigCodeRedeemer {
+	r := &service.ConfigCodeRedeemer{
+		ClientIP:  c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		DeviceId:  c.Query("id"),
+		Uuid:      c.Query("uuid"),
+	}
+	r.User = service.AllService.UserService.CurUser(c)
+	return r
+}
+
+// Select 为客户端选择服务器配置
+// @Tags 客户端配置
+// @Summary 选择服务器配置
+// @Description 按客户端IP地域、登录用户的用户组和优先级选择最佳服务器配置, 同时返回备选配置
+// @Accept json
+// @Produce json
+// @Success 200 {object} response.Response{data=api.ServerConfigSelectResponse}
+// @Failure 500 {object} response.Response
+// @Router /api/server-config/select [get]
+func (ct *ServerConfig) Select(c *gin.Context) {
+	region, list := service.AllService.ServerConfigService.SelectForClient(c.ClientIP(), service.AllService.UserService.CurUser(c))
+	res := &apiResp.ServerConfigSelectResponse{Region: region, Fallbacks: []*model.ClientServerConfig{}}
+	for i, sc := range list {
+		if i == 0 {
+			res.Config = sc.ToClientConfig()
+			continue
+		}
+		res.Fallbacks = append(res.Fallbacks, sc.ToClientConfig())
+	}
+	if res.Config == nil {
+		res.Config = service.AllService.ServerConfigService.ClientConfigFor(c.ClientIP(), nil)
+	}
+	response.Success(c, res)
+}
@@ -2,11 +2,10 @@ package api
 
 import (
 	"github.com/gin-gonic/gin"
-	"github.com/lejianwen/rustdesk-api/v2/global"
 	"github.com/lejianwen/rustdesk-api/v2/http/response"
 	"github.com/lejianwen/rustdesk-api/v2/http/response/api"
+	"github.com/lejianwen/rustdesk-api/v2/model"
 	"github.com/lejianwen/rustdesk-api/v2/service"
-	"time"
 )
 
 type WebClient struct {
@@ -26,18 +25,26 @@ func (i *WebClient) ServerConfig(c *gin.Context) {
 	u := service.AllService.UserService.CurUser(c)
 
 	peers := map[string]*api.WebClientPeerPayload{}
-	abs := service.AllService.AddressBookService.ListByUserIdAndCollectionId(u.Id, 0, 1, 100)
-	for _, ab := range abs.AddressBooks {
-		pp := &api.WebClientPeerPayload{}
-		pp.FromAddressBook(ab)
-		peers[ab.Id] = pp
+	err := service.AllService.AddressBookService.EachByUserIdAndCollectionId(u.Id, 0, int(service.AllService.AddressBookService.MaxPageSize()), func(abs []*model.AddressBook) error {
+		for _, ab := range abs {
+			pp := &api.WebClientPeerPayload{}
+			pp.FromAddressBook(ab)
+			peers[ab.Id] = pp
+		}
+		return nil
+	})
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, "OperationFailed")+err.Error())
+		return
 	}
+	sc := service.AllService.ServerConfigService.ClientConfigFor(c.ClientIP(), u)
 	response.Success(
 		c,
 		gin.H{
-			"id_server": global.Config.Rustdesk.IdServer,
-			"key":       global.Config.Rustdesk.Key,
-			"peers":     peers,
+			"id_server":    sc.IdServer,
+			"relay_server": sc.RelayServer,
+			"key":          sc.Key,
+			"peers":        peers,
 		},
 	)
 }
@@ -45,33 +52,27 @@ func (i *WebClient) ServerConfig(c *gin.Context) {
 // SharedPeer 分享的peer
 // @Tags WEBCLIENT
 // @Summary 分享的peer
-// @Description 分享的peer
+// @Description 分享的peer, 链接限定了接收人时需要以接收人账号登录
 // @Accept  json
 // @Produce  json
+// @Param body body object true "{share_token}"
 // @Success 200 {object} response.Response
 // @Failure 500 {object} response.Response
 // @Router /shared-peer [post]
 func (i *WebClient) SharedPeer(c *gin.Context) {
 	j := &gin.H{}
 	c.ShouldBindJSON(j)
-	t := (*j)["share_token"].(string)
+	t, _ := (*j)["share_token"].(string)
 	if t == "" {
 		response.Fail(c, 101, "share_token is required")
 		return
 	}
-	sr := service.AllService.AddressBookService.SharedPeer(t)
-	if sr == nil || sr.Id == 0 {
-		response.Fail(c, 101, "share not found")
+	u := service.AllService.UserService.CurUser(c)
+	sr, err := service.AllService.ShareRecordService.Use(t, c.ClientIP(), c.Request.UserAgent(), u)
+	if err != nil {
+		response.Fail(c, 101, response.TranslateMsg(c, err.Error()))
 		return
 	}
-	if sr.Expire != 0 {
-		//判断是否过期,created_at + expire > now
-		ca := time.Time(sr.CreatedAt)
-		if ca.Add(time.Second * time.Duration(sr.Expire)).Before(time.Now()) {
-			response.Fail(c, 101, "share expired")
-			return
-		}
-	}
 
 	ab := service.AllService.AddressBookService.InfoByUserIdAndId(sr.UserId, sr.PeerId)
 	if ab.RowId == 0 {
@@ -82,10 +83,12 @@ func (i *WebClient) SharedPeer(c *gin.Context) {
 	pp.FromShareRecord(sr)
 	pp.Info.Username = ab.Username
 	pp.Info.Hostname = ab.Hostname
+	sc := service.AllService.ServerConfigService.ClientConfigFor(c.ClientIP(), nil)
 	response.Success(c, gin.H{
-		"id_server": global.Config.Rustdesk.IdServer,
-		"key":       global.Config.Rustdesk.Key,
-		"peer":      pp,
+		"id_server":    sc.IdServer,
+		"relay_server": sc.RelayServer,
+		"key":          sc.Key,
+		"peer":         pp,
 	})
 }
 
@@ -100,11 +103,14 @@ func (i *WebClient) SharedPeer(c *gin.Context) {
 // @Router /server-config-v2 [get]
 // @Security token
 func (i *WebClient) ServerConfigV2(c *gin.Context) {
+	u := service.AllService.UserService.CurUser(c)
+	sc := service.AllService.ServerConfigService.ClientConfigFor(c.ClientIP(), u)
 	response.Success(
 		c,
 		gin.H{
-			"id_server": global.Config.Rustdesk.IdServer,
-			"key":       global.Config.Rustdesk.Key,
+			"id_server":    sc.IdServer,
+			"relay_server": sc.RelayServer,
+			"key":          sc.Key,
 		},
 	)
 }
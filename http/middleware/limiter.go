@@ -4,6 +4,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/lejianwen/rustdesk-api/v2/global"
 	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/service"
 	"net/http"
 )
 
@@ -12,7 +13,7 @@ func Limiter() gin.HandlerFunc {
 		loginLimiter := global.LoginLimiter
 		clientIp := c.ClientIP()
 		banned, _ := loginLimiter.CheckSecurityStatus(clientIp)
-		if banned {
+		if banned || service.AllService.IpBlockService.IsBlocked(clientIp) {
 			response.Fail(c, http.StatusLocked, response.TranslateMsg(c, "Banned"))
 			c.Abort()
 			return
@@ -9,61 +9,57 @@ import (
 func RustAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		//fmt.Println(c.Request.URL, c.Request.Header)
-		//获取HTTP_AUTHORIZATION
-		token := c.GetHeader("Authorization")
-		if token == "" {
+		if !rustAuthUser(c) {
 			c.JSON(401, gin.H{
 				"error": "Unauthorized",
 			})
 			c.Abort()
 			return
 		}
-		if len(token) <= 7 {
-			c.JSON(401, gin.H{
-				"error": "Unauthorized",
-			})
-			c.Abort()
-			return
-		}
-		//提取token，格式是Bearer {token}
-		//这里只是简单的提取
-		token = token[7:]
+		c.Next()
+	}
+}
 
-		//验证token
+// RustAuthOptional 带了有效 token 时设置当前用户, 没有或无效时按未登录继续
+func RustAuthOptional() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rustAuthUser(c)
+		c.Next()
+	}
+}
 
-		//检查是否设置了jwt key
-		if len(global.Jwt.Key) > 0 {
-			uid, _ := service.AllService.UserService.VerifyJWT(token)
-			if uid == 0 {
-				c.JSON(401, gin.H{
-					"error": "Unauthorized",
-				})
-				c.Abort()
-				return
-			}
-		}
+// rustAuthUser 校验 token 并设置当前用户
+func rustAuthUser(c *gin.Context) bool {
+	//获取HTTP_AUTHORIZATION
+	token := c.GetHeader("Authorization")
+	if len(token) <= 7 {
+		return false
+	}
+	//提取token，格式是Bearer {token}
+	//这里只是简单的提取
+	token = token[7:]
 
-		user, ut := service.AllService.UserService.InfoByAccessToken(token)
-		if user.Id == 0 {
-			c.JSON(401, gin.H{
-				"error": "Unauthorized",
-			})
-			c.Abort()
-			return
-		}
-		if !service.AllService.UserService.CheckUserEnable(user) {
-			c.JSON(401, gin.H{
-				"error": "Unauthorized",
-			})
-			c.Abort()
-			return
+	//验证token
+
+	//检查是否设置了jwt key
+	if len(global.Jwt.Key) > 0 {
+		uid, _ := service.AllService.UserService.VerifyJWT(token)
+		if uid == 0 {
+			return false
 		}
+	}
 
-		c.Set("curUser", user)
-		c.Set("token", token)
+	user, ut := service.AllService.UserService.InfoByAccessToken(token)
+	if user.Id == 0 {
+		return false
+	}
+	if !service.AllService.UserService.CheckUserEnable(user) {
+		return false
+	}
 
-		service.AllService.UserService.AutoRefreshAccessToken(ut)
+	c.Set("curUser", user)
+	c.Set("token", token)
 
-		c.Next()
-	}
+	service.AllService.UserService.AutoRefreshAccessToken(ut)
+	return true
 }
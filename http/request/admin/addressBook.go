@@ -2,6 +2,8 @@ package admin
 
 import (
 	"encoding/json"
+	"strings"
+
 	"github.com/lejianwen/rustdesk-api/v2/model"
 )
 
@@ -95,15 +97,22 @@ type ShareByWebClientForm struct {
 	PasswordType string `json:"password_type" validate:"required,oneof=once fixed"` //只能是once,fixed
 	Password     string `json:"password" validate:"required"`
 	Expire       int64  `json:"expire"`
+	// 最大使用次数, 0 不限制
+	MaxUses        int    `json:"max_uses" validate:"gte=0"`
+	RevokeOnUse    bool   `json:"revoke_on_use"`
+	RecipientEmail string `json:"recipient_email" validate:"omitempty,email"`
 }
 
 func (sbwcf ShareByWebClientForm) ToShareRecord() *model.ShareRecord {
 	return &model.ShareRecord{
-		UserId:       0,
-		PeerId:       sbwcf.Id,
-		PasswordType: sbwcf.PasswordType,
-		Password:     sbwcf.Password,
-		Expire:       sbwcf.Expire,
+		UserId:         0,
+		PeerId:         sbwcf.Id,
+		PasswordType:   sbwcf.PasswordType,
+		Password:       sbwcf.Password,
+		Expire:         sbwcf.Expire,
+		MaxUses:        sbwcf.MaxUses,
+		RevokeOnUse:    sbwcf.RevokeOnUse,
+		RecipientEmail: strings.TrimSpace(sbwcf.RecipientEmail),
 	}
 }
 
@@ -113,6 +122,22 @@ type AddressBookCollectionQuery struct {
 	PageQuery
 }
 
+type AddressBookCollectionTreeQuery struct {
+	UserId uint `form:"user_id"`
+}
+
+// AddressBookCollectionMoveForm 修改上级, parent_id 为 0 时移到顶层
+type AddressBookCollectionMoveForm struct {
+	Id       uint `json:"id" validate:"required,gt=0"`
+	ParentId uint `json:"parent_id"`
+}
+
+// AddressBookCollectionDeleteForm 删除地址簿, policy 为对下级地址簿的处理, 默认 restrict
+type AddressBookCollectionDeleteForm struct {
+	Id     uint   `json:"id" validate:"required,gt=0"`
+	Policy string `json:"policy" validate:"omitempty,oneof=restrict cascade reparent"`
+}
+
 type AddressBookCollectionSimpleListQuery struct {
 	UserIds []uint `form:"user_ids"`
 }
@@ -133,3 +158,27 @@ type BatchUpdateTagsForm struct {
 	RowIds []uint   `json:"row_ids"`
 	Tags   []string `json:"tags"`
 }
+
+type SmartCollectionPreviewForm struct {
+	UserId    uint             `json:"user_id" validate:"required,gt=0"`
+	PeerQuery *model.PeerQuery `json:"peer_query" validate:"required"`
+	Page      uint             `json:"page"`
+	PageSize  uint             `json:"page_size"`
+}
+
+// AddressBookImportForm 导入地址簿, content 为文件内容
+type AddressBookImportForm struct {
+	UserId       uint              `json:"user_id"`
+	CollectionId uint              `json:"collection_id"`
+	Format       string            `json:"format" validate:"required,oneof=csv json rustdesk"`
+	Content      string            `json:"content" validate:"required"`
+	Mapping      map[string]string `json:"mapping"` // 字段 => 列, 为空时按列名自动识别
+	Strategy     string            `json:"strategy" validate:"omitempty,oneof=skip overwrite duplicate"`
+}
+
+type AddressBookExportQuery struct {
+	UserId       uint   `form:"user_id"`
+	CollectionId uint   `form:"collection_id"`
+	Format       string `form:"format" validate:"required,oneof=csv json rustdesk"`
+	Secrets      bool   `form:"secrets"` // 是否包含密码和 hash
+}
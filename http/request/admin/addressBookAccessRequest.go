@@ -0,0 +1,28 @@
+package admin
+
+type AddressBookAccessRequestQuery struct {
+	UserId       uint   `form:"user_id"`
+	OwnerId      uint   `form:"owner_id"`
+	CollectionId uint   `form:"collection_id"`
+	Status       string `form:"status"`
+	Incoming     int    `form:"incoming"` // 个人中心: 1 为别人对我的地址簿的申请, 0 为我提交的申请
+	PageQuery
+}
+
+// AddressBookAccessRequestForm 申请访问地址簿
+type AddressBookAccessRequestForm struct {
+	CollectionId uint   `json:"collection_id" validate:"required,gt=0"`
+	Rule         int    `json:"rule" validate:"required,gte=1,lte=3"`
+	StartAt      int64  `json:"start_at" validate:"gte=0"`
+	EndAt        int64  `json:"end_at" validate:"gte=0"`
+	Reason       string `json:"reason" validate:"max=512"`
+}
+
+// AddressBookAccessDecisionForm 审批或撤回申请, 批准时可以调整权限和有效期, 不传则使用申请的值
+type AddressBookAccessDecisionForm struct {
+	Id      uint   `json:"id" validate:"required,gt=0"`
+	Rule    int    `json:"rule" validate:"omitempty,gte=1,lte=3"`
+	StartAt *int64 `json:"start_at" validate:"omitempty,gte=0"`
+	EndAt   *int64 `json:"end_at" validate:"omitempty,gte=0"`
+	Note    string `json:"note" validate:"max=512"`
+}
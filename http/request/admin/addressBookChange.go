@@ -0,0 +1,20 @@
+package admin
+
+type AddressBookChangeQuery struct {
+	PageQuery
+	UserId       uint   `form:"user_id"`
+	CollectionId *uint  `form:"collection_id"`
+	Target       string `form:"target" binding:"omitempty,oneof=peer tag collection"`
+	TargetKey    string `form:"target_key"`
+	Source       string `form:"source"`
+	ActorId      uint   `form:"actor_id"`
+	Since        int64  `form:"since"`
+	Until        int64  `form:"until"`
+}
+
+// AddressBookRestoreForm 按时间点恢复, CollectionId 为 0 表示个人地址簿
+type AddressBookRestoreForm struct {
+	UserId       uint  `json:"user_id"`
+	CollectionId uint  `json:"collection_id"`
+	At           int64 `json:"at" validate:"required,gt=0"`
+}
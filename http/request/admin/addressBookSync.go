@@ -0,0 +1,23 @@
+package admin
+
+type AddressBookSyncQuery struct {
+	PageQuery
+	UserId uint   `form:"user_id"`
+	Action string `form:"action"`
+}
+
+type AddressBookSyncRestoreForm struct {
+	UserId   uint `json:"user_id" validate:"required,gt=0"`
+	Revision uint `json:"revision" validate:"required,gt=0"`
+}
+
+type AddressBookTombstoneQuery struct {
+	PageQuery
+	UserId   uint   `form:"user_id"`
+	PeerId   string `form:"peer_id"`
+	Restored int    `form:"restored"` // 0 全部 1 已恢复 2 未恢复
+}
+
+type AddressBookTombstoneForm struct {
+	Id uint `json:"id"`
+}
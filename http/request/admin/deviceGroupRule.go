@@ -0,0 +1,44 @@
+package admin
+
+import "github.com/lejianwen/rustdesk-api/v2/model"
+
+type DeviceGroupRuleForm struct {
+	Id            uint             `json:"id"`
+	Name          string           `json:"name" validate:"required"`
+	DeviceGroupId uint             `json:"device_group_id" validate:"required,gt=0"`
+	Priority      int              `json:"priority"`
+	HostnameRegex string           `json:"hostname_regex" validate:"omitempty,max=255"`
+	Os            string           `json:"os"`
+	UserGroupId   uint             `json:"user_group_id"`
+	Cidr          string           `json:"cidr"`
+	Tag           string           `json:"tag"`
+	PeerLabel     string           `json:"peer_label"`
+	PeerAttribute string           `json:"peer_attribute"`
+	Status        model.StatusCode `json:"status"`
+}
+
+func (f *DeviceGroupRuleForm) ToDeviceGroupRule() *model.DeviceGroupRule {
+	r := &model.DeviceGroupRule{
+		Name:          f.Name,
+		DeviceGroupId: f.DeviceGroupId,
+		Priority:      f.Priority,
+		HostnameRegex: f.HostnameRegex,
+		Os:            f.Os,
+		UserGroupId:   f.UserGroupId,
+		Cidr:          f.Cidr,
+		Tag:           f.Tag,
+		PeerLabel:     f.PeerLabel,
+		PeerAttribute: f.PeerAttribute,
+		Status:        f.Status,
+	}
+	r.Id = f.Id
+	if r.Status == 0 {
+		r.Status = model.COMMON_STATUS_ENABLE
+	}
+	return r
+}
+
+type DeviceGroupRuleQuery struct {
+	DeviceGroupId uint `form:"device_group_id"`
+	PageQuery
+}
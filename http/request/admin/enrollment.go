@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+type EnrollmentLinkForm struct {
+	Id             uint             `json:"id"`
+	Name           string           `json:"name" validate:"required"`
+	GroupId        uint             `json:"group_id"`
+	DeviceGroupId  uint             `json:"device_group_id"`
+	ServerConfigId uint             `json:"server_config_id" validate:"required,gt=0"`
+	AllowRegister  *bool            `json:"allow_register"`
+	AllowOauth     *bool            `json:"allow_oauth"`
+	ExpiresAt      *time.Time       `json:"expires_at"`
+	MaxUses        int              `json:"max_uses" validate:"gte=0"`
+	Status         model.StatusCode `json:"status"`
+}
+
+func (f *EnrollmentLinkForm) ToEnrollmentLink() *model.EnrollmentLink {
+	enable := true
+	l := &model.EnrollmentLink{
+		Name:           f.Name,
+		GroupId:        f.GroupId,
+		DeviceGroupId:  f.DeviceGroupId,
+		ServerConfigId: f.ServerConfigId,
+		AllowRegister:  f.AllowRegister,
+		AllowOauth:     f.AllowOauth,
+		ExpiresAt:      f.ExpiresAt,
+		MaxUses:        f.MaxUses,
+		Status:         f.Status,
+	}
+	l.Id = f.Id
+	if l.AllowRegister == nil {
+		l.AllowRegister = &enable
+	}
+	if l.AllowOauth == nil {
+		l.AllowOauth = &enable
+	}
+	if l.Status == 0 {
+		l.Status = model.COMMON_STATUS_ENABLE
+	}
+	return l
+}
+
+type EnrollmentRecordQuery struct {
+	EnrollmentLinkId uint `form:"enrollment_link_id"`
+	PageQuery
+}
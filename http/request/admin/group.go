@@ -24,13 +24,25 @@ func (gf *GroupForm) ToGroup() *model.Group {
 }
 
 type DeviceGroupForm struct {
-	Id   uint   `json:"id"`
-	Name string `json:"name" validate:"required"`
+	Id                 uint   `json:"id"`
+	Name               string `json:"name" validate:"required"`
+	MinVersion         string `json:"min_version" validate:"omitempty,max=32"`
+	RecommendedVersion string `json:"recommended_version" validate:"omitempty,max=32"`
+	EnforceVersion     bool   `json:"enforce_version"`
 }
 
 func (gf *DeviceGroupForm) ToDeviceGroup() *model.DeviceGroup {
 	group := &model.DeviceGroup{}
 	group.Id = gf.Id
 	group.Name = gf.Name
+	group.MinVersion = gf.MinVersion
+	group.RecommendedVersion = gf.RecommendedVersion
+	group.EnforceVersion = gf.EnforceVersion
 	return group
 }
+
+type ClientComplianceQuery struct {
+	DeviceGroupId uint   `form:"device_group_id"`
+	Status        string `form:"status"` // 为空时返回 outdated 和 noncompliant
+	PageQuery
+}
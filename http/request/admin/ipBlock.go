@@ -0,0 +1,37 @@
+package admin
+
+import "github.com/lejianwen/rustdesk-api/v2/model"
+
+type IpBlockForm struct {
+	Id        uint   `json:"id"`
+	Cidr      string `json:"cidr" validate:"required"`
+	Reason    string `json:"reason"`
+	ExpiredAt int64  `json:"expired_at" validate:"gte=0"`
+}
+
+func (f *IpBlockForm) ToIpBlock() *model.IpBlock {
+	b := &model.IpBlock{
+		Cidr:      f.Cidr,
+		Reason:    f.Reason,
+		Source:    model.IpBlockSourceManual,
+		ExpiredAt: f.ExpiredAt,
+	}
+	b.Id = f.Id
+	return b
+}
+
+type IpBlockQuery struct {
+	Cidr   string `form:"cidr"`
+	Source string `form:"source"`
+	PageQuery
+}
+
+type IpBlockIds struct {
+	Ids []uint `json:"ids" validate:"required"`
+}
+
+type IpBlockImportForm struct {
+	Cidrs     []string `json:"cidrs" validate:"required"`
+	Reason    string   `json:"reason"`
+	ExpiredAt int64    `json:"expired_at" validate:"gte=0"`
+}
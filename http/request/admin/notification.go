@@ -0,0 +1,11 @@
+package admin
+
+type NotificationQuery struct {
+	Unread int `form:"unread"` // 1 只看未读
+	PageQuery
+}
+
+// NotificationReadForm 标记已读, ids 为空时全部标记
+type NotificationReadForm struct {
+	Ids []uint `json:"ids"`
+}
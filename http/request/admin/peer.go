@@ -39,15 +39,70 @@ func (f *PeerForm) ToPeer() *model.Peer {
 
 type PeerQuery struct {
 	PageQuery
-	TimeAgo  int    `json:"time_ago" form:"time_ago"`
-	Id       string `json:"id" form:"id"`
-	Hostname string `json:"hostname" form:"hostname"`
-	Uuids    string `json:"uuids" form:"uuids"`
-	Ip       string `json:"ip" form:"ip"`
-	Username string `json:"username" form:"username"`
-	Alias    string `json:"alias" form:"alias"`
+	TimeAgo  int      `json:"time_ago" form:"time_ago"`
+	Id       string   `json:"id" form:"id"`
+	Hostname string   `json:"hostname" form:"hostname"`
+	Uuids    string   `json:"uuids" form:"uuids"`
+	Ip       string   `json:"ip" form:"ip"`
+	Username string   `json:"username" form:"username"`
+	Alias    string   `json:"alias" form:"alias"`
+	Labels   string   `json:"labels" form:"labels"` // 逗号分隔, 须全部带有
+	Attrs    []string `json:"attrs" form:"attr"`    // name=value 或 name~value, 可重复
+}
+
+type PeerLabelsForm struct {
+	RowId  uint     `json:"row_id" validate:"required,gt=0"`
+	Labels []string `json:"labels"`
+}
+
+type PeerBatchLabelsForm struct {
+	RowIds []uint   `json:"row_ids" validate:"required"`
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+type PeerAttributesForm struct {
+	RowId      uint              `json:"row_id" validate:"required,gt=0"`
+	Attributes map[string]string `json:"attributes" validate:"required"` // 值为空时删除
+}
+
+type PeerAttributeDefinitionForm struct {
+	Id    uint   `json:"id"`
+	Name  string `json:"name" validate:"required,max=64"`
+	Title string `json:"title"`
+	Type  string `json:"type" validate:"omitempty,oneof=string number bool date email"`
+}
+
+func (f *PeerAttributeDefinitionForm) ToPeerAttributeDefinition() *model.PeerAttributeDefinition {
+	d := &model.PeerAttributeDefinition{
+		Name:  f.Name,
+		Title: f.Title,
+		Type:  f.Type,
+	}
+	d.Id = f.Id
+	return d
 }
 
 type SimpleDataQuery struct {
 	Ids []string `json:"ids" form:"ids"`
 }
+
+type PeerDuplicateQuery struct {
+	MinScore int `form:"min_score"`
+}
+
+// PeerMergeForm 把 Ids 对应的设备合并到 RowId, Ids 也可以是只在地址簿中引用的 id
+type PeerMergeForm struct {
+	RowId uint     `json:"row_id" validate:"required,gt=0"`
+	Ids   []string `json:"ids" validate:"required,min=1"`
+}
+
+type PeerAliasQuery struct {
+	AliasId   string `form:"alias_id"`
+	PeerRowId uint   `form:"peer_row_id"`
+	PageQuery
+}
+
+type PeerAliasForm struct {
+	Id uint `json:"id" validate:"required,gt=0"`
+}
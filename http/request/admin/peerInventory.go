@@ -0,0 +1,24 @@
+package admin
+
+type PeerInventoryQuery struct {
+	PageQuery
+	PeerRowId uint   `form:"peer_row_id"`
+	PeerId    string `form:"peer_id"`
+	Field     string `form:"field" binding:"omitempty,oneof=cpu memory os hostname username version"`
+	Since     int64  `form:"since"`
+	Until     int64  `form:"until"`
+}
+
+// PeerFleetQuery 按 SysInfo 字段查询设备
+// Value 匹配当前值, ChangedSince/ChangedUntil 查询时间范围内该字段发生过变更的设备
+type PeerFleetQuery struct {
+	PageQuery
+	Field        string `form:"field" binding:"required,oneof=cpu memory os hostname username version"`
+	Value        string `form:"value"`
+	ChangedSince int64  `form:"changed_since"`
+	ChangedUntil int64  `form:"changed_until"`
+}
+
+type PeerInventorySummaryQuery struct {
+	Field string `form:"field" binding:"required,oneof=cpu memory os hostname username version"`
+}
@@ -0,0 +1,13 @@
+package admin
+
+type RelayUsageQuery struct {
+	EndpointId *uint `form:"endpoint_id"`
+	PageQuery
+}
+
+type RelayUsageSeriesQuery struct {
+	EndpointId *uint `form:"endpoint_id"`
+	Since      int64 `form:"since"`
+	Until      int64 `form:"until"`
+	Step       int64 `form:"step"`
+}
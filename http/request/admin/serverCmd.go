@@ -0,0 +1,35 @@
+package admin
+
+import "github.com/lejianwen/rustdesk-api/v2/model"
+
+// ServerCmdEndpointForm 命令端点表单, 更新时 Secret 为空且 ClearSecret 为 false 表示保留原值
+type ServerCmdEndpointForm struct {
+	Id             uint             `json:"id"`
+	Name           string           `json:"name" validate:"required"`
+	Host           string           `json:"host"`
+	Port           int              `json:"port" validate:"gte=0,lte=65535"`
+	Target         string           `json:"target" validate:"required,oneof=21115 21117"`
+	Secret         string           `json:"secret"`
+	ClearSecret    bool             `json:"clear_secret"`
+	ServerConfigId uint             `json:"server_config_id"`
+	Status         model.StatusCode `json:"status"`
+}
+
+func (f *ServerCmdEndpointForm) ToServerCmdEndpoint() *model.ServerCmdEndpoint {
+	e := &model.ServerCmdEndpoint{
+		Name:           f.Name,
+		Host:           f.Host,
+		Port:           f.Port,
+		Target:         f.Target,
+		Secret:         f.Secret,
+		ServerConfigId: f.ServerConfigId,
+		Status:         f.Status,
+	}
+	e.Id = f.Id
+	return e
+}
+
+// UpdateSecret 更新时是否写入 Secret
+func (f *ServerCmdEndpointForm) UpdateSecret() bool {
+	return f.Secret != "" || f.ClearSecret
+}
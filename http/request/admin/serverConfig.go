@@ -17,6 +17,9 @@ type ServerConfigForm struct {
 	IsEnabled   *bool  `json:"is_enabled" label:"是否启用"`
 	IsDefault   *bool  `json:"is_default" label:"是否为默认配置"`
 	Priority    int    `json:"priority" label:"优先级"`
+	GroupIds    []uint `json:"group_ids" label:"限定用户组"`
+	// 修改密钥时旧密钥继续下发的秒数, 0 表示立即替换
+	KeyGracePeriod int64 `json:"key_grace_period" binding:"gte=0" label:"密钥轮换宽限期"`
 }
 
 // ServerConfigListQuery 服务器配置列表查询
@@ -33,6 +36,9 @@ type ConfigCodeForm struct {
 	ServerConfigId uint       `json:"server_config_id" binding:"required,min=1" label:"服务器配置ID"`
 	ExpiresAt      *time.Time `json:"expires_at" label:"过期时间"`
 	MaxUsage       *int       `json:"max_usage" binding:"omitempty,min=1" label:"最大使用次数"`
+	Audience       string     `json:"audience" label:"签名受众"` // 为空时使用 rustdesk.api-server
+	model.ConfigCodeBinding
+	RevisionId uint `json:"revision_id" label:"固定配置修订"` // 0 表示始终使用最新配置
 }
 
 // ConfigCodeListQuery 配置码列表查询
@@ -49,6 +55,52 @@ type ConfigCodeBatchForm struct {
 	Count          int        `json:"count" binding:"required,min=1,max=100" label:"生成数量"`
 	ExpiresAt      *time.Time `json:"expires_at" label:"过期时间"`
 	MaxUsage       *int       `json:"max_usage" binding:"omitempty,min=1" label:"最大使用次数"`
+	Audience       string     `json:"audience" label:"签名受众"` // 为空时使用 rustdesk.api-server
+	model.ConfigCodeBinding
+	RevisionId uint `json:"revision_id" label:"固定配置修订"` // 0 表示始终使用最新配置
+}
+
+// ConfigCodeRevokeForm 吊销配置码
+type ConfigCodeRevokeForm struct {
+	Reason string `json:"reason" label:"吊销原因"`
+}
+
+// ConfigCodeUsageQuery 配置码使用记录查询
+type ConfigCodeUsageQuery struct {
+	model.Pagination
+	ConfigCodeId uint   `form:"config_code_id" label:"配置码ID"`
+	DeviceId     string `form:"device_id" label:"设备ID"`
+	Uuid         string `form:"uuid" label:"设备UUID"`
+}
+
+// ServerConfigRollbackForm 回滚服务器配置
+type ServerConfigRollbackForm struct {
+	Revision    int   `json:"revision" binding:"required,min=1" label:"修订号"`
+	GracePeriod int64 `json:"grace_period" binding:"gte=0" label:"宽限期(秒)"`
+}
+
+// ServerConfigRotateKeyForm 轮换服务器密钥
+type ServerConfigRotateKeyForm struct {
+	Key         string `json:"key" binding:"required,max=500" label:"新密钥"`
+	GracePeriod int64  `json:"grace_period" binding:"gte=0" label:"宽限期(秒)"`
+}
+
+// ConfigCodeQrQuery 配置码二维码参数
+type ConfigCodeQrQuery struct {
+	Format  string `form:"format" binding:"omitempty,oneof=png svg" label:"图片格式"`
+	Content string `form:"content" binding:"omitempty,oneof=config code link" label:"二维码内容"`
+	Scale   int    `form:"scale" binding:"omitempty,min=1,max=32" label:"每模块像素"`
+}
+
+// ConfigCodeLinkQuery 配置码导入字符串参数
+type ConfigCodeLinkQuery struct {
+	Embed bool `form:"embed" label:"携带服务器配置"`
+}
+
+// ConfigCodeSheetQuery 配置码打印参数
+type ConfigCodeSheetQuery struct {
+	Ids     []uint `form:"ids" binding:"required,min=1" label:"配置码ID"`
+	Content string `form:"content" binding:"omitempty,oneof=config code link" label:"二维码内容"`
 }
 
 // SetDefaultConfigForm 设置默认配置表单
@@ -13,3 +13,10 @@ type ShareRecordForm struct {
 type PeerShareRecordBatchDeleteForm struct {
 	Ids []uint `json:"ids" validate:"required"`
 }
+
+type ShareRecordUseQuery struct {
+	ShareRecordId uint   `json:"share_record_id" form:"share_record_id"`
+	UserId        uint   `json:"user_id" form:"user_id"`
+	Result        string `json:"result" form:"result"`
+	PageQuery
+}
@@ -35,3 +35,70 @@ type TagQuery struct {
 	CollectionId *int `form:"collection_id"`
 	PageQuery
 }
+
+// TagMergeForm 把 Ids 中的标签合并到 TargetId
+type TagMergeForm struct {
+	Ids      []uint `json:"ids" validate:"required,min=1"`
+	TargetId uint   `json:"target_id" validate:"required,gt=0"`
+}
+
+type TagDefinitionForm struct {
+	Id    uint   `json:"id"`
+	Name  string `json:"name" validate:"required,max=255"`
+	Color uint   `json:"color" validate:"required"`
+	Note  string `json:"note"`
+}
+
+func (f *TagDefinitionForm) ToTagDefinition() *model.TagDefinition {
+	d := &model.TagDefinition{
+		Name:  f.Name,
+		Color: f.Color,
+		Note:  f.Note,
+	}
+	d.Id = f.Id
+	return d
+}
+
+type TagDefinitionQuery struct {
+	Name string `form:"name"`
+	PageQuery
+}
+
+// TagDefinitionPushForm 推送到共享地址簿 CollectionIds 和用户的个人地址簿 UserIds
+type TagDefinitionPushForm struct {
+	Ids           []uint `json:"ids" validate:"required,min=1"`
+	CollectionIds []uint `json:"collection_ids"`
+	UserIds       []uint `json:"user_ids"`
+	Overwrite     bool   `json:"overwrite"`
+}
+
+type TagRuleForm struct {
+	Id            uint             `json:"id"`
+	Name          string           `json:"name" validate:"required"`
+	Tags          []string         `json:"tags" validate:"required,min=1"`
+	HostnameRegex string           `json:"hostname_regex" validate:"omitempty,max=255"`
+	Os            string           `json:"os"`
+	DeviceGroupId uint             `json:"device_group_id"`
+	Status        model.StatusCode `json:"status"`
+}
+
+func (f *TagRuleForm) ToTagRule() *model.TagRule {
+	r := &model.TagRule{
+		Name:          f.Name,
+		Tags:          f.Tags,
+		HostnameRegex: f.HostnameRegex,
+		Os:            f.Os,
+		DeviceGroupId: f.DeviceGroupId,
+		Status:        f.Status,
+	}
+	r.Id = f.Id
+	if r.Status == 0 {
+		r.Status = model.COMMON_STATUS_ENABLE
+	}
+	return r
+}
+
+type TagRuleQuery struct {
+	Status int `form:"status"`
+	PageQuery
+}
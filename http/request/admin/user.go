@@ -23,6 +23,7 @@ type UserForm struct {
 	
 	// 新增字段：个人设备数量限制
 	MaxDevices *int `json:"max_devices"`
+	MaxAbPeers *int `json:"max_ab_peers"`
 }
 
 func (uf *UserForm) FromUser(user *model.User) *UserForm {
@@ -38,6 +39,7 @@ func (uf *UserForm) FromUser(user *model.User) *UserForm {
 	uf.AccountStartTime = user.AccountStartTime
 	uf.AccountEndTime = user.AccountEndTime
 	uf.MaxDevices = user.MaxDevices
+	uf.MaxAbPeers = user.MaxAbPeers
 	return uf
 }
 func (uf *UserForm) ToUser() *model.User {
@@ -54,6 +56,7 @@ func (uf *UserForm) ToUser() *model.User {
 	user.AccountStartTime = uf.AccountStartTime
 	user.AccountEndTime = uf.AccountEndTime
 	user.MaxDevices = uf.MaxDevices
+	user.MaxAbPeers = uf.MaxAbPeers
 	return user
 }
 
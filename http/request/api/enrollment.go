@@ -0,0 +1,17 @@
+package api
+
+// EnrollRegisterForm 通过注册链接注册
+type EnrollRegisterForm struct {
+	DeviceInfo DeviceInfoInLogin `json:"deviceInfo" label:"设备信息"`
+	Id         string            `json:"id" label:"id"`
+	Uuid       string            `json:"uuid" label:"uuid"`
+	Username   string            `json:"username" validate:"required,gte=2,lte=32" label:"用户名"`
+	Email      string            `json:"email" validate:"omitempty,email" label:"邮箱"`
+	Password   string            `json:"password" validate:"required,gte=4,lte=32" label:"密码"`
+}
+
+// EnrollRedeemForm 已登录用户兑换注册链接
+type EnrollRedeemForm struct {
+	Id   string `json:"id" label:"id"`
+	Uuid string `json:"uuid" label:"uuid"`
+}
@@ -77,3 +77,11 @@ type PeerInfoInHeartbeat struct {
 	Uuid string `json:"uuid"`
 	Ver  int    `json:"ver"`
 }
+
+// AbPeersQuery 地址簿条目分页, 传 cursor 时按 row_id 游标分页, 忽略 current
+type AbPeersQuery struct {
+	Ab       string `form:"ab"`
+	Current  uint   `form:"current"`
+	PageSize uint   `form:"pageSize"`
+	Cursor   uint   `form:"cursor"`
+}
@@ -0,0 +1,7 @@
+package api
+
+// ConfigCodeVerifyForm 签名配置码校验
+type ConfigCodeVerifyForm struct {
+	Code     string `json:"code"`
+	Audience string `json:"audience"` // 为空时不校验受众
+}
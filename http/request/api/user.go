@@ -46,8 +46,10 @@ type UserListQuery struct {
 }
 
 type PeerListQuery struct {
-	Page       uint   `json:"page" form:"page" validate:"required" label:"页码"`
-	PageSize   uint   `json:"pageSize" form:"pageSize" validate:"required" label:"每页数量"`
-	Status     int    `json:"status" form:"status" label:"状态"`
-	Accessible string `json:"accessible" form:"accessible"`
+	Page       uint     `json:"page" form:"page" validate:"required" label:"页码"`
+	PageSize   uint     `json:"pageSize" form:"pageSize" validate:"required" label:"每页数量"`
+	Status     int      `json:"status" form:"status" label:"状态"`
+	Accessible string   `json:"accessible" form:"accessible"`
+	Labels     string   `json:"labels" form:"labels"` // 逗号分隔, 须全部带有
+	Attrs      []string `json:"attrs" form:"attr"`    // name=value 或 name~value, 可重复
 }
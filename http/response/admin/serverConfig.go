@@ -18,6 +18,16 @@ type ServerConfigResponse struct {
 	IsEnabled   bool      `json:"is_enabled"`
 	IsDefault   bool      `json:"is_default"`
 	Priority    int       `json:"priority"`
+	GroupIds    []uint    `json:"group_ids"`
+	// 健康状态 unknown, healthy, unhealthy
+	HealthStatus    string `json:"health_status"`
+	HealthLatencyMs int64  `json:"health_latency_ms"`
+	HealthError     string `json:"health_error"`
+	HealthCheckedAt int64  `json:"health_checked_at"`
+	// 当前修订号
+	Revision int `json:"revision"`
+	// 旧密钥下发截止时间, 0 表示没有轮换中的密钥
+	PreviousKeyUntil int64 `json:"previous_key_until"`
 	Status      int       `json:"status"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
@@ -41,6 +51,10 @@ type ConfigCodeResponse struct {
 	CreatedBy      uint                  `json:"created_by"`
 	Creator        *UserResponse         `json:"creator,omitempty"`
 	Status         int                   `json:"status"`
+	model.ConfigCodeBinding
+	BoundUuid      string                `json:"bound_uuid"`
+	RevokedAt      int64                 `json:"revoked_at"`
+	RevokeReason   string                `json:"revoke_reason"`
 	CreatedAt      time.Time             `json:"created_at"`
 	UpdatedAt      time.Time             `json:"updated_at"`
 }
@@ -66,6 +80,8 @@ type ConfigCodeGenerateResponse struct {
 	MaxUsage     *int      `json:"max_usage"`
 	DownloadUrl  string    `json:"download_url,omitempty"`
 	QrCodeUrl    string    `json:"qr_code_url,omitempty"`
+	SignedCode   string    `json:"signed_code"`
+	Kid          string    `json:"kid"`
 }
 
 // ConfigCodeBatchGenerateResponse 批量生成配置码响应
@@ -1,6 +1,9 @@
 package api
 
-import "github.com/lejianwen/rustdesk-api/v2/model"
+import (
+	"github.com/lejianwen/rustdesk-api/v2/http/response"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
 
 /*
 GroupPeerPayload
@@ -39,6 +42,9 @@ type GroupPeerPayload struct {
 	UserName        string           `json:"user_name"`
 	Note            string           `json:"note"`
 	DeviceGroupName string           `json:"device_group_name"`
+	// 管理员维护的设备标签和自定义属性
+	Labels     []string          `json:"labels,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 type PeerPayloadInfo struct {
 	DeviceName string `json:"device_name"`
@@ -70,4 +76,13 @@ func (gpp *GroupPeerPayload) FromPeer(p *model.Peer, username string, dGroupName
 	gpp.Note = ""
 	gpp.UserName = username
 	gpp.DeviceGroupName = dGroupName
+	gpp.Labels = p.Labels
+	gpp.Attributes = p.Attributes
+}
+
+// VersionResponse /api/version 响应, 在原有结构上附带客户端版本建议
+type VersionResponse struct {
+	response.Response
+	RecommendedClientVersion string `json:"recommended_client_version,omitempty"`
+	MinClientVersion         string `json:"min_client_version,omitempty"`
 }
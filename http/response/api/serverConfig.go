@@ -0,0 +1,43 @@
+package api
+
+import (
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+// ConfigCodeVerifyResponse 签名配置码校验结果
+type ConfigCodeVerifyResponse struct {
+	Valid     bool   `json:"valid"`
+	Revoked   bool   `json:"revoked"`
+	Error     string `json:"error"`
+	Kid       string `json:"kid"`
+	Code      string `json:"code"`
+	Audience  string `json:"audience"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// ServerConfigSelectResponse 服务器配置选择结果
+type ServerConfigSelectResponse struct {
+	Region    string                      `json:"region"`
+	Config    *model.ClientServerConfig   `json:"config"`
+	Fallbacks []*model.ClientServerConfig `json:"fallbacks"`
+}
+
+// EnrollInfoResponse 注册链接信息
+type EnrollInfoResponse struct {
+	Name           string     `json:"name"`
+	ServerName     string     `json:"server_name"`
+	AllowRegister  bool       `json:"allow_register"`
+	AllowOauth     bool       `json:"allow_oauth"`
+	OauthProviders []string   `json:"oauth_providers"`
+	ExpiresAt      *time.Time `json:"expires_at"`
+}
+
+// EnrollResponse 注册链接兑换结果
+type EnrollResponse struct {
+	Type         string                    `json:"type,omitempty"`
+	AccessToken  string                    `json:"access_token,omitempty"`
+	User         *UserPayload              `json:"user,omitempty"`
+	ServerConfig *model.ClientServerConfig `json:"server_config"`
+}
@@ -55,4 +55,6 @@ type LoginRes struct {
 	User        UserPayload `json:"user"`
 	Secret      string      `json:"secret,omitempty"`
 	TfaType     string      `json:"tfa_type,omitempty"`
+	// 设备组启用版本强制且客户端低于最低版本时返回
+	ClientCompliance *model.PeerCompliance `json:"client_compliance,omitempty"`
 }
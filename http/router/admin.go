@@ -30,6 +30,8 @@ func Init(g *gin.Engine) {
 	UserBind(adg)
 	GroupBind(adg)
 	TagBind(adg)
+	TagDefinitionBind(adg)
+	TagRuleBind(adg)
 	AddressBookBind(adg)
 	PeerBind(adg)
 	OauthBind(adg)
@@ -37,6 +39,7 @@ func Init(g *gin.Engine) {
 	AuditBind(adg)
 	AddressBookCollectionBind(adg)
 	AddressBookCollectionRuleBind(adg)
+	AddressBookAccessRequestBind(adg)
 	UserTokenBind(adg)
 
 	//deprecated by ConfigBind
@@ -50,7 +53,16 @@ func Init(g *gin.Engine) {
 	MyBind(adg)
 
 	RustdeskCmdBind(adg)
+	IpBlockBind(adg)
+	RelayUsageBind(adg)
 	DeviceGroupBind(adg)
+	DeviceGroupRuleBind(adg)
+	EnrollmentBind(adg)
+	PeerInventoryBind(adg)
+	PeerAttributeBind(adg)
+	PeerMergeBind(adg)
+	AddressBookSyncBind(adg)
+	AddressBookChangeBind(adg)
 	SystemBind(adg)  // 新增：系统配置路由
 	//访问静态文件
 	//g.StaticFS("/upload", http.Dir(global.Config.Gin.ResourcesPath+"/upload"))
@@ -63,6 +75,37 @@ func RustdeskCmdBind(adg *gin.RouterGroup) {
 	rg.GET("/cmdList", cont.CmdList)
 	rg.POST("/cmdDelete", cont.CmdDelete)
 	rg.POST("/cmdCreate", cont.CmdCreate)
+	rg.POST("/sendCmdAll", cont.SendCmdAll)
+	//命令端点包含共享密钥, 仅管理员可维护
+	erg := rg.Group("").Use(middleware.AdminPrivilege())
+	erg.GET("/endpointList", cont.EndpointList)
+	erg.POST("/endpointCreate", cont.EndpointCreate)
+	erg.POST("/endpointUpdate", cont.EndpointUpdate)
+	erg.POST("/endpointDelete", cont.EndpointDelete)
+}
+func RelayUsageBind(adg *gin.RouterGroup) {
+	aR := adg.Group("/relay_usage").Use(middleware.AdminPrivilege())
+	{
+		cont := &admin.RelayUsage{}
+		aR.GET("/list", cont.List)
+		aR.GET("/latest", cont.Latest)
+		aR.GET("/series", cont.Series)
+		aR.POST("/collect", cont.Collect)
+	}
+}
+func IpBlockBind(adg *gin.RouterGroup) {
+	aR := adg.Group("/ip_block").Use(middleware.AdminPrivilege())
+	{
+		cont := &admin.IpBlock{}
+		aR.GET("/list", cont.List)
+		aR.GET("/detail/:id", cont.Detail)
+		aR.POST("/create", cont.Create)
+		aR.POST("/update", cont.Update)
+		aR.POST("/delete", cont.Delete)
+		aR.POST("/batchDelete", cont.BatchDelete)
+		aR.POST("/import", cont.Import)
+		aR.POST("/sync", cont.Sync)
+	}
 }
 func LoginBind(rg *gin.RouterGroup) {
 	cont := &admin.Login{}
@@ -121,9 +164,95 @@ func DeviceGroupBind(rg *gin.RouterGroup) {
 		cont := &admin.DeviceGroup{}
 		aR.GET("/list", cont.List)
 		aR.GET("/detail/:id", cont.Detail)
+		aR.GET("/compliance", cont.Compliance)
+		aR.POST("/create", cont.Create)
+		aR.POST("/update", cont.Update)
+		aR.POST("/delete", cont.Delete)
+	}
+}
+
+func DeviceGroupRuleBind(rg *gin.RouterGroup) {
+	aR := rg.Group("/device_group_rule").Use(middleware.AdminPrivilege())
+	{
+		cont := &admin.DeviceGroupRule{}
+		aR.GET("/list", cont.List)
+		aR.GET("/detail/:id", cont.Detail)
+		aR.POST("/create", cont.Create)
+		aR.POST("/update", cont.Update)
+		aR.POST("/delete", cont.Delete)
+		aR.POST("/reevaluate", cont.Reevaluate)
+	}
+}
+
+func EnrollmentBind(rg *gin.RouterGroup) {
+	aR := rg.Group("/enrollment").Use(middleware.AdminPrivilege())
+	{
+		cont := &admin.Enrollment{}
+		aR.GET("/list", cont.List)
+		aR.GET("/detail/:id", cont.Detail)
 		aR.POST("/create", cont.Create)
 		aR.POST("/update", cont.Update)
 		aR.POST("/delete", cont.Delete)
+		aR.GET("/records", cont.Records)
+	}
+}
+
+func PeerInventoryBind(rg *gin.RouterGroup) {
+	aR := rg.Group("/peer_inventory").Use(middleware.AdminPrivilege())
+	{
+		cont := &admin.PeerInventory{}
+		aR.GET("/history", cont.History)
+		aR.GET("/fleet", cont.Fleet)
+		aR.GET("/summary", cont.Summary)
+	}
+}
+
+func PeerMergeBind(rg *gin.RouterGroup) {
+	aR := rg.Group("/peer_merge").Use(middleware.AdminPrivilege())
+	{
+		cont := &admin.PeerMerge{}
+		aR.GET("/duplicates", cont.Duplicates)
+		aR.POST("/merge", cont.Merge)
+		aR.GET("/aliases", cont.Aliases)
+		aR.POST("/delete_alias", cont.DeleteAlias)
+		aR.GET("/resolve", cont.Resolve)
+	}
+}
+
+func PeerAttributeBind(rg *gin.RouterGroup) {
+	aR := rg.Group("/peer_attribute").Use(middleware.AdminPrivilege())
+	{
+		cont := &admin.PeerAttribute{}
+		aR.GET("/list", cont.List)
+		aR.POST("/create", cont.Create)
+		aR.POST("/update", cont.Update)
+		aR.POST("/delete", cont.Delete)
+		aR.GET("/labels", cont.Labels)
+		aR.GET("/peer/:row_id", cont.Peer)
+		aR.POST("/set_labels", cont.SetLabels)
+		aR.POST("/batch_labels", cont.BatchLabels)
+		aR.POST("/set_attributes", cont.SetAttributes)
+	}
+}
+
+func AddressBookSyncBind(rg *gin.RouterGroup) {
+	aR := rg.Group("/address_book_sync").Use(middleware.AdminPrivilege())
+	{
+		cont := &admin.AddressBookSync{}
+		aR.GET("/list", cont.List)
+		aR.GET("/detail/:id", cont.Detail)
+		aR.POST("/restore", cont.Restore)
+		aR.GET("/tombstones", cont.Tombstones)
+		aR.POST("/undelete", cont.Undelete)
+	}
+}
+
+func AddressBookChangeBind(rg *gin.RouterGroup) {
+	aR := rg.Group("/address_book_change").Use(middleware.AdminPrivilege())
+	{
+		cont := &admin.AddressBookChange{}
+		aR.GET("/list", cont.List)
+		aR.POST("/restore", cont.Restore)
 	}
 }
 
@@ -136,6 +265,33 @@ func TagBind(rg *gin.RouterGroup) {
 		aR.POST("/create", cont.Create)
 		aR.POST("/update", cont.Update)
 		aR.POST("/delete", cont.Delete)
+		aR.POST("/merge", cont.Merge)
+	}
+}
+
+func TagDefinitionBind(rg *gin.RouterGroup) {
+	aR := rg.Group("/tag_definition").Use(middleware.AdminPrivilege())
+	{
+		cont := &admin.TagDefinition{}
+		aR.GET("/list", cont.List)
+		aR.GET("/detail/:id", cont.Detail)
+		aR.POST("/create", cont.Create)
+		aR.POST("/update", cont.Update)
+		aR.POST("/delete", cont.Delete)
+		aR.POST("/push", cont.Push)
+		aR.POST("/merge", cont.Merge)
+	}
+}
+
+func TagRuleBind(rg *gin.RouterGroup) {
+	aR := rg.Group("/tag_rule").Use(middleware.AdminPrivilege())
+	{
+		cont := &admin.TagRule{}
+		aR.GET("/list", cont.List)
+		aR.GET("/detail/:id", cont.Detail)
+		aR.POST("/create", cont.Create)
+		aR.POST("/update", cont.Update)
+		aR.POST("/delete", cont.Delete)
 	}
 }
 
@@ -153,6 +309,9 @@ func AddressBookBind(rg *gin.RouterGroup) {
 		arp.POST("/delete", cont.Delete)
 		arp.POST("/batchCreate", cont.BatchCreate)
 		arp.POST("/batchCreateFromPeers", cont.BatchCreateFromPeers)
+		arp.GET("/export", cont.Export)
+		arp.POST("/import/preview", cont.ImportPreview)
+		arp.POST("/import", cont.Import)
 
 	}
 }
@@ -220,9 +379,23 @@ func AddressBookCollectionBind(rg *gin.RouterGroup) {
 		aR.POST("/create", cont.Create)
 		aR.POST("/update", cont.Update)
 		aR.POST("/delete", cont.Delete)
+		aR.POST("/sync/:id", cont.Sync)
+		aR.POST("/preview", cont.Preview)
+		aR.GET("/tree", cont.Tree)
+		aR.POST("/move", cont.Move)
 	}
 
 }
+func AddressBookAccessRequestBind(rg *gin.RouterGroup) {
+	aR := rg.Group("/address_book_access_request").Use(middleware.AdminPrivilege())
+	{
+		cont := &admin.AddressBookAccessRequest{}
+		aR.GET("/list", cont.List)
+		aR.POST("/approve", cont.Approve)
+		aR.POST("/deny", cont.Deny)
+	}
+}
+
 func AddressBookCollectionRuleBind(rg *gin.RouterGroup) {
 	aR := rg.Group("/address_book_collection_rule").Use(middleware.AdminPrivilege())
 	{
@@ -272,6 +445,14 @@ func MyBind(rg *gin.RouterGroup) {
 		rg.GET("/my/share_record/list", cont.List)
 		rg.POST("/my/share_record/delete", cont.Delete)
 		rg.POST("/my/share_record/batchDelete", cont.BatchDelete)
+		rg.POST("/my/share_record/revoke", cont.Revoke)
+		rg.GET("/my/share_record/uses", cont.Uses)
+	}
+
+	{
+		cont := &my.Notification{}
+		rg.GET("/my/notification/list", cont.List)
+		rg.POST("/my/notification/read", cont.Read)
 	}
 
 	{
@@ -282,6 +463,9 @@ func MyBind(rg *gin.RouterGroup) {
 		rg.POST("/my/address_book/delete", cont.Delete)
 		rg.POST("/my/address_book/batchCreateFromPeers", cont.BatchCreateFromPeers)
 		rg.POST("/my/address_book/batchUpdateTags", cont.BatchUpdateTags)
+		rg.GET("/my/address_book/export", cont.Export)
+		rg.POST("/my/address_book/import/preview", cont.ImportPreview)
+		rg.POST("/my/address_book/import", cont.Import)
 	}
 
 	{
@@ -290,6 +474,7 @@ func MyBind(rg *gin.RouterGroup) {
 		rg.POST("/my/tag/create", cont.Create)
 		rg.POST("/my/tag/update", cont.Update)
 		rg.POST("/my/tag/delete", cont.Delete)
+		rg.POST("/my/tag/merge", cont.Merge)
 	}
 
 	{
@@ -298,6 +483,14 @@ func MyBind(rg *gin.RouterGroup) {
 		rg.POST("/my/address_book_collection/create", cont.Create)
 		rg.POST("/my/address_book_collection/update", cont.Update)
 		rg.POST("/my/address_book_collection/delete", cont.Delete)
+		rg.GET("/my/address_book_collection/tree", cont.Tree)
+		rg.POST("/my/address_book_collection/move", cont.Move)
+	}
+
+	{
+		cont := &my.AddressBookChange{}
+		rg.GET("/my/address_book_change/list", cont.List)
+		rg.POST("/my/address_book_change/restore", cont.Restore)
 	}
 
 	{
@@ -307,6 +500,16 @@ func MyBind(rg *gin.RouterGroup) {
 		rg.POST("/my/address_book_collection_rule/update", cont.Update)
 		rg.POST("/my/address_book_collection_rule/delete", cont.Delete)
 	}
+
+	{
+		cont := &my.AddressBookAccessRequest{}
+		rg.GET("/my/address_book_access_request/list", cont.List)
+		rg.POST("/my/address_book_access_request/create", cont.Create)
+		rg.POST("/my/address_book_access_request/cancel", cont.Cancel)
+		rg.POST("/my/address_book_access_request/approve", cont.Approve)
+		rg.POST("/my/address_book_access_request/deny", cont.Deny)
+	}
+
 	{
 		cont := &my.Peer{}
 		rg.GET("/my/peer/list", cont.List)
@@ -328,6 +531,8 @@ func ShareRecordBind(rg *gin.RouterGroup) {
 		aR.GET("/list", cont.List)
 		aR.POST("/delete", cont.Delete)
 		aR.POST("/batchDelete", cont.BatchDelete)
+		aR.POST("/revoke", cont.Revoke)
+		aR.GET("/uses", cont.Uses)
 	}
 
 }
@@ -342,6 +547,7 @@ func SystemBind(rg *gin.RouterGroup) {
 		aR.GET("/status", cont.GetStatus)
 		aR.GET("/statistics/users", cont.GetUserStatistics)
 		aR.GET("/statistics/devices", cont.GetDeviceStatistics)
+		aR.GET("/statistics/relays", cont.GetRelayStatistics)
 	}
 }
 
@@ -356,6 +562,11 @@ func ServerConfigBind(rg *gin.RouterGroup) {
 		aR.PUT("/update/:id", cont.Update)
 		aR.DELETE("/delete/:id", cont.Delete)
 		aR.POST("/set-default", cont.SetDefault)
+		aR.GET("/health/:id", cont.HealthHistory)
+		aR.POST("/health-check/:id", cont.HealthCheck)
+		aR.GET("/revisions/:id", cont.Revisions)
+		aR.POST("/rollback/:id", cont.Rollback)
+		aR.POST("/rotate-key/:id", cont.RotateKey)
 	}
 
 	// 配置码管理 - 需要管理员权限
@@ -365,7 +576,14 @@ func ServerConfigBind(rg *gin.RouterGroup) {
 		cR.GET("/list", cont.ConfigCodeList)
 		cR.POST("/generate", cont.GenerateConfigCode)
 		cR.POST("/batch-generate", cont.BatchGenerateConfigCode)
+		cR.GET("/qr/:id", cont.ConfigCodeQr)
+		cR.GET("/link/:id", cont.ConfigCodeLink)
+		cR.GET("/sheet", cont.ConfigCodeSheet)
 		cR.DELETE("/delete/:id", cont.DeleteConfigCode)
 		cR.GET("/stats", cont.GetConfigCodeStats)
+		cR.GET("/keys", cont.SigningKeys)
+		cR.POST("/rotate-key", cont.RotateSigningKey)
+		cR.POST("/revoke/:id", cont.RevokeConfigCode)
+		cR.GET("/usages", cont.ConfigCodeUsageList)
 	}
 }
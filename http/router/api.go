@@ -65,6 +65,13 @@ func ApiInit(g *gin.Engine) {
 		WebClientRoutes(frg)
 	}
 
+	{
+		en := &api.Enrollment{}
+		frg.GET("/enroll/:token", en.Info)
+		frg.POST("/enroll/:token/register", en.Register)
+		frg.POST("/enroll/:token/oauth", en.Oauth)
+	}
+
 	{
 		au := &api.Audit{}
 		//[method:POST] [uri:/api/audit/conn]
@@ -72,6 +79,8 @@ func ApiInit(g *gin.Engine) {
 		//[method:POST] [uri:/api/audit/file]
 		frg.POST("/audit/file", au.AuditFile)
 	}
+	// 配置码兑换无需认证, 需要在 RustAuth 之前注册
+	ServerConfigRoutes(frg)
 
 	frg.Use(middleware.RustAuth())
 	{
@@ -83,6 +92,10 @@ func ApiInit(g *gin.Engine) {
 		l := &api.Login{}
 		frg.POST("/logout", l.Logout)
 	}
+	{
+		en := &api.Enrollment{}
+		frg.POST("/enroll/:token/redeem", en.Redeem)
+	}
 	{
 		gr := &api.Group{}
 		frg.GET("/users", gr.Users)
@@ -100,7 +113,6 @@ func ApiInit(g *gin.Engine) {
 	}
 
 	PersonalRoutes(frg)
-	ServerConfigRoutes(frg)
 	//访问静态文件
 	g.StaticFS("/upload", http.Dir(global.Config.Gin.ResourcesPath+"/public/upload"))
 }
@@ -139,7 +151,7 @@ func PersonalRoutes(frg *gin.RouterGroup) {
 func WebClientRoutes(frg *gin.RouterGroup) {
 	w := &api.WebClient{}
 	{
-		frg.POST("/shared-peer", w.SharedPeer)
+		frg.POST("/shared-peer", middleware.RustAuthOptional(), w.SharedPeer)
 	}
 	{
 		frg.POST("/server-config", middleware.RustAuth(), w.ServerConfig)
@@ -151,8 +163,12 @@ func WebClientRoutes(frg *gin.RouterGroup) {
 func ServerConfigRoutes(frg *gin.RouterGroup) {
 	sc := &api.ServerConfig{}
 	{
-		// 客户端获取配置 - 无需认证
-		frg.GET("/config/:code", sc.GetConfigByCode)
-		frg.GET("/config/:code/validate", sc.ValidateConfigCode)
+		// 客户端获取配置 - 无需认证, 带有效 token 时按登录用户校验绑定
+		frg.GET("/config/:code", middleware.RustAuthOptional(), sc.GetConfigByCode)
+		frg.GET("/config/:code/validate", middleware.RustAuthOptional(), sc.ValidateConfigCode)
+		// 签名配置码公钥和校验 - 无需认证
+		frg.GET("/config-code/keys", sc.SigningKeys)
+		frg.POST("/config-code/verify", sc.VerifyConfigCode)
+		frg.GET("/server-config/select", middleware.RustAuthOptional(), sc.Select)
 	}
 }
@@ -0,0 +1,139 @@
+// Package cmdproxy 远程 hbbs/hbbr 的命令代理
+// hbbs/hbbr 只接受本机的命令连接, 在远程服务器上运行代理后, API 服务通过远程命令端点发送命令
+// 协议: 配置了 Secret 时请求的第一行为 Secret, 其余内容原样转发到本机命令端口, 再把响应原样返回
+package cmdproxy
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+// DefaultPort 代理的默认监听端口, 远程命令端点未设置端口时使用
+const DefaultPort = 21120
+
+// ErrUnauthorized Secret 不匹配时返回给调用方的响应
+const ErrUnauthorized = "unauthorized"
+
+type Proxy struct {
+	Listen string // 监听地址, 如 :21120
+	Target string // 本机命令端口, 如 127.0.0.1:21117
+	Secret string
+	// 请求读完的判定: 收到数据后空闲超过该时间
+	Idle time.Duration
+	// 等待 hbbs/hbbr 响应的时间
+	Timeout time.Duration
+	Logf    func(format string, args ...interface{})
+}
+
+func (p *Proxy) ListenAndServe() error {
+	l, err := net.Listen("tcp", p.Listen)
+	if err != nil {
+		return err
+	}
+	return p.Serve(l)
+}
+
+func (p *Proxy) Serve(l net.Listener) error {
+	defer l.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go p.handle(conn)
+	}
+}
+
+func (p *Proxy) handle(conn net.Conn) {
+	defer conn.Close()
+	req, err := readAll(conn, 3*time.Second, p.idle())
+	if err != nil || len(req) == 0 {
+		return
+	}
+	cmd, ok := p.authorize(req)
+	if !ok {
+		p.logf("cmd proxy: unauthorized request from %s", conn.RemoteAddr())
+		conn.Write([]byte(ErrUnauthorized))
+		return
+	}
+	res, err := p.forward(cmd)
+	if err != nil {
+		p.logf("cmd proxy: forward to %s failed: %v", p.Target, err)
+		conn.Write([]byte(err.Error()))
+		return
+	}
+	conn.Write(res)
+}
+
+// authorize 校验并去掉第一行的 Secret, 没有配置 Secret 时原样转发
+func (p *Proxy) authorize(req []byte) ([]byte, bool) {
+	if p.Secret == "" {
+		return req, true
+	}
+	line, rest, found := bytes.Cut(req, []byte("\n"))
+	if !found {
+		return nil, false
+	}
+	line = bytes.TrimRight(line, "\r")
+	if subtle.ConstantTimeCompare(line, []byte(p.Secret)) != 1 {
+		return nil, false
+	}
+	return rest, true
+}
+
+func (p *Proxy) forward(cmd []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("tcp", p.Target, 3*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err = conn.Write(cmd); err != nil {
+		return nil, err
+	}
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+	return readAll(conn, timeout, p.idle())
+}
+
+func (p *Proxy) idle() time.Duration {
+	if p.Idle <= 0 {
+		return 100 * time.Millisecond
+	}
+	return p.Idle
+}
+
+func (p *Proxy) logf(format string, args ...interface{}) {
+	if p.Logf != nil {
+		p.Logf(format, args...)
+	}
+}
+
+// readAll 读到对端关闭, 或收到数据后空闲超过 idle; 在 wait 内没有收到任何数据时返回已读到的内容
+func readAll(conn net.Conn, wait, idle time.Duration) ([]byte, error) {
+	res := make([]byte, 0, 1024)
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(wait))
+	for {
+		n, err := conn.Read(buf)
+		res = append(res, buf[:n]...)
+		if n > 0 {
+			conn.SetReadDeadline(time.Now().Add(idle))
+		}
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) || err.Error() == "EOF" {
+			return res, nil
+		}
+		return res, err
+	}
+}
@@ -0,0 +1,90 @@
+package cmdproxy
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer 模拟 hbbr 的命令端口: 读到命令后返回并关闭连接
+func fakeServer(t *testing.T) (string, chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	got := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 1024)
+			n, _ := conn.Read(buf)
+			got <- string(buf[:n])
+			conn.Write([]byte("ok: " + string(buf[:n])))
+			conn.Close()
+		}
+	}()
+	return l.Addr().String(), got
+}
+
+func startProxy(t *testing.T, target, secret string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Proxy{Target: target, Secret: secret, Idle: 50 * time.Millisecond}
+	go p.Serve(l)
+	t.Cleanup(func() { l.Close() })
+	return l.Addr().String()
+}
+
+func send(t *testing.T, addr, req string) string {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte(req))
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	res, _ := io.ReadAll(conn)
+	return string(res)
+}
+
+func TestProxyForwardsWithSecret(t *testing.T) {
+	target, got := fakeServer(t)
+	addr := startProxy(t, target, "s3cret")
+	if res := send(t, addr, "s3cret\nblocklist-add 1.2.3.4"); res != "ok: blocklist-add 1.2.3.4" {
+		t.Fatalf("got %q", res)
+	}
+	if cmd := <-got; cmd != "blocklist-add 1.2.3.4" {
+		t.Fatalf("forwarded %q", cmd)
+	}
+}
+
+func TestProxyRejectsWrongSecret(t *testing.T) {
+	target, got := fakeServer(t)
+	addr := startProxy(t, target, "s3cret")
+	for _, req := range []string{"wrong\nusage ", "usage "} {
+		if res := send(t, addr, req); res != ErrUnauthorized {
+			t.Fatalf("%q: got %q", req, res)
+		}
+	}
+	select {
+	case cmd := <-got:
+		t.Fatalf("forwarded %q without secret", cmd)
+	default:
+	}
+}
+
+func TestProxyWithoutSecret(t *testing.T) {
+	target, _ := fakeServer(t)
+	addr := startProxy(t, target, "")
+	if res := send(t, addr, "usage "); !strings.HasPrefix(res, "ok: usage") {
+		t.Fatalf("got %q", res)
+	}
+}
@@ -0,0 +1,138 @@
+// Package configcode 签名配置码的生成与离线校验
+//
+// 配置码格式为 KSC1.<payload>.<signature>, payload 为 JSON 经 base64url 编码,
+// signature 为服务端 Ed25519 私钥对 "KSC1.<payload>" 的签名.
+// 安装程序只需从 /api/config-code/keys 获取公钥即可离线校验, 无需共享密钥.
+// payload 可被任何人读取, 只包含标识和有效期, 服务器配置需要通过兑换接口获取.
+package configcode
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	Prefix = "KSC1"
+	Alg    = "Ed25519"
+)
+
+var (
+	ErrMalformed    = errors.New("malformed config code")
+	ErrUnknownKey   = errors.New("unknown signing key")
+	ErrBadSignature = errors.New("invalid signature")
+	ErrExpired      = errors.New("config code has expired")
+	ErrAudience     = errors.New("config code audience mismatch")
+)
+
+// Claims 配置码内容
+type Claims struct {
+	Kid      string `json:"kid"`
+	Jti      string `json:"jti"` // 对应服务端的短配置码
+	Audience string `json:"aud"`
+	IssuedAt int64  `json:"iat"`
+	Expires  int64  `json:"exp"` // 0 表示永不过期
+}
+
+// PublicKey 公开的验签公钥
+type PublicKey struct {
+	Kid       string `json:"kid"`
+	Alg       string `json:"alg"`
+	PublicKey string `json:"public_key"` // base64 std 编码
+	Active    bool   `json:"active"`
+	RetiredAt int64  `json:"retired_at"`
+}
+
+// Sign 签发配置码
+func Sign(priv ed25519.PrivateKey, claims *Claims) (string, error) {
+	if claims.Kid == "" {
+		return "", ErrUnknownKey
+	}
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := Prefix + "." + base64.RawURLEncoding.EncodeToString(b)
+	sig := ed25519.Sign(priv, []byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// IsSigned 判断是否为签名配置码
+func IsSigned(code string) bool {
+	return strings.HasPrefix(code, Prefix+".")
+}
+
+// Parse 解析配置码但不验签
+func Parse(code string) (claims *Claims, signed []byte, sig []byte, err error) {
+	parts := strings.Split(code, ".")
+	if len(parts) != 3 || parts[0] != Prefix {
+		return nil, nil, nil, ErrMalformed
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, nil, ErrMalformed
+	}
+	sig, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, nil, nil, ErrMalformed
+	}
+	claims = &Claims{}
+	if err = json.Unmarshal(payload, claims); err != nil {
+		return nil, nil, nil, ErrMalformed
+	}
+	return claims, []byte(parts[0] + "." + parts[1]), sig, nil
+}
+
+// Verifier 使用一组公钥校验配置码
+type Verifier struct {
+	keys map[string]ed25519.PublicKey
+}
+
+func NewVerifier(keys []PublicKey) (*Verifier, error) {
+	v := &Verifier{keys: make(map[string]ed25519.PublicKey, len(keys))}
+	for _, k := range keys {
+		if k.Alg != "" && k.Alg != Alg {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(k.PublicKey)
+		if err != nil || len(b) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid public key " + k.Kid)
+		}
+		v.keys[k.Kid] = b
+	}
+	return v, nil
+}
+
+// ParseKeySet 从 /api/config-code/keys 返回的 JSON 数组创建校验器
+func ParseKeySet(data []byte) (*Verifier, error) {
+	var keys []PublicKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	return NewVerifier(keys)
+}
+
+// Verify 校验签名、有效期和受众, audience 为空时不校验受众
+func (v *Verifier) Verify(code string, audience string, now time.Time) (*Claims, error) {
+	claims, signed, sig, err := Parse(code)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := v.keys[claims.Kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if !ed25519.Verify(pub, signed, sig) {
+		return nil, ErrBadSignature
+	}
+	if claims.Expires > 0 && now.Unix() >= claims.Expires {
+		return claims, ErrExpired
+	}
+	if audience != "" && claims.Audience != "" && claims.Audience != audience {
+		return claims, ErrAudience
+	}
+	return claims, nil
+}
@@ -0,0 +1,84 @@
+package configcode
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newKey(t *testing.T, kid string) (ed25519.PrivateKey, PublicKey) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return priv, PublicKey{Kid: kid, Alg: Alg, PublicKey: base64.StdEncoding.EncodeToString(pub)}
+}
+
+func TestSignVerify(t *testing.T) {
+	priv, pub := newKey(t, "k1")
+	now := time.Now()
+	code, err := Sign(priv, &Claims{Kid: "k1", Jti: "KUST-1", Audience: "https://api.example.com", IssuedAt: now.Unix(), Expires: now.Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSigned(code) {
+		t.Fatalf("expected signed code, got %s", code)
+	}
+	v, err := NewVerifier([]PublicKey{pub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := v.Verify(code, "https://api.example.com", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Jti != "KUST-1" || claims.Audience != "https://api.example.com" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+	if _, err = v.Verify(code, "https://other.example.com", now); err != ErrAudience {
+		t.Fatalf("expected ErrAudience, got %v", err)
+	}
+	if _, err = v.Verify(code, "", now.Add(2*time.Hour)); err != ErrExpired {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	priv, pub := newKey(t, "k1")
+	code, _ := Sign(priv, &Claims{Kid: "k1", Jti: "a"})
+	parts := strings.Split(code, ".")
+	b, _ := json.Marshal(&Claims{Kid: "k1", Jti: "b"})
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString(b) + "." + parts[2]
+	v, _ := NewVerifier([]PublicKey{pub})
+	if _, err := v.Verify(tampered, "", time.Now()); err != ErrBadSignature {
+		t.Fatalf("expected ErrBadSignature, got %v", err)
+	}
+	if _, err := v.Verify("KUST-20240101-abc", "", time.Now()); err != ErrMalformed {
+		t.Fatalf("expected ErrMalformed, got %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldPriv, oldPub := newKey(t, "k1")
+	newPriv, newPub := newKey(t, "k2")
+	oldCode, _ := Sign(oldPriv, &Claims{Kid: "k1", Jti: "a"})
+	newCode, _ := Sign(newPriv, &Claims{Kid: "k2", Jti: "b"})
+	data, _ := json.Marshal([]PublicKey{oldPub, newPub})
+	v, err := ParseKeySet(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []string{oldCode, newCode} {
+		if _, err := v.Verify(c, "", time.Now()); err != nil {
+			t.Fatalf("verify %s: %v", c, err)
+		}
+	}
+	v, _ = NewVerifier([]PublicKey{newPub})
+	if _, err := v.Verify(oldCode, "", time.Now()); err != ErrUnknownKey {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+}
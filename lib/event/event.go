@@ -0,0 +1,57 @@
+package event
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Handler 事件处理函数, payload 由发布方决定
+type Handler func(payload interface{})
+
+// Bus 进程内事件总线, 订阅者在独立的 goroutine 中执行, 不阻塞发布方
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+	wg       sync.WaitGroup
+	// OnPanic 订阅者 panic 时调用, 为 nil 时忽略
+	OnPanic func(name string, err error)
+}
+
+func New() *Bus {
+	return &Bus{
+		handlers: make(map[string][]Handler),
+	}
+}
+
+// Subscribe 订阅事件
+func (b *Bus) Subscribe(name string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[name] = append(b.handlers[name], h)
+}
+
+// Publish 发布事件, 每个订阅者异步执行, 单个订阅者 panic 不影响其他订阅者
+func (b *Bus) Publish(name string, payload interface{}) {
+	b.mu.RLock()
+	hs := b.handlers[name]
+	b.mu.RUnlock()
+	for _, h := range hs {
+		b.wg.Add(1)
+		go b.call(name, h, payload)
+	}
+}
+
+func (b *Bus) call(name string, h Handler, payload interface{}) {
+	defer b.wg.Done()
+	defer func() {
+		if r := recover(); r != nil && b.OnPanic != nil {
+			b.OnPanic(name, fmt.Errorf("%v", r))
+		}
+	}()
+	h(payload)
+}
+
+// Wait 等待已发布事件的订阅者执行完毕
+func (b *Bus) Wait() {
+	b.wg.Wait()
+}
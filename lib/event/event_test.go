@@ -0,0 +1,33 @@
+package event
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestBus_Publish(t *testing.T) {
+	b := New()
+	var n int32
+	var panics int32
+	b.OnPanic = func(name string, err error) {
+		atomic.AddInt32(&panics, 1)
+	}
+	b.Subscribe("a", func(payload interface{}) {
+		atomic.AddInt32(&n, int32(payload.(int)))
+	})
+	b.Subscribe("a", func(payload interface{}) {
+		panic("boom")
+	})
+	b.Subscribe("a", func(payload interface{}) {
+		atomic.AddInt32(&n, int32(payload.(int)))
+	})
+	b.Publish("a", 2)
+	b.Publish("b", 100)
+	b.Wait()
+	if n != 4 {
+		t.Fatalf("n = %d", n)
+	}
+	if panics != 1 {
+		t.Fatalf("panics = %d", panics)
+	}
+}
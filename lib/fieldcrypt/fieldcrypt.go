@@ -0,0 +1,196 @@
+package fieldcrypt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Prefix 加密值前缀, 格式 enc:v1:<密钥ID>:<包裹的数据密钥>:<密文>
+// 每个值使用随机的数据密钥(DEK)加密, 数据密钥再由主密钥(KEK)包裹, 密钥ID用于轮换后找到对应的主密钥
+const Prefix = "enc:v1:"
+
+var (
+	ErrNoKey      = errors.New("fieldcrypt: no key configured")
+	ErrUnknownKey = errors.New("fieldcrypt: unknown key id")
+	ErrMalformed  = errors.New("fieldcrypt: malformed value")
+)
+
+// Key 主密钥
+type Key struct {
+	Id     string
+	Secret []byte
+}
+
+// Keyring 主密钥集合, 第一个为当前加密用的密钥, 其余只用于解密
+type Keyring struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+// NewKey 校验并创建主密钥, secret 为 base64 编码的 16/24/32 字节
+func NewKey(id, secret string) (*Key, error) {
+	if id == "" || strings.Contains(id, ":") {
+		return nil, fmt.Errorf("fieldcrypt: invalid key id %q", id)
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(secret))
+	if err != nil {
+		return nil, fmt.Errorf("fieldcrypt: key %s is not base64: %w", id, err)
+	}
+	switch len(b) {
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("fieldcrypt: key %s must be 16, 24 or 32 bytes, got %d", id, len(b))
+	}
+	return &Key{Id: id, Secret: b}, nil
+}
+
+// ParseKeyFile 解析密钥文件, 每行 "<密钥ID>:<base64密钥>", 空行和 # 开头的行忽略
+func ParseKeyFile(data []byte) ([]*Key, error) {
+	var keys []*Key
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, secret, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("fieldcrypt: line %d: expected <id>:<base64 key>", n)
+		}
+		k, err := NewKey(strings.TrimSpace(id), secret)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, sc.Err()
+}
+
+// NewKeyring 创建密钥集合, keys[0] 为当前密钥
+func NewKeyring(keys ...*Key) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKey
+	}
+	kr := &Keyring{active: keys[0], keys: make(map[string]*Key, len(keys))}
+	for _, k := range keys {
+		if _, ok := kr.keys[k.Id]; ok {
+			return nil, fmt.Errorf("fieldcrypt: duplicate key id %s", k.Id)
+		}
+		kr.keys[k.Id] = k
+	}
+	return kr, nil
+}
+
+// ActiveId 当前密钥ID
+func (kr *Keyring) ActiveId() string {
+	return kr.active.Id
+}
+
+// IsEncrypted 是否为加密值
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, Prefix)
+}
+
+// KeyId 加密值使用的密钥ID, 非加密值返回空
+func KeyId(s string) string {
+	if !IsEncrypted(s) {
+		return ""
+	}
+	id, _, _ := strings.Cut(s[len(Prefix):], ":")
+	return id
+}
+
+// Encrypt 用当前密钥加密
+func (kr *Keyring) Encrypt(plain []byte) (string, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	aad := []byte(kr.active.Id)
+	wrapped, err := seal(kr.active.Secret, dek, aad)
+	if err != nil {
+		return "", err
+	}
+	ct, err := seal(dek, plain, aad)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	return Prefix + kr.active.Id + ":" + enc.EncodeToString(wrapped) + ":" + enc.EncodeToString(ct), nil
+}
+
+// Decrypt 解密, 按值中的密钥ID选择主密钥
+func (kr *Keyring) Decrypt(s string) ([]byte, error) {
+	if !IsEncrypted(s) {
+		return nil, ErrMalformed
+	}
+	parts := strings.Split(s[len(Prefix):], ":")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	k, ok := kr.keys[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownKey, parts[0])
+	}
+	enc := base64.RawURLEncoding
+	wrapped, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	ct, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	aad := []byte(k.Id)
+	dek, err := open(k.Secret, wrapped, aad)
+	if err != nil {
+		return nil, err
+	}
+	return open(dek, ct, aad)
+}
+
+// NeedsRewrite 值是否需要用当前密钥重新加密: 明文或由其他密钥加密的非空值
+func (kr *Keyring) NeedsRewrite(s string) bool {
+	if s == "" {
+		return false
+	}
+	return KeyId(s) != kr.active.Id
+}
+
+func seal(key, plain, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, aad), nil
+}
+
+func open(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrMalformed
+	}
+	return gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
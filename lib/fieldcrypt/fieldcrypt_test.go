@@ -0,0 +1,83 @@
+package fieldcrypt
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func testKey(t *testing.T, id string, b byte) *Key {
+	k, err := NewKey(id, base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	kr, err := NewKeyring(testKey(t, "k1", 'a'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := kr.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(s) || KeyId(s) != "k1" || strings.Contains(s, "secret") {
+		t.Fatalf("unexpected ciphertext %s", s)
+	}
+	s2, _ := kr.Encrypt([]byte("secret"))
+	if s == s2 {
+		t.Fatal("expected random data key per value")
+	}
+	b, err := kr.Decrypt(s)
+	if err != nil || string(b) != "secret" {
+		t.Fatalf("decrypt got %q, %v", b, err)
+	}
+	if _, err = kr.Decrypt(s[:len(s)-2] + "AA"); err == nil {
+		t.Fatal("expected tampered value to fail")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	old, _ := NewKeyring(testKey(t, "k1", 'a'))
+	s, _ := old.Encrypt([]byte("secret"))
+
+	kr, err := NewKeyring(testKey(t, "k2", 'b'), testKey(t, "k1", 'a'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := kr.Decrypt(s); err != nil || string(b) != "secret" {
+		t.Fatalf("old key decrypt got %q, %v", b, err)
+	}
+	if !kr.NeedsRewrite(s) || !kr.NeedsRewrite("plain") || kr.NeedsRewrite("") {
+		t.Fatal("unexpected NeedsRewrite")
+	}
+	s2, _ := kr.Encrypt([]byte("secret"))
+	if kr.NeedsRewrite(s2) {
+		t.Fatal("value with active key should not need rewrite")
+	}
+	if _, err = old.Decrypt(s2); err == nil {
+		t.Fatal("expected unknown key error")
+	}
+	if _, err = NewKeyring(testKey(t, "k1", 'a'), testKey(t, "k1", 'b')); err == nil {
+		t.Fatal("expected duplicate key id error")
+	}
+}
+
+func TestParseKeyFile(t *testing.T) {
+	a := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32)))
+	b := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", 16)))
+	keys, err := ParseKeyFile([]byte("# keys\n2024:" + a + "\n\n2023: " + b + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].Id != "2024" || keys[1].Id != "2023" || len(keys[1].Secret) != 16 {
+		t.Fatalf("unexpected keys %+v", keys)
+	}
+	for _, bad := range []string{"nokey", "k:notbase64!", "k:" + base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err = ParseKeyFile([]byte(bad)); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
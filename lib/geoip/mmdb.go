@@ -0,0 +1,322 @@
+// Package geoip 读取 MaxMind DB (mmdb) 格式的 GeoIP 数据库
+//
+// 只实现查询所需的部分: 元数据、搜索树和数据段解码, 兼容 GeoLite2/GeoIP2 Country/City
+// 以及 DB-IP 等同格式的数据库.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/big"
+	"net"
+	"os"
+)
+
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+var (
+	ErrInvalidDatabase = errors.New("invalid mmdb database")
+	ErrInvalidIp       = errors.New("invalid ip")
+)
+
+// Reader mmdb 数据库
+type Reader struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	nodeBytes  uint
+	dataStart  uint
+	ipv4Start  uint
+}
+
+// Open 读取整个数据库文件到内存
+func Open(path string) (*Reader, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(b)
+}
+
+func FromBytes(b []byte) (*Reader, error) {
+	i := bytes.LastIndex(b, metadataMarker)
+	if i < 0 {
+		return nil, ErrInvalidDatabase
+	}
+	metaStart := uint(i + len(metadataMarker))
+	md := &decoder{buf: b[metaStart:]}
+	v, _, err := md.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	meta, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+	r := &Reader{
+		buf:        b,
+		nodeCount:  toUint(meta["node_count"]),
+		recordSize: toUint(meta["record_size"]),
+		ipVersion:  toUint(meta["ip_version"]),
+	}
+	if r.nodeCount == 0 || (r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32) {
+		return nil, ErrInvalidDatabase
+	}
+	r.nodeBytes = r.recordSize * 2 / 8
+	r.dataStart = r.nodeCount*r.nodeBytes + 16
+	if r.dataStart > uint(i) {
+		return nil, ErrInvalidDatabase
+	}
+	// IPv6 数据库中 IPv4 地址位于 ::/96 之下
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for j := 0; j < 96 && node < r.nodeCount; j++ {
+			node = r.readNode(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// Lookup 查询IP对应的记录, 未找到时返回 nil
+func (r *Reader) Lookup(ip net.IP) (map[string]interface{}, error) {
+	if ip == nil {
+		return nil, ErrInvalidIp
+	}
+	node := uint(0)
+	bits := 128
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+		bits = 32
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else if r.ipVersion == 4 {
+		return nil, nil
+	}
+	for i := 0; i < bits && node < r.nodeCount; i++ {
+		bit := (ip[i>>3] >> (7 - uint(i&7))) & 1
+		node = r.readNode(node, uint(bit))
+	}
+	if node <= r.nodeCount {
+		return nil, nil
+	}
+	offset := node - r.nodeCount - 16
+	d := &decoder{buf: r.buf[r.dataStart:]}
+	v, _, err := d.decode(offset)
+	if err != nil {
+		return nil, err
+	}
+	m, _ := v.(map[string]interface{})
+	return m, nil
+}
+
+// Country 取IP的国家代码, 没有 country 时使用 registered_country
+func (r *Reader) Country(ip net.IP) string {
+	rec, err := r.Lookup(ip)
+	if err != nil || rec == nil {
+		return ""
+	}
+	for _, k := range []string{"country", "registered_country"} {
+		if c, ok := rec[k].(map[string]interface{}); ok {
+			if code, ok := c["iso_code"].(string); ok && code != "" {
+				return code
+			}
+		}
+	}
+	return ""
+}
+
+func (r *Reader) readNode(node uint, bit uint) uint {
+	b := r.buf[node*r.nodeBytes : (node+1)*r.nodeBytes]
+	switch r.recordSize {
+	case 24:
+		if bit == 0 {
+			return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3])<<16 | uint(b[4])<<8 | uint(b[5])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		if bit == 0 {
+			return uint(binary.BigEndian.Uint32(b[0:4]))
+		}
+		return uint(binary.BigEndian.Uint32(b[4:8]))
+	}
+}
+
+// decoder mmdb 数据段解码, 指针相对 buf 起始位置
+type decoder struct {
+	buf []byte
+}
+
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+func (d *decoder) decode(offset uint) (interface{}, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return nil, 0, ErrInvalidDatabase
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ := uint(ctrl >> 5)
+	if typ == typePointer {
+		ptr, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(ptr)
+		return v, next, err
+	}
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, ErrInvalidDatabase
+		}
+		typ = 7 + uint(d.buf[offset])
+		offset++
+	}
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.buf)) {
+			return nil, 0, ErrInvalidDatabase
+		}
+		v := uint(0)
+		for _, b := range d.buf[offset : offset+n] {
+			v = v<<8 | uint(b)
+		}
+		switch size {
+		case 29:
+			size = 29 + v
+		case 30:
+			size = 285 + v
+		default:
+			size = 65821 + v
+		}
+		offset += n
+	}
+	return d.value(typ, size, offset)
+}
+
+func (d *decoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	ss := uint(ctrl>>3) & 3
+	n := ss + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, ErrInvalidDatabase
+	}
+	v := uint(0)
+	if ss < 3 {
+		v = uint(ctrl & 7)
+	}
+	for _, b := range d.buf[offset : offset+n] {
+		v = v<<8 | uint(b)
+	}
+	switch ss {
+	case 1:
+		v += 2048
+	case 2:
+		v += 526336
+	}
+	return v, offset + n, nil
+}
+
+func (d *decoder) value(typ, size, offset uint) (interface{}, uint, error) {
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			v, next2, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			ks, _ := k.(string)
+			m[ks] = v
+			offset = next2
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, ErrInvalidDatabase
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return append([]byte(nil), b...), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		v := uint64(0)
+		for _, x := range b {
+			v = v<<8 | uint64(x)
+		}
+		return v, next, nil
+	case typeInt32:
+		v := uint32(0)
+		for _, x := range b {
+			v = v<<8 | uint32(x)
+		}
+		return int32(v), next, nil
+	case typeUint128:
+		return new(big.Int).SetBytes(b), next, nil
+	case typeContainer, typeEndMarker:
+		return nil, next, nil
+	}
+	return nil, 0, ErrInvalidDatabase
+}
+
+func toUint(v interface{}) uint {
+	if n, ok := v.(uint64); ok {
+		return uint(n)
+	}
+	return 0
+}
@@ -0,0 +1,50 @@
+package geoip
+
+import (
+	"net"
+	"testing"
+)
+
+// buildDb 构造一个只有一个节点的 IPv4 数据库: 0.0.0.0/1 -> {country: {iso_code: CN}}
+func buildDb() []byte {
+	// node_count=1, record_size=24, 左记录指向数据段偏移0 (1+16+0), 右记录为 node_count 表示无数据
+	b := []byte{0x00, 0x00, 0x11, 0x00, 0x00, 0x01}
+	b = append(b, make([]byte, 16)...)
+	b = append(b, 0xE1, 0x47)
+	b = append(b, "country"...)
+	b = append(b, 0xE1, 0x48)
+	b = append(b, "iso_code"...)
+	b = append(b, 0x42)
+	b = append(b, "CN"...)
+	b = append(b, metadataMarker...)
+	b = append(b, 0xE3, 0x4A)
+	b = append(b, "node_count"...)
+	b = append(b, 0xC1, 0x01, 0x4B)
+	b = append(b, "record_size"...)
+	b = append(b, 0xA1, 0x18, 0x4A)
+	b = append(b, "ip_version"...)
+	b = append(b, 0xA1, 0x04)
+	return b
+}
+
+func TestCountry(t *testing.T) {
+	r, err := FromBytes(buildDb())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := r.Country(net.ParseIP("10.1.2.3")); c != "CN" {
+		t.Fatalf("expected CN, got %q", c)
+	}
+	if c := r.Country(net.ParseIP("192.168.1.1")); c != "" {
+		t.Fatalf("expected empty, got %q", c)
+	}
+	if c := r.Country(net.ParseIP("2001:db8::1")); c != "" {
+		t.Fatalf("expected empty for ipv6 on ipv4 db, got %q", c)
+	}
+}
+
+func TestInvalidDatabase(t *testing.T) {
+	if _, err := FromBytes([]byte("not a database")); err != ErrInvalidDatabase {
+		t.Fatalf("expected ErrInvalidDatabase, got %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDocument(t *testing.T) {
+	d := New(A4Width, A4Height)
+	p := d.AddPage()
+	p.Rect(10, 10, 20, 20)
+	p.Text(10, 50, 12, "code (a\\b) 配置")
+	d.AddPage().Text(10, 10, 8, "second")
+	out := d.Bytes()
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatal("bad pdf header or trailer")
+	}
+	if !bytes.Contains(out, []byte(`(code \(a\\b\) ??) Tj`)) {
+		t.Fatal("text not escaped")
+	}
+	if !bytes.Contains(out, []byte("/Count 2")) {
+		t.Fatal("expected two pages")
+	}
+	// xref 中的偏移必须指向对应对象
+	s := string(out)
+	xref := s[strings.LastIndex(s, "\nxref\n")+1:]
+	lines := strings.Split(xref, "\n")[3:]
+	for i := 0; i < 7; i++ {
+		var off int
+		fmt.Sscanf(lines[i], "%d", &off)
+		if !strings.HasPrefix(s[off:], fmt.Sprintf("%d 0 obj", i+1)) {
+			t.Fatalf("bad offset for object %d", i+1)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package qrcode
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDataCapacity(t *testing.T) {
+	cases := []struct {
+		version int
+		level   Level
+		want    int
+	}{
+		{1, L, 19}, {1, M, 16}, {1, H, 9}, {2, M, 28}, {3, M, 44}, {4, M, 64}, {5, M, 86},
+		{10, M, 216}, {10, L, 274}, {20, M, 669}, {20, L, 861}, {20, H, 385},
+		{40, L, 2956}, {40, M, 2334}, {40, Q, 1666}, {40, H, 1276},
+	}
+	for _, c := range cases {
+		if got := numDataCodewords(c.version, c.level); got != c.want {
+			t.Fatalf("version %d level %d: got %d want %d", c.version, c.level, got, c.want)
+		}
+	}
+}
+
+func TestFormatBits(t *testing.T) {
+	// ISO/IEC 18004 附录 C 中的格式信息
+	if got := formatBits(M, 0); got != 0x5412 {
+		t.Fatalf("M/0 got %015b", got)
+	}
+	if got := formatBits(L, 0); got != 0x77C4 {
+		t.Fatalf("L/0 got %015b", got)
+	}
+	if got := formatBits(Q, 0); got != 0x355F {
+		t.Fatalf("Q/0 got %015b", got)
+	}
+	if got := formatBits(H, 0); got != 0x1689 {
+		t.Fatalf("H/0 got %015b", got)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	inputs := []string{
+		"",
+		"hello",
+		strings.Repeat("KSC1.", 40),
+		strings.Repeat("0123456789abcdef", 60),
+	}
+	for _, in := range inputs {
+		for _, level := range []Level{L, M, Q, H} {
+			c, err := Encode([]byte(in), level)
+			if err != nil {
+				t.Fatalf("encode %d bytes: %v", len(in), err)
+			}
+			if c.Size != c.Version*4+17 {
+				t.Fatalf("bad size %d for version %d", c.Size, c.Version)
+			}
+			got := decode(t, c)
+			if !bytes.Equal(got, []byte(in)) {
+				t.Fatalf("level %d version %d: round trip mismatch", level, c.Version)
+			}
+		}
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(make([]byte, 3000), L); err != ErrTooLong {
+		t.Fatalf("expected ErrTooLong, got %v", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	c, err := Encode([]byte("rustdesk"), M)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := c.PNG(4, 4)
+	if err != nil || !bytes.HasPrefix(p, []byte("\x89PNG")) {
+		t.Fatalf("bad png %v", err)
+	}
+	if s := c.SVG(4, 4); !bytes.Contains(s, []byte("<svg")) {
+		t.Fatal("bad svg")
+	}
+}
+
+// decode 读取格式信息, 去掩码, 校验 RS 码并还原字节模式数据
+func decode(t *testing.T, c *Code) []byte {
+	t.Helper()
+	fb := 0
+	for i := 0; i <= 5; i++ {
+		fb |= b2i(c.Get(8, i)) << i
+	}
+	fb |= b2i(c.Get(8, 7)) << 6
+	fb |= b2i(c.Get(8, 8)) << 7
+	fb |= b2i(c.Get(7, 8)) << 8
+	for i := 9; i < 15; i++ {
+		fb |= b2i(c.Get(14-i, 8)) << i
+	}
+	if fb != formatBits(c.Level, c.Mask) {
+		t.Fatalf("format bits mismatch")
+	}
+	if !c.Get(8, c.Size-8) {
+		t.Fatal("dark module missing")
+	}
+
+	raw := make([]byte, numRawDataModules(c.Version)/8)
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = c.Size - 1 - vert
+				}
+				if c.isFunction[y][x] || i >= len(raw)*8 {
+					continue
+				}
+				if c.modules[y][x] != maskBit(c.Mask, x, y) {
+					raw[i>>3] |= 1 << uint(7-i&7)
+				}
+				i++
+			}
+		}
+	}
+
+	numBlocks := numErrorCorrectionBlocks[c.Level][c.Version]
+	eccLen := eccCodewordsPerBlock[c.Level][c.Version]
+	numShort := numBlocks - len(raw)%numBlocks
+	shortLen := len(raw) / numBlocks
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for pos := 0; pos <= shortLen; pos++ {
+		for j := 0; j < numBlocks; j++ {
+			if pos == shortLen-eccLen && j < numShort {
+				continue
+			}
+			blocks[j] = append(blocks[j], raw[k])
+			k++
+		}
+	}
+	var data []byte
+	for _, block := range blocks {
+		// 码字多项式在生成多项式的每个根处取值为 0
+		root := byte(1)
+		for r := 0; r < eccLen; r++ {
+			v := byte(0)
+			for _, b := range block {
+				v = gfMul(v, root) ^ b
+			}
+			if v != 0 {
+				t.Fatalf("rs syndrome %d non-zero", r)
+			}
+			root = gfMul(root, 0x02)
+		}
+		data = append(data, block[:len(block)-eccLen]...)
+	}
+
+	rd := func(off, n int) int {
+		v := 0
+		for i := off; i < off+n; i++ {
+			v = v<<1 | int(data[i>>3]>>uint(7-i&7)&1)
+		}
+		return v
+	}
+	if rd(0, 4) != 0x4 {
+		t.Fatal("not byte mode")
+	}
+	ccb := charCountBits(c.Version)
+	n := rd(4, ccb)
+	out := make([]byte, n)
+	for j := range out {
+		out[j] = byte(rd(4+ccb+j*8, 8))
+	}
+	return out
+}
+
+func b2i(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -22,12 +22,12 @@ type AddressBook struct {
 	RowId            uint                   `gorm:"primaryKey" json:"row_id"`
 	Id               string                 `json:"id" gorm:"default:0;not null;index"`
 	Username         string                 `json:"username" gorm:"default:'';not null;"`
-	Password         string                 `json:"password" gorm:"default:'';not null;"`
+	Password         string                 `json:"password" gorm:"size:1024;default:'';not null;serializer:encrypted;"`
 	Hostname         string                 `json:"hostname" gorm:"default:'';not null;"`
 	Alias            string                 `json:"alias" gorm:"default:'';not null;"`
 	Platform         string                 `json:"platform" gorm:"default:'';not null;"`
 	Tags             custom_types.AutoJson  `json:"tags" gorm:"not null;" swaggertype:"array,string"`
-	Hash             string                 `json:"hash" gorm:"default:'';not null;"`
+	Hash             string                 `json:"hash" gorm:"size:1024;default:'';not null;serializer:encrypted;"`
 	UserId           uint                   `json:"user_id" gorm:"default:0;not null;index"`
 	ForceAlwaysRelay bool                   `json:"forceAlwaysRelay" gorm:"default:0;not null;"`
 	RdpPort          string                 `json:"rdpPort" gorm:"default:'';not null;"`
@@ -37,6 +37,7 @@ type AddressBook struct {
 	SameServer       bool                   `json:"sameServer" gorm:"default:0;not null;"`
 	CollectionId     uint                   `json:"collection_id" gorm:"default:0;not null;index"`
 	Collection       *AddressBookCollection `json:"collection,omitempty"`
+	ClientCompliance string                 `json:"client_compliance,omitempty" gorm:"-"` // 设备组启用版本强制时标记不合规的客户端, 不入库
 	TimeModel
 }
 
@@ -49,8 +50,42 @@ type AddressBookCollection struct {
 	IdModel
 	UserId uint   `json:"user_id" gorm:"default:0;not null;index"`
 	Name   string `json:"name" gorm:"default:'';not null;" validate:"required"`
+	// 智能地址簿的设备查询, 为空表示普通地址簿; 成员由查询结果自动同步为地址簿条目
+	PeerQuery *PeerQuery `json:"peer_query" gorm:"type:text;serializer:json;"`
+	SyncedAt  int64      `json:"synced_at" gorm:"default:0;not null;"`
+	// 条目数上限, null 或 0 使用全局配置
+	MaxPeers *int `json:"max_peers" gorm:"default:null"`
+	// 上级地址簿, 0 为顶层; 只能是同一用户的地址簿, 上级的共享规则对下级同样生效
+	ParentId uint `json:"parent_id" gorm:"default:0;not null;index"`
 	TimeModel
 }
+
+// IsSmart 是否为智能地址簿
+func (c *AddressBookCollection) IsSmart() bool {
+	return !c.PeerQuery.IsEmpty()
+}
+
+// 地址簿层级
+const (
+	AddressBookCollectionMaxDepth = 8     // 最大层数
+	AddressBookCollectionPathSep  = " / " // 共享给客户端时的组合名称分隔符, 如 "Site / Building / Floor"
+)
+
+// 删除地址簿时对下级地址簿的处理
+const (
+	AddressBookCollectionDeleteRestrict = "restrict" // 有下级时拒绝删除
+	AddressBookCollectionDeleteCascade  = "cascade"  // 连同所有下级一起删除
+	AddressBookCollectionDeleteReparent = "reparent" // 下级移到被删除地址簿的上级
+)
+
+// AddressBookCollectionNode 地址簿树的节点
+type AddressBookCollectionNode struct {
+	*AddressBookCollection
+	Path      string                       `json:"path"`
+	PeerCount int64                        `json:"peer_count"`
+	Children  []*AddressBookCollectionNode `json:"children"`
+}
+
 type AddressBookCollectionList struct {
 	AddressBookCollection []*AddressBookCollection `json:"list"`
 	Pagination
@@ -62,8 +97,19 @@ type AddressBookCollectionRule struct {
 	Rule         int  `json:"rule" gorm:"default:0;not null;" validate:"required,gte=1,lte=3"` // 0: 无 1: 读 2: 读写  3: 完全控制
 	Type         int  `json:"type" gorm:"default:1;not null;" validate:"required,gte=1,lte=2"` // 1: 个人 2: 群组
 	ToId         uint `json:"to_id" gorm:"default:0;not null;" validate:"required,gt=0"`
+	// 生效时间, 0 表示立即生效
+	StartAt int64 `json:"start_at" gorm:"default:0;not null;" validate:"gte=0"`
+	// 到期时间, 0 表示永久; 到期后立即失效并由定时任务删除
+	EndAt     int64 `json:"end_at" gorm:"default:0;not null;index" validate:"gte=0"`
+	RequestId uint  `json:"request_id" gorm:"default:0;not null;"` // 由访问申请批准生成
 	TimeModel
 }
+
+// IsActive 规则在 now 时是否生效
+func (r *AddressBookCollectionRule) IsActive(now int64) bool {
+	return r.StartAt <= now && (r.EndAt == 0 || r.EndAt > now)
+}
+
 type AddressBookCollectionRuleList struct {
 	AddressBookCollectionRule []*AddressBookCollectionRule `json:"list"`
 	Pagination
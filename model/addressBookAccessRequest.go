@@ -0,0 +1,34 @@
+package model
+
+const (
+	AddressBookAccessRequestPending   = "pending"
+	AddressBookAccessRequestApproved  = "approved"
+	AddressBookAccessRequestDenied    = "denied"
+	AddressBookAccessRequestCancelled = "cancelled" // 申请人撤回
+	AddressBookAccessRequestExpired   = "expired"   // 批准的授权已到期撤销
+)
+
+// AddressBookAccessRequest 申请访问他人的地址簿, 由地址簿所有者或管理员审批
+// 审批结果保留在记录中, 作为授权的审批日志
+type AddressBookAccessRequest struct {
+	IdModel
+	UserId       uint   `json:"user_id" gorm:"default:0;not null;index"`  // 申请人
+	OwnerId      uint   `json:"owner_id" gorm:"default:0;not null;index"` // 地址簿所有者
+	CollectionId uint   `json:"collection_id" gorm:"default:0;not null;index"`
+	Rule         int    `json:"rule" gorm:"default:0;not null;"`
+	StartAt      int64  `json:"start_at" gorm:"default:0;not null;"`
+	EndAt        int64  `json:"end_at" gorm:"default:0;not null;"`
+	Reason       string `json:"reason" gorm:"size:512;default:'';not null;"`
+	Status       string `json:"status" gorm:"default:'pending';not null;index"`
+	// 审批时可以调整权限和有效期, 以规则为准
+	DeciderId    uint   `json:"decider_id" gorm:"default:0;not null;"`
+	DecidedAt    int64  `json:"decided_at" gorm:"default:0;not null;"`
+	DecisionNote string `json:"decision_note" gorm:"size:512;default:'';not null;"`
+	RuleId       uint   `json:"rule_id" gorm:"default:0;not null;"` // 批准后生成或更新的规则
+	TimeModel
+}
+
+type AddressBookAccessRequestList struct {
+	AddressBookAccessRequests []*AddressBookAccessRequest `json:"list"`
+	Pagination
+}
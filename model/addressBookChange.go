@@ -0,0 +1,76 @@
+package model
+
+const (
+	AddressBookChangeTargetPeer       = "peer"       // 地址簿条目, 以设备id为键
+	AddressBookChangeTargetTag        = "tag"        // 标签, 以名称为键
+	AddressBookChangeTargetCollection = "collection" // 地址簿本身, 以id为键
+)
+
+const (
+	AddressBookChangeActionCreate = "create"
+	AddressBookChangeActionUpdate = "update"
+	AddressBookChangeActionDelete = "delete"
+)
+
+const (
+	AddressBookChangeSourceApi     = "api"     // 客户端
+	AddressBookChangeSourceAdmin   = "admin"   // 后台管理
+	AddressBookChangeSourceMy      = "my"      // 后台个人中心
+	AddressBookChangeSourceSync    = "sync"    // 旧版地址簿整体同步
+	AddressBookChangeSourceSmart   = "smart"   // 智能地址簿同步
+	AddressBookChangeSourceRestore = "restore" // 按时间点恢复
+	AddressBookChangeSourceImport  = "import"  // 文件导入
+	AddressBookChangeSourceMerge   = "merge"   // 合并重复设备
+)
+
+// AddressBookChange 地址簿条目、标签和地址簿的变更日志, 只追加
+// 以 用户+地址簿 为范围, 个人地址簿的 CollectionId 为 0
+type AddressBookChange struct {
+	IdModel
+	UserId       uint                   `json:"user_id" gorm:"default:0;not null;index:idx_ab_change_scope"`
+	CollectionId uint                   `json:"collection_id" gorm:"default:0;not null;index:idx_ab_change_scope"`
+	Target       string                 `json:"target" gorm:"default:'';not null;"`
+	TargetKey    string                 `json:"target_key" gorm:"default:'';not null;"`
+	Action       string                 `json:"action" gorm:"default:'';not null;"`
+	Before       *AddressBookChangeData `json:"before" gorm:"type:text;serializer:json;comment:为空表示新增"`
+	After        *AddressBookChangeData `json:"after" gorm:"type:text;serializer:json;comment:为空表示删除"`
+	ActorId      uint                   `json:"actor_id" gorm:"default:0;not null;comment:操作用户, 0为系统"`
+	DeviceUuid   string                 `json:"device_uuid" gorm:"default:'';not null;"`
+	Source       string                 `json:"source" gorm:"default:'';not null;"`
+	RestoreTo    int64                  `json:"restore_to" gorm:"default:0;not null;comment:恢复操作的目标时间点"`
+	ChangedAt    int64                  `json:"changed_at" gorm:"default:0;not null;index"`
+}
+
+type AddressBookChangeList struct {
+	AddressBookChanges []*AddressBookChange `json:"list"`
+	Pagination
+}
+
+// AddressBookChangeData 变更前后的数据, 按 Target 只有一项有值, 条目的密码和 hash 已加密
+type AddressBookChangeData struct {
+	Peer       *AddressBookSnapshot         `json:"peer,omitempty"`
+	Tag        *AddressBookChangeTag        `json:"tag,omitempty"`
+	Collection *AddressBookChangeCollection `json:"collection,omitempty"`
+}
+
+type AddressBookChangeTag struct {
+	Name  string `json:"name"`
+	Color uint   `json:"color"`
+}
+
+type AddressBookChangeCollection struct {
+	Name      string     `json:"name"`
+	PeerQuery *PeerQuery `json:"peer_query"`
+	// 为 nil 是增加层级前的记录, 恢复时不改变上级
+	ParentId *uint `json:"parent_id,omitempty"`
+}
+
+// AddressBookRestoreResult 按时间点恢复的结果
+type AddressBookRestoreResult struct {
+	UserId       uint  `json:"user_id"`
+	CollectionId uint  `json:"collection_id"`
+	RestoreTo    int64 `json:"restore_to"`
+	Created      int   `json:"created"`
+	Updated      int   `json:"updated"`
+	Deleted      int   `json:"deleted"`
+}
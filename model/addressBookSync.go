@@ -0,0 +1,150 @@
+package model
+
+import (
+	"encoding/json"
+
+	"github.com/lejianwen/rustdesk-api/v2/model/custom_types"
+)
+
+const (
+	AddressBookSyncActionInit     = "init"     // 首次读取时为已有数据建立的基线
+	AddressBookSyncActionSync     = "sync"     // 客户端上传
+	AddressBookSyncActionRestore  = "restore"  // 恢复到历史修订
+	AddressBookSyncActionUndelete = "undelete" // 恢复已删除的条目
+)
+
+// AddressBookSync 旧版地址簿(/api/ab)同步历史, 每次同步生成一个修订号, 作为 ETag 下发
+// 快照中的密码和 hash 按字段加密配置加密
+type AddressBookSync struct {
+	IdModel
+	UserId       uint                   `json:"user_id" gorm:"default:0;not null;uniqueIndex:idx_ab_sync_revision"`
+	Revision     uint                   `json:"revision" gorm:"default:0;not null;uniqueIndex:idx_ab_sync_revision"`
+	BaseRevision uint                   `json:"base_revision" gorm:"default:0;not null;comment:客户端上传时基于的修订号"`
+	Action       string                 `json:"action" gorm:"default:'';not null;"`
+	OperatorId   uint                   `json:"operator_id" gorm:"default:0;not null;comment:恢复操作的管理员"`
+	DeviceId     string                 `json:"device_id" gorm:"default:'';not null;"`
+	ClientIp     string                 `json:"client_ip" gorm:"default:'';not null;"`
+	Added        int                    `json:"added" gorm:"default:0;not null;"`
+	Updated      int                    `json:"updated" gorm:"default:0;not null;"`
+	Removed      int                    `json:"removed" gorm:"default:0;not null;"`
+	Merged       bool                   `json:"merged" gorm:"default:0;not null;comment:是否保留了上传中没有的服务端修改"`
+	Conflicts    []string               `json:"conflicts" gorm:"type:text;serializer:json;comment:双方都修改过的条目"`
+	Peers        []*AddressBookSnapshot `json:"peers,omitempty" gorm:"type:text;serializer:json;"`
+	TagColors    map[string]uint        `json:"tag_colors,omitempty" gorm:"type:text;serializer:json;"`
+	TimeModel
+}
+
+type AddressBookSyncList struct {
+	AddressBookSyncs []*AddressBookSync `json:"list"`
+	Pagination
+}
+
+// AddressBookTombstone 同步删除的地址簿条目, 可以恢复
+type AddressBookTombstone struct {
+	IdModel
+	UserId     uint                 `json:"user_id" gorm:"default:0;not null;index"`
+	PeerId     string               `json:"peer_id" gorm:"default:'';not null;index"`
+	Revision   uint                 `json:"revision" gorm:"default:0;not null;comment:删除该条目的修订号"`
+	Peer       *AddressBookSnapshot `json:"peer" gorm:"type:text;serializer:json;"`
+	RestoredAt int64                `json:"restored_at" gorm:"default:0;not null;"`
+	TimeModel
+}
+
+type AddressBookTombstoneList struct {
+	AddressBookTombstones []*AddressBookTombstone `json:"list"`
+	Pagination
+}
+
+// AddressBookSnapshot 地址簿条目中由客户端维护的字段
+type AddressBookSnapshot struct {
+	Id               string   `json:"id"`
+	Username         string   `json:"username"`
+	Password         string   `json:"password"`
+	Hostname         string   `json:"hostname"`
+	Alias            string   `json:"alias"`
+	Platform         string   `json:"platform"`
+	Tags             []string `json:"tags"`
+	Hash             string   `json:"hash"`
+	ForceAlwaysRelay bool     `json:"forceAlwaysRelay"`
+	RdpPort          string   `json:"rdpPort"`
+	RdpUsername      string   `json:"rdpUsername"`
+	LoginName        string   `json:"loginName"`
+	SameServer       bool     `json:"sameServer"`
+}
+
+// AddressBookSnapshotColumns 快照字段对应的列, 用于按快照更新条目
+var AddressBookSnapshotColumns = []string{"username", "password", "hostname", "alias", "platform", "tags", "hash",
+	"force_always_relay", "rdp_port", "rdp_username", "login_name", "same_server"}
+
+// NewAddressBookSnapshot 由条目生成快照, 标签统一为字符串数组
+func NewAddressBookSnapshot(ab *AddressBook) *AddressBookSnapshot {
+	s := &AddressBookSnapshot{
+		Id:               ab.Id,
+		Username:         ab.Username,
+		Password:         ab.Password,
+		Hostname:         ab.Hostname,
+		Alias:            ab.Alias,
+		Platform:         ab.Platform,
+		Tags:             []string{},
+		Hash:             ab.Hash,
+		ForceAlwaysRelay: ab.ForceAlwaysRelay,
+		RdpPort:          ab.RdpPort,
+		RdpUsername:      ab.RdpUsername,
+		LoginName:        ab.LoginName,
+		SameServer:       ab.SameServer,
+	}
+	if len(ab.Tags) > 0 {
+		_ = json.Unmarshal(ab.Tags, &s.Tags)
+	}
+	return s
+}
+
+// ToAddressBook 转为条目, 不含用户和地址簿
+func (s *AddressBookSnapshot) ToAddressBook() *AddressBook {
+	tags := s.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	t, _ := json.Marshal(tags)
+	return &AddressBook{
+		Id:               s.Id,
+		Username:         s.Username,
+		Password:         s.Password,
+		Hostname:         s.Hostname,
+		Alias:            s.Alias,
+		Platform:         s.Platform,
+		Tags:             custom_types.AutoJson(t),
+		Hash:             s.Hash,
+		ForceAlwaysRelay: s.ForceAlwaysRelay,
+		RdpPort:          s.RdpPort,
+		RdpUsername:      s.RdpUsername,
+		LoginName:        s.LoginName,
+		SameServer:       s.SameServer,
+	}
+}
+
+// Seal 加密快照中的密码和 hash, 用于存入历史
+func (s *AddressBookSnapshot) Seal() (*AddressBookSnapshot, error) {
+	c := *s
+	var err error
+	if c.Password, err = custom_types.EncryptString(c.Password); err != nil {
+		return nil, err
+	}
+	if c.Hash, err = custom_types.EncryptString(c.Hash); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Open 解密 Seal 加密的字段
+func (s *AddressBookSnapshot) Open() (*AddressBookSnapshot, error) {
+	c := *s
+	var err error
+	if c.Password, err = custom_types.DecryptString(c.Password); err != nil {
+		return nil, err
+	}
+	if c.Hash, err = custom_types.DecryptString(c.Hash); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
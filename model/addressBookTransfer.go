@@ -0,0 +1,48 @@
+package model
+
+// 地址簿导入导出格式
+const (
+	AddressBookFormatCsv      = "csv"
+	AddressBookFormatJson     = "json"     // 本系统的导出格式, 标签带颜色
+	AddressBookFormatRustdesk = "rustdesk" // RustDesk 客户端 /api/ab 的 data 内容, 即 {"tags":[],"peers":[],"tag_colors":"{}"}
+)
+
+// 导入时地址簿中已有相同 ID 条目的处理方式
+const (
+	AddressBookImportSkip      = "skip"      // 跳过
+	AddressBookImportOverwrite = "overwrite" // 用导入数据覆盖已映射的字段
+	AddressBookImportDuplicate = "duplicate" // 仍然新建一条
+)
+
+// 导入行的处理结果
+const (
+	AddressBookImportActionCreate  = "create"
+	AddressBookImportActionUpdate  = "update"
+	AddressBookImportActionSkip    = "skip"
+	AddressBookImportActionInvalid = "invalid"
+)
+
+// AddressBookImportRow 导入的一行, 预览时 Action 为将要执行的操作
+type AddressBookImportRow struct {
+	Line int                  `json:"line"` // csv 为文件行号, json 为 peers 中的序号, 均从 1 开始
+	Peer *AddressBookSnapshot `json:"peer"` // 不含密码和 hash
+	// 从设备信息补全的字段
+	Filled []string `json:"filled,omitempty"`
+	Action string   `json:"action"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// AddressBookImportReport 导入预览或导入结果
+type AddressBookImportReport struct {
+	Columns []string `json:"columns"` // 文件中的列
+	// 字段 => 列, 未提交映射时为自动识别的结果
+	Mapping  map[string]string       `json:"mapping"`
+	Strategy string                  `json:"strategy"`
+	Rows     []*AddressBookImportRow `json:"rows"`
+	// 导入的标签及颜色, 包含未被条目使用的标签
+	Tags    map[string]uint `json:"tags"`
+	Created int             `json:"created"`
+	Updated int             `json:"updated"`
+	Skipped int             `json:"skipped"`
+	Invalid int             `json:"invalid"`
+}
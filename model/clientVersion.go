@@ -0,0 +1,30 @@
+package model
+
+// 客户端版本合规状态
+const (
+	ClientVersionUnknown      = "unknown"      // 设备组未配置版本策略或版本无法识别
+	ClientVersionCompliant    = "compliant"    // 不低于推荐版本
+	ClientVersionOutdated     = "outdated"     // 低于推荐版本, 建议升级
+	ClientVersionNonCompliant = "noncompliant" // 低于最低版本
+)
+
+// PeerCompliance 设备的客户端版本合规情况
+type PeerCompliance struct {
+	RowId              uint   `json:"row_id"`
+	Id                 string `json:"id"`
+	Hostname           string `json:"hostname"`
+	Version            string `json:"version"`
+	DeviceGroupId      uint   `json:"device_group_id"`
+	DeviceGroupName    string `json:"device_group_name"`
+	MinVersion         string `json:"min_version"`
+	RecommendedVersion string `json:"recommended_version"`
+	Status             string `json:"status"`
+	Enforced           bool   `json:"enforced"`
+	LastOnlineTime     int64  `json:"last_online_time"`
+}
+
+type PeerComplianceReport struct {
+	PeerCompliances []*PeerCompliance `json:"list"`
+	Summary         map[string]int64  `json:"summary"` // 各状态的设备数
+	Pagination
+}
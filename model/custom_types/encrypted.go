@@ -0,0 +1,85 @@
+package custom_types
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/lejianwen/rustdesk-api/v2/lib/fieldcrypt"
+	"gorm.io/gorm/schema"
+)
+
+var keyring atomic.Pointer[fieldcrypt.Keyring]
+
+func init() {
+	schema.RegisterSerializer("encrypted", EncryptedSerializer{})
+}
+
+// SetKeyring 设置字段加密用的密钥, 为 nil 时新写入的值保持明文
+func SetKeyring(kr *fieldcrypt.Keyring) {
+	keyring.Store(kr)
+}
+
+// Keyring 当前的字段加密密钥
+func Keyring() *fieldcrypt.Keyring {
+	return keyring.Load()
+}
+
+// EncryptString 加密字符串, 未配置密钥、空值或已加密的值原样返回
+// Updates(map) 不经过 serializer, 按 map 更新加密字段时需要先调用
+func EncryptString(s string) (string, error) {
+	kr := keyring.Load()
+	if kr == nil || s == "" || fieldcrypt.IsEncrypted(s) {
+		return s, nil
+	}
+	return kr.Encrypt([]byte(s))
+}
+
+// DecryptString 解密字符串, 未加密的历史数据原样返回
+func DecryptString(s string) (string, error) {
+	if !fieldcrypt.IsEncrypted(s) {
+		return s, nil
+	}
+	kr := keyring.Load()
+	if kr == nil {
+		return "", fieldcrypt.ErrNoKey
+	}
+	b, err := kr.Decrypt(s)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// EncryptedSerializer 字符串字段加密存储, 用法 `gorm:"serializer:encrypted"`
+type EncryptedSerializer struct{}
+
+// Scan implements serializer interface
+func (EncryptedSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var s string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("failed to scan encrypted value: %#v", dbValue)
+	}
+	plain, err := DecryptString(s)
+	if err != nil {
+		return fmt.Errorf("decrypt %s: %w", field.DBName, err)
+	}
+	field.ReflectValueOf(ctx, dst).SetString(plain)
+	return nil
+}
+
+// Value implements serializer interface
+func (EncryptedSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	s, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid field type %#v for EncryptedSerializer, only string supported", fieldValue)
+	}
+	return EncryptString(s)
+}
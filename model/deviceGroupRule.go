@@ -0,0 +1,38 @@
+package model
+
+// DeviceGroupRule 设备组自动分配规则
+// 设备上报 SysInfo 或心跳 IP 变化时按优先级匹配, 所有非空条件都满足才命中
+// 设备标签和属性只在设备入库后才有, 新设备首次上报时不会命中这类条件
+type DeviceGroupRule struct {
+	IdModel
+	Name          string     `json:"name" gorm:"default:'';not null;"`
+	DeviceGroupId uint       `json:"device_group_id" gorm:"default:0;not null;index"`
+	Priority      int        `json:"priority" gorm:"default:0;not null;"`        // 数字越大优先级越高
+	HostnameRegex string     `json:"hostname_regex" gorm:"default:'';not null;"` // 主机名正则
+	Os            string     `json:"os" gorm:"default:'';not null;"`             // 操作系统, 不区分大小写的包含匹配
+	UserGroupId   uint       `json:"user_group_id" gorm:"default:0;not null;"`   // 设备所属用户的用户组
+	Cidr          string     `json:"cidr" gorm:"default:'';not null;"`           // 设备来源 IP 网段
+	Tag           string     `json:"tag" gorm:"default:'';not null;"`            // 设备在地址簿中带有的标签
+	PeerLabel     string     `json:"peer_label" gorm:"default:'';not null;"`     // 管理员为设备打的标签
+	PeerAttribute string     `json:"peer_attribute" gorm:"default:'';not null;"` // 设备自定义属性, name=value 或 name~value
+	Status        StatusCode `json:"status" gorm:"default:1;not null;"`
+	TimeModel
+}
+
+// HasCondition 至少配置了一个匹配条件
+func (r *DeviceGroupRule) HasCondition() bool {
+	return r.HostnameRegex != "" || r.Os != "" || r.UserGroupId > 0 || r.Cidr != "" || r.Tag != "" ||
+		r.PeerLabel != "" || r.PeerAttribute != ""
+}
+
+type DeviceGroupRuleList struct {
+	DeviceGroupRules []*DeviceGroupRule `json:"list"`
+	Pagination
+}
+
+// DeviceGroupRuleResult 重新评估的结果
+type DeviceGroupRuleResult struct {
+	Total    int `json:"total"`    // 评估的设备数
+	Assigned int `json:"assigned"` // 设备组发生变化的设备数
+	Skipped  int `json:"skipped"`  // 手动分配而跳过的设备数
+}
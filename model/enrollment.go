@@ -0,0 +1,67 @@
+package model
+
+import "time"
+
+// EnrollmentLink 自助注册链接
+// 兑换时注册用户(或通过 OAuth 绑定), 下发服务器配置, 并在设备首次上报 SysInfo 时分配设备组
+type EnrollmentLink struct {
+	IdModel
+	Name           string        `json:"name" gorm:"default:'';not null;"`
+	Token          string        `json:"token" gorm:"uniqueIndex;not null;"`
+	GroupId        uint          `json:"group_id" gorm:"default:0;not null;"`        // 新注册用户所属用户组
+	DeviceGroupId  uint          `json:"device_group_id" gorm:"default:0;not null;"` // 设备首次上报时分配的设备组
+	ServerConfigId uint          `json:"server_config_id" gorm:"default:0;not null;index"`
+	ServerConfig   *ServerConfig `json:"server_config,omitempty" gorm:"foreignKey:ServerConfigId"`
+	ConfigCodeId   uint          `json:"config_code_id" gorm:"default:0;not null;"` // 下发配置使用的配置码
+	AllowRegister  *bool         `json:"allow_register" gorm:"default:true;not null;"`
+	AllowOauth     *bool         `json:"allow_oauth" gorm:"default:true;not null;"`
+	ExpiresAt      *time.Time    `json:"expires_at"`
+	MaxUses        int           `json:"max_uses" gorm:"default:0;not null;"` // 0 表示不限制
+	UseCount       int           `json:"use_count" gorm:"default:0;not null;"`
+	CreatedBy      uint          `json:"created_by" gorm:"default:0;not null;"`
+	Status         StatusCode    `json:"status" gorm:"default:1;not null;"`
+	TimeModel
+}
+
+// IsExpired 是否过期
+func (l *EnrollmentLink) IsExpired() bool {
+	return l.ExpiresAt != nil && time.Now().After(*l.ExpiresAt)
+}
+
+// IsExhausted 是否已达到使用次数
+func (l *EnrollmentLink) IsExhausted() bool {
+	return l.MaxUses > 0 && l.UseCount >= l.MaxUses
+}
+
+type EnrollmentLinkList struct {
+	EnrollmentLinks []*EnrollmentLink `json:"list"`
+	Pagination
+}
+
+// Enrollment 注册记录, AssignedAt 为 0 表示设备还未上报, 设备组待分配
+type Enrollment struct {
+	IdModel
+	EnrollmentLinkId uint   `json:"enrollment_link_id" gorm:"default:0;not null;index"`
+	UserId           uint   `json:"user_id" gorm:"default:0;not null;index"`
+	User             *User  `json:"user,omitempty"`
+	Registered       bool   `json:"registered" gorm:"default:false;not null;"` // 是否通过链接新注册的用户
+	Method           string `json:"method" gorm:"default:'';not null;"`
+	Uuid             string `json:"uuid" gorm:"default:'';not null;index"`
+	DeviceId         string `json:"device_id" gorm:"default:'';not null;"`
+	DeviceGroupId    uint   `json:"device_group_id" gorm:"default:0;not null;"`
+	AssignedAt       int64  `json:"assigned_at" gorm:"default:0;not null;"`
+	ClientIp         string `json:"client_ip" gorm:"default:'';not null;"`
+	TimeModel
+}
+
+// 注册方式
+const (
+	EnrollmentMethodRegister = "register"
+	EnrollmentMethodOauth    = "oauth"
+	EnrollmentMethodLogin    = "login"
+)
+
+type EnrollmentList struct {
+	Enrollments []*Enrollment `json:"list"`
+	Pagination
+}
@@ -0,0 +1,9 @@
+package model
+
+// FieldEncryptionResult 加密字段迁移结果, 按表和字段统计
+type FieldEncryptionResult struct {
+	Table     string `json:"table"`
+	Column    string `json:"column"`
+	Total     int    `json:"total"`
+	Rewritten int    `json:"rewritten"`
+}
@@ -19,7 +19,10 @@ type GroupList struct {
 
 type DeviceGroup struct {
 	IdModel
-	Name string `json:"name" gorm:"default:'';not null;"`
+	Name               string `json:"name" gorm:"default:'';not null;"`
+	MinVersion         string `json:"min_version" gorm:"default:'';not null;"`         // 最低客户端版本, 低于此版本为不合规
+	RecommendedVersion string `json:"recommended_version" gorm:"default:'';not null;"` // 推荐客户端版本, 低于此版本提示升级
+	EnforceVersion     bool   `json:"enforce_version" gorm:"default:0;not null;"`      // 登录和地址簿中标记不合规设备
 	TimeModel
 }
 
@@ -0,0 +1,29 @@
+package model
+
+const (
+	IpBlockSourceManual       = "manual"
+	IpBlockSourceLoginLimiter = "login-limiter"
+	IpBlockSourceImport       = "import"
+)
+
+// IpBlock IP黑名单, 同步到 hbbs/hbbr 并由API限流中间件执行
+type IpBlock struct {
+	IdModel
+	Cidr      string `json:"cidr" gorm:"default:'';not null;uniqueIndex"`
+	Reason    string `json:"reason" gorm:"default:'';not null;"`
+	Source    string `json:"source" gorm:"default:'manual';not null;index"`
+	ExpiredAt int64  `json:"expired_at" gorm:"default:0;not null;index"` // 0 表示永久
+	SyncedAt  int64  `json:"synced_at" gorm:"default:0;not null;"`
+	SyncError string `json:"sync_error" gorm:"default:'';not null;"`
+	TimeModel
+}
+
+type IpBlockList struct {
+	IpBlocks []*IpBlock `json:"list"`
+	Pagination
+}
+
+// IsExpired 是否已过期
+func (b *IpBlock) IsExpired(now int64) bool {
+	return b.ExpiredAt > 0 && b.ExpiredAt <= now
+}
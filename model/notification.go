@@ -0,0 +1,26 @@
+package model
+
+// 通知类型
+const (
+	NotificationShareOpened = "share_opened" // 分享链接被打开
+)
+
+// Notification 站内通知
+type Notification struct {
+	IdModel
+	UserId  uint   `json:"user_id" gorm:"default:0;not null;index"`
+	Type    string `json:"type" gorm:"default:'';not null;index"`
+	Title   string `json:"title" gorm:"default:'';not null;"`
+	Content string `json:"content" gorm:"type:text;"`
+	// 关联的业务数据, 如 share_record_id
+	Data   map[string]interface{} `json:"data" gorm:"type:text;serializer:json;"`
+	ReadAt int64                  `json:"read_at" gorm:"default:0;not null;index"`
+	TimeModel
+}
+
+// NotificationList 通知列表
+type NotificationList struct {
+	Notifications []*Notification `json:"list"`
+	Unread        int64           `json:"unread"`
+	Pagination
+}
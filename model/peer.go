@@ -15,7 +15,11 @@ type Peer struct {
 	LastOnlineTime int64  `json:"last_online_time"  gorm:"default:0;not null;"`
 	LastOnlineIp   string `json:"last_online_ip"  gorm:"default:'';not null;"`
 	GroupId        uint   `json:"group_id"  gorm:"default:0;not null;index"`
+	GroupRuleId    uint   `json:"group_rule_id"  gorm:"default:0;not null;"` // 自动分配设备组的规则, 0 表示手动分配或未分配
 	Alias          string `json:"alias" gorm:"default:'';not null;index"`
+	// 标签和自定义属性单独存储, 列表接口按需填充
+	Labels     []string          `json:"labels,omitempty" gorm:"-"`
+	Attributes map[string]string `json:"attributes,omitempty" gorm:"-"`
 	TimeModel
 }
 
@@ -0,0 +1,62 @@
+package model
+
+// 自定义属性类型
+const (
+	PeerAttributeString = "string"
+	PeerAttributeNumber = "number"
+	PeerAttributeBool   = "bool"
+	PeerAttributeDate   = "date" // 2006-01-02
+	PeerAttributeEmail  = "email"
+)
+
+var PeerAttributeTypes = []string{PeerAttributeString, PeerAttributeNumber, PeerAttributeBool, PeerAttributeDate, PeerAttributeEmail}
+
+// PeerAttributeDefinition 设备自定义属性定义, 如资产编号、位置、成本中心、负责人邮箱
+type PeerAttributeDefinition struct {
+	IdModel
+	Name  string `json:"name" gorm:"size:64;uniqueIndex;not null;"` // 属性键, 小写字母、数字和下划线
+	Title string `json:"title" gorm:"default:'';not null;"`
+	Type  string `json:"type" gorm:"default:'string';not null;"`
+	TimeModel
+}
+
+type PeerAttributeDefinitionList struct {
+	PeerAttributeDefinitions []*PeerAttributeDefinition `json:"list"`
+	Pagination
+}
+
+// PeerAttribute 设备的自定义属性值, 按类型规范化后存储
+type PeerAttribute struct {
+	IdModel
+	PeerRowId uint   `json:"peer_row_id" gorm:"default:0;not null;uniqueIndex:idx_peer_attribute"`
+	Name      string `json:"name" gorm:"size:64;not null;uniqueIndex:idx_peer_attribute;index"`
+	Value     string `json:"value" gorm:"default:'';not null;"`
+	TimeModel
+}
+
+// PeerLabel 管理员为设备打的标签, 与地址簿中的标签相互独立
+type PeerLabel struct {
+	IdModel
+	PeerRowId uint   `json:"peer_row_id" gorm:"default:0;not null;uniqueIndex:idx_peer_label"`
+	Name      string `json:"name" gorm:"size:64;not null;uniqueIndex:idx_peer_label;index"`
+	TimeModel
+}
+
+// 属性筛选操作
+const (
+	PeerAttributeOpEq       = "="
+	PeerAttributeOpContains = "~"
+)
+
+// PeerAttributeFilter 属性筛选条件, 文本形式为 name=value 或 name~value
+type PeerAttributeFilter struct {
+	Name  string `json:"name"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+// PeerAttributeSet 设备的标签和属性
+type PeerAttributeSet struct {
+	Labels     []string          `json:"labels"`
+	Attributes map[string]string `json:"attributes"`
+}
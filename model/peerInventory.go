@@ -0,0 +1,63 @@
+package model
+
+// SysInfo 中记录变更历史的字段
+const (
+	PeerInventoryCpu      = "cpu"
+	PeerInventoryMemory   = "memory"
+	PeerInventoryOs       = "os"
+	PeerInventoryHostname = "hostname"
+	PeerInventoryUsername = "username"
+	PeerInventoryVersion  = "version"
+)
+
+// PeerInventoryFields 按固定顺序列出记录历史的字段
+var PeerInventoryFields = []string{
+	PeerInventoryCpu,
+	PeerInventoryMemory,
+	PeerInventoryOs,
+	PeerInventoryHostname,
+	PeerInventoryUsername,
+	PeerInventoryVersion,
+}
+
+// PeerInventoryChange 设备 SysInfo 字段的一次变更
+type PeerInventoryChange struct {
+	IdModel
+	PeerRowId uint   `json:"peer_row_id" gorm:"default:0;not null;index"`
+	PeerId    string `json:"peer_id" gorm:"default:'';not null;index"`
+	Uuid      string `json:"uuid" gorm:"default:'';not null;"`
+	Field     string `json:"field" gorm:"default:'';not null;index:idx_peer_inventory_field_time"`
+	OldValue  string `json:"old_value" gorm:"type:text"`
+	NewValue  string `json:"new_value" gorm:"type:text"`
+	ChangedAt int64  `json:"changed_at" gorm:"default:0;not null;index:idx_peer_inventory_field_time"`
+}
+
+type PeerInventoryChangeList struct {
+	PeerInventoryChanges []*PeerInventoryChange `json:"list"`
+	Pagination
+}
+
+// PeerInventoryCount 按字段当前值统计的设备数
+type PeerInventoryCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// InventoryValue 取 SysInfo 字段的值
+func (p *Peer) InventoryValue(field string) string {
+	switch field {
+	case PeerInventoryCpu:
+		return p.Cpu
+	case PeerInventoryMemory:
+		return p.Memory
+	case PeerInventoryOs:
+		return p.Os
+	case PeerInventoryHostname:
+		return p.Hostname
+	case PeerInventoryUsername:
+		return p.Username
+	case PeerInventoryVersion:
+		return p.Version
+	}
+	return ""
+}
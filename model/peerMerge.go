@@ -0,0 +1,60 @@
+package model
+
+// 重复设备评分, 机器重装后 id 和 uuid 会变化, 主机名和硬件通常不变
+const (
+	PeerDuplicateScoreUuid     = 50
+	PeerDuplicateScoreHostname = 30
+	PeerDuplicateScoreUsername = 10
+	PeerDuplicateScoreIp       = 10
+	PeerDuplicateScoreCpu      = 10
+	PeerDuplicateScoreMemory   = 5
+	// PeerDuplicateMinScore 默认的最低分数, 主机名相同时还需要另一项相同
+	PeerDuplicateMinScore = 40
+)
+
+// 相同的字段
+const (
+	PeerDuplicateReasonUuid     = "uuid"
+	PeerDuplicateReasonHostname = "hostname"
+	PeerDuplicateReasonUsername = "username"
+	PeerDuplicateReasonIp       = "ip"
+	PeerDuplicateReasonCpu      = "cpu"
+	PeerDuplicateReasonMemory   = "memory"
+)
+
+// PeerDuplicate 疑似同一台机器的两条记录, Peer 为建议保留的设备, Duplicate 为建议合并掉的设备
+// Duplicate.RowId 为 0 时表示设备已不存在, 只有地址簿条目还在引用该 id
+type PeerDuplicate struct {
+	Peer      *Peer    `json:"peer"`
+	Duplicate *Peer    `json:"duplicate"`
+	Score     int      `json:"score"`
+	Reasons   []string `json:"reasons"`
+}
+
+// PeerAlias 被合并设备的旧 id, 旧 id 仍能解析到保留的设备
+type PeerAlias struct {
+	IdModel
+	AliasId    string `json:"alias_id" gorm:"size:255;not null;uniqueIndex"`
+	PeerRowId  uint   `json:"peer_row_id" gorm:"default:0;not null;index"`
+	Uuid       string `json:"uuid" gorm:"default:'';not null;"` // 被合并设备的 uuid
+	Hostname   string `json:"hostname" gorm:"default:'';not null;"`
+	OperatorId uint   `json:"operator_id" gorm:"default:0;not null;"`
+	Peer       *Peer  `json:"peer,omitempty" gorm:"foreignKey:PeerRowId;references:RowId"`
+	TimeModel
+}
+
+type PeerAliasList struct {
+	PeerAliases []*PeerAlias `json:"list"`
+	Pagination
+}
+
+// PeerMergeResult 合并时迁移的记录数
+type PeerMergeResult struct {
+	Peers        int   `json:"peers"` // 删除的重复设备数
+	Aliases      int   `json:"aliases"`
+	AddressBooks int   `json:"address_books"` // 改为保留设备 id 或并入已有条目的地址簿条目数
+	Audits       int64 `json:"audits"`        // 连接、文件传输和登录日志
+	Inventory    int64 `json:"inventory"`
+	ShareRecords int64 `json:"share_records"`
+	UserBound    bool  `json:"user_bound"` // 保留的设备从重复设备继承了用户绑定
+}
@@ -0,0 +1,27 @@
+package model
+
+// PeerQuery 保存的设备查询, 用于智能地址簿, 所有非空条件都须满足
+type PeerQuery struct {
+	DeviceGroupIds   []uint   `json:"device_group_ids"`
+	UserIds          []uint   `json:"user_ids"`
+	Os               string   `json:"os"`                 // 操作系统包含
+	Hostname         string   `json:"hostname"`           // 主机名包含
+	OnlineWithinDays int      `json:"online_within_days"` // 最近多少天内在线
+	Labels           []string `json:"labels"`             // 设备标签, 须全部带有
+	Attrs            []string `json:"attrs"`              // 设备属性, name=value 或 name~value
+}
+
+// IsEmpty 没有任何条件, 视为普通地址簿
+func (q *PeerQuery) IsEmpty() bool {
+	return q == nil || (len(q.DeviceGroupIds) == 0 && len(q.UserIds) == 0 && q.Os == "" && q.Hostname == "" &&
+		q.OnlineWithinDays <= 0 && len(q.Labels) == 0 && len(q.Attrs) == 0)
+}
+
+// SmartCollectionSyncResult 智能地址簿同步结果
+type SmartCollectionSyncResult struct {
+	CollectionId uint `json:"collection_id"`
+	Total        int  `json:"total"`   // 匹配的设备数
+	Added        int  `json:"added"`   // 新增的地址簿条目
+	Removed      int  `json:"removed"` // 不再匹配而删除的条目
+	Updated      int  `json:"updated"` // 主机名等信息更新的条目
+}
@@ -0,0 +1,42 @@
+package model
+
+// RelayUsage hbbr 负载采样, 由 usage 和带宽命令的输出解析而来
+type RelayUsage struct {
+	IdModel
+	EndpointId          uint    `json:"endpoint_id" gorm:"default:0;not null;index"` // 0 表示本机
+	EndpointName        string  `json:"endpoint_name" gorm:"default:'';not null;"`
+	Connections         int     `json:"connections" gorm:"default:0;not null;"`           // 当前中继连接数
+	TotalMb             float64 `json:"total_mb" gorm:"default:0;not null;"`              // 当前连接累计流量
+	SpeedKbps           int64   `json:"speed_kbps" gorm:"default:0;not null;"`            // 当前连接实时速率之和
+	HighestKbps         int64   `json:"highest_kbps" gorm:"default:0;not null;"`          // 单连接最高速率
+	TotalBandwidthMbps  float64 `json:"total_bandwidth_mbps" gorm:"default:0;not null;"`  // total-bandwidth
+	SingleBandwidthMbps float64 `json:"single_bandwidth_mbps" gorm:"default:0;not null;"` // single-bandwidth
+	LimitSpeedMbps      float64 `json:"limit_speed_mbps" gorm:"default:0;not null;"`      // limit-speed
+	Error               string  `json:"error" gorm:"default:'';not null;"`
+	CollectedAt         int64   `json:"collected_at" gorm:"default:0;not null;index"`
+	TimeModel
+}
+
+type RelayUsageList struct {
+	RelayUsages []*RelayUsage `json:"list"`
+	Pagination
+}
+
+// RelayUsageConn usage 命令中的单条连接
+type RelayUsageConn struct {
+	Ip          string  `json:"ip"`
+	ElapsedSec  int64   `json:"elapsed_sec"`
+	TotalMb     float64 `json:"total_mb"`
+	HighestKbps int64   `json:"highest_kbps"`
+	AvgKbps     int64   `json:"avg_kbps"`
+	SpeedKbps   int64   `json:"speed_kbps"`
+}
+
+// RelayUsagePoint 时间序列中的一个点, 按采样时间聚合全部端点
+type RelayUsagePoint struct {
+	Time        int64   `json:"time"`
+	Connections int     `json:"connections"`
+	TotalMb     float64 `json:"total_mb"`
+	SpeedKbps   int64   `json:"speed_kbps"`
+	HighestKbps int64   `json:"highest_kbps"`
+}
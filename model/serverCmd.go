@@ -20,6 +20,36 @@ const (
 	ServerCmdTargetRelayServer = "21117"
 )
 
+// ServerCmdEndpoint hbbs/hbbr 命令端点
+// hbbs/hbbr 只接受本机的命令连接, 远程端点需要在对端运行 apimain cmd-proxy,
+// Secret 非空时作为第一行发送给代理校验, 不通过接口返回, 只返回 SecretSet
+type ServerCmdEndpoint struct {
+	IdModel
+	Name           string     `json:"name" gorm:"default:'';not null;" validate:"required"`
+	Host           string     `json:"host" gorm:"default:'';not null;"` // 为空表示本机
+	Port           int        `json:"port" gorm:"default:0;not null;" validate:"gte=0,lte=65535"` // 为0时本机使用命令端口, 远程使用命令代理默认端口21120
+	Target         string     `json:"target" gorm:"default:'';not null;index" validate:"required,oneof=21115 21117"`
+	Secret         string     `json:"-" gorm:"size:1024;default:'';not null;serializer:encrypted;"`
+	SecretSet      bool       `json:"secret_set" gorm:"-"`
+	ServerConfigId uint       `json:"server_config_id" gorm:"default:0;not null;index"`
+	Status         StatusCode `json:"status" gorm:"default:1;not null;"`
+	TimeModel
+}
+
+type ServerCmdEndpointList struct {
+	ServerCmdEndpoints []*ServerCmdEndpoint `json:"list"`
+	Pagination
+}
+
+// ServerCmdResult 单个端点的命令执行结果
+type ServerCmdResult struct {
+	EndpointId uint   `json:"endpoint_id"`
+	Name       string `json:"name"`
+	Addr       string `json:"addr"`
+	Result     string `json:"result"`
+	Error      string `json:"error"`
+}
+
 var SysIdServerCmds = []*ServerCmd{
 	{Cmd: "h", Option: "", Explain: "show help", Target: ServerCmdTargetIdServer},
 	{Cmd: "relay-servers", Alias: "rs", Option: "<separated by ,>", Explain: "set or show relay servers", Target: ServerCmdTargetIdServer},
@@ -21,10 +21,21 @@ type ServerConfig struct {
 	IdServer    string     `json:"id_server" gorm:"not null;comment:ID服务器地址"`
 	RelayServer string     `json:"relay_server" gorm:"comment:中继服务器地址"`
 	ApiServer   string     `json:"api_server" gorm:"comment:API服务器地址"`
-	Key         string     `json:"key" gorm:"comment:服务器密钥"`
+	Key         string     `json:"key" gorm:"size:1024;serializer:encrypted;comment:服务器密钥"`
 	IsEnabled   *bool      `json:"is_enabled" gorm:"default:false;not null;comment:是否启用"`
 	IsDefault   *bool      `json:"is_default" gorm:"default:false;not null;comment:是否为默认配置"`
 	Priority    int        `json:"priority" gorm:"default:0;comment:优先级，数字越大优先级越高"`
+	GroupIds    []uint     `json:"group_ids" gorm:"type:text;serializer:json;comment:限定的用户组，为空表示不限"`
+	// 健康检查结果, 由 ServerHealthService 定时更新
+	HealthStatus    string `json:"health_status" gorm:"default:'unknown';not null;comment:健康状态"`
+	HealthFails     int    `json:"health_fails" gorm:"default:0;not null;comment:连续失败次数"`
+	HealthLatencyMs int64  `json:"health_latency_ms" gorm:"default:0;not null;comment:ID服务器延迟"`
+	HealthError     string `json:"health_error" gorm:"default:'';not null;comment:最近一次失败原因"`
+	HealthCheckedAt int64  `json:"health_checked_at" gorm:"default:0;not null;comment:最近检查时间"`
+	// 修订号和密钥轮换, 宽限期内同时下发新旧密钥
+	Revision         int    `json:"revision" gorm:"default:0;not null;comment:当前修订号"`
+	PreviousKey      string `json:"previous_key" gorm:"type:text;serializer:encrypted;comment:轮换前的密钥"`
+	PreviousKeyUntil int64  `json:"previous_key_until" gorm:"default:0;not null;comment:旧密钥下发截止时间"`
 	Status      StatusCode `json:"status" gorm:"default:1;not null;comment:状态"`
 	TimeModel
 }
@@ -41,6 +52,43 @@ type ConfigCode struct {
 	CreatedBy      uint       `json:"created_by" gorm:"not null;index;comment:创建者用户ID"`
 	Creator        *User      `json:"creator,omitempty" gorm:"foreignKey:CreatedBy"`
 	Status         StatusCode `json:"status" gorm:"default:1;not null;comment:状态"`
+	Kid            string     `json:"kid" gorm:"default:'';not null;index;comment:签名密钥ID"`
+	Audience       string     `json:"audience" gorm:"default:'';not null;comment:签名受众"`
+	SignedCode     string     `json:"signed_code" gorm:"type:text;serializer:encrypted;comment:Ed25519签名配置码"`
+	ConfigCodeBinding
+	BoundUuid    string `json:"bound_uuid" gorm:"default:'';not null;comment:绑定的设备UUID"`
+	RevokedAt    int64  `json:"revoked_at" gorm:"default:0;not null;comment:吊销时间"`
+	RevokeReason string `json:"revoke_reason" gorm:"default:'';not null;comment:吊销原因"`
+	RevisionId   uint   `json:"revision_id" gorm:"default:0;not null;comment:固定的配置修订ID, 0表示始终使用最新"`
+	TimeModel
+}
+
+// ConfigCodeBinding 配置码兑换限制, 为空表示不限制
+type ConfigCodeBinding struct {
+	BindDevice      bool     `json:"bind_device" gorm:"default:false;not null;comment:首次兑换后绑定设备UUID"`
+	AllowedUserIds  []uint   `json:"allowed_user_ids" gorm:"type:text;serializer:json;comment:允许兑换的用户"`
+	AllowedGroupIds []uint   `json:"allowed_group_ids" gorm:"type:text;serializer:json;comment:允许兑换的用户组"`
+	AllowedCidrs    []string `json:"allowed_cidrs" gorm:"type:text;serializer:json;comment:允许兑换的来源网段"`
+}
+
+// RequireUser 是否需要登录后兑换
+func (b *ConfigCodeBinding) RequireUser() bool {
+	return len(b.AllowedUserIds) > 0 || len(b.AllowedGroupIds) > 0
+}
+
+// IsRevoked 是否已吊销
+func (cc *ConfigCode) IsRevoked() bool {
+	return cc.RevokedAt > 0
+}
+
+// ConfigSigningKey 配置码签名密钥, 轮换后旧密钥保留到其签发的配置码全部过期
+type ConfigSigningKey struct {
+	IdModel
+	Kid        string `json:"kid" gorm:"default:'';not null;uniqueIndex;comment:密钥ID"`
+	PublicKey  string `json:"public_key" gorm:"type:text;not null;comment:公钥base64"`
+	PrivateKey string `json:"-" gorm:"type:text;not null;serializer:encrypted;comment:私钥base64"`
+	Active     bool   `json:"active" gorm:"default:false;not null;comment:是否为当前签名密钥"`
+	RetiredAt  int64  `json:"retired_at" gorm:"default:0;not null;comment:轮换时间"`
 	TimeModel
 }
 
@@ -52,15 +100,34 @@ type ConfigCodeUsage struct {
 	ClientIP     string     `json:"client_ip" gorm:"comment:客户端IP"`
 	UserAgent    string     `json:"user_agent" gorm:"comment:用户代理"`
 	UsedAt       time.Time  `json:"used_at" gorm:"not null;comment:使用时间"`
+	DeviceId     string     `json:"device_id" gorm:"default:'';not null;index;comment:设备ID"`
+	Uuid         string     `json:"uuid" gorm:"default:'';not null;index;comment:设备UUID"`
+	UserId       uint       `json:"user_id" gorm:"default:0;not null;comment:兑换用户ID"`
+	// 配置码吊销后在设备下次心跳时通知, 记录通知时间
+	RevokeNotifiedAt int64 `json:"revoke_notified_at" gorm:"default:0;not null;comment:吊销通知时间"`
 	TimeModel
 }
 
+// ConfigCodeRevokeNotice 心跳中下发的吊销通知
+type ConfigCodeRevokeNotice struct {
+	Code           string `json:"code"`
+	ServerConfigId uint   `json:"server_config_id"`
+	RevokedAt      int64  `json:"revoked_at"`
+	Reason         string `json:"reason"`
+}
+
 // ServerConfigList 服务器配置列表
 type ServerConfigList struct {
 	ServerConfigs []*ServerConfig `json:"list"`
 	Pagination
 }
 
+// ConfigCodeUsageList 配置码使用记录列表
+type ConfigCodeUsageList struct {
+	ConfigCodeUsages []*ConfigCodeUsage `json:"list"`
+	Pagination
+}
+
 // ConfigCodeList 配置码列表  
 type ConfigCodeList struct {
 	ConfigCodes []*ConfigCode `json:"list"`
@@ -75,6 +142,32 @@ type ClientServerConfig struct {
 	RelayServer string `json:"relay_server"`
 	ApiServer   string `json:"api_server"`
 	Key         string `json:"key"`
+	PreviousKey string `json:"previous_key,omitempty"` // 密钥轮换宽限期内的旧密钥
+}
+
+// RustdeskImportString RustDesk 客户端导入服务器配置使用的字符串, 即配置 JSON 的 base64url 编码反转
+func (c *ClientServerConfig) RustdeskImportString() string {
+	b, _ := json.Marshal(map[string]string{
+		"host":  c.IdServer,
+		"relay": c.RelayServer,
+		"api":   c.ApiServer,
+		"key":   c.Key,
+	})
+	r := []byte(base64.URLEncoding.EncodeToString(b))
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
+
+// ConfigCodeLink 配置码的各种分发形式
+type ConfigCodeLink struct {
+	Code         string `json:"code"`
+	SignedCode   string `json:"signed_code"`
+	ImportString string `json:"import_string"` // 客户端"导入服务器配置"粘贴的字符串
+	ScanContent  string `json:"scan_content"`  // 移动端扫码配置服务器的内容
+	DeepLink     string `json:"deep_link"`
+	Command      string `json:"command"` // 桌面端命令行导入
 }
 
 // EncryptedConfigData 加密的配置数据结构
@@ -84,7 +177,29 @@ type EncryptedConfigData struct {
 	Version   string             `json:"version"`
 }
 
+// IsUnhealthy 是否被健康检查判定为不可用, 未检查过的视为可用
+func (sc *ServerConfig) IsUnhealthy() bool {
+	return sc.HealthStatus == ServerHealthUnhealthy
+}
+
+// ToClientConfig 转为客户端配置
+func (sc *ServerConfig) ToClientConfig() *ClientServerConfig {
+	c := &ClientServerConfig{
+		Name:        sc.Name,
+		Region:      sc.Region,
+		IdServer:    sc.IdServer,
+		RelayServer: sc.RelayServer,
+		ApiServer:   sc.ApiServer,
+		Key:         sc.Key,
+	}
+	if sc.PreviousKey != "" && sc.PreviousKey != sc.Key && time.Now().Unix() < sc.PreviousKeyUntil {
+		c.PreviousKey = sc.PreviousKey
+	}
+	return c
+}
+
 // GenerateConfigCode 生成配置码
+// Deprecated: 对称加密的配置码需要共享密钥才能校验, 新配置码使用 lib/configcode 签名
 func (sc *ServerConfig) GenerateConfigCode(secretKey string) (string, error) {
 	// 构建客户端配置数据
 	configData := EncryptedConfigData{
@@ -120,6 +235,7 @@ func (sc *ServerConfig) GenerateConfigCode(secretKey string) (string, error) {
 }
 
 // DecryptConfigCode 解密配置码
+// Deprecated: 仅用于兼容旧配置码, 签名配置码使用 lib/configcode 校验
 func DecryptConfigCode(code, secretKey string) (*ClientServerConfig, error) {
 	// 解析配置码格式
 	// 提取加密数据部分（跳过前缀）
@@ -239,6 +355,10 @@ func (ConfigCode) TableName() string {
 	return "config_codes"
 }
 
+func (ConfigSigningKey) TableName() string {
+	return "config_signing_keys"
+}
+
 func (ConfigCodeUsage) TableName() string {
 	return "config_code_usages"
 }
@@ -0,0 +1,129 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+const (
+	ServerConfigRevisionCreate    = "create"
+	ServerConfigRevisionUpdate    = "update"
+	ServerConfigRevisionRollback  = "rollback"
+	ServerConfigRevisionRotateKey = "rotate-key"
+	ServerConfigRevisionBaseline  = "baseline" // 修订功能上线前已有的配置, 首次修改前记录原内容
+)
+
+// ServerConfigRevision 服务器配置的不可变修订, 每次变更生成一条
+type ServerConfigRevision struct {
+	IdModel
+	ServerConfigId uint   `json:"server_config_id" gorm:"not null;uniqueIndex:idx_server_config_revision;comment:服务器配置ID"`
+	Revision       int    `json:"revision" gorm:"not null;uniqueIndex:idx_server_config_revision;comment:修订号"`
+	Action         string `json:"action" gorm:"default:'';not null;comment:变更类型"`
+	AuthorId       uint   `json:"author_id" gorm:"default:0;not null;comment:修改人"`
+	Name           string `json:"name" gorm:"default:'';not null;"`
+	Description    string `json:"description" gorm:"type:text;"`
+	Region         string `json:"region" gorm:"default:'';not null;"`
+	IdServer       string `json:"id_server" gorm:"default:'';not null;"`
+	RelayServer    string `json:"relay_server" gorm:"default:'';not null;"`
+	ApiServer      string `json:"api_server" gorm:"default:'';not null;"`
+	Key            string `json:"-" gorm:"type:text;serializer:encrypted;"`
+	KeyFingerprint string `json:"key_fingerprint" gorm:"-"` // 接口只返回密钥指纹
+	Priority       int    `json:"priority" gorm:"default:0;not null;"`
+	GroupIds       []uint `json:"group_ids" gorm:"type:text;serializer:json;"`
+	// Diff 与上一修订的差异, 字段名 => [旧值, 新值]
+	Diff map[string][2]interface{} `json:"diff" gorm:"type:text;serializer:json;"`
+	TimeModel
+}
+
+type ServerConfigRevisionList struct {
+	ServerConfigRevisions []*ServerConfigRevision `json:"list"`
+	Pagination
+}
+
+// NewServerConfigRevision 以配置当前内容生成修订快照
+func NewServerConfigRevision(sc *ServerConfig) *ServerConfigRevision {
+	return &ServerConfigRevision{
+		ServerConfigId: sc.Id,
+		Name:           sc.Name,
+		Description:    sc.Description,
+		Region:         sc.Region,
+		IdServer:       sc.IdServer,
+		RelayServer:    sc.RelayServer,
+		ApiServer:      sc.ApiServer,
+		Key:            sc.Key,
+		Priority:       sc.Priority,
+		GroupIds:       sc.GroupIds,
+	}
+}
+
+// ApplyTo 将修订内容写回配置, 密钥由调用方按宽限期单独处理
+func (r *ServerConfigRevision) ApplyTo(sc *ServerConfig) {
+	sc.Name = r.Name
+	sc.Description = r.Description
+	sc.Region = r.Region
+	sc.IdServer = r.IdServer
+	sc.RelayServer = r.RelayServer
+	sc.ApiServer = r.ApiServer
+	sc.Priority = r.Priority
+	sc.GroupIds = r.GroupIds
+}
+
+// DiffFrom 计算相对 prev 的差异, prev 为 nil 时为空
+func (r *ServerConfigRevision) DiffFrom(prev *ServerConfigRevision) {
+	r.Diff = map[string][2]interface{}{}
+	if prev == nil {
+		return
+	}
+	add := func(field string, old, new interface{}) {
+		r.Diff[field] = [2]interface{}{old, new}
+	}
+	if prev.Name != r.Name {
+		add("name", prev.Name, r.Name)
+	}
+	if prev.Description != r.Description {
+		add("description", prev.Description, r.Description)
+	}
+	if prev.Region != r.Region {
+		add("region", prev.Region, r.Region)
+	}
+	if prev.IdServer != r.IdServer {
+		add("id_server", prev.IdServer, r.IdServer)
+	}
+	if prev.RelayServer != r.RelayServer {
+		add("relay_server", prev.RelayServer, r.RelayServer)
+	}
+	if prev.ApiServer != r.ApiServer {
+		add("api_server", prev.ApiServer, r.ApiServer)
+	}
+	// 密钥只记录指纹, 不把明文写进差异
+	if prev.Key != r.Key {
+		add("key", KeyFingerprint(prev.Key), KeyFingerprint(r.Key))
+	}
+	if prev.Priority != r.Priority {
+		add("priority", prev.Priority, r.Priority)
+	}
+	if !equalUints(prev.GroupIds, r.GroupIds) {
+		add("group_ids", prev.GroupIds, r.GroupIds)
+	}
+}
+
+// KeyFingerprint 密钥指纹, 用于在差异中区分不同的密钥
+func KeyFingerprint(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "sha256:" + hex.EncodeToString(sum[:4])
+}
+
+func equalUints(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
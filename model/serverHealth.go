@@ -0,0 +1,29 @@
+package model
+
+const (
+	ServerHealthUnknown   = "unknown"
+	ServerHealthHealthy   = "healthy"
+	ServerHealthUnhealthy = "unhealthy"
+
+	ServerHealthTargetId    = "id"
+	ServerHealthTargetRelay = "relay"
+	ServerHealthTargetApi   = "api"
+)
+
+// ServerHealthCheck 服务器配置的一次端口探测
+type ServerHealthCheck struct {
+	IdModel
+	ServerConfigId uint   `json:"server_config_id" gorm:"default:0;not null;index"`
+	Target         string `json:"target" gorm:"default:'';not null;"` // id, relay, api
+	Addr           string `json:"addr" gorm:"default:'';not null;"`
+	Ok             bool   `json:"ok" gorm:"default:false;not null;"`
+	LatencyMs      int64  `json:"latency_ms" gorm:"default:0;not null;"`
+	Error          string `json:"error" gorm:"default:'';not null;"`
+	CheckedAt      int64  `json:"checked_at" gorm:"default:0;not null;index"`
+	TimeModel
+}
+
+type ServerHealthCheckList struct {
+	ServerHealthChecks []*ServerHealthCheck `json:"list"`
+	Pagination
+}
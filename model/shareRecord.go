@@ -1,13 +1,30 @@
 package model
 
+// 分享密码类型
+const (
+	ShareRecordPasswordOnce  = "once"  // 设备的一次性密码
+	ShareRecordPasswordFixed = "fixed" // 设备的固定密码
+)
+
 type ShareRecord struct {
 	IdModel
 	UserId       uint   `json:"user_id" gorm:"default:0;not null;index"`
 	PeerId       string `json:"peer_id" gorm:"default:'';not null;index"`
 	ShareToken   string `json:"share_token" gorm:"default:'';not null;index"`
 	PasswordType string `json:"password_type" gorm:"default:'';not null;"`
-	Password     string `json:"password" gorm:"default:'';not null;"`
-	Expire       int64  `json:"expire" gorm:"default:0;not null;"`
+	// web client 连接时需要明文, 加密存储且不在列表中返回
+	Password string `json:"-" gorm:"size:1024;default:'';not null;serializer:encrypted;"`
+	Expire   int64  `json:"expire" gorm:"default:0;not null;"`
+	// 最大使用次数, 0 不限制
+	MaxUses  int `json:"max_uses" gorm:"default:0;not null;"`
+	UseCount int `json:"use_count" gorm:"default:0;not null;"`
+	// 首次使用后吊销
+	RevokeOnUse bool `json:"revoke_on_use" gorm:"default:false;not null;"`
+	// 限定接收人邮箱, 为空不限制; 创建时绑定到该邮箱唯一对应的用户, 打开时需要该用户登录
+	RecipientEmail  string `json:"recipient_email" gorm:"default:'';not null;"`
+	RecipientUserId uint   `json:"recipient_user_id" gorm:"default:0;not null;"`
+	LastUsedAt      int64  `json:"last_used_at" gorm:"default:0;not null;"`
+	RevokedAt       int64  `json:"revoked_at" gorm:"default:0;not null;"`
 	TimeModel
 }
 
@@ -16,3 +33,31 @@ type ShareRecordList struct {
 	ShareRecords []*ShareRecord `json:"list,omitempty"`
 	Pagination
 }
+
+// 分享链接访问结果
+const (
+	ShareRecordUseOk        = "ok"
+	ShareRecordUseExpired   = "expired"
+	ShareRecordUseRevoked   = "revoked"
+	ShareRecordUseExhausted = "exhausted"
+	ShareRecordUseRecipient = "recipient_mismatch"
+)
+
+// ShareRecordUse 分享链接访问记录, 被拒绝的访问也会记录
+type ShareRecordUse struct {
+	IdModel
+	ShareRecordId uint   `json:"share_record_id" gorm:"default:0;not null;index"`
+	UserId        uint   `json:"user_id" gorm:"default:0;not null;index"` // 分享者
+	PeerId        string `json:"peer_id" gorm:"default:'';not null;"`
+	Ip            string `json:"ip" gorm:"default:'';not null;"`
+	UserAgent     string `json:"user_agent" gorm:"size:512;default:'';not null;"`
+	Email         string `json:"email" gorm:"default:'';not null;"`
+	Result        string `json:"result" gorm:"default:'';not null;index"`
+	TimeModel
+}
+
+// ShareRecordUseList 分享链接访问记录列表
+type ShareRecordUseList struct {
+	ShareRecordUses []*ShareRecordUse `json:"list"`
+	Pagination
+}
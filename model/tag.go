@@ -14,3 +14,57 @@ type TagList struct {
 	Tags []*Tag `json:"list"`
 	Pagination
 }
+
+// TagDefaultColor 自动创建且没有全局定义的标签颜色
+const TagDefaultColor uint = 0xFF9E9E9E
+
+// TagDefinition 全局标签定义, 由管理员推送到各地址簿, 地址簿中同名的标签视为该定义的实例
+type TagDefinition struct {
+	IdModel
+	Name  string `json:"name" gorm:"size:255;default:'';not null;uniqueIndex" validate:"required"`
+	Color uint   `json:"color" gorm:"default:0;not null;"`
+	Note  string `json:"note" gorm:"default:'';not null;"`
+	TimeModel
+}
+
+type TagDefinitionList struct {
+	TagDefinitions []*TagDefinition `json:"list"`
+	Pagination
+}
+
+// TagRule 自动打标签规则
+// 地址簿条目创建时匹配, 所有非空条件都满足才命中, 命中的所有规则的标签都会加到条目上
+// 设备信息取已入库的设备, 设备未入库时主机名和系统使用条目上的主机名和平台
+type TagRule struct {
+	IdModel
+	Name          string     `json:"name" gorm:"default:'';not null;"`
+	Tags          []string   `json:"tags" gorm:"type:text;serializer:json;"`
+	HostnameRegex string     `json:"hostname_regex" gorm:"default:'';not null;"` // 主机名正则
+	Os            string     `json:"os" gorm:"default:'';not null;"`             // 操作系统, 不区分大小写的包含匹配
+	DeviceGroupId uint       `json:"device_group_id" gorm:"default:0;not null;"` // 设备所在设备组
+	Status        StatusCode `json:"status" gorm:"default:1;not null;"`
+	TimeModel
+}
+
+// HasCondition 至少配置了一个匹配条件
+func (r *TagRule) HasCondition() bool {
+	return r.HostnameRegex != "" || r.Os != "" || r.DeviceGroupId > 0
+}
+
+type TagRuleList struct {
+	TagRules []*TagRule `json:"list"`
+	Pagination
+}
+
+// TagRenameResult 标签改名或合并的结果
+type TagRenameResult struct {
+	Tags  int `json:"tags"`  // 改名或删除的地址簿标签数
+	Peers int `json:"peers"` // 标签被替换的地址簿条目数
+}
+
+// TagPushResult 推送全局标签的结果
+type TagPushResult struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"` // 覆盖了颜色
+	Skipped int `json:"skipped"`
+}
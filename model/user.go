@@ -21,6 +21,7 @@ type User struct {
 	
 	// 新增字段：个人设备数量限制
 	MaxDevices *int `json:"max_devices" gorm:"default:null"` // 个人最大设备数量，null表示使用全局配置
+	MaxAbPeers *int `json:"max_ab_peers" gorm:"default:null"` // 所有地址簿的条目总数上限，null表示使用全局配置
 	
 	TimeModel
 }
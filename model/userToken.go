@@ -14,6 +14,7 @@ type UserToken struct {
 	DeviceOS      string `json:"device_os" gorm:"default:''"`         // 操作系统
 	DeviceIP      string `json:"device_ip" gorm:"default:''"`         // 设备IP地址
 	LastActiveAt  int64  `json:"last_active_at" gorm:"default:0"`    // 最后活跃时间
+	AbRevision    uint   `json:"ab_revision" gorm:"default:0;not null"` // 该设备最后一次同步看到的旧版地址簿修订号
 	
 	TimeModel
 }
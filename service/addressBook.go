@@ -4,8 +4,10 @@ import (
 	"encoding/json"
 	"github.com/google/uuid"
 	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/model/custom_types"
 	"gorm.io/gorm"
 	"strings"
+	"time"
 )
 
 type AddressBookService struct {
@@ -47,59 +49,8 @@ func (s *AddressBookService) ListByUserIds(userIds []uint, page, pageSize uint)
 }
 
 // AddAddressBook
-func (s *AddressBookService) AddAddressBook(ab *model.AddressBook) error {
-	return DB.Create(ab).Error
-}
-
-// UpdateAddressBook
-func (s *AddressBookService) UpdateAddressBook(abs []*model.AddressBook, userId uint) error {
-	//比较peers和数据库中的数据，如果peers中的数据在数据库中不存在，则添加，如果存在则更新，如果数据库中的数据在peers中不存在，则删除
-	// 开始事务
-	tx := DB.Begin()
-	//1. 获取数据库中的数据
-	var dbABs []*model.AddressBook
-	tx.Where("user_id = ?", userId).Find(&dbABs)
-	//2. 比较peers和数据库中的数据
-	//2.1 获取peers中的id
-	aBIds := make(map[string]*model.AddressBook)
-	for _, ab := range abs {
-		aBIds[ab.Id] = ab
-	}
-	//2.2 获取数据库中的id
-	dbABIds := make(map[string]*model.AddressBook)
-	for _, dbAb := range dbABs {
-		dbABIds[dbAb.Id] = dbAb
-	}
-	//2.3 比较peers和数据库中的数据
-	for id, ab := range aBIds {
-		dbAB, ok := dbABIds[id]
-		ab.UserId = userId
-		if !ok {
-			//添加
-			if ab.Platform == "" || ab.Username == "" || ab.Hostname == "" {
-				peer := AllService.PeerService.FindById(ab.Id)
-				if peer.RowId != 0 {
-					ab.Platform = AllService.AddressBookService.PlatformFromOs(peer.Os)
-					ab.Username = peer.Username
-					ab.Hostname = peer.Hostname
-				}
-			}
-			tx.Create(ab)
-		} else {
-			//更新
-			tx.Model(&model.AddressBook{}).Where("row_id = ?", dbAB.RowId).Updates(ab)
-		}
-	}
-	//2.4 删除
-	for id, dbAB := range dbABIds {
-		_, ok := aBIds[id]
-		if !ok {
-			tx.Delete(dbAB)
-		}
-	}
-	tx.Commit()
-	return nil
-
+func (s *AddressBookService) AddAddressBook(ab *model.AddressBook, actor *AddressBookActor) error {
+	return s.Create(ab, actor)
 }
 
 func (s *AddressBookService) List(page, pageSize uint, where func(tx *gorm.DB)) (res *model.AddressBookList) {
@@ -127,31 +78,97 @@ func (s *AddressBookService) FromPeer(peer *model.Peer) (a *model.AddressBook) {
 }
 
 // Create 创建
-func (s *AddressBookService) Create(u *model.AddressBook) error {
-	res := DB.Create(u).Error
-	return res
+func (s *AddressBookService) Create(u *model.AddressBook, actor *AddressBookActor) error {
+	ms := AllService.TagRuleService.matchers()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := s.CheckQuota(tx, u.UserId, u.CollectionId, 1); err != nil {
+			return err
+		}
+		if err := AllService.TagRuleService.apply(tx, ms, u, actor); err != nil {
+			return err
+		}
+		if err := tx.Create(u).Error; err != nil {
+			return err
+		}
+		return AllService.AddressBookChangeService.RecordPeer(tx, actor, nil, u)
+	})
 }
-func (s *AddressBookService) Delete(u *model.AddressBook) error {
-	return DB.Delete(u).Error
+func (s *AddressBookService) Delete(u *model.AddressBook, actor *AddressBookActor) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		before := &model.AddressBook{}
+		tx.Where("row_id = ?", u.RowId).First(before)
+		if err := tx.Delete(u).Error; err != nil {
+			return err
+		}
+		if before.RowId == 0 {
+			return nil
+		}
+		return AllService.AddressBookChangeService.RecordPeer(tx, actor, before, nil)
+	})
 }
 
 // Update 更新
-func (s *AddressBookService) Update(u *model.AddressBook) error {
-	return DB.Model(u).Updates(u).Error
+func (s *AddressBookService) Update(u *model.AddressBook, actor *AddressBookActor) error {
+	return s.updateWithChange(u.RowId, actor, func(tx *gorm.DB, before *model.AddressBook) error {
+		return tx.Model(u).Updates(u).Error
+	})
 }
 
-// UpdateByMap 更新
-func (s *AddressBookService) UpdateByMap(u *model.AddressBook, data map[string]interface{}) error {
-	return DB.Model(u).Updates(data).Error
+// UpdateByMap 更新, map 更新不经过 serializer, 加密字段在这里加密
+func (s *AddressBookService) UpdateByMap(u *model.AddressBook, data map[string]interface{}, actor *AddressBookActor) error {
+	for _, k := range []string{"password", "hash"} {
+		if v, ok := data[k].(string); ok {
+			enc, err := custom_types.EncryptString(v)
+			if err != nil {
+				return err
+			}
+			data[k] = enc
+		}
+	}
+	return s.updateWithChange(u.RowId, actor, func(tx *gorm.DB, before *model.AddressBook) error {
+		return tx.Model(u).Updates(data).Error
+	})
 }
 
 // UpdateAll 更新
-func (s *AddressBookService) UpdateAll(u *model.AddressBook) error {
-	return DB.Model(u).Select("*").Omit("created_at").Updates(u).Error
+func (s *AddressBookService) UpdateAll(u *model.AddressBook, actor *AddressBookActor) error {
+	return s.updateWithChange(u.RowId, actor, func(tx *gorm.DB, before *model.AddressBook) error {
+		//移到其他用户或地址簿时计入新地址簿的配额
+		if before.UserId != u.UserId || before.CollectionId != u.CollectionId {
+			if err := s.CheckQuota(tx, u.UserId, u.CollectionId, 1); err != nil {
+				return err
+			}
+		}
+		return tx.Model(u).Select("*").Omit("created_at").Updates(u).Error
+	})
+}
+
+// updateWithChange 在事务中更新条目并记录更新前后的数据
+func (s *AddressBookService) updateWithChange(rowId uint, actor *AddressBookActor, update func(tx *gorm.DB, before *model.AddressBook) error) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		before := &model.AddressBook{}
+		tx.Where("row_id = ?", rowId).First(before)
+		if err := update(tx, before); err != nil {
+			return err
+		}
+		after := &model.AddressBook{}
+		tx.Where("row_id = ?", rowId).First(after)
+		if before.RowId == 0 || after.RowId == 0 {
+			return nil
+		}
+		return AllService.AddressBookChangeService.RecordPeer(tx, actor, before, after)
+	})
 }
 
 // ShareByWebClient 分享
 func (s *AddressBookService) ShareByWebClient(m *model.ShareRecord) error {
+	if m.RecipientEmail != "" {
+		uid, err := AllService.ShareRecordService.ResolveRecipient(m.RecipientEmail)
+		if err != nil {
+			return err
+		}
+		m.RecipientUserId = uid
+	}
 	m.ShareToken = uuid.New().String()
 	return DB.Create(m).Error
 }
@@ -182,9 +199,30 @@ func (s *AddressBookService) PlatformFromOs(os string) string {
 func (s *AddressBookService) ListByUserIdAndCollectionId(userId, cid, page, pageSize uint) (res *model.AddressBookList) {
 	res = s.List(page, pageSize, func(tx *gorm.DB) {
 		tx.Where("user_id = ? and collection_id = ?", userId, cid)
+		tx.Order("row_id asc")
 	})
 	return
 }
+
+// ListByUserIdAndCollectionIdAfter 按 row_id 游标分页, 返回 after 之后的 limit 条, 没有更多时 next 为 0
+func (s *AddressBookService) ListByUserIdAndCollectionIdAfter(userId, cid, after, limit uint) (abs []*model.AddressBook, next uint) {
+	DB.Where("user_id = ? and collection_id = ? and row_id > ?", userId, cid, after).
+		Order("row_id asc").Limit(int(limit) + 1).Find(&abs)
+	if len(abs) > int(limit) {
+		abs = abs[:limit]
+		next = abs[limit-1].RowId
+	}
+	return
+}
+
+// EachByUserIdAndCollectionId 按 row_id 顺序分批读取地址簿的全部条目
+func (s *AddressBookService) EachByUserIdAndCollectionId(userId, cid uint, batch int, fn func(abs []*model.AddressBook) error) error {
+	var abs []*model.AddressBook
+	return DB.Where("user_id = ? and collection_id = ?", userId, cid).Order("row_id asc").
+		FindInBatches(&abs, batch, func(tx *gorm.DB, _ int) error {
+			return fn(abs)
+		}).Error
+}
 func (s *AddressBookService) ListCollection(page, pageSize uint, where func(tx *gorm.DB)) (res *model.AddressBookCollectionList) {
 	res = &model.AddressBookCollectionList{}
 	res.Page = int64(page)
@@ -215,46 +253,43 @@ func (s *AddressBookService) CollectionInfoById(id uint) *model.AddressBookColle
 	return p
 }
 
+// ActiveRule 只查询在 now 时生效的规则
+func ActiveRule(now int64) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("start_at <= ? and (end_at = 0 or end_at > ?)", now, now)
+	}
+}
+
 func (s *AddressBookService) CollectionReadRules(user *model.User) (res []*model.AddressBookCollectionRule) {
 	// personalRules
 	var personalRules []*model.AddressBookCollectionRule
 	tx2 := DB.Model(&model.AddressBookCollectionRule{})
-	tx2.Where("type = ? and to_id = ? and rule > 0", model.ShareAddressBookRuleTypePersonal, user.Id).Find(&personalRules)
+	tx2.Scopes(ActiveRule(time.Now().Unix())).Where("type = ? and to_id = ? and rule > 0", model.ShareAddressBookRuleTypePersonal, user.Id).Find(&personalRules)
 	res = append(res, personalRules...)
 
 	//group
 	var groupRules []*model.AddressBookCollectionRule
 	tx3 := DB.Model(&model.AddressBookCollectionRule{})
-	tx3.Where("type = ? and to_id = ? and rule > 0", model.ShareAddressBookRuleTypeGroup, user.GroupId).Find(&groupRules)
+	tx3.Scopes(ActiveRule(time.Now().Unix())).Where("type = ? and to_id = ? and rule > 0", model.ShareAddressBookRuleTypeGroup, user.GroupId).Find(&groupRules)
 	res = append(res, groupRules...)
 	return
 }
 
+// UserMaxRule 用户对地址簿的最大权限, 上级地址簿的规则对下级同样生效
 func (s *AddressBookService) UserMaxRule(user *model.User, uid, cid uint) int {
 	// ismy?
 	if user.Id == uid {
 		return model.ShareAddressBookRuleRuleFullControl
 	}
+	var rules []*model.AddressBookCollectionRule
+	DB.Model(&model.AddressBookCollectionRule{}).Scopes(ActiveRule(time.Now().Unix())).
+		Where("collection_id in ?", s.collectionChainOf(uid, cid)).
+		Where("(type = ? and to_id = ?) or (type = ? and to_id = ?)", model.ShareAddressBookRuleTypePersonal, user.Id, model.ShareAddressBookRuleTypeGroup, user.GroupId).
+		Find(&rules)
 	max := 0
-	personalRules := &model.AddressBookCollectionRule{}
-	tx := DB.Model(personalRules)
-	tx.Where("type = ? and collection_id = ? and to_id = ?", model.ShareAddressBookRuleTypePersonal, cid, user.Id).First(&personalRules)
-	if personalRules.Id != 0 {
-		max = personalRules.Rule
-		if max == model.ShareAddressBookRuleRuleFullControl {
-			return max
-		}
-	}
-
-	groupRules := &model.AddressBookCollectionRule{}
-	tx2 := DB.Model(groupRules)
-	tx2.Where("type = ? and collection_id = ? and to_id = ?", model.ShareAddressBookRuleTypeGroup, cid, user.GroupId).First(&groupRules)
-	if groupRules.Id != 0 {
-		if groupRules.Rule > max {
-			max = groupRules.Rule
-		}
-		if max == model.ShareAddressBookRuleRuleFullControl {
-			return max
+	for _, r := range rules {
+		if r.Rule > max {
+			max = r.Rule
 		}
 	}
 	return max
@@ -270,21 +305,119 @@ func (s *AddressBookService) CheckUserFullControlPrivilege(user *model.User, uid
 	return s.UserMaxRule(user, uid, cid) >= model.ShareAddressBookRuleRuleFullControl
 }
 
-func (s *AddressBookService) CreateCollection(t *model.AddressBookCollection) error {
-	return DB.Create(t).Error
+func (s *AddressBookService) CreateCollection(t *model.AddressBookCollection, actor *AddressBookActor) error {
+	if err := AllService.SmartCollectionService.Check(t.PeerQuery); err != nil {
+		return err
+	}
+	if err := s.CheckCollectionParent(t, t.ParentId); err != nil {
+		return err
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(t).Error; err != nil {
+			return err
+		}
+		return AllService.AddressBookChangeService.RecordCollection(tx, actor, nil, t)
+	})
+	if err != nil {
+		return err
+	}
+	//智能地址簿创建后立即同步
+	_, err = AllService.SmartCollectionService.Sync(t)
+	return err
+}
+
+// UpdateCollection 更新, peer_query 传 {} 可转为普通地址簿, 已同步的条目保留
+// 上级通过 MoveCollection 修改
+func (s *AddressBookService) UpdateCollection(t *model.AddressBookCollection, actor *AddressBookActor) error {
+	if err := AllService.SmartCollectionService.Check(t.PeerQuery); err != nil {
+		return err
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		before := &model.AddressBookCollection{}
+		tx.Where("id = ?", t.Id).First(before)
+		if err := tx.Model(t).Omit("parent_id").Updates(t).Error; err != nil {
+			return err
+		}
+		after := &model.AddressBookCollection{}
+		tx.Where("id = ?", t.Id).First(after)
+		if before.Id == 0 || after.Id == 0 {
+			return nil
+		}
+		return AllService.AddressBookChangeService.RecordCollection(tx, actor, before, after)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = AllService.SmartCollectionService.Sync(s.CollectionInfoById(t.Id))
+	return err
 }
 
-func (s *AddressBookService) UpdateCollection(t *model.AddressBookCollection) error {
-	return DB.Model(t).Updates(t).Error
+// DeleteCollection 删除地址簿, policy 为对下级地址簿的处理, 为空时按 restrict 处理
+func (s *AddressBookService) DeleteCollection(t *model.AddressBookCollection, policy string, actor *AddressBookActor) error {
+	cs := s.CollectionsByUserId(t.UserId)
+	descendants := collectionDescendants(cs, t.Id)
+	if len(descendants) > 0 && policy != model.AddressBookCollectionDeleteCascade && policy != model.AddressBookCollectionDeleteReparent {
+		return ErrAbCollectionHasChildren
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if len(descendants) > 0 && policy == model.AddressBookCollectionDeleteReparent {
+			for _, c := range cs {
+				if c.ParentId != t.Id {
+					continue
+				}
+				before := *c
+				c.ParentId = t.ParentId
+				if err := tx.Model(c).Update("parent_id", c.ParentId).Error; err != nil {
+					return err
+				}
+				if err := AllService.AddressBookChangeService.RecordCollection(tx, actor, &before, c); err != nil {
+					return err
+				}
+			}
+		}
+		if len(descendants) > 0 && policy == model.AddressBookCollectionDeleteCascade {
+			//从最下层开始删除
+			for i := len(descendants) - 1; i >= 0; i-- {
+				d := &model.AddressBookCollection{}
+				d.Id = descendants[i]
+				if err := s.deleteCollection(tx, d, actor); err != nil {
+					return err
+				}
+			}
+		}
+		return s.deleteCollection(tx, t, actor)
+	})
 }
 
-func (s *AddressBookService) DeleteCollection(t *model.AddressBookCollection) error {
+func (s *AddressBookService) deleteCollection(tx *gorm.DB, t *model.AddressBookCollection, actor *AddressBookActor) error {
 	//删除集合下的所有规则、地址簿，再删除集合
-	tx := DB.Begin()
-	tx.Where("collection_id = ?", t.Id).Delete(&model.AddressBookCollectionRule{})
-	tx.Where("collection_id = ?", t.Id).Delete(&model.AddressBook{})
-	tx.Delete(t)
-	return tx.Commit().Error
+	var abs []*model.AddressBook
+	tx.Where("collection_id = ?", t.Id).Find(&abs)
+	before := &model.AddressBookCollection{}
+	tx.Where("id = ?", t.Id).First(before)
+	if err := tx.Where("collection_id = ?", t.Id).Delete(&model.AddressBookCollectionRule{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&model.AddressBookAccessRequest{}).Where("collection_id = ? and status = ?", t.Id, model.AddressBookAccessRequestPending).
+		Update("status", model.AddressBookAccessRequestCancelled).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("collection_id = ?", t.Id).Delete(&model.AddressBook{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Delete(t).Error; err != nil {
+		return err
+	}
+	//逐条记录删除的条目, 以便按时间点恢复整个地址簿
+	for _, ab := range abs {
+		if err := AllService.AddressBookChangeService.RecordPeer(tx, actor, ab, nil); err != nil {
+			return err
+		}
+	}
+	if before.Id == 0 {
+		return nil
+	}
+	return AllService.AddressBookChangeService.RecordCollection(tx, actor, before, nil)
 }
 
 func (s *AddressBookService) RuleInfoById(u uint) *model.AddressBookCollectionRule {
@@ -319,7 +452,8 @@ func (s *AddressBookService) ListRules(page uint, size uint, f func(tx *gorm.DB)
 }
 
 func (s *AddressBookService) UpdateRule(t *model.AddressBookCollectionRule) error {
-	return DB.Model(t).Updates(t).Error
+	//有效期为 0 表示不限制, 需要单独更新
+	return DB.Model(t).Select("*").Omit("created_at", "request_id").Updates(t).Error
 }
 
 func (s *AddressBookService) DeleteRule(t *model.AddressBookCollectionRule) error {
@@ -332,11 +466,25 @@ func (s *AddressBookService) CheckCollectionOwner(uid uint, cid uint) bool {
 	return p.UserId == uid
 }
 
-func (s *AddressBookService) BatchUpdateTags(abs []*model.AddressBook, tags []string) error {
+func (s *AddressBookService) BatchUpdateTags(abs []*model.AddressBook, tags []string, actor *AddressBookActor) error {
 	ids := make([]uint, 0)
 	for _, ab := range abs {
 		ids = append(ids, ab.RowId)
 	}
 	tagsv, _ := json.Marshal(tags)
-	return DB.Model(&model.AddressBook{}).Where("row_id in ?", ids).Update("tags", tagsv).Error
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var before []*model.AddressBook
+		tx.Where("row_id in ?", ids).Find(&before)
+		if err := tx.Model(&model.AddressBook{}).Where("row_id in ?", ids).Update("tags", tagsv).Error; err != nil {
+			return err
+		}
+		for _, b := range before {
+			a := *b
+			a.Tags = tagsv
+			if err := AllService.AddressBookChangeService.RecordPeer(tx, actor, b, &a); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
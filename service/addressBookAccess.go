@@ -0,0 +1,211 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"gorm.io/gorm"
+)
+
+// AddressBookAccessService 地址簿限时授权和访问申请
+// 规则在有效期外不生效, 到期的规则由定时任务删除; 申请由地址簿所有者或管理员审批, 批准后生成个人规则
+type AddressBookAccessService struct {
+}
+
+var (
+	ErrAbAccessPeriod  = errors.New("AccessPeriodInvalid")
+	ErrAbAccessPending = errors.New("AccessRequestPending")
+	ErrAbAccessDecided = errors.New("AccessRequestDecided")
+)
+
+// AddressBookAccessDecision 审批时调整的权限和有效期, 为空时使用申请的值
+type AddressBookAccessDecision struct {
+	DeciderId uint
+	Rule      int
+	StartAt   *int64
+	EndAt     *int64
+	Note      string
+}
+
+// CheckPeriod 校验有效期, 到期时间必须晚于当前时间和生效时间
+func (s *AddressBookAccessService) CheckPeriod(startAt, endAt int64) error {
+	if startAt < 0 || endAt < 0 {
+		return ErrAbAccessPeriod
+	}
+	if endAt > 0 && (endAt <= time.Now().Unix() || endAt <= startAt) {
+		return ErrAbAccessPeriod
+	}
+	return nil
+}
+
+func (s *AddressBookAccessService) InfoById(id uint) *model.AddressBookAccessRequest {
+	r := &model.AddressBookAccessRequest{}
+	DB.Where("id = ?", id).First(r)
+	return r
+}
+
+func (s *AddressBookAccessService) List(page, pageSize uint, where func(tx *gorm.DB)) (res *model.AddressBookAccessRequestList) {
+	res = &model.AddressBookAccessRequestList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := DB.Model(&model.AddressBookAccessRequest{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Order("id desc").Find(&res.AddressBookAccessRequests)
+	return
+}
+
+// Create 提交申请, 同一地址簿只能有一个待审批的申请
+func (s *AddressBookAccessService) Create(r *model.AddressBookAccessRequest) error {
+	if err := s.CheckPeriod(r.StartAt, r.EndAt); err != nil {
+		return err
+	}
+	var count int64
+	DB.Model(&model.AddressBookAccessRequest{}).
+		Where("user_id = ? and collection_id = ? and status = ?", r.UserId, r.CollectionId, model.AddressBookAccessRequestPending).
+		Count(&count)
+	if count > 0 {
+		return ErrAbAccessPending
+	}
+	r.Status = model.AddressBookAccessRequestPending
+	r.DeciderId = 0
+	r.DecidedAt = 0
+	r.DecisionNote = ""
+	r.RuleId = 0
+	return DB.Create(r).Error
+}
+
+// Cancel 申请人撤回待审批的申请
+func (s *AddressBookAccessService) Cancel(r *model.AddressBookAccessRequest) error {
+	if r.Status != model.AddressBookAccessRequestPending {
+		return ErrAbAccessDecided
+	}
+	return s.decide(DB, r, model.AddressBookAccessRequestCancelled, &AddressBookAccessDecision{DeciderId: r.UserId})
+}
+
+// Deny 拒绝申请
+func (s *AddressBookAccessService) Deny(r *model.AddressBookAccessRequest, d *AddressBookAccessDecision) error {
+	if r.Status != model.AddressBookAccessRequestPending {
+		return ErrAbAccessDecided
+	}
+	return s.decide(DB, r, model.AddressBookAccessRequestDenied, d)
+}
+
+// Approve 批准申请, 为申请人生成或更新个人规则
+// 已有永久生效且权限不低于本次批准的规则时保留原规则, 避免限时授权覆盖长期授权
+func (s *AddressBookAccessService) Approve(r *model.AddressBookAccessRequest, d *AddressBookAccessDecision) error {
+	if r.Status != model.AddressBookAccessRequestPending {
+		return ErrAbAccessDecided
+	}
+	if d.Rule > 0 {
+		r.Rule = d.Rule
+	}
+	if d.StartAt != nil {
+		r.StartAt = *d.StartAt
+	}
+	if d.EndAt != nil {
+		r.EndAt = *d.EndAt
+	}
+	if err := s.CheckPeriod(r.StartAt, r.EndAt); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		ex := &model.AddressBookCollectionRule{}
+		tx.Where("type = ? and to_id = ? and collection_id = ?", model.ShareAddressBookRuleTypePersonal, r.UserId, r.CollectionId).First(ex)
+		switch {
+		case ex.Id > 0 && ex.EndAt == 0 && ex.IsActive(now) && ex.Rule >= r.Rule:
+			//保留原有的长期授权
+		case ex.Id > 0:
+			err := tx.Model(ex).Select("rule", "start_at", "end_at", "request_id").Updates(&model.AddressBookCollectionRule{
+				Rule:      r.Rule,
+				StartAt:   r.StartAt,
+				EndAt:     r.EndAt,
+				RequestId: r.Id,
+			}).Error
+			if err != nil {
+				return err
+			}
+		default:
+			ex = &model.AddressBookCollectionRule{
+				UserId:       r.OwnerId,
+				CollectionId: r.CollectionId,
+				Rule:         r.Rule,
+				Type:         model.ShareAddressBookRuleTypePersonal,
+				ToId:         r.UserId,
+				StartAt:      r.StartAt,
+				EndAt:        r.EndAt,
+				RequestId:    r.Id,
+			}
+			if err := tx.Create(ex).Error; err != nil {
+				return err
+			}
+		}
+		r.RuleId = ex.Id
+		return s.decide(tx, r, model.AddressBookAccessRequestApproved, d)
+	})
+}
+
+// decide 记录审批结果
+func (s *AddressBookAccessService) decide(tx *gorm.DB, r *model.AddressBookAccessRequest, status string, d *AddressBookAccessDecision) error {
+	r.Status = status
+	r.DeciderId = d.DeciderId
+	r.DecidedAt = time.Now().Unix()
+	r.DecisionNote = d.Note
+	err := tx.Model(r).Select("rule", "start_at", "end_at", "status", "decider_id", "decided_at", "decision_note", "rule_id").Updates(r).Error
+	if err != nil {
+		return err
+	}
+	Logger.Infof("address book access request %d %s by user %d: collection %d, user %d, rule %d, %d-%d",
+		r.Id, status, r.DeciderId, r.CollectionId, r.UserId, r.Rule, r.StartAt, r.EndAt)
+	return nil
+}
+
+// ExpireRules 删除已到期的规则, 由申请生成的规则同时把申请标记为已到期
+func (s *AddressBookAccessService) ExpireRules() (int, error) {
+	var rules []*model.AddressBookCollectionRule
+	DB.Where("end_at > 0 and end_at <= ?", time.Now().Unix()).Find(&rules)
+	if len(rules) == 0 {
+		return 0, nil
+	}
+	ids := make([]uint, 0, len(rules))
+	for _, r := range rules {
+		ids = append(ids, r.Id)
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id in ?", ids).Delete(&model.AddressBookCollectionRule{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.AddressBookAccessRequest{}).
+			Where("rule_id in ? and status = ?", ids, model.AddressBookAccessRequestApproved).
+			Update("status", model.AddressBookAccessRequestExpired).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range rules {
+		Logger.Infof("address book rule %d expired: collection %d, type %d, to %d, rule %d", r.Id, r.CollectionId, r.Type, r.ToId, r.Rule)
+	}
+	return len(rules), nil
+}
+
+// StartExpire 定时删除到期的规则, 规则到期后已经不生效, 这里只做清理和记录
+func (s *AddressBookAccessService) StartExpire(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := s.ExpireRules(); err != nil {
+				Logger.Warn("expire address book rules failed: " + err.Error())
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+func TestAddressBookAccessPeriod(t *testing.T) {
+	s := &AddressBookAccessService{}
+	now := time.Now().Unix()
+	cases := []struct {
+		start, end int64
+		ok         bool
+	}{
+		{0, 0, true},
+		{now + 3600, 0, true},
+		{0, now + 14*86400, true},
+		{now + 86400, now + 3600, false},
+		{0, now - 1, false},
+		{-1, 0, false},
+	}
+	for _, c := range cases {
+		if err := s.CheckPeriod(c.start, c.end); (err == nil) != c.ok {
+			t.Fatalf("%d-%d: %v", c.start, c.end, err)
+		}
+	}
+
+	r := &model.AddressBookCollectionRule{StartAt: now, EndAt: now + 10}
+	if !r.IsActive(now) || r.IsActive(now-1) || r.IsActive(now+10) {
+		t.Fatal("IsActive")
+	}
+}
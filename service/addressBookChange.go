@@ -0,0 +1,407 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"gorm.io/gorm"
+)
+
+// AddressBookChangeService 地址簿变更日志和按时间点恢复
+// 条目、标签和地址簿的增删改在同一事务中记录变更前后的数据; 恢复按日志推算时间点的状态, 恢复产生的修改同样记入日志
+type AddressBookChangeService struct {
+}
+
+// AddressBookActor 地址簿变更的操作者
+type AddressBookActor struct {
+	UserId     uint // 0 为系统
+	DeviceUuid string
+	Source     string
+	restoreTo  int64
+}
+
+// Actor 当前请求的操作者, 设备 uuid 取自登录令牌
+func (s *AddressBookChangeService) Actor(c *gin.Context, source string) *AddressBookActor {
+	a := &AddressBookActor{Source: source}
+	if u := AllService.UserService.CurUser(c); u != nil {
+		a.UserId = u.Id
+	}
+	if token := c.GetString("token"); token != "" {
+		_, ut := AllService.UserService.InfoByAccessToken(token)
+		a.DeviceUuid = ut.DeviceUuid
+	}
+	return a
+}
+
+// SystemActor 定时任务等没有操作用户的变更
+func (s *AddressBookChangeService) SystemActor(source string) *AddressBookActor {
+	return &AddressBookActor{Source: source}
+}
+
+// List 变更日志, 条目快照已解密
+func (s *AddressBookChangeService) List(page, pageSize uint, where func(tx *gorm.DB)) (res *model.AddressBookChangeList) {
+	res = &model.AddressBookChangeList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := DB.Model(&model.AddressBookChange{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Order("id desc").Find(&res.AddressBookChanges)
+	for _, c := range res.AddressBookChanges {
+		for _, d := range []*model.AddressBookChangeData{c.Before, c.After} {
+			if d != nil && d.Peer != nil {
+				if p, err := d.Peer.Open(); err == nil {
+					d.Peer = p
+				}
+			}
+		}
+	}
+	return
+}
+
+// RecordPeer 记录条目变更, before 为空表示新增, after 为空表示删除
+func (s *AddressBookChangeService) RecordPeer(tx *gorm.DB, actor *AddressBookActor, before, after *model.AddressBook) error {
+	if before != nil && after != nil && (before.UserId != after.UserId || before.CollectionId != after.CollectionId || before.Id != after.Id) {
+		// 移到其他地址簿, 分别记为原地址簿的删除和新地址簿的新增
+		if err := s.RecordPeer(tx, actor, before, nil); err != nil {
+			return err
+		}
+		return s.RecordPeer(tx, actor, nil, after)
+	}
+	var b, a *model.AddressBookSnapshot
+	if before != nil {
+		b = model.NewAddressBookSnapshot(before)
+	}
+	if after != nil {
+		a = model.NewAddressBookSnapshot(after)
+	}
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	ab := after
+	if ab == nil {
+		ab = before
+	}
+	bd, err := peerChangeData(b)
+	if err != nil {
+		return err
+	}
+	ad, err := peerChangeData(a)
+	if err != nil {
+		return err
+	}
+	return s.record(tx, actor, ab.UserId, ab.CollectionId, model.AddressBookChangeTargetPeer, ab.Id, bd, ad)
+}
+
+// RecordTag 记录标签变更, 重命名记为旧名称的删除和新名称的新增
+func (s *AddressBookChangeService) RecordTag(tx *gorm.DB, actor *AddressBookActor, before, after *model.Tag) error {
+	if before != nil && after != nil && (before.UserId != after.UserId || before.CollectionId != after.CollectionId || before.Name != after.Name) {
+		if err := s.RecordTag(tx, actor, before, nil); err != nil {
+			return err
+		}
+		return s.RecordTag(tx, actor, nil, after)
+	}
+	t := after
+	if t == nil {
+		t = before
+	}
+	if t == nil {
+		return nil
+	}
+	return s.record(tx, actor, t.UserId, t.CollectionId, model.AddressBookChangeTargetTag, t.Name, tagChangeData(before), tagChangeData(after))
+}
+
+// RecordCollection 记录地址簿本身的变更
+func (s *AddressBookChangeService) RecordCollection(tx *gorm.DB, actor *AddressBookActor, before, after *model.AddressBookCollection) error {
+	c := after
+	if c == nil {
+		c = before
+	}
+	if c == nil {
+		return nil
+	}
+	return s.record(tx, actor, c.UserId, c.Id, model.AddressBookChangeTargetCollection, strconv.Itoa(int(c.Id)), collectionChangeData(before), collectionChangeData(after))
+}
+
+func (s *AddressBookChangeService) record(tx *gorm.DB, actor *AddressBookActor, userId, cid uint, target, key string, before, after *model.AddressBookChangeData) error {
+	if before == nil && after == nil {
+		return nil
+	}
+	// 条目快照加密后每次不同, 在 RecordPeer 中比较
+	if target != model.AddressBookChangeTargetPeer && reflect.DeepEqual(before, after) {
+		return nil
+	}
+	if actor == nil {
+		actor = &AddressBookActor{}
+	}
+	action := model.AddressBookChangeActionUpdate
+	if before == nil {
+		action = model.AddressBookChangeActionCreate
+	} else if after == nil {
+		action = model.AddressBookChangeActionDelete
+	}
+	return tx.Create(&model.AddressBookChange{
+		UserId:       userId,
+		CollectionId: cid,
+		Target:       target,
+		TargetKey:    key,
+		Action:       action,
+		Before:       before,
+		After:        after,
+		ActorId:      actor.UserId,
+		DeviceUuid:   actor.DeviceUuid,
+		Source:       actor.Source,
+		RestoreTo:    actor.restoreTo,
+		ChangedAt:    time.Now().Unix(),
+	}).Error
+}
+
+// Restore 将地址簿恢复到时间点 at 的状态, 只处理有变更记录的条目、标签和地址簿名称
+// 地址簿在该时间点之后才创建时保留地址簿本身, 只撤销其中的条目和标签
+// 恢复的是历史状态, 不受地址簿配额限制
+func (s *AddressBookChangeService) Restore(userId, cid uint, at int64, actor *AddressBookActor) (*model.AddressBookRestoreResult, error) {
+	var changes []*model.AddressBookChange
+	DB.Where("user_id = ? and collection_id = ?", userId, cid).Order("id asc").Find(&changes)
+	if len(changes) == 0 {
+		return nil, errors.New("ItemNotFound")
+	}
+	states := addressBookStatesAt(changes, at)
+	ra := &AddressBookActor{Source: model.AddressBookChangeSourceRestore, restoreTo: at}
+	if actor != nil {
+		ra.UserId = actor.UserId
+		ra.DeviceUuid = actor.DeviceUuid
+	}
+	res := &model.AddressBookRestoreResult{UserId: userId, CollectionId: cid, RestoreTo: at}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if cid > 0 {
+			if err := s.restoreCollection(tx, ra, userId, cid, states[model.AddressBookChangeTargetCollection], res); err != nil {
+				return err
+			}
+		}
+		if err := s.restorePeers(tx, ra, userId, cid, states[model.AddressBookChangeTargetPeer], res); err != nil {
+			return err
+		}
+		return s.restoreTags(tx, ra, userId, cid, states[model.AddressBookChangeTargetTag], res)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (s *AddressBookChangeService) restoreCollection(tx *gorm.DB, actor *AddressBookActor, userId, cid uint, states map[string]*model.AddressBookChangeData, res *model.AddressBookRestoreResult) error {
+	cur := &model.AddressBookCollection{}
+	tx.Where("id = ?", cid).First(cur)
+	st := states[strconv.Itoa(int(cid))]
+	if st == nil || st.Collection == nil {
+		if cur.Id == 0 {
+			return errors.New("ItemNotFound")
+		}
+		return nil
+	}
+	if cur.Id == 0 {
+		// 已删除的地址簿按原 id 重建, 共享规则随地址簿删除, 不恢复
+		n := &model.AddressBookCollection{UserId: userId, Name: st.Collection.Name, PeerQuery: st.Collection.PeerQuery, ParentId: restoreCollectionParent(tx, userId, cid, st.Collection.ParentId, 0)}
+		n.Id = cid
+		if err := tx.Create(n).Error; err != nil {
+			return err
+		}
+		res.Created++
+		return s.RecordCollection(tx, actor, nil, n)
+	}
+	if cur.UserId != userId {
+		return errors.New("NoAccess")
+	}
+	parentId := restoreCollectionParent(tx, userId, cid, st.Collection.ParentId, cur.ParentId)
+	if cur.Name == st.Collection.Name && reflect.DeepEqual(cur.PeerQuery, st.Collection.PeerQuery) && cur.ParentId == parentId {
+		return nil
+	}
+	before := *cur
+	cur.Name = st.Collection.Name
+	cur.PeerQuery = st.Collection.PeerQuery
+	cur.ParentId = parentId
+	if err := tx.Model(cur).Select("name", "peer_query", "parent_id").Updates(cur).Error; err != nil {
+		return err
+	}
+	res.Updated++
+	return s.RecordCollection(tx, actor, &before, cur)
+}
+
+// restoreCollectionParent 恢复时的上级, 记录中没有上级、上级已删除或会形成环时使用 def
+func restoreCollectionParent(tx *gorm.DB, userId, cid uint, parentId *uint, def uint) uint {
+	if parentId == nil {
+		return def
+	}
+	if *parentId == 0 {
+		return 0
+	}
+	var cs []*model.AddressBookCollection
+	tx.Where("user_id = ?", userId).Find(&cs)
+	if checkCollectionParent(cs, cid, *parentId) != nil {
+		return def
+	}
+	return *parentId
+}
+
+func (s *AddressBookChangeService) restorePeers(tx *gorm.DB, actor *AddressBookActor, userId, cid uint, states map[string]*model.AddressBookChangeData, res *model.AddressBookRestoreResult) error {
+	var abs []*model.AddressBook
+	tx.Where("user_id = ? and collection_id = ?", userId, cid).Find(&abs)
+	rows := make(map[string]*model.AddressBook, len(abs))
+	for _, ab := range abs {
+		if _, ok := rows[ab.Id]; !ok {
+			rows[ab.Id] = ab
+		}
+	}
+	for _, id := range sortedKeys(states) {
+		st, cur := states[id], rows[id]
+		if st == nil || st.Peer == nil {
+			if cur == nil {
+				continue
+			}
+			if err := tx.Delete(cur).Error; err != nil {
+				return err
+			}
+			res.Deleted++
+			if err := s.RecordPeer(tx, actor, cur, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		snap, err := st.Peer.Open()
+		if err != nil {
+			return err
+		}
+		if cur == nil {
+			ab := snap.ToAddressBook()
+			ab.UserId = userId
+			ab.CollectionId = cid
+			if err = tx.Create(ab).Error; err != nil {
+				return err
+			}
+			res.Created++
+			if err = s.RecordPeer(tx, actor, nil, ab); err != nil {
+				return err
+			}
+			continue
+		}
+		if reflect.DeepEqual(model.NewAddressBookSnapshot(cur), snap) {
+			continue
+		}
+		if err = tx.Model(&model.AddressBook{}).Where("row_id = ?", cur.RowId).
+			Select(model.AddressBookSnapshotColumns).Updates(snap.ToAddressBook()).Error; err != nil {
+			return err
+		}
+		after := &model.AddressBook{}
+		tx.Where("row_id = ?", cur.RowId).First(after)
+		res.Updated++
+		if err = s.RecordPeer(tx, actor, cur, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *AddressBookChangeService) restoreTags(tx *gorm.DB, actor *AddressBookActor, userId, cid uint, states map[string]*model.AddressBookChangeData, res *model.AddressBookRestoreResult) error {
+	var ts []*model.Tag
+	tx.Where("user_id = ? and collection_id = ?", userId, cid).Find(&ts)
+	rows := make(map[string]*model.Tag, len(ts))
+	for _, t := range ts {
+		rows[t.Name] = t
+	}
+	for _, name := range sortedKeys(states) {
+		st, cur := states[name], rows[name]
+		switch {
+		case (st == nil || st.Tag == nil) && cur != nil:
+			if err := tx.Delete(cur).Error; err != nil {
+				return err
+			}
+			res.Deleted++
+			if err := s.RecordTag(tx, actor, cur, nil); err != nil {
+				return err
+			}
+		case st != nil && st.Tag != nil && cur == nil:
+			t := &model.Tag{Name: name, Color: st.Tag.Color, UserId: userId, CollectionId: cid}
+			if err := tx.Create(t).Error; err != nil {
+				return err
+			}
+			res.Created++
+			if err := s.RecordTag(tx, actor, nil, t); err != nil {
+				return err
+			}
+		case st != nil && st.Tag != nil && cur.Color != st.Tag.Color:
+			before := *cur
+			if err := tx.Model(cur).Update("color", st.Tag.Color).Error; err != nil {
+				return err
+			}
+			res.Updated++
+			if err := s.RecordTag(tx, actor, &before, cur); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addressBookStatesAt 按变更日志推算时间点 at 的状态, 返回 target -> key -> 数据, 数据为空表示当时不存在
+// changes 按 id 升序; 时间点之前有记录的取最后一条的变更后数据, 否则取之后第一条的变更前数据
+func addressBookStatesAt(changes []*model.AddressBookChange, at int64) map[string]map[string]*model.AddressBookChangeData {
+	res := map[string]map[string]*model.AddressBookChangeData{}
+	for _, c := range changes {
+		m, ok := res[c.Target]
+		if !ok {
+			m = map[string]*model.AddressBookChangeData{}
+			res[c.Target] = m
+		}
+		if c.ChangedAt <= at {
+			m[c.TargetKey] = c.After
+			continue
+		}
+		if _, ok = m[c.TargetKey]; !ok {
+			m[c.TargetKey] = c.Before
+		}
+	}
+	return res
+}
+
+func sortedKeys(m map[string]*model.AddressBookChangeData) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func peerChangeData(p *model.AddressBookSnapshot) (*model.AddressBookChangeData, error) {
+	if p == nil {
+		return nil, nil
+	}
+	sp, err := p.Seal()
+	if err != nil {
+		return nil, err
+	}
+	return &model.AddressBookChangeData{Peer: sp}, nil
+}
+
+func tagChangeData(t *model.Tag) *model.AddressBookChangeData {
+	if t == nil {
+		return nil
+	}
+	return &model.AddressBookChangeData{Tag: &model.AddressBookChangeTag{Name: t.Name, Color: t.Color}}
+}
+
+func collectionChangeData(c *model.AddressBookCollection) *model.AddressBookChangeData {
+	if c == nil {
+		return nil
+	}
+	parentId := c.ParentId
+	return &model.AddressBookChangeData{Collection: &model.AddressBookChangeCollection{Name: c.Name, PeerQuery: c.PeerQuery, ParentId: &parentId}}
+}
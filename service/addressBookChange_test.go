@@ -0,0 +1,51 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+func abTagData(color uint) *model.AddressBookChangeData {
+	return &model.AddressBookChangeData{Tag: &model.AddressBookChangeTag{Color: color}}
+}
+
+func TestAddressBookStatesAt(t *testing.T) {
+	tag := model.AddressBookChangeTargetTag
+	changes := []*model.AddressBookChange{
+		// a: 10 新增, 20 修改, 30 删除
+		{Target: tag, TargetKey: "a", After: abTagData(1), ChangedAt: 10},
+		{Target: tag, TargetKey: "a", Before: abTagData(1), After: abTagData(2), ChangedAt: 20},
+		{Target: tag, TargetKey: "a", Before: abTagData(2), ChangedAt: 30},
+		// b: 日志之前已存在, 25 修改
+		{Target: tag, TargetKey: "b", Before: abTagData(5), After: abTagData(6), ChangedAt: 25},
+		// c: 40 新增
+		{Target: tag, TargetKey: "c", After: abTagData(7), ChangedAt: 40},
+	}
+	cases := []struct {
+		at   int64
+		want map[string]int // 颜色, 0 表示不存在
+	}{
+		{5, map[string]int{"a": 0, "b": 5, "c": 0}},
+		{20, map[string]int{"a": 2, "b": 5, "c": 0}},
+		{25, map[string]int{"a": 2, "b": 6, "c": 0}},
+		{35, map[string]int{"a": 0, "b": 6, "c": 0}},
+		{50, map[string]int{"a": 0, "b": 6, "c": 7}},
+	}
+	for _, cs := range cases {
+		states := addressBookStatesAt(changes, cs.at)[tag]
+		for key, color := range cs.want {
+			st, ok := states[key]
+			if !ok {
+				t.Fatalf("at %d: %s missing", cs.at, key)
+			}
+			got := 0
+			if st != nil {
+				got = int(st.Tag.Color)
+			}
+			if got != color {
+				t.Fatalf("at %d: %s color %d, want %d", cs.at, key, got, color)
+			}
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrAbQuotaExceeded 新增条目超出用户或地址簿的配额
+var ErrAbQuotaExceeded = errors.New("AddressBookQuotaExceeded")
+
+// UserPeerQuota 用户所有地址簿的条目总数上限, 0 表示不限制
+func (s *AddressBookService) UserPeerQuota(userId uint) int {
+	u := &model.User{}
+	DB.Select("id", "max_ab_peers").Where("id = ?", userId).First(u)
+	if u.MaxAbPeers != nil && *u.MaxAbPeers > 0 {
+		return *u.MaxAbPeers
+	}
+	return max(Config.App.AbMaxPeersPerUser, 0)
+}
+
+// CollectionPeerQuota 单个地址簿的条目数上限, 个人地址簿 cid 为 0, 0 表示不限制
+func (s *AddressBookService) CollectionPeerQuota(cid uint) int {
+	if cid > 0 {
+		col := s.CollectionInfoById(cid)
+		if col.MaxPeers != nil && *col.MaxPeers > 0 {
+			return *col.MaxPeers
+		}
+	}
+	return max(Config.App.AbMaxPeersPerCollection, 0)
+}
+
+// LicensedDevices 地址簿最多能容纳的条目数(含已有条目), 同时受地址簿和用户配额限制, 0 表示不限制
+// 返回给客户端的 licensed_devices, 客户端据此判断地址簿是否已满
+func (s *AddressBookService) LicensedDevices(userId, cid uint) int {
+	res := s.CollectionPeerQuota(cid)
+	if uq := s.UserPeerQuota(userId); uq > 0 {
+		var total, inCollection int64
+		DB.Model(&model.AddressBook{}).Where("user_id = ?", userId).Count(&total)
+		DB.Model(&model.AddressBook{}).Where("user_id = ? and collection_id = ?", userId, cid).Count(&inCollection)
+		// 其他地址簿占用的配额不能用于本地址簿; 已超出时按现有条目数报告为已满
+		capacity := max(uq-int(total-inCollection), int(inCollection))
+		if res == 0 || capacity < res {
+			res = capacity
+		}
+		// 0 会被客户端当作不限制
+		res = max(res, 1)
+	}
+	return res
+}
+
+// CheckQuota 在事务中检查地址簿新增 n 个条目后是否超出配额, n 为净增数
+// 计数前锁定用户行, 同一用户的并发新增按顺序检查, 需要与写入在同一事务中调用
+func (s *AddressBookService) CheckQuota(tx *gorm.DB, userId, cid uint, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	cq, uq := s.CollectionPeerQuota(cid), s.UserPeerQuota(userId)
+	if cq == 0 && uq == 0 {
+		return nil
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("id = ?", userId).Find(&model.User{}).Error; err != nil {
+		return err
+	}
+	if cq > 0 {
+		var count int64
+		tx.Model(&model.AddressBook{}).Where("user_id = ? and collection_id = ?", userId, cid).Count(&count)
+		if int(count)+n > cq {
+			return ErrAbQuotaExceeded
+		}
+	}
+	if uq > 0 {
+		var count int64
+		tx.Model(&model.AddressBook{}).Where("user_id = ?", userId).Count(&count)
+		if int(count)+n > uq {
+			return ErrAbQuotaExceeded
+		}
+	}
+	return nil
+}
+
+// MaxPageSize 客户端分页读取地址簿时每页最大条数
+func (s *AddressBookService) MaxPageSize() uint {
+	if Config.App.AbMaxPageSize > 0 {
+		return uint(Config.App.AbMaxPageSize)
+	}
+	return 1000
+}
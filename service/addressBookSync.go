@@ -0,0 +1,545 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"gorm.io/gorm"
+)
+
+// ErrAbSyncConflict 上传基于的修订不存在(已清理或比当前新), 无法合并
+var ErrAbSyncConflict = errors.New("AddressBookConflict")
+
+// AddressBookSyncService 旧版地址簿(/api/ab)同步
+// 每次同步生成修订号和快照, 上传与设备上次看到的修订、服务端当前数据三方合并, 同步删除的条目记为墓碑
+type AddressBookSyncService struct {
+}
+
+// AddressBookSyncMeta 同步来源
+type AddressBookSyncMeta struct {
+	DeviceId   string
+	DeviceUuid string
+	ClientIp   string
+	OperatorId uint
+}
+
+// abMergePlan 合并结果, 相对服务端当前数据的增删改
+type abMergePlan struct {
+	Create    []*model.AddressBookSnapshot
+	Update    []*model.AddressBookSnapshot
+	Delete    []string
+	Conflicts []string
+	// Merged 结果是否保留了上传中没有的服务端修改
+	Merged bool
+}
+
+// List 同步历史, 列表不含快照
+func (ss *AddressBookSyncService) List(page, pageSize uint, where func(tx *gorm.DB)) (res *model.AddressBookSyncList) {
+	res = &model.AddressBookSyncList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := DB.Model(&model.AddressBookSync{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Omit("peers", "tag_colors").Order("id desc").Find(&res.AddressBookSyncs)
+	return
+}
+
+// InfoById 根据id取同步记录, 快照已解密
+func (ss *AddressBookSyncService) InfoById(id uint) (*model.AddressBookSync, error) {
+	s := &model.AddressBookSync{}
+	DB.Where("id = ?", id).First(s)
+	return s, ss.open(s)
+}
+
+// Latest 用户当前的修订, 没有同步过时 Id 为 0
+func (ss *AddressBookSyncService) Latest(userId uint) *model.AddressBookSync {
+	s := &model.AddressBookSync{}
+	DB.Where("user_id = ?", userId).Order("revision desc").First(s)
+	return s
+}
+
+// Ensure 返回用户当前修订号, 没有同步历史时以现有数据建立基线
+func (ss *AddressBookSyncService) Ensure(userId uint) (uint, error) {
+	if cur := ss.Latest(userId); cur.Id > 0 {
+		return cur.Revision, nil
+	}
+	s, err := ss.apply(userId, &model.AddressBookSync{Action: model.AddressBookSyncActionInit}, &abMergePlan{}, nil, nil, nil)
+	if err != nil {
+		// 并发读取时其他请求已经建立了基线
+		if cur := ss.Latest(userId); cur.Id > 0 {
+			return cur.Revision, nil
+		}
+		return 0, err
+	}
+	return s.Revision, nil
+}
+
+// Sync 客户端上传, base 为设备上次看到的修订号, 0 表示未知(只增改不删)
+func (ss *AddressBookSyncService) Sync(userId, base uint, peers []*model.AddressBook, tagColors map[string]uint, meta *AddressBookSyncMeta) (*model.AddressBookSync, error) {
+	cur := ss.Latest(userId)
+	if base > cur.Revision {
+		return nil, ErrAbSyncConflict
+	}
+	baseSync := &model.AddressBookSync{}
+	if base == cur.Revision {
+		baseSync = cur
+	} else if base > 0 {
+		DB.Where("user_id = ? and revision = ?", userId, base).First(baseSync)
+		if baseSync.Id == 0 {
+			return nil, ErrAbSyncConflict
+		}
+	}
+	if err := ss.open(baseSync); err != nil {
+		return nil, err
+	}
+	ours := ss.current(userId)
+	theirs := make(map[string]*model.AddressBookSnapshot, len(peers))
+	for _, p := range peers {
+		if p.Id != "" {
+			theirs[p.Id] = model.NewAddressBookSnapshot(p)
+		}
+	}
+	plan := mergeAddressBook(snapshotMap(baseSync.Peers), ours, theirs)
+	tags, tagsMerged := mergeTagColors(baseSync.TagColors, ss.currentTags(userId), tagColors)
+	plan.Merged = plan.Merged || tagsMerged
+	s := &model.AddressBookSync{
+		Action:       model.AddressBookSyncActionSync,
+		BaseRevision: base,
+	}
+	actor := &AddressBookActor{UserId: userId, Source: model.AddressBookChangeSourceSync}
+	if meta != nil {
+		s.DeviceId = meta.DeviceId
+		s.ClientIp = meta.ClientIp
+		actor.DeviceUuid = meta.DeviceUuid
+	}
+	return ss.apply(userId, s, plan, tags, actor, nil)
+}
+
+// Restore 将用户地址簿恢复到历史修订, 生成新的修订
+func (ss *AddressBookSyncService) Restore(userId, revision, operatorId uint) (*model.AddressBookSync, error) {
+	target := &model.AddressBookSync{}
+	DB.Where("user_id = ? and revision = ?", userId, revision).First(target)
+	if target.Id == 0 {
+		return nil, errors.New("ItemNotFound")
+	}
+	if err := ss.open(target); err != nil {
+		return nil, err
+	}
+	ours := ss.current(userId)
+	tags := target.TagColors
+	if tags == nil {
+		tags = map[string]uint{}
+	}
+	// 以当前数据为基线合并即为整体替换
+	plan := mergeAddressBook(ours, ours, snapshotMap(target.Peers))
+	return ss.apply(userId, &model.AddressBookSync{
+		Action:       model.AddressBookSyncActionRestore,
+		BaseRevision: revision,
+		OperatorId:   operatorId,
+	}, plan, tags, &AddressBookActor{UserId: operatorId, Source: model.AddressBookChangeSourceAdmin}, nil)
+}
+
+// Tombstones 同步删除的条目
+func (ss *AddressBookSyncService) Tombstones(page, pageSize uint, where func(tx *gorm.DB)) (res *model.AddressBookTombstoneList) {
+	res = &model.AddressBookTombstoneList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := DB.Model(&model.AddressBookTombstone{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Order("id desc").Find(&res.AddressBookTombstones)
+	for _, t := range res.AddressBookTombstones {
+		if t.Peer != nil {
+			if p, err := t.Peer.Open(); err == nil {
+				t.Peer = p
+			}
+		}
+	}
+	return
+}
+
+// RestoreTombstone 恢复同步删除的条目, 生成新的修订
+func (ss *AddressBookSyncService) RestoreTombstone(id, operatorId uint) (*model.AddressBookSync, error) {
+	t := &model.AddressBookTombstone{}
+	DB.Where("id = ?", id).First(t)
+	if t.Id == 0 || t.RestoredAt > 0 || t.Peer == nil {
+		return nil, errors.New("ItemNotFound")
+	}
+	ours := ss.current(t.UserId)
+	if _, ok := ours[t.PeerId]; ok {
+		return nil, errors.New("ItemExists")
+	}
+	p, err := t.Peer.Open()
+	if err != nil {
+		return nil, err
+	}
+	return ss.apply(t.UserId, &model.AddressBookSync{
+		Action:     model.AddressBookSyncActionUndelete,
+		OperatorId: operatorId,
+	}, &abMergePlan{Create: []*model.AddressBookSnapshot{p}}, nil, &AddressBookActor{UserId: operatorId, Source: model.AddressBookChangeSourceAdmin}, func(tx *gorm.DB) error {
+		return tx.Model(t).Update("restored_at", time.Now().Unix()).Error
+	})
+}
+
+// SetTokenRevision 记录令牌对应设备看到的修订号
+func (ss *AddressBookSyncService) SetTokenRevision(token string, revision uint) {
+	DB.Model(&model.UserToken{}).Where("token = ?", token).Update("ab_revision", revision)
+}
+
+// apply 在事务中执行合并结果并记录新修订和变更日志, tags 为 nil 时不修改标签
+func (ss *AddressBookSyncService) apply(userId uint, s *model.AddressBookSync, plan *abMergePlan, tags map[string]uint, actor *AddressBookActor, extra func(tx *gorm.DB) error) (*model.AddressBookSync, error) {
+	//恢复删除的条目时保持原样, 不按规则补充标签, 也不替换已合并的旧ID
+	//规则和设备在事务外查询
+	var ms []*tagRuleMatcher
+	peers := make(map[string]*model.Peer, len(plan.Create))
+	if s.Action != model.AddressBookSyncActionUndelete {
+		ms = AllService.TagRuleService.matchers()
+		for _, p := range plan.Create {
+			if peer := AllService.PeerService.Resolve(p.Id); peer.RowId != 0 {
+				peers[p.Id] = peer
+			}
+		}
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var abs []*model.AddressBook
+		tx.Where("user_id = ? and collection_id = 0", userId).Find(&abs)
+		rows := make(map[string]*model.AddressBook, len(abs))
+		for _, ab := range abs {
+			rows[ab.Id] = ab
+		}
+		if err := AllService.AddressBookService.CheckQuota(tx, userId, 0, len(plan.Create)-len(plan.Delete)); err != nil {
+			return err
+		}
+		latest := &model.AddressBookSync{}
+		tx.Select("revision").Where("user_id = ?", userId).Order("revision desc").First(latest)
+		s.UserId = userId
+		s.Revision = latest.Revision + 1
+
+		added := 0
+		created := make(map[string]bool, len(plan.Create))
+		for _, p := range plan.Create {
+			ab := p.ToAddressBook()
+			ab.UserId = userId
+			if peer, ok := peers[ab.Id]; ok {
+				if peer.Id != ab.Id {
+					// 旧ID已合并, 按合并后的ID保存, 已有该设备时不再重复添加
+					ab.Id = peer.Id
+					if _, ok := rows[ab.Id]; ok || created[ab.Id] {
+						continue
+					}
+				}
+				if ab.Platform == "" || ab.Username == "" || ab.Hostname == "" {
+					ab.Platform = AllService.AddressBookService.PlatformFromOs(peer.Os)
+					ab.Username = peer.Username
+					ab.Hostname = peer.Hostname
+				}
+			}
+			if err := AllService.TagRuleService.apply(tx, ms, ab, actor); err != nil {
+				return err
+			}
+			if err := tx.Create(ab).Error; err != nil {
+				return err
+			}
+			added++
+			created[ab.Id] = true
+			if err := AllService.AddressBookChangeService.RecordPeer(tx, actor, nil, ab); err != nil {
+				return err
+			}
+		}
+		for _, p := range plan.Update {
+			row, ok := rows[p.Id]
+			if !ok {
+				continue
+			}
+			if err := tx.Model(&model.AddressBook{}).Where("row_id = ?", row.RowId).
+				Select(model.AddressBookSnapshotColumns).Updates(p.ToAddressBook()).Error; err != nil {
+				return err
+			}
+			after := &model.AddressBook{}
+			tx.Where("row_id = ?", row.RowId).First(after)
+			if err := AllService.AddressBookChangeService.RecordPeer(tx, actor, row, after); err != nil {
+				return err
+			}
+		}
+		for _, id := range plan.Delete {
+			row, ok := rows[id]
+			if !ok {
+				continue
+			}
+			snap, err := model.NewAddressBookSnapshot(row).Seal()
+			if err != nil {
+				return err
+			}
+			if err = tx.Create(&model.AddressBookTombstone{UserId: userId, PeerId: id, Revision: s.Revision, Peer: snap}).Error; err != nil {
+				return err
+			}
+			if err = tx.Delete(row).Error; err != nil {
+				return err
+			}
+			if err = AllService.AddressBookChangeService.RecordPeer(tx, actor, row, nil); err != nil {
+				return err
+			}
+		}
+		if tags != nil {
+			if err := ss.applyTags(tx, userId, tags, actor); err != nil {
+				return err
+			}
+		}
+		if extra != nil {
+			if err := extra(tx); err != nil {
+				return err
+			}
+		}
+
+		// 快照为执行后的数据
+		abs = nil
+		tx.Where("user_id = ? and collection_id = 0", userId).Order("row_id asc").Find(&abs)
+		s.Peers = make([]*model.AddressBookSnapshot, 0, len(abs))
+		for _, ab := range abs {
+			snap, err := model.NewAddressBookSnapshot(ab).Seal()
+			if err != nil {
+				return err
+			}
+			s.Peers = append(s.Peers, snap)
+		}
+		var ts []*model.Tag
+		tx.Where("user_id = ? and collection_id = 0", userId).Find(&ts)
+		s.TagColors = make(map[string]uint, len(ts))
+		for _, t := range ts {
+			s.TagColors[t.Name] = t.Color
+		}
+		s.Added = added
+		s.Updated = len(plan.Update)
+		s.Removed = len(plan.Delete)
+		s.Merged = plan.Merged
+		s.Conflicts = plan.Conflicts
+		// 并发同步时修订号唯一索引冲突, 整个事务回滚
+		return tx.Create(s).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	ss.prune(userId, s.Revision)
+	return s, nil
+}
+
+// applyTags 按合并结果更新个人地址簿的标签
+func (ss *AddressBookSyncService) applyTags(tx *gorm.DB, userId uint, tags map[string]uint, actor *AddressBookActor) error {
+	var ts []*model.Tag
+	tx.Where("user_id = ? and collection_id = 0", userId).Find(&ts)
+	exists := make(map[string]bool, len(ts))
+	for _, t := range ts {
+		color, ok := tags[t.Name]
+		exists[t.Name] = true
+		if !ok {
+			if err := tx.Delete(t).Error; err != nil {
+				return err
+			}
+			if err := AllService.AddressBookChangeService.RecordTag(tx, actor, t, nil); err != nil {
+				return err
+			}
+		} else if color != t.Color {
+			before := *t
+			if err := tx.Model(t).Update("color", color).Error; err != nil {
+				return err
+			}
+			if err := AllService.AddressBookChangeService.RecordTag(tx, actor, &before, t); err != nil {
+				return err
+			}
+		}
+	}
+	for name, color := range tags {
+		if exists[name] {
+			continue
+		}
+		t := &model.Tag{Name: name, Color: color, UserId: userId}
+		if err := tx.Create(t).Error; err != nil {
+			return err
+		}
+		if err := AllService.AddressBookChangeService.RecordTag(tx, actor, nil, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune 每个用户只保留最近的同步历史
+func (ss *AddressBookSyncService) prune(userId, revision uint) {
+	limit := Config.Admin.AbSyncHistoryLimit
+	if limit <= 0 || revision <= uint(limit) {
+		return
+	}
+	DB.Where("user_id = ? and revision <= ?", userId, revision-uint(limit)).Delete(&model.AddressBookSync{})
+}
+
+// current 个人地址簿当前数据
+func (ss *AddressBookSyncService) current(userId uint) map[string]*model.AddressBookSnapshot {
+	var abs []*model.AddressBook
+	DB.Where("user_id = ? and collection_id = 0", userId).Find(&abs)
+	res := make(map[string]*model.AddressBookSnapshot, len(abs))
+	for _, ab := range abs {
+		res[ab.Id] = model.NewAddressBookSnapshot(ab)
+	}
+	return res
+}
+
+func (ss *AddressBookSyncService) currentTags(userId uint) map[string]uint {
+	var ts []*model.Tag
+	DB.Where("user_id = ? and collection_id = 0", userId).Find(&ts)
+	res := make(map[string]uint, len(ts))
+	for _, t := range ts {
+		res[t.Name] = t.Color
+	}
+	return res
+}
+
+// open 解密快照
+func (ss *AddressBookSyncService) open(s *model.AddressBookSync) error {
+	for i, p := range s.Peers {
+		op, err := p.Open()
+		if err != nil {
+			return err
+		}
+		s.Peers[i] = op
+	}
+	return nil
+}
+
+func snapshotMap(peers []*model.AddressBookSnapshot) map[string]*model.AddressBookSnapshot {
+	res := make(map[string]*model.AddressBookSnapshot, len(peers))
+	for _, p := range peers {
+		res[p.Id] = p
+	}
+	return res
+}
+
+// mergeAddressBook 三方合并, base 为上传方上次看到的数据, ours 为服务端当前数据, theirs 为上传的数据
+// 只有一方修改的以修改方为准; 双方都修改的字段以上传为准并记为冲突;
+// 一方删除另一方修改的条目保留修改
+func mergeAddressBook(base, ours, theirs map[string]*model.AddressBookSnapshot) *abMergePlan {
+	plan := &abMergePlan{}
+	ids := make(map[string]bool, len(ours)+len(theirs))
+	for id := range ours {
+		ids[id] = true
+	}
+	for id := range theirs {
+		ids[id] = true
+	}
+	for id := range base {
+		ids[id] = true
+	}
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	for _, id := range sorted {
+		b, o, t := base[id], ours[id], theirs[id]
+		switch {
+		case o != nil && t != nil:
+			res, conflict, keptOurs := mergeSnapshot(b, o, t)
+			if conflict {
+				plan.Conflicts = append(plan.Conflicts, id)
+			}
+			if keptOurs {
+				plan.Merged = true
+			}
+			if !reflect.DeepEqual(res, o) {
+				plan.Update = append(plan.Update, res)
+			}
+		case o != nil:
+			// 上传中没有: 上传方删除了未被修改的条目才删除, 其余都是服务端新增或修改的
+			if b != nil && reflect.DeepEqual(b, o) {
+				plan.Delete = append(plan.Delete, id)
+			} else {
+				if b != nil {
+					plan.Conflicts = append(plan.Conflicts, id)
+				}
+				plan.Merged = true
+			}
+		case t != nil:
+			// 服务端没有: 服务端删除了上传方未修改的条目则保持删除
+			if b != nil && reflect.DeepEqual(b, t) {
+				plan.Merged = true
+			} else {
+				if b != nil {
+					plan.Conflicts = append(plan.Conflicts, id)
+				}
+				plan.Create = append(plan.Create, t)
+			}
+		}
+	}
+	return plan
+}
+
+// mergeSnapshot 按字段三方合并, 返回是否有双方都修改的字段、是否保留了服务端的修改
+func mergeSnapshot(b, o, t *model.AddressBookSnapshot) (*model.AddressBookSnapshot, bool, bool) {
+	res := *t
+	conflict, keptOurs := false, false
+	rr := reflect.ValueOf(&res).Elem()
+	ro := reflect.ValueOf(o).Elem()
+	rt := reflect.ValueOf(t).Elem()
+	var rb reflect.Value
+	if b != nil {
+		rb = reflect.ValueOf(b).Elem()
+	}
+	for i := 0; i < rr.NumField(); i++ {
+		of, tf := ro.Field(i).Interface(), rt.Field(i).Interface()
+		if reflect.DeepEqual(of, tf) {
+			continue
+		}
+		if b == nil {
+			conflict = true
+			continue
+		}
+		bf := rb.Field(i).Interface()
+		if reflect.DeepEqual(tf, bf) {
+			rr.Field(i).Set(ro.Field(i))
+			keptOurs = true
+		} else if !reflect.DeepEqual(of, bf) {
+			conflict = true
+		}
+	}
+	return &res, conflict, keptOurs
+}
+
+// mergeTagColors 标签颜色三方合并, 规则同 mergeAddressBook
+func mergeTagColors(base, ours, theirs map[string]uint) (map[string]uint, bool) {
+	res := make(map[string]uint, len(ours)+len(theirs))
+	merged := false
+	for name, tc := range theirs {
+		bc, inBase := base[name]
+		oc, inOurs := ours[name]
+		switch {
+		case inBase && tc == bc && inOurs:
+			res[name] = oc
+			merged = merged || oc != tc
+		case inBase && tc == bc && !inOurs:
+			merged = true
+		default:
+			res[name] = tc
+		}
+	}
+	for name, oc := range ours {
+		if _, ok := theirs[name]; ok {
+			continue
+		}
+		if bc, inBase := base[name]; inBase && bc == oc {
+			continue
+		}
+		res[name] = oc
+		merged = true
+	}
+	return res, merged
+}
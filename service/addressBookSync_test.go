@@ -0,0 +1,87 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+func abSnap(id, alias string, tags ...string) *model.AddressBookSnapshot {
+	if tags == nil {
+		tags = []string{}
+	}
+	return &model.AddressBookSnapshot{Id: id, Alias: alias, Tags: tags}
+}
+
+func abSnaps(ss ...*model.AddressBookSnapshot) map[string]*model.AddressBookSnapshot {
+	return snapshotMap(ss)
+}
+
+func TestMergeAddressBook(t *testing.T) {
+	base := abSnaps(abSnap("keep", "k"), abSnap("del", "d"), abSnap("mod", "m", "a"), abSnap("srvdel", "s"), abSnap("both", "b"))
+	// 服务端: 另一台设备新增 other, 修改 mod 的标签, 删除 srvdel, 修改 both
+	ours := abSnaps(abSnap("keep", "k"), abSnap("del", "d"), abSnap("mod", "m", "b"), abSnap("other", "o"), abSnap("both", "server"))
+	// 上传: 删除 del, 修改 mod 的别名, 新增 new, 修改 both
+	theirs := abSnaps(abSnap("keep", "k"), abSnap("mod", "m2", "a"), abSnap("srvdel", "s"), abSnap("new", "n"), abSnap("both", "client"))
+
+	plan := mergeAddressBook(base, ours, theirs)
+	if !reflect.DeepEqual(plan.Delete, []string{"del"}) {
+		t.Fatalf("delete %v", plan.Delete)
+	}
+	if len(plan.Create) != 1 || plan.Create[0].Id != "new" {
+		t.Fatalf("create %v", plan.Create)
+	}
+	updates := map[string]*model.AddressBookSnapshot{}
+	for _, u := range plan.Update {
+		updates[u.Id] = u
+	}
+	if len(updates) != 2 {
+		t.Fatalf("update %v", plan.Update)
+	}
+	if m := updates["mod"]; m.Alias != "m2" || !reflect.DeepEqual(m.Tags, []string{"b"}) {
+		t.Fatalf("mod should combine both sides, got %+v", m)
+	}
+	if updates["both"].Alias != "client" {
+		t.Fatalf("upload should win on conflicting field, got %+v", updates["both"])
+	}
+	if !reflect.DeepEqual(plan.Conflicts, []string{"both"}) {
+		t.Fatalf("conflicts %v", plan.Conflicts)
+	}
+	if !plan.Merged {
+		t.Fatal("expected merged")
+	}
+}
+
+func TestMergeAddressBookFastForward(t *testing.T) {
+	base := abSnaps(abSnap("a", "1"), abSnap("b", "2"))
+	theirs := abSnaps(abSnap("a", "x"), abSnap("c", "3"))
+	plan := mergeAddressBook(base, base, theirs)
+	if plan.Merged || len(plan.Conflicts) > 0 {
+		t.Fatalf("unexpected merge %+v", plan)
+	}
+	if len(plan.Update) != 1 || len(plan.Create) != 1 || !reflect.DeepEqual(plan.Delete, []string{"b"}) {
+		t.Fatalf("unexpected plan %+v", plan)
+	}
+
+	// 没有基线时不删除服务端条目
+	plan = mergeAddressBook(nil, base, theirs)
+	if len(plan.Delete) != 0 || !plan.Merged {
+		t.Fatalf("unexpected plan without base %+v", plan)
+	}
+}
+
+func TestMergeTagColors(t *testing.T) {
+	base := map[string]uint{"a": 1, "b": 2, "c": 3}
+	ours := map[string]uint{"a": 1, "b": 20, "d": 4}
+	theirs := map[string]uint{"b": 2, "c": 3, "e": 5}
+	res, merged := mergeTagColors(base, ours, theirs)
+	want := map[string]uint{"b": 20, "d": 4, "e": 5}
+	if !reflect.DeepEqual(res, want) || !merged {
+		t.Fatalf("got %v %v", res, merged)
+	}
+	res, merged = mergeTagColors(base, base, theirs)
+	if !reflect.DeepEqual(res, theirs) || merged {
+		t.Fatalf("fast forward got %v %v", res, merged)
+	}
+}
@@ -0,0 +1,804 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"gorm.io/gorm"
+)
+
+// AddressBookTransferService 地址簿导入导出
+// 导入先把文件解析为 列 => 值 的记录, 再按字段映射转为条目; 预览和导入走同一流程, 导入在一个事务中完成
+type AddressBookTransferService struct {
+}
+
+// AddressBookImportOptions 导入参数
+type AddressBookImportOptions struct {
+	Format   string
+	Content  string
+	Mapping  map[string]string // 字段 => 列, 为空时按列名自动识别; rustdesk 格式固定自动识别
+	Strategy string
+}
+
+// abImportFields 可导入的字段及自动识别的列名, 列名比较时忽略大小写、空格、下划线和中划线
+var abImportFields = []struct {
+	Field string
+	Names []string
+}{
+	{"id", []string{"id", "peerid", "rustdeskid", "deviceid"}},
+	{"alias", []string{"alias", "name"}},
+	{"hostname", []string{"hostname", "host"}},
+	{"username", []string{"username", "user"}},
+	{"platform", []string{"platform", "os"}},
+	{"tags", []string{"tags", "tag"}},
+	{"tag_colors", []string{"tagcolors"}},
+	{"password", []string{"password"}},
+	{"hash", []string{"hash"}},
+	{"force_always_relay", []string{"forcealwaysrelay"}},
+	{"rdp_port", []string{"rdpport"}},
+	{"rdp_username", []string{"rdpusername"}},
+	{"login_name", []string{"loginname"}},
+}
+
+// abImportUpdateColumns 覆盖已有条目时字段对应的列, 只更新映射了的字段
+var abImportUpdateColumns = map[string]string{
+	"alias":              "alias",
+	"hostname":           "hostname",
+	"username":           "username",
+	"platform":           "platform",
+	"tags":               "tags",
+	"password":           "password",
+	"hash":               "hash",
+	"force_always_relay": "force_always_relay",
+	"rdp_port":           "rdp_port",
+	"rdp_username":       "rdp_username",
+	"login_name":         "login_name",
+}
+
+// abExportJson json 格式的导出内容, 条目的键与导入字段一致
+type abExportJson struct {
+	Tags  []*abExportJsonTag  `json:"tags"`
+	Peers []*abExportJsonPeer `json:"peers"`
+}
+
+type abExportJsonTag struct {
+	Name  string `json:"name"`
+	Color uint   `json:"color"`
+}
+
+type abExportJsonPeer struct {
+	Id               string   `json:"id"`
+	Alias            string   `json:"alias"`
+	Hostname         string   `json:"hostname"`
+	Username         string   `json:"username"`
+	Platform         string   `json:"platform"`
+	Tags             []string `json:"tags"`
+	Password         string   `json:"password,omitempty"`
+	Hash             string   `json:"hash,omitempty"`
+	ForceAlwaysRelay bool     `json:"force_always_relay"`
+	RdpPort          string   `json:"rdp_port"`
+	RdpUsername      string   `json:"rdp_username"`
+	LoginName        string   `json:"login_name"`
+}
+
+// abExportRustdesk 与客户端 /api/ab 的 data 内容一致
+type abExportRustdesk struct {
+	Tags      []string                     `json:"tags"`
+	Peers     []*model.AddressBookSnapshot `json:"peers"`
+	TagColors string                       `json:"tag_colors"`
+}
+
+// Export 导出地址簿, secrets 为 false 时不含密码和 hash
+func (s *AddressBookTransferService) Export(userId, cid uint, format string, secrets bool) ([]byte, error) {
+	peers := make([]*model.AddressBookSnapshot, 0)
+	err := AllService.AddressBookService.EachByUserIdAndCollectionId(userId, cid, 1000, func(abs []*model.AddressBook) error {
+		for _, ab := range abs {
+			peers = append(peers, model.NewAddressBookSnapshot(ab))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	tags := AllService.TagService.ListByUserIdAndCollectionId(userId, cid).Tags
+	names := make([]string, 0, len(tags))
+	colors := make(map[string]uint, len(tags))
+	for _, t := range tags {
+		names = append(names, t.Name)
+		colors[t.Name] = t.Color
+	}
+	return exportAddressBook(format, peers, names, colors, secrets)
+}
+
+// exportAddressBook 按格式序列化; csv 没有单独的标签表, 只保留条目用到的标签及其颜色
+func exportAddressBook(format string, peers []*model.AddressBookSnapshot, tags []string, colors map[string]uint, secrets bool) ([]byte, error) {
+	if !secrets {
+		for _, p := range peers {
+			p.Password = ""
+			p.Hash = ""
+		}
+	}
+	switch format {
+	case model.AddressBookFormatCsv:
+		header := []string{"id", "alias", "hostname", "username", "platform", "tags", "tag_colors",
+			"force_always_relay", "rdp_port", "rdp_username", "login_name"}
+		if secrets {
+			header = append(header, "password", "hash")
+		}
+		buf := &bytes.Buffer{}
+		w := csv.NewWriter(buf)
+		_ = w.Write(header)
+		for _, p := range peers {
+			tc := make([]string, 0, len(p.Tags))
+			for _, t := range p.Tags {
+				if c, ok := colors[t]; ok {
+					tc = append(tc, t+"="+formatAbTagColor(c))
+				}
+			}
+			row := []string{p.Id, p.Alias, p.Hostname, p.Username, p.Platform, strings.Join(p.Tags, ";"), strings.Join(tc, ";"),
+				strconv.FormatBool(p.ForceAlwaysRelay), p.RdpPort, p.RdpUsername, p.LoginName}
+			if secrets {
+				row = append(row, p.Password, p.Hash)
+			}
+			_ = w.Write(row)
+		}
+		w.Flush()
+		return buf.Bytes(), w.Error()
+	case model.AddressBookFormatJson:
+		res := &abExportJson{Tags: make([]*abExportJsonTag, 0, len(tags)), Peers: make([]*abExportJsonPeer, 0, len(peers))}
+		for _, t := range tags {
+			res.Tags = append(res.Tags, &abExportJsonTag{Name: t, Color: colors[t]})
+		}
+		for _, p := range peers {
+			res.Peers = append(res.Peers, &abExportJsonPeer{
+				Id:               p.Id,
+				Alias:            p.Alias,
+				Hostname:         p.Hostname,
+				Username:         p.Username,
+				Platform:         p.Platform,
+				Tags:             p.Tags,
+				Password:         p.Password,
+				Hash:             p.Hash,
+				ForceAlwaysRelay: p.ForceAlwaysRelay,
+				RdpPort:          p.RdpPort,
+				RdpUsername:      p.RdpUsername,
+				LoginName:        p.LoginName,
+			})
+		}
+		return json.MarshalIndent(res, "", "  ")
+	case model.AddressBookFormatRustdesk:
+		tc, _ := json.Marshal(colors)
+		return json.Marshal(&abExportRustdesk{Tags: tags, Peers: peers, TagColors: string(tc)})
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// abImportPlan 导入计划, peers 与 report.Rows 一一对应, 含密码和 hash
+type abImportPlan struct {
+	report   *model.AddressBookImportReport
+	peers    []*model.AddressBookSnapshot
+	existing map[string]*model.AddressBook
+	colors   map[string]uint // 文件中指定了颜色的标签
+	columns  []string        // 覆盖已有条目时更新的列
+}
+
+// Preview 导入预览, 不修改数据
+func (s *AddressBookTransferService) Preview(userId, cid uint, opt *AddressBookImportOptions) (*model.AddressBookImportReport, error) {
+	plan, err := s.plan(userId, cid, opt)
+	if err != nil {
+		return nil, err
+	}
+	return plan.report, nil
+}
+
+// Import 按预览的结果导入, 配额不足时整体失败
+func (s *AddressBookTransferService) Import(userId, cid uint, opt *AddressBookImportOptions, actor *AddressBookActor) (*model.AddressBookImportReport, error) {
+	plan, err := s.plan(userId, cid, opt)
+	if err != nil {
+		return nil, err
+	}
+	ms := AllService.TagRuleService.matchers()
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := AllService.AddressBookService.CheckQuota(tx, userId, cid, plan.report.Created); err != nil {
+			return err
+		}
+		if err := s.importTags(tx, userId, cid, plan, actor); err != nil {
+			return err
+		}
+		for i, row := range plan.report.Rows {
+			switch row.Action {
+			case model.AddressBookImportActionCreate:
+				ab := plan.peers[i].ToAddressBook()
+				ab.UserId = userId
+				ab.CollectionId = cid
+				if err := AllService.TagRuleService.apply(tx, ms, ab, actor); err != nil {
+					return err
+				}
+				if err := tx.Create(ab).Error; err != nil {
+					return err
+				}
+				if err := AllService.AddressBookChangeService.RecordPeer(tx, actor, nil, ab); err != nil {
+					return err
+				}
+			case model.AddressBookImportActionUpdate:
+				if err := s.importUpdate(tx, plan, plan.peers[i], actor); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plan.report, nil
+}
+
+// importUpdate 覆盖已有条目, 文件中为空的密码和 hash 不会清空已有的值
+func (s *AddressBookTransferService) importUpdate(tx *gorm.DB, plan *abImportPlan, p *model.AddressBookSnapshot, actor *AddressBookActor) error {
+	ex := plan.existing[p.Id]
+	columns := make([]string, 0, len(plan.columns))
+	for _, col := range plan.columns {
+		if (col == "password" && p.Password == "") || (col == "hash" && p.Hash == "") {
+			continue
+		}
+		columns = append(columns, col)
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	ab := p.ToAddressBook()
+	if err := tx.Model(&model.AddressBook{RowId: ex.RowId}).Select(columns).Updates(ab).Error; err != nil {
+		return err
+	}
+	after := &model.AddressBook{}
+	tx.Where("row_id = ?", ex.RowId).First(after)
+	return AllService.AddressBookChangeService.RecordPeer(tx, actor, ex, after)
+}
+
+// importTags 创建缺少的标签, 覆盖时同时更新文件中指定了颜色的已有标签
+func (s *AddressBookTransferService) importTags(tx *gorm.DB, userId, cid uint, plan *abImportPlan, actor *AddressBookActor) error {
+	var ts []*model.Tag
+	tx.Where("user_id = ? and collection_id = ?", userId, cid).Find(&ts)
+	exists := make(map[string]bool, len(ts))
+	for _, t := range ts {
+		exists[t.Name] = true
+		color, ok := plan.colors[t.Name]
+		if !ok || color == t.Color || plan.report.Strategy != model.AddressBookImportOverwrite {
+			continue
+		}
+		before := *t
+		if err := tx.Model(t).Update("color", color).Error; err != nil {
+			return err
+		}
+		if err := AllService.AddressBookChangeService.RecordTag(tx, actor, &before, t); err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(plan.report.Tags))
+	for name := range plan.report.Tags {
+		if !exists[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		t := &model.Tag{Name: name, Color: plan.report.Tags[name], UserId: userId, CollectionId: cid}
+		if err := tx.Create(t).Error; err != nil {
+			return err
+		}
+		if err := AllService.AddressBookChangeService.RecordTag(tx, actor, nil, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// plan 解析文件并与地址簿现有条目比对
+func (s *AddressBookTransferService) plan(userId, cid uint, opt *AddressBookImportOptions) (*abImportPlan, error) {
+	strategy := opt.Strategy
+	if strategy == "" {
+		strategy = model.AddressBookImportSkip
+	}
+	table, err := parseAbImport(opt.Format, opt.Content)
+	if err != nil {
+		return nil, err
+	}
+	mapping := opt.Mapping
+	if opt.Format == model.AddressBookFormatRustdesk || len(mapping) == 0 {
+		mapping = abImportMapping(table.columns)
+	} else if err := checkAbImportMapping(mapping, table.columns); err != nil {
+		return nil, err
+	}
+	if mapping["id"] == "" {
+		return nil, errors.New("no column is mapped to id")
+	}
+
+	plan := &abImportPlan{
+		report: &model.AddressBookImportReport{
+			Columns:  table.columns,
+			Mapping:  mapping,
+			Strategy: strategy,
+			Rows:     make([]*model.AddressBookImportRow, 0, len(table.records)),
+			Tags:     map[string]uint{},
+		},
+		peers:    make([]*model.AddressBookSnapshot, 0, len(table.records)),
+		existing: map[string]*model.AddressBook{},
+		colors:   table.colors,
+	}
+	for field := range mapping {
+		if col, ok := abImportUpdateColumns[field]; ok {
+			plan.columns = append(plan.columns, col)
+		}
+	}
+	sort.Strings(plan.columns)
+
+	_ = AllService.AddressBookService.EachByUserIdAndCollectionId(userId, cid, 1000, func(abs []*model.AddressBook) error {
+		for _, ab := range abs {
+			if _, ok := plan.existing[ab.Id]; !ok {
+				plan.existing[ab.Id] = ab
+			}
+		}
+		return nil
+	})
+
+	seen := map[string]bool{}
+	for i, rec := range table.records {
+		row := &model.AddressBookImportRow{Line: table.lines[i]}
+		p, colors, err := abImportRecord(rec, mapping)
+		if err == nil && seen[p.Id] && strategy != model.AddressBookImportDuplicate {
+			err = fmt.Errorf("duplicate id %s", p.Id)
+		}
+		if err != nil {
+			row.Action = model.AddressBookImportActionInvalid
+			row.Error = err.Error()
+			plan.report.Rows = append(plan.report.Rows, row)
+			plan.peers = append(plan.peers, p)
+			plan.report.Invalid++
+			continue
+		}
+		seen[p.Id] = true
+		for name, c := range colors {
+			plan.colors[name] = c
+		}
+		for _, t := range p.Tags {
+			plan.report.Tags[t] = 0
+		}
+		_, exists := plan.existing[p.Id]
+		switch {
+		case !exists || strategy == model.AddressBookImportDuplicate:
+			row.Action = model.AddressBookImportActionCreate
+			plan.report.Created++
+		case strategy == model.AddressBookImportOverwrite:
+			row.Action = model.AddressBookImportActionUpdate
+			plan.report.Updated++
+		default:
+			row.Action = model.AddressBookImportActionSkip
+			plan.report.Skipped++
+		}
+		plan.report.Rows = append(plan.report.Rows, row)
+		plan.peers = append(plan.peers, p)
+	}
+	s.fillFromPeers(plan)
+
+	//文件中的标签表可能包含没有条目使用的标签
+	for name := range plan.colors {
+		plan.report.Tags[name] = 0
+	}
+	var ts []*model.Tag
+	DB.Where("user_id = ? and collection_id = ?", userId, cid).Find(&ts)
+	current := make(map[string]uint, len(ts))
+	for _, t := range ts {
+		current[t.Name] = t.Color
+	}
+	//已有标签的颜色只在覆盖时更新
+	for name := range plan.report.Tags {
+		c, given := plan.colors[name]
+		old, exists := current[name]
+		if exists && (!given || strategy != model.AddressBookImportOverwrite) {
+			c = old
+		}
+		plan.report.Tags[name] = c
+	}
+
+	//预览结果不返回密码和 hash
+	for i, row := range plan.report.Rows {
+		masked := *plan.peers[i]
+		masked.Password = ""
+		masked.Hash = ""
+		row.Peer = &masked
+	}
+	return plan, nil
+}
+
+// fillFromPeers 用设备信息补全空的主机名、平台和用户名
+func (s *AddressBookTransferService) fillFromPeers(plan *abImportPlan) {
+	ids := make([]string, 0)
+	for i, row := range plan.report.Rows {
+		p := plan.peers[i]
+		if row.Action == model.AddressBookImportActionInvalid || row.Action == model.AddressBookImportActionSkip {
+			continue
+		}
+		if p.Hostname == "" || p.Platform == "" || p.Username == "" {
+			ids = append(ids, p.Id)
+		}
+	}
+	devices := make(map[string]*model.Peer, len(ids))
+	for start := 0; start < len(ids); start += 500 {
+		var ps []*model.Peer
+		DB.Where("id in ?", ids[start:min(start+500, len(ids))]).Find(&ps)
+		for _, d := range ps {
+			devices[d.Id] = d
+		}
+	}
+	for i, row := range plan.report.Rows {
+		p := plan.peers[i]
+		d, ok := devices[p.Id]
+		if !ok || row.Action == model.AddressBookImportActionInvalid || row.Action == model.AddressBookImportActionSkip {
+			continue
+		}
+		if p.Hostname == "" && d.Hostname != "" {
+			p.Hostname = d.Hostname
+			row.Filled = append(row.Filled, "hostname")
+		}
+		if p.Platform == "" && d.Os != "" {
+			if platform := AllService.AddressBookService.PlatformFromOs(d.Os); platform != "" {
+				p.Platform = platform
+				row.Filled = append(row.Filled, "platform")
+			}
+		}
+		if p.Username == "" && d.Username != "" {
+			p.Username = d.Username
+			row.Filled = append(row.Filled, "username")
+		}
+	}
+}
+
+// abImportTable 解析后的文件内容
+type abImportTable struct {
+	columns []string
+	records []map[string]string
+	lines   []int
+	colors  map[string]uint // json 文件中标签表的颜色
+}
+
+// parseAbImport 解析导入文件; json 和 rustdesk 格式都接受条目数组、{"peers":[]} 或客户端 /api/ab 的 {"data":"..."}
+func parseAbImport(format, content string) (*abImportTable, error) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	switch format {
+	case model.AddressBookFormatCsv:
+		return parseAbImportCsv(content)
+	case model.AddressBookFormatJson, model.AddressBookFormatRustdesk:
+		return parseAbImportJson(content)
+	}
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+func parseAbImportCsv(content string) (*abImportTable, error) {
+	r := csv.NewReader(strings.NewReader(content))
+	r.FieldsPerRecord = -1
+	//表格软件在部分语言下导出的 csv 以分号或制表符分隔
+	header, _, _ := strings.Cut(content, "\n")
+	if !strings.Contains(header, ",") {
+		if strings.Contains(header, ";") {
+			r.Comma = ';'
+		} else if strings.Contains(header, "\t") {
+			r.Comma = '\t'
+		}
+	}
+	t := &abImportTable{colors: map[string]uint{}}
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if t.columns == nil {
+			for _, col := range rec {
+				t.columns = append(t.columns, strings.TrimSpace(col))
+			}
+			continue
+		}
+		line, _ := r.FieldPos(0)
+		m := make(map[string]string, len(t.columns))
+		empty := true
+		for i, v := range rec {
+			if i >= len(t.columns) {
+				break
+			}
+			v = strings.TrimSpace(v)
+			if v != "" {
+				empty = false
+			}
+			m[t.columns[i]] = v
+		}
+		if empty {
+			continue
+		}
+		t.records = append(t.records, m)
+		t.lines = append(t.lines, line)
+	}
+	if t.columns == nil {
+		return nil, errors.New("empty file")
+	}
+	return t, nil
+}
+
+func parseAbImportJson(content string) (*abImportTable, error) {
+	d := json.NewDecoder(strings.NewReader(content))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	var peers []any
+	t := &abImportTable{colors: map[string]uint{}}
+	switch root := v.(type) {
+	case []any:
+		peers = root
+	case map[string]any:
+		if data, ok := root["data"].(string); ok {
+			return parseAbImportJson(data)
+		}
+		peers, _ = root["peers"].([]any)
+		if err := parseAbImportTags(root["tags"], root["tag_colors"], t.colors); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("expect an array of peers or an object with peers")
+	}
+	keys := map[string]bool{}
+	for i, p := range peers {
+		obj, ok := p.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("peer %d is not an object", i+1)
+		}
+		m := make(map[string]string, len(obj))
+		for k, val := range obj {
+			m[k] = abImportValue(val)
+			if !keys[k] {
+				keys[k] = true
+				t.columns = append(t.columns, k)
+			}
+		}
+		t.records = append(t.records, m)
+		t.lines = append(t.lines, i+1)
+	}
+	sort.Strings(t.columns)
+	return t, nil
+}
+
+// parseAbImportTags 解析 json 中的标签表, tags 为名称数组或 {name, color} 数组, tag_colors 为对象或 json 字符串
+func parseAbImportTags(tags, tagColors any, colors map[string]uint) error {
+	if s, ok := tagColors.(string); ok && s != "" {
+		d := json.NewDecoder(strings.NewReader(s))
+		d.UseNumber()
+		if err := d.Decode(&tagColors); err != nil {
+			return fmt.Errorf("tag_colors: %w", err)
+		}
+	}
+	if m, ok := tagColors.(map[string]any); ok {
+		for name, c := range m {
+			color, err := parseAbTagColor(abImportValue(c))
+			if err != nil {
+				return fmt.Errorf("tag_colors %s: %w", name, err)
+			}
+			colors[name] = color
+		}
+	}
+	list, _ := tags.([]any)
+	for _, t := range list {
+		switch tv := t.(type) {
+		case string:
+			if _, ok := colors[tv]; !ok && tv != "" {
+				colors[tv] = 0
+			}
+		case map[string]any:
+			name := abImportValue(tv["name"])
+			if name == "" {
+				continue
+			}
+			color, err := parseAbTagColor(abImportValue(tv["color"]))
+			if err != nil {
+				return fmt.Errorf("tag %s: %w", name, err)
+			}
+			colors[name] = color
+		}
+	}
+	return nil
+}
+
+// abImportValue json 值转为与 csv 单元格相同的字符串形式
+func abImportValue(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(t)
+	case json.Number:
+		return t.String()
+	case bool:
+		return strconv.FormatBool(t)
+	case []any:
+		res := make([]string, 0, len(t))
+		for _, e := range t {
+			res = append(res, abImportValue(e))
+		}
+		return strings.Join(res, ";")
+	case map[string]any:
+		res := make([]string, 0, len(t))
+		for _, k := range sortedAnyKeys(t) {
+			res = append(res, k+"="+abImportValue(t[k]))
+		}
+		return strings.Join(res, ";")
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+func sortedAnyKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// normalizeAbImportColumn 列名比较时忽略大小写、空格、下划线和中划线
+func normalizeAbImportColumn(s string) string {
+	return strings.NewReplacer(" ", "", "_", "", "-", "").Replace(strings.ToLower(s))
+}
+
+// abImportMapping 按列名自动识别字段
+func abImportMapping(columns []string) map[string]string {
+	res := map[string]string{}
+	used := map[string]bool{}
+	for _, f := range abImportFields {
+		for _, name := range f.Names {
+			for _, col := range columns {
+				if !used[col] && normalizeAbImportColumn(col) == name {
+					res[f.Field] = col
+					used[col] = true
+					break
+				}
+			}
+			if res[f.Field] != "" {
+				break
+			}
+		}
+	}
+	return res
+}
+
+// checkAbImportMapping 校验提交的映射, 值为空的字段忽略
+func checkAbImportMapping(mapping map[string]string, columns []string) error {
+	cols := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		cols[c] = true
+	}
+	for field, col := range mapping {
+		known := false
+		for _, f := range abImportFields {
+			if f.Field == field {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown field %q", field)
+		}
+		if col == "" {
+			delete(mapping, field)
+			continue
+		}
+		if !cols[col] {
+			return fmt.Errorf("column %q not found", col)
+		}
+	}
+	return nil
+}
+
+// abImportRecord 按映射把一条记录转为条目, 返回记录中指定的标签颜色
+func abImportRecord(rec map[string]string, mapping map[string]string) (*model.AddressBookSnapshot, map[string]uint, error) {
+	get := func(field string) string {
+		if col := mapping[field]; col != "" {
+			return rec[col]
+		}
+		return ""
+	}
+	p := &model.AddressBookSnapshot{
+		Id:          get("id"),
+		Alias:       get("alias"),
+		Hostname:    get("hostname"),
+		Username:    get("username"),
+		Platform:    get("platform"),
+		Tags:        []string{},
+		Password:    get("password"),
+		Hash:        get("hash"),
+		RdpPort:     get("rdp_port"),
+		RdpUsername: get("rdp_username"),
+		LoginName:   get("login_name"),
+	}
+	seen := map[string]bool{}
+	for _, t := range strings.Split(get("tags"), ";") {
+		t = strings.TrimSpace(t)
+		if t != "" && !seen[t] {
+			seen[t] = true
+			p.Tags = append(p.Tags, t)
+		}
+	}
+	if p.Id == "" {
+		return p, nil, errors.New("id is required")
+	}
+	if strings.ContainsAny(p.Id, " \t\r\n") {
+		return p, nil, fmt.Errorf("invalid id %q", p.Id)
+	}
+	if v := get("force_always_relay"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return p, nil, fmt.Errorf("invalid force_always_relay %q", v)
+		}
+		p.ForceAlwaysRelay = b
+	}
+	if p.RdpPort != "" {
+		if port, err := strconv.Atoi(p.RdpPort); err != nil || port < 1 || port > 65535 {
+			return p, nil, fmt.Errorf("invalid rdp_port %q", p.RdpPort)
+		}
+	}
+	colors := map[string]uint{}
+	for _, kv := range strings.Split(get("tag_colors"), ";") {
+		if strings.TrimSpace(kv) == "" {
+			continue
+		}
+		name, c, ok := strings.Cut(kv, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return p, nil, fmt.Errorf("invalid tag_colors %q", kv)
+		}
+		color, err := parseAbTagColor(strings.TrimSpace(c))
+		if err != nil {
+			return p, nil, fmt.Errorf("tag_colors %s: %w", name, err)
+		}
+		colors[name] = color
+	}
+	return p, colors, nil
+}
+
+// parseAbTagColor 标签颜色, 支持客户端使用的十进制 ARGB 值以及 #RRGGBB、#AARRGGBB
+func parseAbTagColor(s string) (uint, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if strings.HasPrefix(s, "#") {
+		hex := s[1:]
+		v, err := strconv.ParseUint(hex, 16, 32)
+		if err != nil || (len(hex) != 6 && len(hex) != 8) {
+			return 0, fmt.Errorf("invalid color %q", s)
+		}
+		if len(hex) == 6 {
+			v |= 0xff000000
+		}
+		return uint(v), nil
+	}
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid color %q", s)
+	}
+	return uint(v), nil
+}
+
+// formatAbTagColor 标签颜色转为 #AARRGGBB
+func formatAbTagColor(c uint) string {
+	return fmt.Sprintf("#%08x", c)
+}
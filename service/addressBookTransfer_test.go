@@ -0,0 +1,115 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+func abTransferPeers() []*model.AddressBookSnapshot {
+	return []*model.AddressBookSnapshot{
+		{Id: "123456789", Alias: "office, 1F", Hostname: "pc-1", Platform: "Windows", Tags: []string{"office", "prod"}, Hash: "h", ForceAlwaysRelay: true, RdpPort: "3389"},
+		{Id: "abc", Alias: "home", Tags: []string{}},
+	}
+}
+
+// importAbExport 导出后按自动识别的映射重新解析
+func importAbExport(t *testing.T, format string, b []byte) ([]*model.AddressBookSnapshot, map[string]uint) {
+	table, err := parseAbImport(format, string(b))
+	if err != nil {
+		t.Fatalf("%s parse: %v", format, err)
+	}
+	mapping := abImportMapping(table.columns)
+	peers := make([]*model.AddressBookSnapshot, 0, len(table.records))
+	for _, rec := range table.records {
+		p, colors, err := abImportRecord(rec, mapping)
+		if err != nil {
+			t.Fatalf("%s record %v: %v", format, rec, err)
+		}
+		for name, c := range colors {
+			table.colors[name] = c
+		}
+		peers = append(peers, p)
+	}
+	return peers, table.colors
+}
+
+func TestAddressBookExportRoundTrip(t *testing.T) {
+	colors := map[string]uint{"office": 4288585374, "prod": 0xff00ff00, "unused": 1}
+	for _, format := range []string{model.AddressBookFormatCsv, model.AddressBookFormatJson, model.AddressBookFormatRustdesk} {
+		b, err := exportAddressBook(format, abTransferPeers(), []string{"office", "prod", "unused"}, colors, false)
+		if err != nil {
+			t.Fatalf("%s export: %v", format, err)
+		}
+		peers, gotColors := importAbExport(t, format, b)
+		want := abTransferPeers()
+		want[0].Hash = ""
+		if !reflect.DeepEqual(peers, want) {
+			t.Fatalf("%s peers %+v %+v", format, peers[0], peers[1])
+		}
+		wantColors := colors
+		if format == model.AddressBookFormatCsv {
+			// csv 只保留条目用到的标签
+			wantColors = map[string]uint{"office": 4288585374, "prod": 0xff00ff00}
+		}
+		if !reflect.DeepEqual(gotColors, wantColors) {
+			t.Fatalf("%s colors %v", format, gotColors)
+		}
+	}
+}
+
+func TestParseAbImportClientData(t *testing.T) {
+	// 客户端 /api/ab 的响应, tags 为名称数组, tag_colors 为 json 字符串
+	content := `{"data":"{\"tags\":[\"a\",\"b\"],\"peers\":[{\"id\":\"1\",\"tags\":[\"a\"],\"forceAlwaysRelay\":false,\"rdpPort\":\"\"}],\"tag_colors\":\"{\\\"a\\\":4278238420}\"}"}`
+	table, err := parseAbImport(model.AddressBookFormatRustdesk, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(table.colors, map[string]uint{"a": 4278238420, "b": 0}) {
+		t.Fatalf("colors %v", table.colors)
+	}
+	mapping := abImportMapping(table.columns)
+	if mapping["force_always_relay"] != "forceAlwaysRelay" || mapping["rdp_port"] != "rdpPort" {
+		t.Fatalf("mapping %v", mapping)
+	}
+}
+
+func TestAbImportMappingAndValidation(t *testing.T) {
+	table, err := parseAbImport(model.AddressBookFormatCsv, "\ufeffPeer ID;Name;Tag;Force-Always-Relay\n1;a;x;yes\n\n2;b;x; \n;c;;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapping := abImportMapping(table.columns)
+	want := map[string]string{"id": "Peer ID", "alias": "Name", "tags": "Tag", "force_always_relay": "Force-Always-Relay"}
+	if !reflect.DeepEqual(mapping, want) {
+		t.Fatalf("mapping %v", mapping)
+	}
+	if !reflect.DeepEqual(table.lines, []int{2, 4, 5}) {
+		t.Fatalf("lines %v", table.lines)
+	}
+	if _, _, err := abImportRecord(table.records[0], mapping); err == nil {
+		t.Fatal("expect invalid force_always_relay")
+	}
+	if p, _, err := abImportRecord(table.records[1], mapping); err != nil || p.Alias != "b" || p.Tags[0] != "x" {
+		t.Fatalf("record %v %v", p, err)
+	}
+	if _, _, err := abImportRecord(table.records[2], mapping); err == nil {
+		t.Fatal("expect id required")
+	}
+	if err := checkAbImportMapping(map[string]string{"id": "missing"}, table.columns); err == nil {
+		t.Fatal("expect column not found")
+	}
+}
+
+func TestParseAbTagColor(t *testing.T) {
+	for s, want := range map[string]uint{"#2196f3": 0xff2196f3, "#802196f3": 0x802196f3, "4288585374": 4288585374, "": 0} {
+		got, err := parseAbTagColor(s)
+		if err != nil || got != want {
+			t.Fatalf("%q => %d %v", s, got, err)
+		}
+	}
+	if _, err := parseAbTagColor("#12345"); err == nil {
+		t.Fatal("expect invalid color")
+	}
+}
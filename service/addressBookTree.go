@@ -0,0 +1,255 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAbCollectionParent      = errors.New("AddressBookCollectionParentInvalid")
+	ErrAbCollectionHasChildren = errors.New("AddressBookCollectionHasChildren")
+)
+
+// CollectionsByUserId 用户的全部地址簿
+func (s *AddressBookService) CollectionsByUserId(userId uint) (res []*model.AddressBookCollection) {
+	DB.Where("user_id = ?", userId).Order("id asc").Find(&res)
+	return
+}
+
+// CollectionTree 用户的地址簿树, 上级不存在的地址簿作为顶层
+func (s *AddressBookService) CollectionTree(userId uint) []*model.AddressBookCollectionNode {
+	var counts []struct {
+		CollectionId uint
+		Cnt          int64
+	}
+	DB.Model(&model.AddressBook{}).Select("collection_id, count(*) as cnt").
+		Where("user_id = ?", userId).Group("collection_id").Scan(&counts)
+	cm := make(map[uint]int64, len(counts))
+	for _, c := range counts {
+		cm[c.CollectionId] = c.Cnt
+	}
+	return buildCollectionTree(s.CollectionsByUserId(userId), cm)
+}
+
+// CollectionPaths 用户各地址簿从顶层开始的组合名称
+func (s *AddressBookService) CollectionPaths(userId uint) map[uint]string {
+	return collectionPaths(s.CollectionsByUserId(userId))
+}
+
+// collectionChainOf cid 及其所有上级的 id
+func (s *AddressBookService) collectionChainOf(uid, cid uint) []uint {
+	if cid == 0 {
+		return []uint{0}
+	}
+	chain := collectionChain(collectionParents(s.CollectionsByUserId(uid)), cid)
+	if len(chain) == 0 {
+		return []uint{cid}
+	}
+	return chain
+}
+
+// SharedCollectionRules 共享给用户的地址簿及权限, 包含通过上级继承的地址簿
+func (s *AddressBookService) SharedCollectionRules(user *model.User) map[uint]int {
+	rules := s.CollectionReadRules(user)
+	if len(rules) == 0 {
+		return map[uint]int{}
+	}
+	direct := make(map[uint]int)
+	owners := make(map[uint]struct{})
+	for _, r := range rules {
+		if r.Rule > direct[r.CollectionId] {
+			direct[r.CollectionId] = r.Rule
+		}
+		owners[r.UserId] = struct{}{}
+	}
+	ownerIds := make([]uint, 0, len(owners))
+	for id := range owners {
+		ownerIds = append(ownerIds, id)
+	}
+	var cs []*model.AddressBookCollection
+	DB.Where("user_id in ?", ownerIds).Find(&cs)
+	return inheritCollectionRules(collectionParents(cs), direct)
+}
+
+// CheckCollectionParent 检查上级是否为同一用户的地址簿, 且不会形成环或超过最大层数
+func (s *AddressBookService) CheckCollectionParent(t *model.AddressBookCollection, parentId uint) error {
+	if parentId == 0 {
+		return nil
+	}
+	return checkCollectionParent(s.CollectionsByUserId(t.UserId), t.Id, parentId)
+}
+
+// MoveCollection 修改上级地址簿, parentId 为 0 时移到顶层
+func (s *AddressBookService) MoveCollection(t *model.AddressBookCollection, parentId uint, actor *AddressBookActor) error {
+	if t.ParentId == parentId {
+		return nil
+	}
+	if err := s.CheckCollectionParent(t, parentId); err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		before := *t
+		if err := tx.Model(t).Update("parent_id", parentId).Error; err != nil {
+			return err
+		}
+		t.ParentId = parentId
+		return AllService.AddressBookChangeService.RecordCollection(tx, actor, &before, t)
+	})
+}
+
+func collectionParents(cs []*model.AddressBookCollection) map[uint]uint {
+	parents := make(map[uint]uint, len(cs))
+	for _, c := range cs {
+		parents[c.Id] = c.ParentId
+	}
+	return parents
+}
+
+// collectionChain 从 cid 到顶层的地址簿 id, 包含 cid; 上级不存在或有环时停止
+func collectionChain(parents map[uint]uint, cid uint) []uint {
+	var chain []uint
+	seen := make(map[uint]bool)
+	for id := cid; id != 0 && !seen[id]; id = parents[id] {
+		if _, ok := parents[id]; !ok {
+			break
+		}
+		seen[id] = true
+		chain = append(chain, id)
+	}
+	return chain
+}
+
+func collectionChildren(cs []*model.AddressBookCollection) map[uint][]uint {
+	children := make(map[uint][]uint)
+	for _, c := range cs {
+		children[c.ParentId] = append(children[c.ParentId], c.Id)
+	}
+	return children
+}
+
+// collectionDescendants 所有下级, 按层级从上到下
+func collectionDescendants(cs []*model.AddressBookCollection, id uint) []uint {
+	children := collectionChildren(cs)
+	var res []uint
+	seen := map[uint]bool{id: true}
+	queue := []uint{id}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, c := range children[cur] {
+			if seen[c] {
+				continue
+			}
+			seen[c] = true
+			res = append(res, c)
+			queue = append(queue, c)
+		}
+	}
+	return res
+}
+
+// collectionHeight 以 id 为根的子树层数, id 为 0 表示新建的地址簿
+func collectionHeight(children map[uint][]uint, id uint, seen map[uint]bool) int {
+	if id == 0 || seen[id] {
+		return 1
+	}
+	seen[id] = true
+	h := 0
+	for _, c := range children[id] {
+		h = max(h, collectionHeight(children, c, seen))
+	}
+	return h + 1
+}
+
+func checkCollectionParent(cs []*model.AddressBookCollection, id, parentId uint) error {
+	if parentId == 0 {
+		return nil
+	}
+	parents := collectionParents(cs)
+	if _, ok := parents[parentId]; !ok || parentId == id {
+		return ErrAbCollectionParent
+	}
+	chain := collectionChain(parents, parentId)
+	for _, c := range chain {
+		if c == id {
+			return ErrAbCollectionParent
+		}
+	}
+	if len(chain)+collectionHeight(collectionChildren(cs), id, map[uint]bool{}) > model.AddressBookCollectionMaxDepth {
+		return ErrAbCollectionParent
+	}
+	return nil
+}
+
+func collectionPaths(cs []*model.AddressBookCollection) map[uint]string {
+	parents := collectionParents(cs)
+	names := make(map[uint]string, len(cs))
+	for _, c := range cs {
+		names[c.Id] = c.Name
+	}
+	paths := make(map[uint]string, len(cs))
+	for _, c := range cs {
+		chain := collectionChain(parents, c.Id)
+		parts := make([]string, len(chain))
+		for i, id := range chain {
+			parts[len(chain)-1-i] = names[id]
+		}
+		paths[c.Id] = strings.Join(parts, model.AddressBookCollectionPathSep)
+	}
+	return paths
+}
+
+// inheritCollectionRules 下级地址簿继承上级的权限, 取链上的最大值
+func inheritCollectionRules(parents map[uint]uint, direct map[uint]int) map[uint]int {
+	res := make(map[uint]int)
+	for id := range parents {
+		r := 0
+		for _, c := range collectionChain(parents, id) {
+			r = max(r, direct[c])
+		}
+		if r > 0 {
+			res[id] = r
+		}
+	}
+	return res
+}
+
+func buildCollectionTree(cs []*model.AddressBookCollection, counts map[uint]int64) []*model.AddressBookCollectionNode {
+	paths := collectionPaths(cs)
+	parents := collectionParents(cs)
+	nodes := make(map[uint]*model.AddressBookCollectionNode, len(cs))
+	for _, c := range cs {
+		nodes[c.Id] = &model.AddressBookCollectionNode{AddressBookCollection: c, Path: paths[c.Id], PeerCount: counts[c.Id], Children: []*model.AddressBookCollectionNode{}}
+	}
+	roots := make([]*model.AddressBookCollectionNode, 0)
+	for _, c := range cs {
+		n := nodes[c.Id]
+		// 上级不存在的地址簿作为顶层, 异常数据中处在环上的地址簿及其下级也作为顶层
+		chain := collectionChain(parents, c.Id)
+		top := parents[chain[len(chain)-1]]
+		_, topHasParent := parents[top]
+		if p, ok := nodes[c.ParentId]; ok && (top == 0 || !topHasParent) {
+			p.Children = append(p.Children, n)
+			continue
+		}
+		roots = append(roots, n)
+	}
+	sortCollectionNodes(roots)
+	return roots
+}
+
+func sortCollectionNodes(nodes []*model.AddressBookCollectionNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Name != nodes[j].Name {
+			return nodes[i].Name < nodes[j].Name
+		}
+		return nodes[i].Id < nodes[j].Id
+	})
+	for _, n := range nodes {
+		sortCollectionNodes(n.Children)
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+func abTreeCollections() []*model.AddressBookCollection {
+	cs := []*model.AddressBookCollection{
+		{Name: "Site", ParentId: 0},
+		{Name: "Building B", ParentId: 1},
+		{Name: "Building A", ParentId: 1},
+		{Name: "Floor 1", ParentId: 3},
+		{Name: "Orphan", ParentId: 99},
+	}
+	for i, c := range cs {
+		c.Id = uint(i + 1)
+	}
+	return cs
+}
+
+func TestCollectionPathsAndTree(t *testing.T) {
+	cs := abTreeCollections()
+	paths := collectionPaths(cs)
+	if paths[4] != "Site / Building A / Floor 1" || paths[5] != "Orphan" {
+		t.Fatalf("paths %v", paths)
+	}
+	roots := buildCollectionTree(cs, map[uint]int64{4: 2})
+	if len(roots) != 2 || roots[0].Name != "Orphan" || roots[1].Name != "Site" {
+		t.Fatalf("roots %v", roots)
+	}
+	site := roots[1]
+	if len(site.Children) != 2 || site.Children[0].Name != "Building A" || site.Children[0].Children[0].PeerCount != 2 {
+		t.Fatalf("site %+v", site.Children)
+	}
+	if got := collectionDescendants(cs, 1); !reflect.DeepEqual(got, []uint{2, 3, 4}) {
+		t.Fatalf("descendants %v", got)
+	}
+}
+
+func TestCheckCollectionParent(t *testing.T) {
+	cs := abTreeCollections()
+	if err := checkCollectionParent(cs, 2, 4); err != nil {
+		t.Fatal(err)
+	}
+	// 移到自己的下级会形成环
+	if err := checkCollectionParent(cs, 1, 4); err != ErrAbCollectionParent {
+		t.Fatal("expect cycle")
+	}
+	if err := checkCollectionParent(cs, 2, 2); err != ErrAbCollectionParent {
+		t.Fatal("expect self")
+	}
+	if err := checkCollectionParent(cs, 0, 99); err != ErrAbCollectionParent {
+		t.Fatal("expect parent not found")
+	}
+	deep := make([]*model.AddressBookCollection, model.AddressBookCollectionMaxDepth)
+	for i := range deep {
+		deep[i] = &model.AddressBookCollection{ParentId: uint(i)}
+		deep[i].Id = uint(i + 1)
+	}
+	if err := checkCollectionParent(deep, 0, uint(model.AddressBookCollectionMaxDepth)); err != ErrAbCollectionParent {
+		t.Fatal("expect max depth")
+	}
+	if err := checkCollectionParent(deep, 0, uint(model.AddressBookCollectionMaxDepth-1)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInheritCollectionRules(t *testing.T) {
+	parents := collectionParents(abTreeCollections())
+	got := inheritCollectionRules(parents, map[uint]int{1: model.ShareAddressBookRuleRuleRead, 3: model.ShareAddressBookRuleRuleFullControl})
+	want := map[uint]int{
+		1: model.ShareAddressBookRuleRuleRead,
+		2: model.ShareAddressBookRuleRuleRead,
+		3: model.ShareAddressBookRuleRuleFullControl,
+		4: model.ShareAddressBookRuleRuleFullControl,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("rules %v", got)
+	}
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/utils"
+)
+
+type ClientVersionService struct {
+}
+
+var ErrInvalidClientVersion = errors.New("InvalidClientVersion")
+
+// CheckPolicy 校验设备组的版本策略, 版本号须可比较且最低版本不高于推荐版本
+func (cs *ClientVersionService) CheckPolicy(g *model.DeviceGroup) error {
+	if g.MinVersion != "" && !utils.IsVersion(g.MinVersion) {
+		return ErrInvalidClientVersion
+	}
+	if g.RecommendedVersion != "" && !utils.IsVersion(g.RecommendedVersion) {
+		return ErrInvalidClientVersion
+	}
+	if g.MinVersion != "" && g.RecommendedVersion != "" && utils.CompareVersion(g.MinVersion, g.RecommendedVersion) > 0 {
+		return ErrInvalidClientVersion
+	}
+	return nil
+}
+
+// Evaluate 按设备组的版本策略判断客户端版本的合规状态
+func (cs *ClientVersionService) Evaluate(version string, g *model.DeviceGroup) string {
+	if g == nil || (g.MinVersion == "" && g.RecommendedVersion == "") || !utils.IsVersion(version) {
+		return model.ClientVersionUnknown
+	}
+	if g.MinVersion != "" && utils.CompareVersion(version, g.MinVersion) < 0 {
+		return model.ClientVersionNonCompliant
+	}
+	if g.RecommendedVersion != "" && utils.CompareVersion(version, g.RecommendedVersion) < 0 {
+		return model.ClientVersionOutdated
+	}
+	return model.ClientVersionCompliant
+}
+
+// Compliance 设备的合规情况, g 为空时按设备所在组查询
+func (cs *ClientVersionService) Compliance(peer *model.Peer, g *model.DeviceGroup) *model.PeerCompliance {
+	if g == nil && peer.GroupId > 0 {
+		g = AllService.GroupService.DeviceGroupInfoById(peer.GroupId)
+	}
+	pc := &model.PeerCompliance{
+		RowId:          peer.RowId,
+		Id:             peer.Id,
+		Hostname:       peer.Hostname,
+		Version:        peer.Version,
+		DeviceGroupId:  peer.GroupId,
+		LastOnlineTime: peer.LastOnlineTime,
+		Status:         cs.Evaluate(peer.Version, g),
+	}
+	if g != nil && g.Id > 0 {
+		pc.DeviceGroupName = g.Name
+		pc.MinVersion = g.MinVersion
+		pc.RecommendedVersion = g.RecommendedVersion
+		pc.Enforced = g.EnforceVersion
+	}
+	return pc
+}
+
+// Report 合规报告, status 为空时只列出 outdated 和 noncompliant 的设备
+// 版本比较无法在 SQL 中完成, 先取出配置了策略的设备组下的设备再分页
+func (cs *ClientVersionService) Report(deviceGroupId uint, status string, page, pageSize uint) *model.PeerComplianceReport {
+	res := &model.PeerComplianceReport{
+		PeerCompliances: []*model.PeerCompliance{},
+		Summary:         map[string]int64{},
+	}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+
+	groups := cs.policyGroups(deviceGroupId)
+	if len(groups) == 0 {
+		return res
+	}
+	ids := make([]uint, 0, len(groups))
+	for id := range groups {
+		ids = append(ids, id)
+	}
+	var peers []*model.Peer
+	DB.Where("group_id in ?", ids).Order("row_id asc").Find(&peers)
+
+	var matched []*model.PeerCompliance
+	for _, p := range peers {
+		pc := cs.Compliance(p, groups[p.GroupId])
+		res.Summary[pc.Status]++
+		if status == "" {
+			if pc.Status != model.ClientVersionOutdated && pc.Status != model.ClientVersionNonCompliant {
+				continue
+			}
+		} else if pc.Status != status {
+			continue
+		}
+		matched = append(matched, pc)
+	}
+	res.Total = int64(len(matched))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	start := int((page - 1) * pageSize)
+	if start < len(matched) {
+		end := min(start+int(pageSize), len(matched))
+		res.PeerCompliances = matched[start:end]
+	}
+	return res
+}
+
+// RecommendedVersion 给设备推荐的版本, 设备组未配置时取所有设备组中最高的推荐版本
+func (cs *ClientVersionService) RecommendedVersion(peer *model.Peer) string {
+	if peer != nil && peer.GroupId > 0 {
+		if g := AllService.GroupService.DeviceGroupInfoById(peer.GroupId); g.RecommendedVersion != "" {
+			return g.RecommendedVersion
+		}
+	}
+	var versions []string
+	DB.Model(&model.DeviceGroup{}).Where("recommended_version <> ''").Pluck("recommended_version", &versions)
+	latest := ""
+	for _, v := range versions {
+		if latest == "" || utils.CompareVersion(v, latest) > 0 {
+			latest = v
+		}
+	}
+	return latest
+}
+
+// FindPeer 按 id 或 uuid 查找设备, 优先 uuid
+func (cs *ClientVersionService) FindPeer(id, uuid string) *model.Peer {
+	if uuid != "" {
+		if p := AllService.PeerService.FindByUuid(uuid); p.RowId > 0 {
+			return p
+		}
+	}
+	if id != "" {
+		return AllService.PeerService.Resolve(id)
+	}
+	return &model.Peer{}
+}
+
+// EnforcedCompliance 设备所在组启用了强制且版本低于最低版本时返回合规情况, 否则返回 nil
+func (cs *ClientVersionService) EnforcedCompliance(peer *model.Peer) *model.PeerCompliance {
+	if peer == nil || peer.RowId == 0 || peer.GroupId == 0 {
+		return nil
+	}
+	pc := cs.Compliance(peer, nil)
+	if !pc.Enforced || pc.Status != model.ClientVersionNonCompliant {
+		return nil
+	}
+	return pc
+}
+
+// MarkAddressBooks 为地址簿中启用强制的设备组下低于最低版本的设备填充 ClientCompliance
+func (cs *ClientVersionService) MarkAddressBooks(abs []*model.AddressBook) {
+	if len(abs) == 0 {
+		return
+	}
+	groups := map[uint]*model.DeviceGroup{}
+	var enforced []*model.DeviceGroup
+	DB.Where("enforce_version = ?", true).Find(&enforced)
+	if len(enforced) == 0 {
+		return
+	}
+	gids := make([]uint, 0, len(enforced))
+	for _, g := range enforced {
+		groups[g.Id] = g
+		gids = append(gids, g.Id)
+	}
+	ids := make([]string, 0, len(abs))
+	for _, ab := range abs {
+		ids = append(ids, ab.Id)
+	}
+	var peers []*model.Peer
+	DB.Where("id in ? and group_id in ?", ids, gids).Find(&peers)
+	status := map[string]string{}
+	for _, p := range peers {
+		if s := cs.Evaluate(p.Version, groups[p.GroupId]); s == model.ClientVersionNonCompliant {
+			status[p.Id] = s
+		}
+	}
+	for _, ab := range abs {
+		ab.ClientCompliance = status[ab.Id]
+	}
+}
+
+// policyGroups 配置了版本策略的设备组
+func (cs *ClientVersionService) policyGroups(deviceGroupId uint) map[uint]*model.DeviceGroup {
+	var list []*model.DeviceGroup
+	tx := DB.Where("min_version <> '' or recommended_version <> ''")
+	if deviceGroupId > 0 {
+		tx = tx.Where("id = ?", deviceGroupId)
+	}
+	tx.Find(&list)
+	groups := make(map[uint]*model.DeviceGroup, len(list))
+	for _, g := range list {
+		groups[g.Id] = g
+	}
+	return groups
+}
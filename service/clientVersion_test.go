@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+func TestClientVersionEvaluate(t *testing.T) {
+	cs := &ClientVersionService{}
+	g := &model.DeviceGroup{MinVersion: "1.2.0", RecommendedVersion: "1.3.0"}
+	cases := map[string]string{
+		"1.1.9":      model.ClientVersionNonCompliant,
+		"1.2.0":      model.ClientVersionOutdated,
+		"1.3.0-beta": model.ClientVersionOutdated,
+		"1.3.0":      model.ClientVersionCompliant,
+		"1.4.1":      model.ClientVersionCompliant,
+		"":           model.ClientVersionUnknown,
+	}
+	for v, want := range cases {
+		if got := cs.Evaluate(v, g); got != want {
+			t.Errorf("Evaluate(%q) = %s, want %s", v, got, want)
+		}
+	}
+	if got := cs.Evaluate("1.0.0", &model.DeviceGroup{}); got != model.ClientVersionUnknown {
+		t.Errorf("group without policy should be unknown, got %s", got)
+	}
+}
+
+func TestClientVersionCheckPolicy(t *testing.T) {
+	cs := &ClientVersionService{}
+	if err := cs.CheckPolicy(&model.DeviceGroup{MinVersion: "1.2.0", RecommendedVersion: "1.3.0"}); err != nil {
+		t.Fatalf("valid policy rejected: %v", err)
+	}
+	if err := cs.CheckPolicy(&model.DeviceGroup{MinVersion: "1.4.0", RecommendedVersion: "1.3.0"}); err == nil {
+		t.Fatal("min above recommended accepted")
+	}
+	if err := cs.CheckPolicy(&model.DeviceGroup{RecommendedVersion: "latest"}); err == nil {
+		t.Fatal("invalid version accepted")
+	}
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/lib/pdf"
+	"github.com/lejianwen/rustdesk-api/v2/lib/qrcode"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+// 二维码内容
+const (
+	ConfigCodeQrConfig = "config" // RustDesk 移动端扫码直接导入服务器配置
+	ConfigCodeQrCode   = "code"   // 配置码本身, 由客户端走兑换接口
+	ConfigCodeQrLink   = "link"   // rustdesk:// 深度链接
+)
+
+// 单次打印的最大配置码数量
+const configCodeSheetMax = 500
+
+// ConfigCodeLink 配置码的导入字符串和深度链接, 使用固定的修订生成
+// embed 为 false 时只返回配置码, 导入字符串直接携带服务器密钥, 需要显式要求
+func (s *ServerConfigService) ConfigCodeLink(id uint, embed bool) (*model.ConfigCodeLink, error) {
+	cc, err := s.configCodeWithServer(id)
+	if err != nil {
+		return nil, err
+	}
+	if !embed {
+		return &model.ConfigCodeLink{Code: cc.Code, SignedCode: cc.SignedCode}, nil
+	}
+	return s.link(cc), nil
+}
+
+// ConfigCodeQr 渲染配置码二维码, format 为 png 或 svg, 返回内容和 Content-Type
+func (s *ServerConfigService) ConfigCodeQr(id uint, content, format string, scale int) ([]byte, string, error) {
+	cc, err := s.configCodeWithServer(id)
+	if err != nil {
+		return nil, "", err
+	}
+	text, err := s.qrContent(cc, content)
+	if err != nil {
+		return nil, "", err
+	}
+	qr, err := qrcode.Encode([]byte(text), qrcode.M)
+	if err != nil {
+		return nil, "", err
+	}
+	if scale <= 0 {
+		scale = 8
+	}
+	if format == "svg" {
+		return qr.SVG(scale, 4), "image/svg+xml", nil
+	}
+	b, err := qr.PNG(scale, 4)
+	return b, "image/png", err
+}
+
+// ConfigCodeSheet 生成可打印的 A4 PDF, 每页 3x4 个配置码
+func (s *ServerConfigService) ConfigCodeSheet(ids []uint, content string) ([]byte, error) {
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no config code selected")
+	}
+	if len(ids) > configCodeSheetMax {
+		return nil, fmt.Errorf("at most %d config codes per sheet", configCodeSheetMax)
+	}
+	var codes []*model.ConfigCode
+	global.DB.Preload("ServerConfig").Where("id in ?", ids).Order("id asc").Find(&codes)
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("config code not found")
+	}
+
+	const (
+		cols, rows = 3, 4
+		margin     = 36.0
+		qrSize     = 130.0
+	)
+	cellW := (pdf.A4Width - margin*2) / cols
+	cellH := (pdf.A4Height - margin*2) / rows
+	doc := pdf.New(pdf.A4Width, pdf.A4Height)
+	var page *pdf.Page
+	for i, cc := range codes {
+		if cc.ServerConfig == nil {
+			return nil, fmt.Errorf("server config of code %s not found", cc.Code)
+		}
+		if err := s.checkIssuable(cc); err != nil {
+			return nil, fmt.Errorf("%s: %v", cc.Code, err)
+		}
+		pinned, err := s.pinConfig(cc.ServerConfig, cc.RevisionId)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", cc.Code, err)
+		}
+		cc.ServerConfig = pinned
+		text, err := s.qrContent(cc, content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", cc.Code, err)
+		}
+		qr, err := qrcode.Encode([]byte(text), qrcode.M)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", cc.Code, err)
+		}
+
+		n := i % (cols * rows)
+		if n == 0 {
+			page = doc.AddPage()
+		}
+		x := margin + float64(n%cols)*cellW
+		y := margin + float64(n/cols)*cellH
+		qx := x + (cellW-qrSize)/2
+		module := qrSize / float64(qr.Size)
+		for my := 0; my < qr.Size; my++ {
+			for mx := 0; mx < qr.Size; mx++ {
+				if qr.Get(mx, my) {
+					page.Rect(qx+float64(mx)*module, y+float64(my)*module, module, module)
+				}
+			}
+		}
+		ty := y + qrSize + 14
+		page.Text(qx, ty, 11, cc.Code)
+		page.Text(qx, ty+12, 8, cc.ServerConfig.Name)
+		expires := "no expiry"
+		if cc.ExpiresAt != nil {
+			expires = "expires " + cc.ExpiresAt.Format(time.DateTime)
+		}
+		page.Text(qx, ty+22, 8, expires)
+	}
+	return doc.Bytes(), nil
+}
+
+func (s *ServerConfigService) configCodeWithServer(id uint) (*model.ConfigCode, error) {
+	cc := &model.ConfigCode{}
+	global.DB.Preload("ServerConfig").Where("id = ?", id).First(cc)
+	if cc.Id == 0 || cc.ServerConfig == nil {
+		return nil, fmt.Errorf("config code not found")
+	}
+	if err := s.checkIssuable(cc); err != nil {
+		return nil, err
+	}
+	pinned, err := s.pinConfig(cc.ServerConfig, cc.RevisionId)
+	if err != nil {
+		return nil, err
+	}
+	cc.ServerConfig = pinned
+	return cc, nil
+}
+
+// checkIssuable 二维码、打印和导入字符串不经过兑换, 不能发放已撤销、停用、过期或次数用尽的配置码
+func (s *ServerConfigService) checkIssuable(cc *model.ConfigCode) error {
+	if err := s.checkValid(cc); err != nil {
+		return err
+	}
+	if cc.MaxUsage != nil && cc.UsageCount >= *cc.MaxUsage {
+		return fmt.Errorf("config code usage limit exceeded")
+	}
+	return nil
+}
+
+func (s *ServerConfigService) link(cc *model.ConfigCode) *model.ConfigCodeLink {
+	l := &model.ConfigCodeLink{
+		Code:       cc.Code,
+		SignedCode: cc.SignedCode,
+	}
+	if !s.isRestricted(cc) {
+		l.ImportString = cc.ServerConfig.ToClientConfig().RustdeskImportString()
+		l.ScanContent = "config=" + l.ImportString
+		l.DeepLink = "rustdesk://config/" + l.ImportString
+		l.Command = "rustdesk --config " + l.ImportString
+	}
+	return l
+}
+
+// qrContent 二维码内容, 默认为配置码, 携带服务器配置的内容需要显式指定
+func (s *ServerConfigService) qrContent(cc *model.ConfigCode, content string) (string, error) {
+	if content == "" || content == ConfigCodeQrCode {
+		if cc.SignedCode != "" {
+			return cc.SignedCode, nil
+		}
+		return cc.Code, nil
+	}
+	l := s.link(cc)
+	if l.ImportString == "" {
+		return "", fmt.Errorf("config code is bound to devices, users or networks, only content=code is allowed")
+	}
+	if content == ConfigCodeQrLink {
+		return l.DeepLink, nil
+	}
+	return l.ScanContent, nil
+}
+
+// isRestricted 导入字符串直接携带服务器配置, 不经过兑换校验, 有绑定限制的配置码不提供
+func (s *ServerConfigService) isRestricted(cc *model.ConfigCode) bool {
+	b := cc.ConfigCodeBinding
+	return b.BindDevice || len(b.AllowedUserIds) > 0 || len(b.AllowedGroupIds) > 0 || len(b.AllowedCidrs) > 0
+}
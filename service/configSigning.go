@@ -0,0 +1,149 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/lib/configcode"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+// ConfigSigningService 配置码 Ed25519 签名密钥管理
+type ConfigSigningService struct {
+}
+
+// configSigningMu 防止并发时生成多把当前密钥
+var configSigningMu sync.Mutex
+
+// Keys 全部未清理的密钥, 当前密钥在前
+func (s *ConfigSigningService) Keys() []*model.ConfigSigningKey {
+	var keys []*model.ConfigSigningKey
+	global.DB.Order("active desc, id desc").Find(&keys)
+	return keys
+}
+
+// PublicKeys 公开的验签公钥
+func (s *ConfigSigningService) PublicKeys() []configcode.PublicKey {
+	keys := s.Keys()
+	res := make([]configcode.PublicKey, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, configcode.PublicKey{
+			Kid:       k.Kid,
+			Alg:       configcode.Alg,
+			PublicKey: k.PublicKey,
+			Active:    k.Active,
+			RetiredAt: k.RetiredAt,
+		})
+	}
+	return res
+}
+
+// ActiveKey 当前签名密钥, 不存在时生成
+func (s *ConfigSigningService) ActiveKey() (*model.ConfigSigningKey, error) {
+	configSigningMu.Lock()
+	defer configSigningMu.Unlock()
+	k := &model.ConfigSigningKey{}
+	global.DB.Where("active = ?", true).Order("id desc").First(k)
+	if k.Id > 0 {
+		return k, nil
+	}
+	return s.generate()
+}
+
+// Rotate 生成新的签名密钥, 旧密钥只用于校验, 并清理已无有效配置码的旧密钥
+func (s *ConfigSigningService) Rotate() (*model.ConfigSigningKey, error) {
+	configSigningMu.Lock()
+	defer configSigningMu.Unlock()
+	global.DB.Model(&model.ConfigSigningKey{}).Where("active = ?", true).
+		Updates(map[string]interface{}{"active": false, "retired_at": time.Now().Unix()})
+	k, err := s.generate()
+	if err != nil {
+		return nil, err
+	}
+	s.purge()
+	return k, nil
+}
+
+// Sign 为配置码签名, 过期时间取配置码的过期时间
+// 签名只证明配置码由本服务签发, 不携带服务器配置, 配置通过兑换接口获取
+func (s *ConfigSigningService) Sign(cc *model.ConfigCode) error {
+	k, err := s.ActiveKey()
+	if err != nil {
+		return err
+	}
+	priv, err := base64.StdEncoding.DecodeString(k.PrivateKey)
+	if err != nil || len(priv) != ed25519.PrivateKeySize {
+		return errors.New("invalid signing key")
+	}
+	if cc.Audience == "" {
+		cc.Audience = global.Config.Rustdesk.ApiServer
+	}
+	claims := &configcode.Claims{
+		Kid:      k.Kid,
+		Jti:      cc.Code,
+		Audience: cc.Audience,
+		IssuedAt: time.Now().Unix(),
+	}
+	if cc.ExpiresAt != nil {
+		claims.Expires = cc.ExpiresAt.Unix()
+	}
+	signed, err := configcode.Sign(ed25519.PrivateKey(priv), claims)
+	if err != nil {
+		return err
+	}
+	cc.Kid = k.Kid
+	cc.SignedCode = signed
+	return nil
+}
+
+// Verify 使用当前保留的公钥校验签名配置码
+func (s *ConfigSigningService) Verify(code string, audience string) (*configcode.Claims, error) {
+	v, err := configcode.NewVerifier(s.PublicKeys())
+	if err != nil {
+		return nil, err
+	}
+	return v.Verify(code, audience, time.Now())
+}
+
+func (s *ConfigSigningService) generate() (*model.ConfigSigningKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	kid := make([]byte, 8)
+	if _, err = rand.Read(kid); err != nil {
+		return nil, err
+	}
+	k := &model.ConfigSigningKey{
+		Kid:        hex.EncodeToString(kid),
+		PublicKey:  base64.StdEncoding.EncodeToString(pub),
+		PrivateKey: base64.StdEncoding.EncodeToString(priv),
+		Active:     true,
+	}
+	if err = global.DB.Create(k).Error; err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// purge 删除已轮换且签发的配置码均已过期的密钥
+func (s *ConfigSigningService) purge() {
+	var keys []*model.ConfigSigningKey
+	global.DB.Where("active = ?", false).Find(&keys)
+	now := time.Now()
+	for _, k := range keys {
+		var count int64
+		global.DB.Model(&model.ConfigCode{}).
+			Where("kid = ? AND (expires_at IS NULL OR expires_at > ?)", k.Kid, now).
+			Count(&count)
+		if count == 0 {
+			global.DB.Delete(k)
+		}
+	}
+}
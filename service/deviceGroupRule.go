@@ -0,0 +1,269 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/utils"
+	"gorm.io/gorm"
+)
+
+type DeviceGroupRuleService struct {
+}
+
+// deviceGroupMatcher 预编译正则的规则
+type deviceGroupMatcher struct {
+	rule      *model.DeviceGroupRule
+	hostname  *regexp.Regexp
+	attribute []*model.PeerAttributeFilter
+}
+
+// deviceGroupSubject 待匹配的设备, 用户组和标签按需加载
+type deviceGroupSubject struct {
+	peer        *model.Peer
+	ip          string
+	userGroupId *uint
+	tags        []string
+	tagsLoaded  bool
+	attrsLoaded bool
+}
+
+// List 规则列表
+func (rs *DeviceGroupRuleService) List(page, pageSize uint, where func(tx *gorm.DB)) (res *model.DeviceGroupRuleList) {
+	res = &model.DeviceGroupRuleList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := DB.Model(&model.DeviceGroupRule{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Order("priority desc, id asc").Find(&res.DeviceGroupRules)
+	return
+}
+
+// InfoById 根据id取规则
+func (rs *DeviceGroupRuleService) InfoById(id uint) *model.DeviceGroupRule {
+	r := &model.DeviceGroupRule{}
+	DB.Where("id = ?", id).First(r)
+	return r
+}
+
+// Create 创建规则
+func (rs *DeviceGroupRuleService) Create(r *model.DeviceGroupRule) error {
+	if err := rs.Check(r); err != nil {
+		return err
+	}
+	return DB.Create(r).Error
+}
+
+// Update 更新规则
+func (rs *DeviceGroupRuleService) Update(r *model.DeviceGroupRule) error {
+	if err := rs.Check(r); err != nil {
+		return err
+	}
+	return DB.Model(r).Select("*").Omit("created_at").Updates(r).Error
+}
+
+// Delete 删除规则, 已分配的设备保留所在设备组
+func (rs *DeviceGroupRuleService) Delete(r *model.DeviceGroupRule) error {
+	return DB.Delete(r).Error
+}
+
+// Check 校验规则, 网段会被规范化
+func (rs *DeviceGroupRuleService) Check(r *model.DeviceGroupRule) error {
+	if !r.HasCondition() {
+		return errors.New("at least one condition is required")
+	}
+	if AllService.GroupService.DeviceGroupInfoById(r.DeviceGroupId).Id == 0 {
+		return errors.New("DeviceGroupNotFound")
+	}
+	if r.UserGroupId > 0 && AllService.GroupService.InfoById(r.UserGroupId).Id == 0 {
+		return errors.New("GroupNotFound")
+	}
+	if r.HostnameRegex != "" {
+		if _, err := regexp.Compile(r.HostnameRegex); err != nil {
+			return err
+		}
+	}
+	if r.Cidr != "" {
+		cidr, err := utils.NormalizeCidr(r.Cidr)
+		if err != nil {
+			return err
+		}
+		r.Cidr = cidr
+	}
+	if r.PeerAttribute != "" {
+		if _, err := AllService.PeerAttributeService.ParseFilters([]string{r.PeerAttribute}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Assign 按规则为设备分配设备组, 返回设备组是否变化
+// 手动分配过设备组(GroupRuleId 为 0 且 GroupId 不为 0)的设备不处理, 没有命中规则时保持不变
+// 已入库的设备直接更新, 未入库的只修改传入的 peer
+func (rs *DeviceGroupRuleService) Assign(peer *model.Peer, ip string) bool {
+	if peer.GroupId > 0 && peer.GroupRuleId == 0 {
+		return false
+	}
+	ms := rs.matchers()
+	if len(ms) == 0 {
+		return false
+	}
+	return rs.assign(ms, &deviceGroupSubject{peer: peer, ip: ip})
+}
+
+// ReevaluateAll 按当前规则重新评估所有自动分配或未分配的设备, 使用设备最后在线的 IP
+func (rs *DeviceGroupRuleService) ReevaluateAll() (*model.DeviceGroupRuleResult, error) {
+	res := &model.DeviceGroupRuleResult{}
+	ms := rs.matchers()
+	var peers []*model.Peer
+	err := DB.Model(&model.Peer{}).FindInBatches(&peers, 500, func(tx *gorm.DB, batch int) error {
+		for _, p := range peers {
+			res.Total++
+			if p.GroupId > 0 && p.GroupRuleId == 0 {
+				res.Skipped++
+				continue
+			}
+			if rs.assign(ms, &deviceGroupSubject{peer: p, ip: p.LastOnlineIp}) {
+				res.Assigned++
+			}
+		}
+		return nil
+	}).Error
+	return res, err
+}
+
+// MarkManual 管理员手动修改设备组后, 规则不再覆盖该设备
+func (rs *DeviceGroupRuleService) MarkManual(rowId uint) error {
+	return DB.Model(&model.Peer{}).Where("row_id = ?", rowId).Update("group_rule_id", 0).Error
+}
+
+func (rs *DeviceGroupRuleService) assign(ms []*deviceGroupMatcher, s *deviceGroupSubject) bool {
+	var hit *model.DeviceGroupRule
+	for _, m := range ms {
+		if rs.match(m, s) {
+			hit = m.rule
+			break
+		}
+	}
+	if hit == nil || (s.peer.GroupId == hit.DeviceGroupId && s.peer.GroupRuleId == hit.Id) {
+		return false
+	}
+	changed := s.peer.GroupId != hit.DeviceGroupId
+	s.peer.GroupId = hit.DeviceGroupId
+	s.peer.GroupRuleId = hit.Id
+	if s.peer.RowId > 0 {
+		DB.Model(&model.Peer{}).Where("row_id = ?", s.peer.RowId).Updates(map[string]interface{}{
+			"group_id":      hit.DeviceGroupId,
+			"group_rule_id": hit.Id,
+		})
+	}
+	return changed
+}
+
+func (rs *DeviceGroupRuleService) match(m *deviceGroupMatcher, s *deviceGroupSubject) bool {
+	r := m.rule
+	if m.hostname != nil && !m.hostname.MatchString(s.peer.Hostname) {
+		return false
+	}
+	if r.Os != "" && !strings.Contains(strings.ToLower(s.peer.Os), strings.ToLower(r.Os)) {
+		return false
+	}
+	if r.Cidr != "" && (s.ip == "" || !utils.CidrContains(r.Cidr, s.ip)) {
+		return false
+	}
+	if r.UserGroupId > 0 {
+		if s.userGroupId == nil {
+			var gid uint
+			if s.peer.UserId > 0 {
+				gid = AllService.UserService.InfoById(s.peer.UserId).GroupId
+			}
+			s.userGroupId = &gid
+		}
+		if *s.userGroupId != r.UserGroupId {
+			return false
+		}
+	}
+	if r.Tag != "" {
+		if !s.tagsLoaded {
+			s.tags = rs.peerTags(s.peer.Id)
+			s.tagsLoaded = true
+		}
+		if !slices.Contains(s.tags, r.Tag) {
+			return false
+		}
+	}
+	if r.PeerLabel != "" || len(m.attribute) > 0 {
+		if s.peer.RowId == 0 {
+			return false
+		}
+		if !s.attrsLoaded {
+			AllService.PeerAttributeService.Fill([]*model.Peer{s.peer})
+			s.attrsLoaded = true
+		}
+		var labels []string
+		if r.PeerLabel != "" {
+			labels = []string{r.PeerLabel}
+		}
+		if !AllService.PeerAttributeService.Match(s.peer, labels, m.attribute) {
+			return false
+		}
+	}
+	return true
+}
+
+// peerTags 设备在所有地址簿中带有的标签
+func (rs *DeviceGroupRuleService) peerTags(id string) []string {
+	if id == "" {
+		return nil
+	}
+	var abs []*model.AddressBook
+	DB.Select("tags").Where("id = ?", id).Find(&abs)
+	var tags []string
+	for _, ab := range abs {
+		var t []string
+		if err := json.Unmarshal(ab.Tags, &t); err == nil {
+			tags = append(tags, t...)
+		}
+	}
+	return tags
+}
+
+// matchers 启用的规则, 按优先级从高到低, 正则无效的规则跳过
+func (rs *DeviceGroupRuleService) matchers() []*deviceGroupMatcher {
+	var rules []*model.DeviceGroupRule
+	DB.Where("status = ?", model.COMMON_STATUS_ENABLE).Order("priority desc, id asc").Find(&rules)
+	ms := make([]*deviceGroupMatcher, 0, len(rules))
+	for _, r := range rules {
+		if !r.HasCondition() {
+			continue
+		}
+		m := &deviceGroupMatcher{rule: r}
+		if r.HostnameRegex != "" {
+			re, err := regexp.Compile(r.HostnameRegex)
+			if err != nil {
+				Logger.Warn("device group rule ", r.Id, " has invalid hostname regex: ", err)
+				continue
+			}
+			m.hostname = re
+		}
+		if r.PeerAttribute != "" {
+			filters, err := AllService.PeerAttributeService.ParseFilters([]string{r.PeerAttribute})
+			if err != nil {
+				Logger.Warn("device group rule ", r.Id, " has invalid peer attribute: ", err)
+				continue
+			}
+			m.attribute = filters
+		}
+		ms = append(ms, m)
+	}
+	return ms
+}
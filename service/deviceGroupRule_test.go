@@ -0,0 +1,50 @@
+package service
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+func TestDeviceGroupRuleMatch(t *testing.T) {
+	rs := &DeviceGroupRuleService{}
+	m := &deviceGroupMatcher{
+		rule:     &model.DeviceGroupRule{Os: "windows", Cidr: "10.1.0.0/16"},
+		hostname: regexp.MustCompile(`^pos-\d+$`),
+	}
+	cases := []struct {
+		host, os, ip string
+		want         bool
+	}{
+		{"pos-01", "Windows 11", "10.1.2.3", true},
+		{"pos-01", "Linux", "10.1.2.3", false},
+		{"pos-01", "Windows 10", "10.2.0.1", false},
+		{"office-1", "Windows 10", "10.1.0.1", false},
+		{"pos-02", "windows", "", false},
+	}
+	for _, c := range cases {
+		s := &deviceGroupSubject{peer: &model.Peer{Hostname: c.host, Os: c.os}, ip: c.ip}
+		if got := rs.match(m, s); got != c.want {
+			t.Errorf("match(%s, %s, %s) = %v, want %v", c.host, c.os, c.ip, got, c.want)
+		}
+	}
+}
+
+func TestDeviceGroupRuleAssignPriority(t *testing.T) {
+	rs := &DeviceGroupRuleService{}
+	ms := []*deviceGroupMatcher{
+		{rule: &model.DeviceGroupRule{IdModel: model.IdModel{Id: 2}, DeviceGroupId: 20, Os: "mac"}},
+		{rule: &model.DeviceGroupRule{IdModel: model.IdModel{Id: 1}, DeviceGroupId: 10, Os: "os"}},
+	}
+	p := &model.Peer{Os: "macOS"}
+	if !rs.assign(ms, &deviceGroupSubject{peer: p}) {
+		t.Fatal("expected assignment")
+	}
+	if p.GroupId != 20 || p.GroupRuleId != 2 {
+		t.Fatalf("expected higher priority rule, got group %d rule %d", p.GroupId, p.GroupRuleId)
+	}
+	if rs.assign(ms, &deviceGroupSubject{peer: p}) {
+		t.Fatal("reassigning to the same group should report no change")
+	}
+}
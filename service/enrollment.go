@@ -0,0 +1,305 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/utils"
+	"gorm.io/gorm"
+)
+
+type EnrollmentService struct {
+}
+
+var (
+	ErrEnrollmentInvalid   = errors.New("EnrollmentInvalid")
+	ErrEnrollmentExpired   = errors.New("EnrollmentExpired")
+	ErrEnrollmentExhausted = errors.New("EnrollmentExhausted")
+	ErrEnrollmentMethod    = errors.New("EnrollmentMethodNotAllowed")
+)
+
+// List 注册链接列表
+func (es *EnrollmentService) List(page, pageSize uint, where func(tx *gorm.DB)) (res *model.EnrollmentLinkList) {
+	res = &model.EnrollmentLinkList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := DB.Model(&model.EnrollmentLink{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Find(&res.EnrollmentLinks)
+	return
+}
+
+// InfoById 根据id取注册链接
+func (es *EnrollmentService) InfoById(id uint) *model.EnrollmentLink {
+	l := &model.EnrollmentLink{}
+	DB.Where("id = ?", id).First(l)
+	return l
+}
+
+// InfoByToken 根据token取注册链接
+func (es *EnrollmentService) InfoByToken(token string) *model.EnrollmentLink {
+	l := &model.EnrollmentLink{}
+	if token == "" {
+		return l
+	}
+	DB.Preload("ServerConfig").Where("token = ?", token).First(l)
+	return l
+}
+
+// Create 创建注册链接, 同时为其生成下发配置用的配置码
+func (es *EnrollmentService) Create(l *model.EnrollmentLink) error {
+	if err := es.checkRefs(l); err != nil {
+		return err
+	}
+	l.Token = utils.RandomString(32)
+	cc, err := AllService.ServerConfigService.GenerateConfigCode(&admin.ConfigCodeForm{
+		ServerConfigId: l.ServerConfigId,
+		ExpiresAt:      l.ExpiresAt,
+	}, l.CreatedBy)
+	if err != nil {
+		return err
+	}
+	l.ConfigCodeId = cc.Id
+	if err = DB.Create(l).Error; err != nil {
+		DB.Delete(cc)
+	}
+	return err
+}
+
+// Update 更新注册链接, 服务器配置变化时换发配置码
+func (es *EnrollmentService) Update(l *model.EnrollmentLink) error {
+	old := es.InfoById(l.Id)
+	if old.Id == 0 {
+		return ErrEnrollmentInvalid
+	}
+	if err := es.checkRefs(l); err != nil {
+		return err
+	}
+	l.Token = old.Token
+	l.UseCount = old.UseCount
+	l.CreatedBy = old.CreatedBy
+	l.ConfigCodeId = old.ConfigCodeId
+	if old.ServerConfigId != l.ServerConfigId || old.ConfigCodeId == 0 {
+		cc, err := AllService.ServerConfigService.GenerateConfigCode(&admin.ConfigCodeForm{
+			ServerConfigId: l.ServerConfigId,
+			ExpiresAt:      l.ExpiresAt,
+		}, l.CreatedBy)
+		if err != nil {
+			return err
+		}
+		if old.ConfigCodeId > 0 {
+			_ = AllService.ServerConfigService.RevokeConfigCode(old.ConfigCodeId, "enrollment link server config changed")
+		}
+		l.ConfigCodeId = cc.Id
+	} else {
+		DB.Model(&model.ConfigCode{}).Where("id = ?", l.ConfigCodeId).Update("expires_at", l.ExpiresAt)
+	}
+	return DB.Model(l).Select("*").Omit("created_at").Updates(l).Error
+}
+
+// Delete 删除注册链接并吊销其配置码
+func (es *EnrollmentService) Delete(l *model.EnrollmentLink) error {
+	if l.ConfigCodeId > 0 {
+		_ = AllService.ServerConfigService.RevokeConfigCode(l.ConfigCodeId, "enrollment link deleted")
+	}
+	return DB.Delete(l).Error
+}
+
+// Records 注册记录
+func (es *EnrollmentService) Records(page, pageSize uint, where func(tx *gorm.DB)) (res *model.EnrollmentList) {
+	res = &model.EnrollmentList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := DB.Model(&model.Enrollment{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Preload("User").Order("id desc").Find(&res.Enrollments)
+	return
+}
+
+// Check 链接是否可用
+func (es *EnrollmentService) Check(l *model.EnrollmentLink) error {
+	if l.Id == 0 || l.Status != model.COMMON_STATUS_ENABLE || l.ConfigCodeId == 0 {
+		return ErrEnrollmentInvalid
+	}
+	if l.IsExpired() {
+		return ErrEnrollmentExpired
+	}
+	if l.IsExhausted() {
+		return ErrEnrollmentExhausted
+	}
+	return nil
+}
+
+// Register 通过注册链接注册新用户并下发配置
+func (es *EnrollmentService) Register(l *model.EnrollmentLink, username, email, password string, r *ConfigCodeRedeemer) (*model.User, *model.ClientServerConfig, error) {
+	if l.AllowRegister != nil && !*l.AllowRegister {
+		return nil, nil, ErrEnrollmentMethod
+	}
+	if err := es.Check(l); err != nil {
+		return nil, nil, err
+	}
+	// 先确认配置码可兑换, 避免注册了用户却拿不到配置
+	if _, err := AllService.ServerConfigService.CheckConfigCode(es.configCode(l), r); err != nil {
+		return nil, nil, err
+	}
+	u := AllService.UserService.Register(username, email, password, model.COMMON_STATUS_ENABLE)
+	if u == nil || u.Id == 0 {
+		return nil, nil, errors.New("UsernameExists")
+	}
+	es.assignGroup(l, u)
+	cfg, err := es.Enroll(l, u, model.EnrollmentMethodRegister, true, r)
+	if err != nil {
+		// 兑换失败时删除刚注册的用户, 否则用户重试时会提示用户名已存在
+		if derr := AllService.UserService.Delete(u); derr != nil {
+			Logger.Warn("delete enrollment user ", u.Id, " failed: ", derr)
+		}
+		return nil, nil, err
+	}
+	return u, cfg, nil
+}
+
+// EnrollOauth OAuth 回调完成登录后记录注册, registered 表示用户由本次 OAuth 自动注册
+func (es *EnrollmentService) EnrollOauth(token string, u *model.User, registered bool, r *ConfigCodeRedeemer) error {
+	l := es.InfoByToken(token)
+	if l.AllowOauth != nil && !*l.AllowOauth {
+		return ErrEnrollmentMethod
+	}
+	if err := es.Check(l); err != nil {
+		return err
+	}
+	if registered {
+		es.assignGroup(l, u)
+	}
+	_, err := es.Enroll(l, u, model.EnrollmentMethodOauth, registered, r)
+	return err
+}
+
+// Enroll 为已登录用户兑换链接: 下发配置, 绑定设备, 记录待分配的设备组
+// 同一用户同一设备重复兑换不占用次数
+func (es *EnrollmentService) Enroll(l *model.EnrollmentLink, u *model.User, method string, registered bool, r *ConfigCodeRedeemer) (*model.ClientServerConfig, error) {
+	if l.Id == 0 {
+		return nil, ErrEnrollmentInvalid
+	}
+	r.User = u
+	if r.Uuid != "" {
+		exist := &model.Enrollment{}
+		DB.Where("enrollment_link_id = ? and user_id = ? and uuid = ?", l.Id, u.Id, r.Uuid).First(exist)
+		if exist.Id > 0 {
+			cc, err := AllService.ServerConfigService.CheckConfigCode(es.configCode(l), r)
+			if err != nil {
+				return nil, err
+			}
+			return cc.ServerConfig.ToClientConfig(), nil
+		}
+	}
+	if err := es.Check(l); err != nil {
+		return nil, err
+	}
+	res := DB.Model(&model.EnrollmentLink{}).
+		Where("id = ? and (max_uses = 0 or use_count < max_uses)", l.Id).
+		UpdateColumn("use_count", gorm.Expr("use_count + 1"))
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrEnrollmentExhausted
+	}
+	l.UseCount++
+
+	cfg, err := AllService.ServerConfigService.GetConfigByCode(es.configCode(l), r)
+	if err != nil {
+		DB.Model(&model.EnrollmentLink{}).Where("id = ?", l.Id).UpdateColumn("use_count", gorm.Expr("use_count - 1"))
+		return nil, err
+	}
+
+	e := &model.Enrollment{
+		EnrollmentLinkId: l.Id,
+		UserId:           u.Id,
+		Registered:       registered,
+		Method:           method,
+		Uuid:             r.Uuid,
+		DeviceId:         r.DeviceId,
+		DeviceGroupId:    l.DeviceGroupId,
+		ClientIp:         r.ClientIP,
+	}
+	if r.Uuid != "" {
+		// 设备已经上报过时立即分配, 否则等首次 SysInfo
+		AllService.PeerService.UuidBindUserId(r.DeviceId, r.Uuid, u.Id)
+		peer := AllService.PeerService.FindByUuid(r.Uuid)
+		if peer.RowId > 0 {
+			if e.DeviceGroupId > 0 {
+				DB.Model(peer).Update("group_id", e.DeviceGroupId)
+			}
+			e.AssignedAt = time.Now().Unix()
+		}
+	}
+	if err = DB.Create(e).Error; err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ApplyOnSysInfo 设备首次上报 SysInfo 时按待处理的注册记录分配设备组和用户
+func (es *EnrollmentService) ApplyOnSysInfo(pe *model.Peer) {
+	if pe.Uuid == "" {
+		return
+	}
+	e := &model.Enrollment{}
+	DB.Where("uuid = ? and assigned_at = 0", pe.Uuid).Order("id desc").First(e)
+	if e.Id == 0 {
+		return
+	}
+	if e.DeviceGroupId > 0 {
+		pe.GroupId = e.DeviceGroupId
+	}
+	if pe.UserId == 0 {
+		pe.UserId = e.UserId
+	}
+	DB.Model(e).Update("assigned_at", time.Now().Unix())
+}
+
+// IsNewOauthUser OAuth 登录的用户是否会由 RegisterByOauth 新建, 同邮箱的已有用户会被直接绑定
+func (es *EnrollmentService) IsNewOauthUser(oauthUser *model.OauthUser) bool {
+	if oauthUser.Email == "" {
+		return true
+	}
+	return AllService.UserService.InfoByEmail(strings.ToLower(oauthUser.Email)).Id == 0
+}
+
+func (es *EnrollmentService) configCode(l *model.EnrollmentLink) string {
+	cc := &model.ConfigCode{}
+	DB.Select("code").Where("id = ?", l.ConfigCodeId).First(cc)
+	return cc.Code
+}
+
+func (es *EnrollmentService) assignGroup(l *model.EnrollmentLink, u *model.User) {
+	if l.GroupId == 0 || l.GroupId == u.GroupId {
+		return
+	}
+	DB.Model(u).Update("group_id", l.GroupId)
+	u.GroupId = l.GroupId
+}
+
+func (es *EnrollmentService) checkRefs(l *model.EnrollmentLink) error {
+	if sc, err := AllService.ServerConfigService.Detail(l.ServerConfigId); err != nil || sc.Id == 0 {
+		return errors.New("ServerConfigNotFound")
+	}
+	if l.GroupId > 0 && AllService.GroupService.InfoById(l.GroupId).Id == 0 {
+		return errors.New("GroupNotFound")
+	}
+	if l.DeviceGroupId > 0 && AllService.GroupService.DeviceGroupInfoById(l.DeviceGroupId).Id == 0 {
+		return errors.New("DeviceGroupNotFound")
+	}
+	return nil
+}
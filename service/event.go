@@ -0,0 +1,29 @@
+package service
+
+import (
+	"github.com/lejianwen/rustdesk-api/v2/lib/event"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+// 事件名
+const (
+	EventShareRecordUsed = "share_record.used" // 分享链接被成功打开, payload 为 *ShareRecordUsedEvent
+)
+
+// ShareRecordUsedEvent 分享链接被打开
+type ShareRecordUsedEvent struct {
+	Record *model.ShareRecord
+	Use    *model.ShareRecordUse
+}
+
+// Events 进程内事件总线
+var Events *event.Bus
+
+func newEvents() *event.Bus {
+	b := event.New()
+	b.OnPanic = func(name string, err error) {
+		Logger.Errorf("event %s handler panic: %v", name, err)
+	}
+	b.Subscribe(EventShareRecordUsed, AllService.NotificationService.onShareRecordUsed)
+	return b
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lejianwen/rustdesk-api/v2/lib/fieldcrypt"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/model/custom_types"
+	"gorm.io/gorm"
+)
+
+// FieldEncryptionService 加密字段的存量数据迁移
+// 读写都绕过 serializer 直接操作原始值, 用于首次加密、更换主密钥后重新加密和解密还原
+type FieldEncryptionService struct {
+}
+
+// fieldEncryptionModels 带有加密字段的模型
+var fieldEncryptionModels = []interface{}{
+	&model.AddressBook{},
+	&model.ConfigCode{},
+	&model.ConfigSigningKey{},
+	&model.Oauth{},
+	&model.ServerCmdEndpoint{},
+	&model.ServerConfig{},
+	&model.ServerConfigRevision{},
+	&model.ShareRecord{},
+}
+
+// Rewrite 用当前密钥重新加密所有加密字段, decrypt 为 true 时还原为明文
+// 已经由当前密钥加密的值不处理, 可重复执行
+func (fs *FieldEncryptionService) Rewrite(decrypt bool) ([]*model.FieldEncryptionResult, error) {
+	kr := custom_types.Keyring()
+	if kr == nil {
+		return nil, fieldcrypt.ErrNoKey
+	}
+	var res []*model.FieldEncryptionResult
+	for _, m := range fieldEncryptionModels {
+		stmt := &gorm.Statement{DB: DB}
+		if err := stmt.Parse(m); err != nil {
+			return res, err
+		}
+		pk := stmt.Schema.PrioritizedPrimaryField
+		if pk == nil {
+			return res, fmt.Errorf("table %s has no primary key", stmt.Schema.Table)
+		}
+		for _, f := range stmt.Schema.Fields {
+			if f.TagSettings["SERIALIZER"] != "encrypted" {
+				continue
+			}
+			r, err := fs.rewriteColumn(kr, stmt.Schema.Table, pk.DBName, f.DBName, decrypt)
+			if r != nil {
+				res = append(res, r)
+			}
+			if err != nil {
+				return res, err
+			}
+		}
+	}
+	return res, nil
+}
+
+func (fs *FieldEncryptionService) rewriteColumn(kr *fieldcrypt.Keyring, table, pk, column string, decrypt bool) (*model.FieldEncryptionResult, error) {
+	res := &model.FieldEncryptionResult{Table: table, Column: column}
+	var last uint
+	for {
+		rows, err := DB.Table(table).Select(pk, column).Where(pk+" > ?", last).Order(pk).Limit(500).Rows()
+		if err != nil {
+			return res, err
+		}
+		updates := make(map[uint]string)
+		n := 0
+		for rows.Next() {
+			var id uint
+			var v sql.NullString
+			if err = rows.Scan(&id, &v); err != nil {
+				rows.Close()
+				return res, err
+			}
+			n++
+			last = id
+			nv, changed, err := rewriteFieldValue(kr, v.String, decrypt)
+			if err != nil {
+				rows.Close()
+				return res, fmt.Errorf("%s.%s %s=%d: %w", table, column, pk, id, err)
+			}
+			if changed {
+				updates[id] = nv
+			}
+		}
+		rows.Close()
+		res.Total += n
+		// Table 更新不解析模型, 写入的就是原始值
+		for id, nv := range updates {
+			if err = DB.Table(table).Where(pk+" = ?", id).Update(column, nv).Error; err != nil {
+				return res, err
+			}
+			res.Rewritten++
+		}
+		if n < 500 {
+			return res, nil
+		}
+	}
+}
+
+// rewriteFieldValue 计算迁移后的值, 返回是否需要写回
+func rewriteFieldValue(kr *fieldcrypt.Keyring, s string, decrypt bool) (string, bool, error) {
+	if s == "" {
+		return s, false, nil
+	}
+	if decrypt {
+		if !fieldcrypt.IsEncrypted(s) {
+			return s, false, nil
+		}
+		b, err := kr.Decrypt(s)
+		return string(b), err == nil, err
+	}
+	if !kr.NeedsRewrite(s) {
+		return s, false, nil
+	}
+	plain := []byte(s)
+	if fieldcrypt.IsEncrypted(s) {
+		var err error
+		if plain, err = kr.Decrypt(s); err != nil {
+			return s, false, err
+		}
+	}
+	nv, err := kr.Encrypt(plain)
+	return nv, err == nil, err
+}
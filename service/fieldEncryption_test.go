@@ -0,0 +1,39 @@
+package service
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/lejianwen/rustdesk-api/v2/lib/fieldcrypt"
+)
+
+func TestRewriteFieldValue(t *testing.T) {
+	k1, _ := fieldcrypt.NewKey("k1", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32))))
+	k2, _ := fieldcrypt.NewKey("k2", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", 32))))
+	old, _ := fieldcrypt.NewKeyring(k1)
+	kr, _ := fieldcrypt.NewKeyring(k2, k1)
+
+	if _, changed, _ := rewriteFieldValue(kr, "", false); changed {
+		t.Fatal("empty value should be kept")
+	}
+	enc, changed, err := rewriteFieldValue(kr, "pwd", false)
+	if err != nil || !changed || fieldcrypt.KeyId(enc) != "k2" {
+		t.Fatalf("plaintext: %s %v %v", enc, changed, err)
+	}
+	if _, changed, _ = rewriteFieldValue(kr, enc, false); changed {
+		t.Fatal("value with active key should be kept")
+	}
+	legacy, _ := old.Encrypt([]byte("pwd"))
+	rotated, changed, err := rewriteFieldValue(kr, legacy, false)
+	if err != nil || !changed || fieldcrypt.KeyId(rotated) != "k2" {
+		t.Fatalf("rotate: %s %v %v", rotated, changed, err)
+	}
+	plain, changed, err := rewriteFieldValue(kr, rotated, true)
+	if err != nil || !changed || plain != "pwd" {
+		t.Fatalf("decrypt: %s %v %v", plain, changed, err)
+	}
+	if _, changed, _ = rewriteFieldValue(kr, "pwd", true); changed {
+		t.Fatal("plaintext should be kept when decrypting")
+	}
+}
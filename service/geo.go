@@ -0,0 +1,114 @@
+package service
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lejianwen/rustdesk-api/v2/lib/geoip"
+	"github.com/lejianwen/rustdesk-api/v2/utils"
+)
+
+// GeoService 根据客户端IP识别地域, 先匹配配置的网段, 再查 GeoIP 数据库
+type GeoService struct {
+}
+
+type geoCidr struct {
+	net    *net.IPNet
+	ones   int
+	region string
+}
+
+var geoState = struct {
+	sync.RWMutex
+	loaded bool
+	reader *geoip.Reader
+	cidrs  []*geoCidr
+}{}
+
+// Reload 重新加载 GeoIP 数据库和网段表
+func (s *GeoService) Reload() {
+	cfg := Config.Geo
+	var reader *geoip.Reader
+	if cfg.MmdbFile != "" {
+		r, err := geoip.Open(cfg.MmdbFile)
+		if err != nil {
+			Logger.Warn("load geoip database failed: ", err)
+		} else {
+			reader = r
+		}
+	}
+	cidrs := make([]*geoCidr, 0)
+	for region, list := range cfg.CidrRegions {
+		for _, c := range list {
+			n, err := utils.ParseCidr(c)
+			if err != nil {
+				Logger.Warn("invalid geo cidr: ", c)
+				continue
+			}
+			ones, _ := n.Mask.Size()
+			cidrs = append(cidrs, &geoCidr{net: n, ones: ones, region: region})
+		}
+	}
+	// 最长前缀优先
+	sort.SliceStable(cidrs, func(i, j int) bool {
+		return cidrs[i].ones > cidrs[j].ones
+	})
+	geoState.Lock()
+	geoState.reader = reader
+	geoState.cidrs = cidrs
+	geoState.loaded = true
+	geoState.Unlock()
+}
+
+// Country 国家代码, 未启用 GeoIP 或未找到时返回空
+func (s *GeoService) Country(ip string) string {
+	p := net.ParseIP(ip)
+	if p == nil {
+		return ""
+	}
+	s.ensureLoaded()
+	geoState.RLock()
+	reader := geoState.reader
+	geoState.RUnlock()
+	if reader == nil {
+		return ""
+	}
+	return reader.Country(p)
+}
+
+// Region 客户端所在地域, 无法识别时返回空
+func (s *GeoService) Region(ip string) string {
+	p := net.ParseIP(ip)
+	if p == nil {
+		return ""
+	}
+	s.ensureLoaded()
+	geoState.RLock()
+	for _, c := range geoState.cidrs {
+		if c.net.Contains(p) {
+			geoState.RUnlock()
+			return c.region
+		}
+	}
+	geoState.RUnlock()
+	country := s.Country(ip)
+	if country == "" {
+		return ""
+	}
+	// viper 读取的 map key 为小写
+	if region, ok := Config.Geo.CountryRegions[strings.ToLower(country)]; ok {
+		return region
+	}
+	return country
+}
+
+func (s *GeoService) ensureLoaded() {
+	geoState.RLock()
+	loaded := geoState.loaded
+	geoState.RUnlock()
+	if !loaded {
+		s.Reload()
+	}
+}
@@ -73,5 +73,5 @@ func (us *GroupService) DeviceGroupDelete(u *model.DeviceGroup) error {
 }
 
 func (us *GroupService) DeviceGroupUpdate(u *model.DeviceGroup) error {
-	return DB.Model(u).Updates(u).Error
+	return DB.Model(u).Select("*").Omit("created_at").Updates(u).Error
 }
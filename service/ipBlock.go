@@ -0,0 +1,397 @@
+package service
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/utils"
+	"gorm.io/gorm"
+)
+
+// IpBlockService IP黑名单
+// hbbr 的 blocklist 支持增删查, hbbs 的 ip-blocker 只能查看和解除,
+// 所以新增封禁只下发到 hbbr, 解除时两边都下发; 配置了多个命令端点时逐个下发
+type IpBlockService struct {
+}
+
+const (
+	// ipBlockMaxExpand 下发到服务端时CIDR最多展开的IP数, 更大的网段只在API层生效
+	ipBlockMaxExpand = 256
+	// ipBlockCmdBatch 每条 blocklist 命令携带的IP数, 多个IP用 | 分隔
+	ipBlockCmdBatch = 16
+)
+
+type ipBlockNet struct {
+	net       *net.IPNet
+	expiredAt int64
+}
+
+var ipBlockCache = struct {
+	sync.RWMutex
+	loaded bool
+	nets   []*ipBlockNet
+}{}
+
+func (s *IpBlockService) InfoById(id uint) *model.IpBlock {
+	b := &model.IpBlock{}
+	DB.Where("id = ?", id).First(b)
+	return b
+}
+
+func (s *IpBlockService) InfoByCidr(cidr string) *model.IpBlock {
+	b := &model.IpBlock{}
+	DB.Where("cidr = ?", cidr).First(b)
+	return b
+}
+
+func (s *IpBlockService) List(page, pageSize uint, where func(tx *gorm.DB)) (res *model.IpBlockList) {
+	res = &model.IpBlockList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := DB.Model(&model.IpBlock{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Find(&res.IpBlocks)
+	return
+}
+
+// Create 创建并下发
+func (s *IpBlockService) Create(b *model.IpBlock) error {
+	cidr, err := utils.NormalizeCidr(b.Cidr)
+	if err != nil {
+		return err
+	}
+	b.Cidr = cidr
+	if b.Source == "" {
+		b.Source = model.IpBlockSourceManual
+	}
+	if ex := s.InfoByCidr(cidr); ex.Id > 0 {
+		return errors.New("ItemExists")
+	}
+	if err = DB.Create(b).Error; err != nil {
+		return err
+	}
+	s.Reload()
+	go s.push(b)
+	return nil
+}
+
+// Update 更新, 网段变化时先解除旧网段
+func (s *IpBlockService) Update(b *model.IpBlock) error {
+	cidr, err := utils.NormalizeCidr(b.Cidr)
+	if err != nil {
+		return err
+	}
+	b.Cidr = cidr
+	old := s.InfoById(b.Id)
+	if old.Id == 0 {
+		return errors.New("ItemNotFound")
+	}
+	if ex := s.InfoByCidr(cidr); ex.Id > 0 && ex.Id != b.Id {
+		return errors.New("ItemExists")
+	}
+	err = DB.Model(b).Select("cidr", "reason", "expired_at").Updates(b).Error
+	if err != nil {
+		return err
+	}
+	s.Reload()
+	go func() {
+		if old.Cidr != cidr {
+			s.unpush(old.Cidr)
+		}
+		s.push(s.InfoById(b.Id))
+	}()
+	return nil
+}
+
+// Delete 解除封禁
+// 先置为过期, 服务端解除成功后才删除记录, 失败的由 Reconcile 重试
+func (s *IpBlockService) Delete(b *model.IpBlock) error {
+	err := DB.Model(b).Update("expired_at", time.Now().Unix()).Error
+	if err != nil {
+		return err
+	}
+	s.Reload()
+	if global.LoginLimiter != nil && !strings.Contains(b.Cidr, "/") {
+		global.LoginLimiter.Unban(b.Cidr)
+	}
+	go func() {
+		if s.unpush(b.Cidr) == nil {
+			DB.Delete(b)
+		}
+	}()
+	return nil
+}
+
+func (s *IpBlockService) BatchDelete(ids []uint) error {
+	var bs []*model.IpBlock
+	DB.Where("id in (?)", ids).Find(&bs)
+	for _, b := range bs {
+		if err := s.Delete(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import 批量导入, 已存在的网段跳过, 返回新增数量和无效的条目
+func (s *IpBlockService) Import(cidrs []string, reason string, expiredAt int64) (created int, invalid []string) {
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		cidr, err := utils.NormalizeCidr(c)
+		if err != nil {
+			invalid = append(invalid, c)
+			continue
+		}
+		if s.InfoByCidr(cidr).Id > 0 {
+			continue
+		}
+		b := &model.IpBlock{Cidr: cidr, Reason: reason, Source: model.IpBlockSourceImport, ExpiredAt: expiredAt}
+		if DB.Create(b).Error != nil {
+			invalid = append(invalid, c)
+			continue
+		}
+		created++
+	}
+	s.Reload()
+	go s.Reconcile()
+	return
+}
+
+// BlockFromLimiter 登录限制器封禁的IP写入黑名单
+func (s *IpBlockService) BlockFromLimiter(ip string, reason string, expiresAt time.Time) {
+	cidr, err := utils.NormalizeCidr(ip)
+	if err != nil {
+		return
+	}
+	ex := s.InfoByCidr(cidr)
+	if ex.Id > 0 {
+		// 只延长有期限的封禁, 永久封禁保持不变
+		if ex.ExpiredAt > 0 && ex.ExpiredAt < expiresAt.Unix() {
+			DB.Model(ex).Update("expired_at", expiresAt.Unix())
+			s.Reload()
+		}
+		return
+	}
+	b := &model.IpBlock{Cidr: cidr, Reason: reason, Source: model.IpBlockSourceLoginLimiter, ExpiredAt: expiresAt.Unix()}
+	if err = DB.Create(b).Error; err != nil {
+		Logger.Warn("ip block from limiter failed: ", err)
+		return
+	}
+	s.Reload()
+	s.push(b)
+}
+
+// IsBlocked 判断IP是否被封禁
+func (s *IpBlockService) IsBlocked(ip string) bool {
+	p := net.ParseIP(ip)
+	if p == nil {
+		return false
+	}
+	ipBlockCache.RLock()
+	loaded := ipBlockCache.loaded
+	ipBlockCache.RUnlock()
+	if !loaded {
+		s.Reload()
+	}
+	now := time.Now().Unix()
+	ipBlockCache.RLock()
+	defer ipBlockCache.RUnlock()
+	for _, n := range ipBlockCache.nets {
+		if n.expiredAt > 0 && n.expiredAt <= now {
+			continue
+		}
+		if n.net.Contains(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload 重新加载生效中的网段
+func (s *IpBlockService) Reload() {
+	var bs []*model.IpBlock
+	DB.Where("expired_at = 0 or expired_at > ?", time.Now().Unix()).Find(&bs)
+	nets := make([]*ipBlockNet, 0, len(bs))
+	for _, b := range bs {
+		n, err := utils.ParseCidr(b.Cidr)
+		if err != nil {
+			continue
+		}
+		nets = append(nets, &ipBlockNet{net: n, expiredAt: b.ExpiredAt})
+	}
+	ipBlockCache.Lock()
+	ipBlockCache.nets = nets
+	ipBlockCache.loaded = true
+	ipBlockCache.Unlock()
+}
+
+// Reconcile 对账: 清理过期记录, 补发各 hbbr 缺失的封禁, 导入 hbbr 上未记录的IP
+func (s *IpBlockService) Reconcile() error {
+	now := time.Now().Unix()
+	var bs []*model.IpBlock
+	DB.Find(&bs)
+
+	eps := AllService.ServerCmdService.Endpoints(model.ServerCmdTargetRelayServer)
+	listed := make(map[*model.ServerCmdEndpoint]map[string]bool, len(eps))
+	var lastErr error
+	for _, e := range eps {
+		l, err := s.relayBlocklist(e)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		listed[e] = l
+	}
+	if len(listed) == 0 {
+		return lastErr
+	}
+	covered := make(map[string]bool)
+	for _, b := range bs {
+		ips, err := utils.ExpandCidr(b.Cidr, ipBlockMaxExpand)
+		for _, ip := range ips {
+			covered[ip] = true
+		}
+		if b.IsExpired(now) {
+			if s.unpush(b.Cidr) == nil {
+				DB.Delete(b)
+			}
+			continue
+		}
+		if err != nil {
+			s.markSynced(b, err)
+			continue
+		}
+		var pushErr error
+		for e, l := range listed {
+			missing := false
+			for _, ip := range ips {
+				if !l[ip] {
+					missing = true
+					break
+				}
+			}
+			if missing {
+				if err := s.sendBatch(e, "blocklist-add", ips); err != nil {
+					pushErr = err
+				}
+			}
+		}
+		s.markSynced(b, pushErr)
+	}
+	for _, l := range listed {
+		for ip := range l {
+			if covered[ip] || s.IsBlocked(ip) {
+				continue
+			}
+			covered[ip] = true
+			DB.Create(&model.IpBlock{Cidr: ip, Reason: "imported from hbbr", Source: model.IpBlockSourceImport, SyncedAt: now})
+		}
+	}
+	s.Reload()
+	return lastErr
+}
+
+// StartReconcile 定时对账
+func (s *IpBlockService) StartReconcile(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := s.Reconcile(); err != nil {
+				Logger.Debug("ip block reconcile failed: ", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// push 下发封禁到全部 hbbr 端点
+func (s *IpBlockService) push(b *model.IpBlock) error {
+	ips, err := utils.ExpandCidr(b.Cidr, ipBlockMaxExpand)
+	if err == nil {
+		for _, e := range AllService.ServerCmdService.Endpoints(model.ServerCmdTargetRelayServer) {
+			if e2 := s.sendBatch(e, "blocklist-add", ips); e2 != nil {
+				err = e2
+			}
+		}
+	}
+	s.markSynced(b, err)
+	return err
+}
+
+// unpush 从全部 hbbr 和 hbbs 端点解除封禁
+func (s *IpBlockService) unpush(cidr string) error {
+	ips, err := utils.ExpandCidr(cidr, ipBlockMaxExpand)
+	if err != nil {
+		// 过大的网段从未下发过
+		return nil
+	}
+	for _, e := range AllService.ServerCmdService.Endpoints(model.ServerCmdTargetRelayServer) {
+		if e2 := s.sendBatch(e, "blocklist-remove", ips); e2 != nil {
+			err = e2
+		}
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range AllService.ServerCmdService.Endpoints(model.ServerCmdTargetIdServer) {
+		for _, ip := range ips {
+			// hbbs 可能未运行, 不影响解除结果
+			AllService.ServerCmdService.SendCmdToEndpoint(e, "ip-blocker", ip+" -")
+		}
+	}
+	return nil
+}
+
+func (s *IpBlockService) sendBatch(e *model.ServerCmdEndpoint, cmd string, ips []string) error {
+	for i := 0; i < len(ips); i += ipBlockCmdBatch {
+		end := i + ipBlockCmdBatch
+		if end > len(ips) {
+			end = len(ips)
+		}
+		if _, err := AllService.ServerCmdService.SendCmdToEndpoint(e, cmd, strings.Join(ips[i:end], "|")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// relayBlocklist 读取 hbbr 端点当前的 blocklist
+func (s *IpBlockService) relayBlocklist(e *model.ServerCmdEndpoint) (map[string]bool, error) {
+	res, err := AllService.ServerCmdService.SendCmdToEndpoint(e, "blocklist", "")
+	if err != nil {
+		return nil, err
+	}
+	listed := make(map[string]bool)
+	for _, f := range strings.FieldsFunc(res, func(r rune) bool {
+		return r == '\n' || r == '\r' || r == ' ' || r == ',' || r == '|'
+	}) {
+		if ip := net.ParseIP(f); ip != nil {
+			listed[ip.String()] = true
+		}
+	}
+	return listed, nil
+}
+
+func (s *IpBlockService) markSynced(b *model.IpBlock, err error) {
+	data := map[string]interface{}{"synced_at": time.Now().Unix(), "sync_error": ""}
+	if err != nil {
+		data = map[string]interface{}{"sync_error": err.Error()}
+	}
+	DB.Model(&model.IpBlock{}).Where("id = ?", b.Id).Updates(data)
+}
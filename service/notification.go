@@ -0,0 +1,62 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"gorm.io/gorm"
+)
+
+type NotificationService struct {
+}
+
+func (ns *NotificationService) List(userId, page, pageSize uint, where func(tx *gorm.DB)) (res *model.NotificationList) {
+	res = &model.NotificationList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	DB.Model(&model.Notification{}).Where("user_id = ? and read_at = 0", userId).Count(&res.Unread)
+	tx := DB.Model(&model.Notification{}).Where("user_id = ?", userId)
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Order("id desc").Find(&res.Notifications)
+	return
+}
+
+func (ns *NotificationService) Create(n *model.Notification) error {
+	return DB.Create(n).Error
+}
+
+// MarkRead 标记已读, ids 为空时标记该用户的全部通知
+func (ns *NotificationService) MarkRead(userId uint, ids []uint) error {
+	tx := DB.Model(&model.Notification{}).Where("user_id = ? and read_at = 0", userId)
+	if len(ids) > 0 {
+		tx.Where("id in (?)", ids)
+	}
+	return tx.Update("read_at", time.Now().Unix()).Error
+}
+
+// onShareRecordUsed 分享链接被打开时通知分享者
+func (ns *NotificationService) onShareRecordUsed(payload interface{}) {
+	e := payload.(*ShareRecordUsedEvent)
+	n := &model.Notification{
+		UserId:  e.Record.UserId,
+		Type:    model.NotificationShareOpened,
+		Title:   fmt.Sprintf("Share link of %s opened", e.Record.PeerId),
+		Content: fmt.Sprintf("Opened from %s (%s)", e.Use.Ip, e.Use.UserAgent),
+		Data: map[string]interface{}{
+			"share_record_id":     e.Record.Id,
+			"share_record_use_id": e.Use.Id,
+			"peer_id":             e.Record.PeerId,
+			"ip":                  e.Use.Ip,
+			"email":               e.Use.Email,
+			"use_count":           e.Record.UseCount,
+		},
+	}
+	if err := ns.Create(n); err != nil {
+		Logger.Errorf("create share opened notification for user %d: %v", n.UserId, err)
+	}
+}
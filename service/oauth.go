@@ -49,6 +49,8 @@ type OauthCacheItem struct {
 	Email      string `json:"email"`
 	Verifier   string `json:"verifier"` // used for oauth pkce
 	Nonce      string `json:"nonce"`
+	// 通过自助注册链接发起时的链接token
+	EnrollToken string `json:"enroll_token"`
 }
 
 func (oci *OauthCacheItem) ToOauthUser() *model.OauthUser {
@@ -14,6 +14,21 @@ func (ps *PeerService) FindById(id string) *model.Peer {
 	DB.Where("id = ?", id).First(p)
 	return p
 }
+
+// Resolve 根据id查找, 找不到时按合并留下的别名查找保留的设备
+func (ps *PeerService) Resolve(id string) *model.Peer {
+	p := ps.FindById(id)
+	if p.RowId > 0 || id == "" {
+		return p
+	}
+	a := &model.PeerAlias{}
+	DB.Where("alias_id = ?", id).First(a)
+	if a.Id == 0 {
+		return p
+	}
+	return ps.InfoByRowId(a.PeerRowId)
+}
+
 func (ps *PeerService) FindByUuid(uuid string) *model.Peer {
 	p := &model.Peer{}
 	DB.Where("uuid = ?", uuid).First(p)
@@ -116,6 +131,8 @@ func (ps *PeerService) Delete(u *model.Peer) error {
 	if err != nil {
 		return err
 	}
+	_ = AllService.PeerAttributeService.DeleteByPeers([]uint{u.RowId})
+	DB.Where("peer_row_id = ?", u.RowId).Delete(&model.PeerAlias{})
 	// 删除token
 	return AllService.UserService.FlushTokenByUuid(uuid)
 }
@@ -143,6 +160,8 @@ func (ps *PeerService) BatchDelete(ids []uint) error {
 	if err != nil {
 		return err
 	}
+	_ = AllService.PeerAttributeService.DeleteByPeers(ids)
+	DB.Where("peer_row_id in (?)", ids).Delete(&model.PeerAlias{})
 	// 删除token
 	return AllService.UserService.FlushTokenByUuids(uuids)
 }
@@ -0,0 +1,371 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"gorm.io/gorm"
+)
+
+type PeerAttributeService struct {
+}
+
+var peerAttributeName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// 单个设备的标签上限
+const peerLabelMax = 64
+
+// DefinitionList 属性定义列表
+func (ps *PeerAttributeService) DefinitionList(page, pageSize uint, where func(tx *gorm.DB)) (res *model.PeerAttributeDefinitionList) {
+	res = &model.PeerAttributeDefinitionList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := DB.Model(&model.PeerAttributeDefinition{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Order("id asc").Find(&res.PeerAttributeDefinitions)
+	return
+}
+
+// DefinitionInfoById 根据id取属性定义
+func (ps *PeerAttributeService) DefinitionInfoById(id uint) *model.PeerAttributeDefinition {
+	d := &model.PeerAttributeDefinition{}
+	DB.Where("id = ?", id).First(d)
+	return d
+}
+
+// DefinitionByName 根据属性键取属性定义
+func (ps *PeerAttributeService) DefinitionByName(name string) *model.PeerAttributeDefinition {
+	d := &model.PeerAttributeDefinition{}
+	DB.Where("name = ?", name).First(d)
+	return d
+}
+
+// DefinitionCreate 创建属性定义
+func (ps *PeerAttributeService) DefinitionCreate(d *model.PeerAttributeDefinition) error {
+	if err := ps.checkDefinition(d); err != nil {
+		return err
+	}
+	if ps.DefinitionByName(d.Name).Id > 0 {
+		return fmt.Errorf("attribute %s already exists", d.Name)
+	}
+	return DB.Create(d).Error
+}
+
+// DefinitionUpdate 更新属性定义, 键不可修改; 修改类型时已有的值须能转换为新类型
+func (ps *PeerAttributeService) DefinitionUpdate(d *model.PeerAttributeDefinition) error {
+	old := ps.DefinitionInfoById(d.Id)
+	if old.Id == 0 {
+		return errors.New("ItemNotFound")
+	}
+	d.Name = old.Name
+	if err := ps.checkDefinition(d); err != nil {
+		return err
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if d.Type != old.Type {
+			var values []*model.PeerAttribute
+			tx.Where("name = ?", d.Name).Find(&values)
+			for _, v := range values {
+				nv, err := ps.Normalize(d, v.Value)
+				if err != nil {
+					return fmt.Errorf("peer %d: %v", v.PeerRowId, err)
+				}
+				if nv != v.Value {
+					if err = tx.Model(v).Update("value", nv).Error; err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return tx.Model(d).Select("title", "type").Updates(d).Error
+	})
+}
+
+// DefinitionDelete 删除属性定义及所有设备上的值
+func (ps *PeerAttributeService) DefinitionDelete(d *model.PeerAttributeDefinition) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("name = ?", d.Name).Delete(&model.PeerAttribute{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(d).Error
+	})
+}
+
+// Normalize 按属性类型校验并规范化值
+func (ps *PeerAttributeService) Normalize(d *model.PeerAttributeDefinition, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch d.Type {
+	case model.PeerAttributeNumber:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return "", fmt.Errorf("%s must be a number", d.Name)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case model.PeerAttributeBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%s must be true or false", d.Name)
+		}
+		return strconv.FormatBool(b), nil
+	case model.PeerAttributeDate:
+		t, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return "", fmt.Errorf("%s must be a date like 2006-01-02", d.Name)
+		}
+		return t.Format(time.DateOnly), nil
+	case model.PeerAttributeEmail:
+		a, err := mail.ParseAddress(value)
+		if err != nil || a.Address != value {
+			return "", fmt.Errorf("%s must be an email address", d.Name)
+		}
+		return strings.ToLower(a.Address), nil
+	}
+	return value, nil
+}
+
+// Get 设备的标签和属性
+func (ps *PeerAttributeService) Get(rowId uint) *model.PeerAttributeSet {
+	p := &model.Peer{RowId: rowId}
+	ps.Fill([]*model.Peer{p})
+	set := &model.PeerAttributeSet{Labels: p.Labels, Attributes: p.Attributes}
+	if set.Labels == nil {
+		set.Labels = []string{}
+	}
+	if set.Attributes == nil {
+		set.Attributes = map[string]string{}
+	}
+	return set
+}
+
+// Fill 为设备列表填充标签和属性
+func (ps *PeerAttributeService) Fill(peers []*model.Peer) {
+	if len(peers) == 0 {
+		return
+	}
+	byRowId := make(map[uint]*model.Peer, len(peers))
+	ids := make([]uint, 0, len(peers))
+	for _, p := range peers {
+		byRowId[p.RowId] = p
+		ids = append(ids, p.RowId)
+	}
+	var labels []*model.PeerLabel
+	DB.Where("peer_row_id in ?", ids).Order("name asc").Find(&labels)
+	for _, l := range labels {
+		p := byRowId[l.PeerRowId]
+		p.Labels = append(p.Labels, l.Name)
+	}
+	var attrs []*model.PeerAttribute
+	DB.Where("peer_row_id in ?", ids).Find(&attrs)
+	for _, a := range attrs {
+		p := byRowId[a.PeerRowId]
+		if p.Attributes == nil {
+			p.Attributes = map[string]string{}
+		}
+		p.Attributes[a.Name] = a.Value
+	}
+}
+
+// SetLabels 替换设备的标签
+func (ps *PeerAttributeService) SetLabels(rowId uint, labels []string) error {
+	labels = ps.cleanLabels(labels)
+	if len(labels) > peerLabelMax {
+		return fmt.Errorf("at most %d labels per peer", peerLabelMax)
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("peer_row_id = ?", rowId).Delete(&model.PeerLabel{}).Error; err != nil {
+			return err
+		}
+		for _, l := range labels {
+			if err := tx.Create(&model.PeerLabel{PeerRowId: rowId, Name: l}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// BatchLabels 批量为设备添加和移除标签
+func (ps *PeerAttributeService) BatchLabels(rowIds []uint, add, remove []string) error {
+	add = ps.cleanLabels(add)
+	remove = ps.cleanLabels(remove)
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if len(remove) > 0 {
+			if err := tx.Where("peer_row_id in ? and name in ?", rowIds, remove).Delete(&model.PeerLabel{}).Error; err != nil {
+				return err
+			}
+		}
+		for _, id := range rowIds {
+			var exist []string
+			tx.Model(&model.PeerLabel{}).Where("peer_row_id = ?", id).Pluck("name", &exist)
+			for _, l := range add {
+				if slices.Contains(exist, l) {
+					continue
+				}
+				if len(exist) >= peerLabelMax {
+					return fmt.Errorf("peer %d: at most %d labels per peer", id, peerLabelMax)
+				}
+				if err := tx.Create(&model.PeerLabel{PeerRowId: id, Name: l}).Error; err != nil {
+					return err
+				}
+				exist = append(exist, l)
+			}
+		}
+		return nil
+	})
+}
+
+// SetAttributes 设置设备的属性, 值为空时删除该属性, 未出现的属性保持不变
+func (ps *PeerAttributeService) SetAttributes(rowId uint, attrs map[string]string) error {
+	values := make(map[string]string, len(attrs))
+	for name, v := range attrs {
+		d := ps.DefinitionByName(name)
+		if d.Id == 0 {
+			return fmt.Errorf("attribute %s is not defined", name)
+		}
+		if strings.TrimSpace(v) == "" {
+			values[name] = ""
+			continue
+		}
+		nv, err := ps.Normalize(d, v)
+		if err != nil {
+			return err
+		}
+		values[name] = nv
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for name, v := range values {
+			if err := tx.Where("peer_row_id = ? and name = ?", rowId, name).Delete(&model.PeerAttribute{}).Error; err != nil {
+				return err
+			}
+			if v == "" {
+				continue
+			}
+			if err := tx.Create(&model.PeerAttribute{PeerRowId: rowId, Name: name, Value: v}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteByPeers 删除设备时清理标签和属性
+func (ps *PeerAttributeService) DeleteByPeers(rowIds []uint) error {
+	if err := DB.Where("peer_row_id in ?", rowIds).Delete(&model.PeerLabel{}).Error; err != nil {
+		return err
+	}
+	return DB.Where("peer_row_id in ?", rowIds).Delete(&model.PeerAttribute{}).Error
+}
+
+// AllLabels 所有在用的标签及设备数
+func (ps *PeerAttributeService) AllLabels() []*model.PeerInventoryCount {
+	var res []*model.PeerInventoryCount
+	DB.Model(&model.PeerLabel{}).Select("name as value, count(*) as count").Group("name").Order("name asc").Scan(&res)
+	return res
+}
+
+// ParseFilters 解析 name=value 或 name~value 形式的属性筛选条件
+func (ps *PeerAttributeService) ParseFilters(strs []string) ([]*model.PeerAttributeFilter, error) {
+	var filters []*model.PeerAttributeFilter
+	for _, s := range strs {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		i := strings.IndexAny(s, model.PeerAttributeOpEq+model.PeerAttributeOpContains)
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid attribute filter %q, use name=value or name~value", s)
+		}
+		f := &model.PeerAttributeFilter{
+			Name:  strings.TrimSpace(s[:i]),
+			Op:    s[i : i+1],
+			Value: strings.TrimSpace(s[i+1:]),
+		}
+		if !peerAttributeName.MatchString(f.Name) {
+			return nil, fmt.Errorf("invalid attribute name %q", f.Name)
+		}
+		// 等值筛选按属性类型规范化, 如邮箱大小写
+		if d := ps.DefinitionByName(f.Name); d.Id > 0 && f.Op == model.PeerAttributeOpEq && f.Value != "" {
+			if nv, err := ps.Normalize(d, f.Value); err == nil {
+				f.Value = nv
+			}
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// Where 按标签和属性筛选设备, 所有条件都须满足
+func (ps *PeerAttributeService) Where(tx *gorm.DB, labels []string, filters []*model.PeerAttributeFilter) {
+	for _, l := range ps.cleanLabels(labels) {
+		tx.Where("row_id in (?)", DB.Model(&model.PeerLabel{}).Select("peer_row_id").Where("name = ?", l))
+	}
+	for _, f := range filters {
+		sub := DB.Model(&model.PeerAttribute{}).Select("peer_row_id").Where("name = ?", f.Name)
+		if f.Op == model.PeerAttributeOpContains {
+			sub = sub.Where("value like ?", "%"+f.Value+"%")
+		} else {
+			sub = sub.Where("value = ?", f.Value)
+		}
+		tx.Where("row_id in (?)", sub)
+	}
+}
+
+// Match 判断已填充标签和属性的设备是否满足条件, 用于规则匹配
+func (ps *PeerAttributeService) Match(p *model.Peer, labels []string, filters []*model.PeerAttributeFilter) bool {
+	for _, l := range ps.cleanLabels(labels) {
+		if !slices.Contains(p.Labels, l) {
+			return false
+		}
+	}
+	for _, f := range filters {
+		v, ok := p.Attributes[f.Name]
+		if !ok {
+			return false
+		}
+		if f.Op == model.PeerAttributeOpContains {
+			if !strings.Contains(strings.ToLower(v), strings.ToLower(f.Value)) {
+				return false
+			}
+		} else if v != f.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// cleanLabels 去除空白和重复的标签并排序
+func (ps *PeerAttributeService) cleanLabels(labels []string) []string {
+	res := make([]string, 0, len(labels))
+	for _, l := range labels {
+		l = strings.TrimSpace(l)
+		if l != "" && len(l) <= 64 && !slices.Contains(res, l) {
+			res = append(res, l)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (ps *PeerAttributeService) checkDefinition(d *model.PeerAttributeDefinition) error {
+	if !peerAttributeName.MatchString(d.Name) {
+		return fmt.Errorf("attribute name must match %s", peerAttributeName.String())
+	}
+	if d.Type == "" {
+		d.Type = model.PeerAttributeString
+	}
+	if !slices.Contains(model.PeerAttributeTypes, d.Type) {
+		return fmt.Errorf("unknown attribute type %s", d.Type)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+func TestPeerAttributeNormalize(t *testing.T) {
+	ps := &PeerAttributeService{}
+	cases := []struct {
+		typ, in, want string
+		ok            bool
+	}{
+		{model.PeerAttributeString, " Room 4 ", "Room 4", true},
+		{model.PeerAttributeNumber, "042.50", "42.5", true},
+		{model.PeerAttributeNumber, "abc", "", false},
+		{model.PeerAttributeBool, "1", "true", true},
+		{model.PeerAttributeBool, "yes", "", false},
+		{model.PeerAttributeDate, "2024-02-29", "2024-02-29", true},
+		{model.PeerAttributeDate, "2023-02-29", "", false},
+		{model.PeerAttributeEmail, "Owner@Example.com", "owner@example.com", true},
+		{model.PeerAttributeEmail, "Owner <owner@example.com>", "", false},
+	}
+	for _, c := range cases {
+		got, err := ps.Normalize(&model.PeerAttributeDefinition{Name: "a", Type: c.typ}, c.in)
+		if (err == nil) != c.ok || got != c.want {
+			t.Errorf("Normalize(%s, %q) = %q, %v", c.typ, c.in, got, err)
+		}
+	}
+}
+
+func TestPeerAttributeMatch(t *testing.T) {
+	ps := &PeerAttributeService{}
+	p := &model.Peer{
+		Labels:     []string{"kiosk", "lobby"},
+		Attributes: map[string]string{"location": "Berlin HQ", "asset_no": "A-100"},
+	}
+	eq := &model.PeerAttributeFilter{Name: "asset_no", Op: model.PeerAttributeOpEq, Value: "A-100"}
+	like := &model.PeerAttributeFilter{Name: "location", Op: model.PeerAttributeOpContains, Value: "berlin"}
+	if !ps.Match(p, []string{" kiosk", ""}, []*model.PeerAttributeFilter{eq, like}) {
+		t.Fatal("expected match")
+	}
+	if ps.Match(p, []string{"kiosk", "server"}, nil) {
+		t.Fatal("all labels must be present")
+	}
+	missing := &model.PeerAttributeFilter{Name: "cost_center", Op: model.PeerAttributeOpEq, Value: ""}
+	if ps.Match(p, nil, []*model.PeerAttributeFilter{missing}) {
+		t.Fatal("missing attribute must not match")
+	}
+}
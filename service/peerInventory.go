@@ -0,0 +1,97 @@
+package service
+
+import (
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"gorm.io/gorm"
+)
+
+type PeerInventoryService struct {
+}
+
+// Diff 比较新旧 SysInfo, 新值为空时不会覆盖旧值, 也不算变更
+func (is *PeerInventoryService) Diff(old, cur *model.Peer, now int64) []*model.PeerInventoryChange {
+	var changes []*model.PeerInventoryChange
+	for _, field := range model.PeerInventoryFields {
+		ov, nv := old.InventoryValue(field), cur.InventoryValue(field)
+		if nv == "" || ov == nv {
+			continue
+		}
+		changes = append(changes, &model.PeerInventoryChange{
+			PeerRowId: old.RowId,
+			PeerId:    old.Id,
+			Uuid:      old.Uuid,
+			Field:     field,
+			OldValue:  ov,
+			NewValue:  nv,
+			ChangedAt: now,
+		})
+	}
+	return changes
+}
+
+// Record 记录一次 SysInfo 上报带来的变更
+func (is *PeerInventoryService) Record(old, cur *model.Peer) error {
+	changes := is.Diff(old, cur, time.Now().Unix())
+	if len(changes) == 0 {
+		return nil
+	}
+	return DB.Create(&changes).Error
+}
+
+// History 变更历史
+func (is *PeerInventoryService) History(page, pageSize uint, where func(tx *gorm.DB)) (res *model.PeerInventoryChangeList) {
+	res = &model.PeerInventoryChangeList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := DB.Model(&model.PeerInventoryChange{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Order("id desc").Find(&res.PeerInventoryChanges)
+	return
+}
+
+// ChangedPeers 在时间范围内字段发生过变更的设备
+func (is *PeerInventoryService) ChangedPeers(field string, since, until int64, page, pageSize uint, where func(tx *gorm.DB)) *model.PeerList {
+	sub := DB.Model(&model.PeerInventoryChange{}).Select("peer_row_id").Where("changed_at >= ?", since)
+	if field != "" {
+		sub.Where("field = ?", field)
+	}
+	if until > 0 {
+		sub.Where("changed_at <= ?", until)
+	}
+	return AllService.PeerService.List(page, pageSize, func(tx *gorm.DB) {
+		tx.Where("row_id in (?)", sub)
+		if where != nil {
+			where(tx)
+		}
+	})
+}
+
+// Summary 按字段当前值统计设备数, 如各客户端版本的设备数量
+func (is *PeerInventoryService) Summary(field string) []*model.PeerInventoryCount {
+	res := make([]*model.PeerInventoryCount, 0)
+	if !is.IsField(field) {
+		return res
+	}
+	DB.Model(&model.Peer{}).
+		Select(field + " as value, count(*) as count").
+		Group(field).
+		Order("count desc").
+		Scan(&res)
+	return res
+}
+
+// IsField 是否为记录历史的字段
+func (is *PeerInventoryService) IsField(field string) bool {
+	for _, f := range model.PeerInventoryFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
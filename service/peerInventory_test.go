@@ -0,0 +1,33 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+func TestPeerInventoryDiff(t *testing.T) {
+	is := &PeerInventoryService{}
+	old := &model.Peer{RowId: 3, Id: "123", Hostname: "pc-1", Os: "Windows 10", Version: "1.2.3", Cpu: "i5"}
+	cur := &model.Peer{Hostname: "pc-2", Os: "Windows 11", Version: "1.2.3", Cpu: ""}
+	changes := is.Diff(old, cur, 100)
+	if len(changes) != 2 {
+		t.Fatalf("expected 2 changes, got %d", len(changes))
+	}
+	got := map[string]*model.PeerInventoryChange{}
+	for _, c := range changes {
+		got[c.Field] = c
+		if c.PeerRowId != 3 || c.PeerId != "123" || c.ChangedAt != 100 {
+			t.Fatalf("unexpected change %+v", c)
+		}
+	}
+	if c := got[model.PeerInventoryOs]; c == nil || c.OldValue != "Windows 10" || c.NewValue != "Windows 11" {
+		t.Fatalf("unexpected os change %+v", c)
+	}
+	if got[model.PeerInventoryHostname] == nil {
+		t.Fatal("hostname change missing")
+	}
+	if got[model.PeerInventoryCpu] != nil {
+		t.Fatal("empty value must not be recorded as a change")
+	}
+}
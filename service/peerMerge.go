@@ -0,0 +1,383 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/model/custom_types"
+	"gorm.io/gorm"
+)
+
+// PeerMergeService 重复设备检测和合并
+// 合并把地址簿条目、审计记录、分享链接和用户绑定迁到保留的设备, 删除重复设备并记录旧 id 的别名
+type PeerMergeService struct {
+}
+
+var ErrPeerMergeSelf = errors.New("PeerMergeSelf")
+
+// Duplicates 疑似重复的设备, 按分数从高到低; minScore 为 0 时使用默认值
+// 候选只在主机名或 uuid 相同的记录之间产生, 地址簿中引用了不存在的 id 的条目也作为候选
+func (s *PeerMergeService) Duplicates(minScore int) []*model.PeerDuplicate {
+	if minScore <= 0 {
+		minScore = model.PeerDuplicateMinScore
+	}
+	var peers []*model.Peer
+	DB.Select("row_id", "id", "cpu", "hostname", "memory", "os", "username", "uuid", "user_id", "last_online_time", "last_online_ip").
+		Order("row_id asc").Find(&peers)
+	return findPeerDuplicates(peers, s.orphans(), minScore)
+}
+
+// orphans 地址簿中引用的既不是设备也不是别名的 id, 用条目上的主机名和用户名参与评分
+func (s *PeerMergeService) orphans() []*model.Peer {
+	var abs []*model.AddressBook
+	DB.Model(&model.AddressBook{}).Select("id", "hostname", "username").
+		Where("id not in (?)", DB.Model(&model.Peer{}).Select("id")).
+		Where("id not in (?)", DB.Model(&model.PeerAlias{}).Select("alias_id")).
+		Where("hostname <> ''").
+		Order("row_id asc").Find(&abs)
+	seen := make(map[string]bool)
+	var res []*model.Peer
+	for _, ab := range abs {
+		if seen[ab.Id] {
+			continue
+		}
+		seen[ab.Id] = true
+		res = append(res, &model.Peer{Id: ab.Id, Hostname: ab.Hostname, Username: ab.Username})
+	}
+	return res
+}
+
+// Aliases 别名列表
+func (s *PeerMergeService) Aliases(page, pageSize uint, where func(tx *gorm.DB)) (res *model.PeerAliasList) {
+	res = &model.PeerAliasList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := DB.Model(&model.PeerAlias{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Preload("Peer").Order("id desc").Find(&res.PeerAliases)
+	return
+}
+
+func (s *PeerMergeService) AliasInfoById(id uint) *model.PeerAlias {
+	a := &model.PeerAlias{}
+	DB.Where("id = ?", id).First(a)
+	return a
+}
+
+// DeleteAlias 删除别名, 旧 id 不再解析到保留的设备
+func (s *PeerMergeService) DeleteAlias(a *model.PeerAlias) error {
+	return DB.Delete(a).Error
+}
+
+// Merge 把 ids 对应的设备和引用合并到 survivor
+// 同一个 id 可能有多条设备记录, 都会删除; id 与 survivor 相同时只合并同 id 的其它记录
+func (s *PeerMergeService) Merge(survivor *model.Peer, ids []string, actor *AddressBookActor) (*model.PeerMergeResult, error) {
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	res := &model.PeerMergeResult{}
+	var uuids []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for _, id := range ids {
+			if id == "" {
+				continue
+			}
+			var dups []*model.Peer
+			tx.Where("id = ? and row_id <> ?", id, survivor.RowId).Order("row_id asc").Find(&dups)
+			if id == survivor.Id && len(dups) == 0 {
+				return ErrPeerMergeSelf
+			}
+			if err := s.mergePeers(tx, survivor, dups, res); err != nil {
+				return err
+			}
+			for _, d := range dups {
+				if d.Uuid != "" && d.Uuid != survivor.Uuid {
+					uuids = append(uuids, d.Uuid)
+				}
+			}
+			if id == survivor.Id {
+				continue
+			}
+			if err := s.mergeId(tx, survivor, id, dups, actor, res); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// 重复设备的登录令牌失效, 与删除设备一致
+	if len(uuids) > 0 {
+		_ = AllService.UserService.FlushTokenByUuids(uuids)
+	}
+	return res, nil
+}
+
+// mergePeers 继承用户绑定、设备组和备注, 迁移标签、自定义属性、硬件历史和指向重复设备的别名, 然后删除重复设备
+func (s *PeerMergeService) mergePeers(tx *gorm.DB, survivor *model.Peer, dups []*model.Peer, res *model.PeerMergeResult) error {
+	if len(dups) == 0 {
+		return nil
+	}
+	rowIds := make([]uint, 0, len(dups))
+	updates := make(map[string]interface{})
+	for _, d := range dups {
+		rowIds = append(rowIds, d.RowId)
+		if survivor.UserId == 0 && d.UserId > 0 {
+			survivor.UserId = d.UserId
+			updates["user_id"] = d.UserId
+			res.UserBound = true
+		}
+		if survivor.GroupId == 0 && d.GroupId > 0 {
+			survivor.GroupId, survivor.GroupRuleId = d.GroupId, d.GroupRuleId
+			updates["group_id"], updates["group_rule_id"] = d.GroupId, d.GroupRuleId
+		}
+		if survivor.Alias == "" && d.Alias != "" {
+			survivor.Alias = d.Alias
+			updates["alias"] = d.Alias
+		}
+	}
+	if len(updates) > 0 {
+		if err := tx.Model(&model.Peer{}).Where("row_id = ?", survivor.RowId).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+	//保留设备上已有的标签和属性优先
+	var labels []*model.PeerLabel
+	tx.Where("peer_row_id in ?", rowIds).Find(&labels)
+	for _, l := range labels {
+		var n int64
+		tx.Model(&model.PeerLabel{}).Where("peer_row_id = ? and name = ?", survivor.RowId, l.Name).Count(&n)
+		if n == 0 {
+			if err := tx.Model(l).Update("peer_row_id", survivor.RowId).Error; err != nil {
+				return err
+			}
+		}
+	}
+	var attrs []*model.PeerAttribute
+	tx.Where("peer_row_id in ?", rowIds).Find(&attrs)
+	for _, a := range attrs {
+		var n int64
+		tx.Model(&model.PeerAttribute{}).Where("peer_row_id = ? and name = ?", survivor.RowId, a.Name).Count(&n)
+		if n == 0 {
+			if err := tx.Model(a).Update("peer_row_id", survivor.RowId).Error; err != nil {
+				return err
+			}
+		}
+	}
+	if err := tx.Where("peer_row_id in ?", rowIds).Delete(&model.PeerLabel{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("peer_row_id in ?", rowIds).Delete(&model.PeerAttribute{}).Error; err != nil {
+		return err
+	}
+	r := tx.Model(&model.PeerInventoryChange{}).Where("peer_row_id in ?", rowIds).
+		Updates(map[string]interface{}{"peer_row_id": survivor.RowId, "peer_id": survivor.Id})
+	if r.Error != nil {
+		return r.Error
+	}
+	res.Inventory += r.RowsAffected
+	if err := tx.Model(&model.PeerAlias{}).Where("peer_row_id in ?", rowIds).Update("peer_row_id", survivor.RowId).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("row_id in ?", rowIds).Delete(&model.Peer{}).Error; err != nil {
+		return err
+	}
+	res.Peers += len(dups)
+	return nil
+}
+
+// mergeId 把引用旧 id 的地址簿条目、审计记录和分享链接改为保留设备的 id, 并记录别名
+func (s *PeerMergeService) mergeId(tx *gorm.DB, survivor *model.Peer, id string, dups []*model.Peer, actor *AddressBookActor, res *model.PeerMergeResult) error {
+	n, err := s.mergeAddressBooks(tx, survivor.Id, id, actor)
+	if err != nil {
+		return err
+	}
+	res.AddressBooks += n
+	audits := []struct {
+		model  interface{}
+		column string
+	}{
+		{&model.AuditConn{}, "peer_id"},
+		{&model.AuditConn{}, "from_peer"},
+		{&model.AuditFile{}, "peer_id"},
+		{&model.AuditFile{}, "from_peer"},
+		{&model.LoginLog{}, "device_id"},
+	}
+	for _, a := range audits {
+		r := tx.Model(a.model).Where(a.column+" = ?", id).Update(a.column, survivor.Id)
+		if r.Error != nil {
+			return r.Error
+		}
+		res.Audits += r.RowsAffected
+	}
+	r := tx.Model(&model.ShareRecord{}).Where("peer_id = ?", id).Update("peer_id", survivor.Id)
+	if r.Error != nil {
+		return r.Error
+	}
+	res.ShareRecords += r.RowsAffected
+	if err := tx.Model(&model.ShareRecordUse{}).Where("peer_id = ?", id).Update("peer_id", survivor.Id).Error; err != nil {
+		return err
+	}
+	alias := &model.PeerAlias{AliasId: id, PeerRowId: survivor.RowId, OperatorId: actor.UserId}
+	if len(dups) > 0 {
+		alias.Uuid = dups[0].Uuid
+		alias.Hostname = dups[0].Hostname
+	}
+	ex := &model.PeerAlias{}
+	tx.Where("alias_id = ?", id).First(ex)
+	if ex.Id > 0 {
+		alias.Id = ex.Id
+		if err := tx.Model(ex).Select("peer_row_id", "uuid", "hostname", "operator_id").Updates(alias).Error; err != nil {
+			return err
+		}
+	} else if err := tx.Create(alias).Error; err != nil {
+		return err
+	}
+	res.Aliases++
+	return nil
+}
+
+// mergeAddressBooks 地址簿中引用旧 id 的条目改为新 id, 同一地址簿已有新 id 时合并标签后删除旧条目
+func (s *PeerMergeService) mergeAddressBooks(tx *gorm.DB, to, from string, actor *AddressBookActor) (int, error) {
+	var abs []*model.AddressBook
+	tx.Where("id = ?", from).Order("row_id asc").Find(&abs)
+	for _, ab := range abs {
+		before := *ab
+		ex := &model.AddressBook{}
+		tx.Where("user_id = ? and collection_id = ? and id = ?", ab.UserId, ab.CollectionId, to).First(ex)
+		if ex.RowId == 0 {
+			ab.Id = to
+			if err := tx.Model(&model.AddressBook{}).Where("row_id = ?", ab.RowId).Update("id", to).Error; err != nil {
+				return 0, err
+			}
+			if err := AllService.AddressBookChangeService.RecordPeer(tx, actor, &before, ab); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		var a, b []string
+		_ = json.Unmarshal(ex.Tags, &a)
+		_ = json.Unmarshal(ab.Tags, &b)
+		if tags, changed := unionTags(a, b); changed {
+			exBefore := *ex
+			tv, _ := json.Marshal(tags)
+			ex.Tags = custom_types.AutoJson(tv)
+			if err := tx.Model(&model.AddressBook{}).Where("row_id = ?", ex.RowId).Update("tags", ex.Tags).Error; err != nil {
+				return 0, err
+			}
+			if err := AllService.AddressBookChangeService.RecordPeer(tx, actor, &exBefore, ex); err != nil {
+				return 0, err
+			}
+		}
+		if err := tx.Delete(ab).Error; err != nil {
+			return 0, err
+		}
+		if err := AllService.AddressBookChangeService.RecordPeer(tx, actor, &before, nil); err != nil {
+			return 0, err
+		}
+	}
+	return len(abs), nil
+}
+
+// unionTags 在 a 后追加 b 中没有的标签
+func unionTags(a, b []string) ([]string, bool) {
+	res := slices.Clone(a)
+	changed := false
+	for _, t := range b {
+		if !slices.Contains(res, t) {
+			res = append(res, t)
+			changed = true
+		}
+	}
+	return res, changed
+}
+
+// scorePeerDuplicate 两条记录相同的字段和分数, 主机名不区分大小写, 空值不算相同
+func scorePeerDuplicate(a, b *model.Peer) (int, []string) {
+	score := 0
+	var reasons []string
+	same := func(x, y string) bool {
+		x, y = strings.TrimSpace(x), strings.TrimSpace(y)
+		return x != "" && strings.EqualFold(x, y)
+	}
+	fields := []struct {
+		reason string
+		score  int
+		a, b   string
+	}{
+		{model.PeerDuplicateReasonUuid, model.PeerDuplicateScoreUuid, a.Uuid, b.Uuid},
+		{model.PeerDuplicateReasonHostname, model.PeerDuplicateScoreHostname, a.Hostname, b.Hostname},
+		{model.PeerDuplicateReasonUsername, model.PeerDuplicateScoreUsername, a.Username, b.Username},
+		{model.PeerDuplicateReasonIp, model.PeerDuplicateScoreIp, a.LastOnlineIp, b.LastOnlineIp},
+		{model.PeerDuplicateReasonCpu, model.PeerDuplicateScoreCpu, a.Cpu, b.Cpu},
+		{model.PeerDuplicateReasonMemory, model.PeerDuplicateScoreMemory, a.Memory, b.Memory},
+	}
+	for _, f := range fields {
+		if same(f.a, f.b) {
+			score += f.score
+			reasons = append(reasons, f.reason)
+		}
+	}
+	return score, reasons
+}
+
+// findPeerDuplicates 按主机名和 uuid 分组后两两评分, orphans 只与设备比较
+// 建议保留最近在线的设备, 同时在线时保留较新的记录
+func findPeerDuplicates(peers, orphans []*model.Peer, minScore int) []*model.PeerDuplicate {
+	groups := make(map[string][]*model.Peer)
+	for _, p := range peers {
+		if h := strings.ToLower(strings.TrimSpace(p.Hostname)); h != "" {
+			groups["h:"+h] = append(groups["h:"+h], p)
+		}
+		if p.Uuid != "" {
+			groups["u:"+p.Uuid] = append(groups["u:"+p.Uuid], p)
+		}
+	}
+	type pair struct{ a, b *model.Peer }
+	seen := make(map[pair]bool)
+	var res []*model.PeerDuplicate
+	add := func(keep, dup *model.Peer) {
+		if seen[pair{keep, dup}] {
+			return
+		}
+		seen[pair{keep, dup}] = true
+		score, reasons := scorePeerDuplicate(keep, dup)
+		if score >= minScore {
+			res = append(res, &model.PeerDuplicate{Peer: keep, Duplicate: dup, Score: score, Reasons: reasons})
+		}
+	}
+	for _, g := range groups {
+		for i := 0; i < len(g); i++ {
+			for j := i + 1; j < len(g); j++ {
+				keep, dup := g[i], g[j]
+				if dup.LastOnlineTime > keep.LastOnlineTime || (dup.LastOnlineTime == keep.LastOnlineTime && dup.RowId > keep.RowId) {
+					keep, dup = dup, keep
+				}
+				add(keep, dup)
+			}
+		}
+	}
+	for _, o := range orphans {
+		for _, p := range groups["h:"+strings.ToLower(strings.TrimSpace(o.Hostname))] {
+			add(p, o)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		if res[i].Peer.RowId != res[j].Peer.RowId {
+			return res[i].Peer.RowId < res[j].Peer.RowId
+		}
+		return res[i].Duplicate.Id < res[j].Duplicate.Id
+	})
+	return res
+}
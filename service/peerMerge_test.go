@@ -0,0 +1,55 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+func TestScorePeerDuplicate(t *testing.T) {
+	a := &model.Peer{Hostname: "Office-PC", Uuid: "u1", Username: "bob", LastOnlineIp: "10.0.0.2", Cpu: "i5", Memory: "16GB"}
+	b := &model.Peer{Hostname: "office-pc ", Uuid: "u2", Username: "bob", Cpu: "i5"}
+	score, reasons := scorePeerDuplicate(a, b)
+	if score != 50 || !reflect.DeepEqual(reasons, []string{"hostname", "username", "cpu"}) {
+		t.Fatalf("got %d %v", score, reasons)
+	}
+	// 空值不算相同
+	if score, _ := scorePeerDuplicate(&model.Peer{}, &model.Peer{}); score != 0 {
+		t.Fatalf("empty peers scored %d", score)
+	}
+}
+
+func TestFindPeerDuplicates(t *testing.T) {
+	peers := []*model.Peer{
+		{RowId: 1, Id: "111", Hostname: "lab", Username: "root", Cpu: "x", LastOnlineTime: 100},
+		{RowId: 2, Id: "222", Hostname: "LAB", Username: "root", Cpu: "x", LastOnlineTime: 200},
+		{RowId: 3, Id: "333", Hostname: "lab", LastOnlineTime: 300},
+		{RowId: 4, Id: "444", Hostname: "other", Uuid: "same", LastOnlineTime: 10},
+		{RowId: 5, Id: "555", Hostname: "another", Uuid: "same", LastOnlineTime: 10},
+	}
+	orphans := []*model.Peer{{Id: "999", Hostname: "Lab", Username: "root"}}
+	res := findPeerDuplicates(peers, orphans, model.PeerDuplicateMinScore)
+	var got [][2]string
+	for _, d := range res {
+		got = append(got, [2]string{d.Peer.Id, d.Duplicate.Id})
+	}
+	// 保留最近在线的设备, 同时在线时保留较新的记录; 只有主机名相同的不够分数
+	want := [][2]string{{"222", "111"}, {"555", "444"}, {"111", "999"}, {"222", "999"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if res[0].Score != 50 || res[1].Score != 50 || res[2].Score != 40 {
+		t.Fatalf("scores %d %d %d", res[0].Score, res[1].Score, res[2].Score)
+	}
+}
+
+func TestUnionTags(t *testing.T) {
+	res, changed := unionTags([]string{"a", "b"}, []string{"b", "c"})
+	if !changed || !reflect.DeepEqual(res, []string{"a", "b", "c"}) {
+		t.Fatalf("got %v %v", res, changed)
+	}
+	if _, changed := unionTags([]string{"a"}, nil); changed {
+		t.Fatal("unexpected change")
+	}
+}
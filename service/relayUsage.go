@@ -0,0 +1,228 @@
+package service
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"gorm.io/gorm"
+)
+
+// RelayUsageService 定时采集 hbbr 的 usage 和带宽配置, 保存为时间序列
+type RelayUsageService struct {
+}
+
+var relayUsageNumber = regexp.MustCompile(`[-+]?\d+(\.\d+)?`)
+
+// relayUsageLatest 各端点最近一次采集到的连接明细, 只保存在内存
+var relayUsageLatest = struct {
+	sync.RWMutex
+	conns map[uint][]*model.RelayUsageConn
+}{conns: make(map[uint][]*model.RelayUsageConn)}
+
+func (s *RelayUsageService) List(page, pageSize uint, where func(tx *gorm.DB)) (res *model.RelayUsageList) {
+	res = &model.RelayUsageList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := DB.Model(&model.RelayUsage{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Find(&res.RelayUsages)
+	return
+}
+
+// Collect 采集全部 hbbr 端点一次
+func (s *RelayUsageService) Collect() []*model.RelayUsage {
+	eps := AllService.ServerCmdService.Endpoints(model.ServerCmdTargetRelayServer)
+	now := time.Now().Unix()
+	list := make([]*model.RelayUsage, len(eps))
+	var wg sync.WaitGroup
+	for i, e := range eps {
+		wg.Add(1)
+		go func(i int, e *model.ServerCmdEndpoint) {
+			defer wg.Done()
+			list[i] = s.collectEndpoint(e, now)
+		}(i, e)
+	}
+	wg.Wait()
+	for _, u := range list {
+		DB.Create(u)
+	}
+	return list
+}
+
+func (s *RelayUsageService) collectEndpoint(e *model.ServerCmdEndpoint, now int64) *model.RelayUsage {
+	u := &model.RelayUsage{EndpointId: e.Id, EndpointName: e.Name, CollectedAt: now}
+	res, err := AllService.ServerCmdService.SendCmdToEndpoint(e, "usage", "")
+	if err != nil {
+		u.Error = err.Error()
+		return u
+	}
+	conns := ParseRelayUsage(res)
+	for _, c := range conns {
+		u.Connections++
+		u.TotalMb += c.TotalMb
+		u.SpeedKbps += c.SpeedKbps
+		if c.HighestKbps > u.HighestKbps {
+			u.HighestKbps = c.HighestKbps
+		}
+	}
+	relayUsageLatest.Lock()
+	relayUsageLatest.conns[e.Id] = conns
+	relayUsageLatest.Unlock()
+
+	// 带宽类命令不带参数时返回当前值
+	u.TotalBandwidthMbps = s.queryNumber(e, "total-bandwidth")
+	u.SingleBandwidthMbps = s.queryNumber(e, "single-bandwidth")
+	u.LimitSpeedMbps = s.queryNumber(e, "limit-speed")
+	return u
+}
+
+func (s *RelayUsageService) queryNumber(e *model.ServerCmdEndpoint, cmd string) float64 {
+	res, err := AllService.ServerCmdService.SendCmdToEndpoint(e, cmd, "")
+	if err != nil {
+		return 0
+	}
+	return ParseRelayNumber(res)
+}
+
+// Latest 各端点最近一次的采样和连接明细
+func (s *RelayUsageService) Latest() []map[string]interface{} {
+	res := make([]map[string]interface{}, 0)
+	for _, e := range AllService.ServerCmdService.Endpoints(model.ServerCmdTargetRelayServer) {
+		u := &model.RelayUsage{}
+		DB.Where("endpoint_id = ?", e.Id).Order("collected_at desc").First(u)
+		relayUsageLatest.RLock()
+		conns := relayUsageLatest.conns[e.Id]
+		relayUsageLatest.RUnlock()
+		if conns == nil {
+			conns = []*model.RelayUsageConn{}
+		}
+		res = append(res, map[string]interface{}{
+			"endpoint_id":   e.Id,
+			"endpoint_name": e.Name,
+			"addr":          AllService.ServerCmdService.EndpointAddr(e),
+			"usage":         u,
+			"conns":         conns,
+		})
+	}
+	return res
+}
+
+// Series 时间序列, 按 step 秒分桶, 桶内每个端点取最后一次采样后再汇总
+// endpointId 为 nil 时汇总全部端点
+func (s *RelayUsageService) Series(endpointId *uint, since, until, step int64) []*model.RelayUsagePoint {
+	if step <= 0 {
+		step = 60
+	}
+	var rows []*model.RelayUsage
+	tx := DB.Model(&model.RelayUsage{}).Where("collected_at >= ? and collected_at <= ? and error = ''", since, until)
+	if endpointId != nil {
+		tx.Where("endpoint_id = ?", *endpointId)
+	}
+	tx.Order("collected_at asc").Find(&rows)
+
+	type key struct {
+		bucket     int64
+		endpointId uint
+	}
+	last := make(map[key]*model.RelayUsage)
+	buckets := make([]int64, 0)
+	seen := make(map[int64]bool)
+	for _, r := range rows {
+		b := r.CollectedAt - r.CollectedAt%step
+		last[key{b, r.EndpointId}] = r
+		if !seen[b] {
+			seen[b] = true
+			buckets = append(buckets, b)
+		}
+	}
+	points := make(map[int64]*model.RelayUsagePoint, len(buckets))
+	for k, r := range last {
+		p := points[k.bucket]
+		if p == nil {
+			p = &model.RelayUsagePoint{Time: k.bucket}
+			points[k.bucket] = p
+		}
+		p.Connections += r.Connections
+		p.TotalMb += r.TotalMb
+		p.SpeedKbps += r.SpeedKbps
+		if r.HighestKbps > p.HighestKbps {
+			p.HighestKbps = r.HighestKbps
+		}
+	}
+	res := make([]*model.RelayUsagePoint, 0, len(buckets))
+	for _, b := range buckets {
+		res = append(res, points[b])
+	}
+	return res
+}
+
+// Purge 清理早于 before 的采样
+func (s *RelayUsageService) Purge(before int64) {
+	DB.Where("collected_at < ?", before).Delete(&model.RelayUsage{})
+}
+
+// StartCollect 定时采集, retention 大于0时同时清理过期采样
+func (s *RelayUsageService) StartCollect(interval, retention time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.Collect()
+			if retention > 0 {
+				s.Purge(time.Now().Add(-retention).Unix())
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// ParseRelayUsage 解析 hbbr usage 命令的输出, 每行格式为
+// <ip:port>: <elapsed>s <total>MB <highest>kb/s <avg>kb/s <speed>kb/s
+func ParseRelayUsage(out string) []*model.RelayUsageConn {
+	conns := make([]*model.RelayUsageConn, 0)
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		i := strings.LastIndex(line, ": ")
+		if i <= 0 {
+			continue
+		}
+		fs := strings.Fields(line[i+2:])
+		if len(fs) < 5 {
+			continue
+		}
+		c := &model.RelayUsageConn{Ip: line[:i]}
+		c.ElapsedSec, _ = strconv.ParseInt(strings.TrimSuffix(fs[0], "s"), 10, 64)
+		c.TotalMb, _ = strconv.ParseFloat(strings.TrimSuffix(fs[1], "MB"), 64)
+		c.HighestKbps = parseKbps(fs[2])
+		c.AvgKbps = parseKbps(fs[3])
+		c.SpeedKbps = parseKbps(fs[4])
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+func parseKbps(s string) int64 {
+	v, _ := strconv.ParseFloat(strings.TrimSuffix(s, "kb/s"), 64)
+	return int64(v)
+}
+
+// ParseRelayNumber 取命令输出中的第一个数值, 如 "1024Mb/s"
+func ParseRelayNumber(out string) float64 {
+	m := relayUsageNumber.FindString(out)
+	if m == "" {
+		return 0
+	}
+	v, _ := strconv.ParseFloat(m, 64)
+	return v
+}
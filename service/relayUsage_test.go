@@ -0,0 +1,33 @@
+package service
+
+import "testing"
+
+func TestParseRelayUsage(t *testing.T) {
+	out := "1.2.3.4:5678: 120s 1.50MB 2048kb/s 100kb/s 50kb/s\n" +
+		"[::1]:21117: 10s 0.25MB 300kb/s 20kb/s 10kb/s\n" +
+		"garbage line\n"
+	conns := ParseRelayUsage(out)
+	if len(conns) != 2 {
+		t.Fatalf("expected 2 conns, got %d", len(conns))
+	}
+	c := conns[0]
+	if c.Ip != "1.2.3.4:5678" || c.ElapsedSec != 120 || c.TotalMb != 1.5 || c.HighestKbps != 2048 || c.AvgKbps != 100 || c.SpeedKbps != 50 {
+		t.Fatalf("unexpected conn %+v", c)
+	}
+	if conns[1].Ip != "[::1]:21117" || conns[1].SpeedKbps != 10 {
+		t.Fatalf("unexpected conn %+v", conns[1])
+	}
+}
+
+func TestParseRelayNumber(t *testing.T) {
+	cases := map[string]float64{
+		"1024Mb/s\n": 1024,
+		"12.5Mb/s":   12.5,
+		"":           0,
+	}
+	for in, want := range cases {
+		if got := ParseRelayNumber(in); got != want {
+			t.Fatalf("ParseRelayNumber(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
@@ -1,10 +1,18 @@
 package service
 
 import (
+	"errors"
 	"fmt"
+	"github.com/lejianwen/rustdesk-api/v2/lib/cmdproxy"
 	"github.com/lejianwen/rustdesk-api/v2/model"
 	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type ServerCmdService struct{}
@@ -39,6 +47,17 @@ func (is *ServerCmdService) Create(u *model.ServerCmd) error {
 	return res
 }
 
+// TargetPort 根据命令目标取本机命令端口
+func (is *ServerCmdService) TargetPort(target string) int {
+	switch target {
+	case model.ServerCmdTargetIdServer:
+		return Config.Admin.IdServerPort - 1
+	case model.ServerCmdTargetRelayServer:
+		return Config.Admin.RelayServerPort
+	}
+	return 0
+}
+
 // SendCmd 发送命令
 func (is *ServerCmdService) SendCmd(port int, cmd string, arg string) (string, error) {
 	//组装命令
@@ -63,29 +82,163 @@ func (is *ServerCmdService) SendSocketCmd(ty string, port int, cmd string) (stri
 		tcp = "tcp"
 		addr = "127.0.0.1"
 	}
-	conn, err := net.Dial(tcp, fmt.Sprintf("%s:%v", addr, port))
+	return is.sendTcpCmd(tcp, fmt.Sprintf("%s:%v", addr, port), cmd)
+}
+
+func (is *ServerCmdService) sendTcpCmd(network string, addr string, cmd string) (string, error) {
+	conn, err := net.DialTimeout(network, addr, 3*time.Second)
 	if err != nil {
-		Logger.Debugf("%s connect to id server failed: %v", ty, err)
+		Logger.Debugf("%s connect to %s failed: %v", network, addr, err)
 		return "", err
 	}
 	defer conn.Close()
 	//发送命令
 	_, err = conn.Write([]byte(cmd))
 	if err != nil {
-		Logger.Debugf("%s send cmd failed: %v", ty, err)
+		Logger.Debugf("%s send cmd failed: %v", addr, err)
 		return "", err
 	}
 	time.Sleep(100 * time.Millisecond)
-	//读取返回
+	//读取返回, 列表类命令的返回可能超过一个缓冲区
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	res := make([]byte, 0, 1024)
 	buf := make([]byte, 1024)
-	n, err := conn.Read(buf)
-	if err != nil && err.Error() != "EOF" {
-		Logger.Debugf("%s read response failed: %v", ty, err)
+	for {
+		n, err := conn.Read(buf)
+		res = append(res, buf[:n]...)
+		if err == nil {
+			continue
+		}
+		if err.Error() == "EOF" || (errors.Is(err, os.ErrDeadlineExceeded) && len(res) > 0) {
+			break
+		}
+		Logger.Debugf("%s read response failed: %v", addr, err)
 		return "", err
 	}
-	return string(buf[:n]), nil
+	return string(res), nil
 }
 
 func (is *ServerCmdService) Update(f *model.ServerCmd) error {
 	return DB.Model(f).Updates(f).Error
 }
+
+// EndpointList 命令端点列表
+func (is *ServerCmdService) EndpointList(page, pageSize uint, where func(tx *gorm.DB)) (res *model.ServerCmdEndpointList) {
+	res = &model.ServerCmdEndpointList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := DB.Model(&model.ServerCmdEndpoint{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Find(&res.ServerCmdEndpoints)
+	for _, e := range res.ServerCmdEndpoints {
+		e.SecretSet = e.Secret != ""
+	}
+	return
+}
+
+func (is *ServerCmdService) EndpointInfo(id uint) *model.ServerCmdEndpoint {
+	e := &model.ServerCmdEndpoint{}
+	DB.Where("id = ?", id).First(e)
+	e.SecretSet = e.Secret != ""
+	return e
+}
+
+func (is *ServerCmdService) EndpointCreate(e *model.ServerCmdEndpoint) error {
+	return DB.Create(e).Error
+}
+
+// EndpointUpdate 更新端点, updateSecret 为 false 时保留原 Secret
+func (is *ServerCmdService) EndpointUpdate(e *model.ServerCmdEndpoint, updateSecret bool) error {
+	cols := []interface{}{"host", "port", "target", "server_config_id", "status"}
+	if updateSecret {
+		cols = append(cols, "secret")
+	}
+	return DB.Model(e).Select("name", cols...).Updates(e).Error
+}
+
+func (is *ServerCmdService) EndpointDelete(e *model.ServerCmdEndpoint) error {
+	return DB.Delete(e).Error
+}
+
+// LocalEndpoint 本机端点, 未配置任何端点时使用
+func (is *ServerCmdService) LocalEndpoint(target string) *model.ServerCmdEndpoint {
+	return &model.ServerCmdEndpoint{Name: "local", Target: target, Status: model.COMMON_STATUS_ENABLE}
+}
+
+// Endpoints 取某类服务的全部启用端点, 没有配置时返回本机端点
+func (is *ServerCmdService) Endpoints(target string) []*model.ServerCmdEndpoint {
+	var list []*model.ServerCmdEndpoint
+	DB.Where("target = ? and status = ?", target, model.COMMON_STATUS_ENABLE).Order("id asc").Find(&list)
+	if len(list) == 0 {
+		list = append(list, is.LocalEndpoint(target))
+	}
+	return list
+}
+
+// EndpointPort 端点端口, 端口为0时本机使用配置中的命令端口, 远程主机使用命令代理的默认端口
+// hbbs/hbbr 的命令端口只接受本机连接, 远程主机直接连接命令端口不会成功
+func (is *ServerCmdService) EndpointPort(e *model.ServerCmdEndpoint) int {
+	if e.Port > 0 {
+		return e.Port
+	}
+	if isLoopbackHost(e.Host) {
+		return is.TargetPort(e.Target)
+	}
+	return cmdproxy.DefaultPort
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "" || strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// EndpointAddr 端点地址
+func (is *ServerCmdService) EndpointAddr(e *model.ServerCmdEndpoint) string {
+	port := is.EndpointPort(e)
+	if e.Host == "" {
+		return "local:" + strconv.Itoa(port)
+	}
+	return net.JoinHostPort(e.Host, strconv.Itoa(port))
+}
+
+// SendCmdToEndpoint 向指定端点发送命令
+func (is *ServerCmdService) SendCmdToEndpoint(e *model.ServerCmdEndpoint, cmd string, arg string) (string, error) {
+	port := is.EndpointPort(e)
+	if e.Host == "" {
+		return is.SendCmd(port, cmd, arg)
+	}
+	line := cmd + " " + arg
+	if e.Secret != "" {
+		line = e.Secret + "\n" + line
+	}
+	return is.sendTcpCmd("tcp", net.JoinHostPort(e.Host, strconv.Itoa(port)), line)
+}
+
+// SendCmdToAll 并发向某类服务的全部端点发送命令, 按端点汇总结果
+func (is *ServerCmdService) SendCmdToAll(target string, cmd string, arg string) []*model.ServerCmdResult {
+	eps := is.Endpoints(target)
+	results := make([]*model.ServerCmdResult, len(eps))
+	var wg sync.WaitGroup
+	for i, e := range eps {
+		wg.Add(1)
+		go func(i int, e *model.ServerCmdEndpoint) {
+			defer wg.Done()
+			r := &model.ServerCmdResult{EndpointId: e.Id, Name: e.Name, Addr: is.EndpointAddr(e)}
+			res, err := is.SendCmdToEndpoint(e, cmd, arg)
+			if err != nil {
+				r.Error = err.Error()
+			}
+			r.Result = res
+			results[i] = r
+		}(i, e)
+	}
+	wg.Wait()
+	return results
+}
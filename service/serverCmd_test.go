@@ -0,0 +1,31 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/lejianwen/rustdesk-api/v2/lib/cmdproxy"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+func TestServerCmdEndpointPort(t *testing.T) {
+	s := &ServerCmdService{}
+	cases := []struct {
+		e    model.ServerCmdEndpoint
+		port int
+	}{
+		{model.ServerCmdEndpoint{Host: "10.0.0.2", Target: model.ServerCmdTargetRelayServer}, cmdproxy.DefaultPort},
+		{model.ServerCmdEndpoint{Host: "relay.example.com", Target: model.ServerCmdTargetIdServer}, cmdproxy.DefaultPort},
+		{model.ServerCmdEndpoint{Host: "10.0.0.2", Port: 21121, Target: model.ServerCmdTargetIdServer}, 21121},
+		{model.ServerCmdEndpoint{Port: 30000, Target: model.ServerCmdTargetRelayServer}, 30000},
+	}
+	for i, c := range cases {
+		if p := s.EndpointPort(&c.e); p != c.port {
+			t.Fatalf("case %d: got %d want %d", i, p, c.port)
+		}
+	}
+	for _, h := range []string{"", "localhost", "127.0.0.1", "::1"} {
+		if !isLoopbackHost(h) {
+			t.Fatalf("%q should be loopback", h)
+		}
+	}
+}
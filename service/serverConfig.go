@@ -4,75 +4,267 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/lejianwen/rustdesk-api/v2/global"
 	"github.com/lejianwen/rustdesk-api/v2/http/request/admin"
+	"github.com/lejianwen/rustdesk-api/v2/lib/configcode"
 	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/utils"
 	"gorm.io/gorm"
 )
 
 type ServerConfigService struct{}
 
-// GetConfigByCode 根据配置码获取配置
-func (s *ServerConfigService) GetConfigByCode(code string) (*model.ClientServerConfig, error) {
+// ConfigCodeRedeemer 兑换配置码的设备和用户
+type ConfigCodeRedeemer struct {
+	ClientIP  string
+	UserAgent string
+	DeviceId  string
+	Uuid      string
+	User      *model.User // 未登录时为 nil
+}
+
+// CheckConfigCode 校验配置码是否可由 r 兑换, 不产生使用记录
+func (s *ServerConfigService) CheckConfigCode(code string, r *ConfigCodeRedeemer) (*model.ConfigCode, error) {
+	code, err := s.resolveCode(code)
+	if err != nil {
+		return nil, err
+	}
 	// 查找配置码
 	var configCode model.ConfigCode
-	result := global.DB.Preload("ServerConfig").Where("code = ? AND status = ?", code, model.COMMON_STATUS_ENABLE).First(&configCode)
+	result := global.DB.Preload("ServerConfig").Where("code = ?", code).First(&configCode)
 	if result.Error != nil {
 		return nil, fmt.Errorf("invalid config code")
 	}
+	if err = s.checkValid(&configCode); err != nil {
+		return nil, err
+	}
 
-	// 检查过期时间
-	if configCode.ExpiresAt != nil && time.Now().After(*configCode.ExpiresAt) {
-		return nil, fmt.Errorf("config code has expired")
+	// 检查服务器配置是否启用
+	if configCode.ServerConfig == nil || configCode.ServerConfig.Status != model.COMMON_STATUS_ENABLE || !*configCode.ServerConfig.IsEnabled {
+		return nil, fmt.Errorf("server config is disabled")
+	}
+	if configCode.ServerConfig.IsUnhealthy() {
+		return nil, fmt.Errorf("server is currently unavailable")
+	}
+	if configCode.ServerConfig, err = s.pinConfig(configCode.ServerConfig, configCode.RevisionId); err != nil {
+		return nil, err
+	}
+
+	if err = s.checkBinding(&configCode, r); err != nil {
+		return nil, err
 	}
 
-	// 检查使用次数限制
-	if configCode.MaxUsage != nil && configCode.UsageCount >= *configCode.MaxUsage {
+	// 同一设备重复兑换绑定设备的配置码不占用次数
+	if configCode.MaxUsage != nil && configCode.UsageCount >= *configCode.MaxUsage && !s.isBoundDevice(&configCode, r) {
 		return nil, fmt.Errorf("config code usage limit exceeded")
 	}
+	return &configCode, nil
+}
 
-	// 检查服务器配置是否启用
-	if configCode.ServerConfig == nil || configCode.ServerConfig.Status != model.COMMON_STATUS_ENABLE || !*configCode.ServerConfig.IsEnabled {
-		return nil, fmt.Errorf("server config is disabled")
+// checkValid 检查配置码是否已撤销、停用或过期
+func (s *ServerConfigService) checkValid(cc *model.ConfigCode) error {
+	if cc.IsRevoked() {
+		return fmt.Errorf("config code has been revoked")
+	}
+	if cc.Status != model.COMMON_STATUS_ENABLE {
+		return fmt.Errorf("invalid config code")
+	}
+	// 检查过期时间
+	if cc.ExpiresAt != nil && time.Now().After(*cc.ExpiresAt) {
+		return fmt.Errorf("config code has expired")
+	}
+	return nil
+}
+
+// GetConfigByCode 兑换配置码, 支持短配置码和签名配置码
+func (s *ServerConfigService) GetConfigByCode(code string, r *ConfigCodeRedeemer) (*model.ClientServerConfig, error) {
+	configCode, err := s.CheckConfigCode(code, r)
+	if err != nil {
+		return nil, err
 	}
 
-	// 更新使用次数
-	global.DB.Model(&configCode).Update("usage_count", configCode.UsageCount+1)
+	if configCode.BindDevice && configCode.BoundUuid == "" {
+		// 并发兑换时只有一台设备能绑定成功
+		res := global.DB.Model(&model.ConfigCode{}).
+			Where("id = ? AND bound_uuid = ''", configCode.Id).
+			Update("bound_uuid", r.Uuid)
+		if res.RowsAffected == 0 {
+			return nil, fmt.Errorf("config code is bound to another device")
+		}
+		configCode.BoundUuid = r.Uuid
+	}
 
-	// 返回客户端配置
-	clientConfig := &model.ClientServerConfig{
-		Name:        configCode.ServerConfig.Name,
-		Region:      configCode.ServerConfig.Region,
-		IdServer:    configCode.ServerConfig.IdServer,
-		RelayServer: configCode.ServerConfig.RelayServer,
-		ApiServer:   configCode.ServerConfig.ApiServer,
-		Key:         configCode.ServerConfig.Key,
+	if !s.isBoundDevice(configCode, r) || configCode.UsageCount == 0 {
+		// 更新使用次数
+		global.DB.Model(configCode).Update("usage_count", gorm.Expr("usage_count + 1"))
+	}
+	if err = s.RecordConfigCodeUsage(configCode, r); err != nil {
+		global.Logger.Warn("record config code usage failed: ", err)
 	}
 
-	return clientConfig, nil
+	// 返回客户端配置
+	return configCode.ServerConfig.ToClientConfig(), nil
 }
 
-// RecordConfigCodeUsage 记录配置码使用
-func (s *ServerConfigService) RecordConfigCodeUsage(code, clientIP, userAgent string) error {
-	// 查找配置码ID
-	var configCode model.ConfigCode
-	if err := global.DB.Select("id").Where("code = ?", code).First(&configCode).Error; err != nil {
-		return err
+// checkBinding 检查设备、用户和来源网段限制
+func (s *ServerConfigService) checkBinding(cc *model.ConfigCode, r *ConfigCodeRedeemer) error {
+	if cc.BindDevice {
+		if r.Uuid == "" {
+			return fmt.Errorf("device uuid is required")
+		}
+		if cc.BoundUuid != "" && cc.BoundUuid != r.Uuid {
+			return fmt.Errorf("config code is bound to another device")
+		}
+	}
+	if cc.RequireUser() {
+		if r.User == nil || r.User.Id == 0 {
+			return fmt.Errorf("login required")
+		}
+		allowed := false
+		for _, id := range cc.AllowedUserIds {
+			if id == r.User.Id {
+				allowed = true
+			}
+		}
+		for _, id := range cc.AllowedGroupIds {
+			if id == r.User.GroupId {
+				allowed = true
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("config code is not available for this user")
+		}
+	}
+	if len(cc.AllowedCidrs) > 0 {
+		allowed := false
+		for _, cidr := range cc.AllowedCidrs {
+			if utils.CidrContains(cidr, r.ClientIP) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("config code is not available from this network")
+		}
+	}
+	return nil
+}
+
+// normalizeBinding 规范化来源网段
+func (s *ServerConfigService) normalizeBinding(b *model.ConfigCodeBinding) error {
+	for i, cidr := range b.AllowedCidrs {
+		n, err := utils.NormalizeCidr(cidr)
+		if err != nil {
+			return err
+		}
+		b.AllowedCidrs[i] = n
 	}
+	return nil
+}
+
+func (s *ServerConfigService) isBoundDevice(cc *model.ConfigCode, r *ConfigCodeRedeemer) bool {
+	return cc.BindDevice && cc.BoundUuid != "" && cc.BoundUuid == r.Uuid
+}
+
+// InfoByCode 根据短配置码查询
+func (s *ServerConfigService) InfoByCode(code string) *model.ConfigCode {
+	cc := &model.ConfigCode{}
+	global.DB.Where("code = ?", code).First(cc)
+	return cc
+}
 
+// RecordConfigCodeUsage 记录配置码使用
+func (s *ServerConfigService) RecordConfigCodeUsage(cc *model.ConfigCode, r *ConfigCodeRedeemer) error {
 	// 创建使用记录
 	usage := model.ConfigCodeUsage{
-		ConfigCodeId: configCode.Id,
-		ClientIP:     clientIP,
-		UserAgent:    userAgent,
+		ConfigCodeId: cc.Id,
+		ClientIP:     r.ClientIP,
+		UserAgent:    r.UserAgent,
+		DeviceId:     r.DeviceId,
+		Uuid:         r.Uuid,
 		UsedAt:       time.Now(),
 	}
+	if r.User != nil {
+		usage.UserId = r.User.Id
+	}
 
 	return global.DB.Create(&usage).Error
 }
 
+// ConfigCodeUsageList 配置码使用记录
+func (s *ServerConfigService) ConfigCodeUsageList(query *admin.ConfigCodeUsageQuery) *model.ConfigCodeUsageList {
+	res := &model.ConfigCodeUsageList{}
+	res.Page = query.Page
+	res.PageSize = query.PageSize
+	tx := global.DB.Model(&model.ConfigCodeUsage{})
+	if query.ConfigCodeId > 0 {
+		tx.Where("config_code_id = ?", query.ConfigCodeId)
+	}
+	if query.DeviceId != "" {
+		tx.Where("device_id = ?", query.DeviceId)
+	}
+	if query.Uuid != "" {
+		tx.Where("uuid = ?", query.Uuid)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(uint(query.Page), uint(query.PageSize)))
+	tx.Order("id desc").Find(&res.ConfigCodeUsages)
+	return res
+}
+
+// RevokeConfigCode 吊销配置码, 已兑换的设备在下次心跳时收到通知
+func (s *ServerConfigService) RevokeConfigCode(id uint, reason string) error {
+	res := global.DB.Model(&model.ConfigCode{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":        model.COMMON_STATUS_DISABLED,
+		"revoked_at":    time.Now().Unix(),
+		"revoke_reason": reason,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return fmt.Errorf("config code not found")
+	}
+	return nil
+}
+
+// TakeRevokeNotices 取出设备尚未通知的吊销, 取出后标记为已通知
+func (s *ServerConfigService) TakeRevokeNotices(uuid string) []*model.ConfigCodeRevokeNotice {
+	if uuid == "" {
+		return nil
+	}
+	var usages []*model.ConfigCodeUsage
+	global.DB.Preload("ConfigCode").
+		Where("uuid = ? AND revoke_notified_at = 0", uuid).
+		Where("config_code_id IN (?)", global.DB.Model(&model.ConfigCode{}).Select("id").Where("revoked_at > 0")).
+		Find(&usages)
+	if len(usages) == 0 {
+		return nil
+	}
+	notices := make([]*model.ConfigCodeRevokeNotice, 0, len(usages))
+	seen := make(map[uint]bool)
+	ids := make([]uint, 0, len(usages))
+	for _, u := range usages {
+		ids = append(ids, u.Id)
+		if u.ConfigCode == nil || seen[u.ConfigCodeId] {
+			continue
+		}
+		seen[u.ConfigCodeId] = true
+		notices = append(notices, &model.ConfigCodeRevokeNotice{
+			Code:           u.ConfigCode.Code,
+			ServerConfigId: u.ConfigCode.ServerConfigId,
+			RevokedAt:      u.ConfigCode.RevokedAt,
+			Reason:         u.ConfigCode.RevokeReason,
+		})
+	}
+	global.DB.Model(&model.ConfigCodeUsage{}).Where("id IN (?)", ids).Update("revoke_notified_at", time.Now().Unix())
+	return notices
+}
+
 // List 获取服务器配置列表
 func (s *ServerConfigService) List(query *admin.ServerConfigListQuery) (*model.ServerConfigList, error) {
 	var configs []*model.ServerConfig
@@ -119,7 +311,7 @@ func (s *ServerConfigService) List(query *admin.ServerConfigListQuery) (*model.S
 }
 
 // Create 创建服务器配置
-func (s *ServerConfigService) Create(form *admin.ServerConfigForm) (*model.ServerConfig, error) {
+func (s *ServerConfigService) Create(form *admin.ServerConfigForm, authorId uint) (*model.ServerConfig, error) {
 	config := &model.ServerConfig{
 		Name:        form.Name,
 		Description: form.Description,
@@ -129,6 +321,7 @@ func (s *ServerConfigService) Create(form *admin.ServerConfigForm) (*model.Serve
 		ApiServer:   form.ApiServer,
 		Key:         form.Key,
 		Priority:    form.Priority,
+		GroupIds:    form.GroupIds,
 		Status:      model.COMMON_STATUS_ENABLE,
 	}
 
@@ -154,12 +347,17 @@ func (s *ServerConfigService) Create(form *admin.ServerConfigForm) (*model.Serve
 		}
 	}
 
-	err := global.DB.Create(config).Error
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(config).Error; err != nil {
+			return err
+		}
+		return s.saveRevision(tx, config, model.ServerConfigRevisionCreate, authorId)
+	})
 	return config, err
 }
 
-// Update 更新服务器配置
-func (s *ServerConfigService) Update(id uint, form *admin.ServerConfigForm) (*model.ServerConfig, error) {
+// Update 更新服务器配置, 每次更新生成一条修订
+func (s *ServerConfigService) Update(id uint, form *admin.ServerConfigForm, authorId uint) (*model.ServerConfig, error) {
 	var config model.ServerConfig
 	if err := global.DB.First(&config, id).Error; err != nil {
 		return nil, err
@@ -179,8 +377,11 @@ func (s *ServerConfigService) Update(id uint, form *admin.ServerConfigForm) (*mo
 	config.IdServer = form.IdServer
 	config.RelayServer = form.RelayServer
 	config.ApiServer = form.ApiServer
-	config.Key = form.Key
+	if config.Key != form.Key {
+		s.stageKey(&config, form.Key, time.Duration(form.KeyGracePeriod)*time.Second)
+	}
 	config.Priority = form.Priority
+	config.GroupIds = form.GroupIds
 
 	if form.IsEnabled != nil {
 		config.IsEnabled = form.IsEnabled
@@ -189,7 +390,15 @@ func (s *ServerConfigService) Update(id uint, form *admin.ServerConfigForm) (*mo
 		config.IsDefault = form.IsDefault
 	}
 
-	err := global.DB.Save(&config).Error
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := s.seedRevision(tx, config.Id); err != nil {
+			return err
+		}
+		if err := tx.Save(&config).Error; err != nil {
+			return err
+		}
+		return s.saveRevision(tx, &config, model.ServerConfigRevisionUpdate, authorId)
+	})
 	return &config, err
 }
 
@@ -248,19 +457,34 @@ func (s *ServerConfigService) GenerateConfigCode(form *admin.ConfigCodeForm, cre
 		return nil, fmt.Errorf("server config not found")
 	}
 
+	if err := s.normalizeBinding(&form.ConfigCodeBinding); err != nil {
+		return nil, err
+	}
+
 	// 生成唯一配置码
 	code, err := s.generateUniqueCode()
 	if err != nil {
 		return nil, err
 	}
 
+	// 校验固定的修订属于该配置
+	if _, err := s.pinConfig(&serverConfig, form.RevisionId); err != nil {
+		return nil, err
+	}
+
 	configCode := &model.ConfigCode{
-		Code:           code,
-		ServerConfigId: form.ServerConfigId,
-		ExpiresAt:      form.ExpiresAt,
-		MaxUsage:       form.MaxUsage,
-		CreatedBy:      createdBy,
-		Status:         model.COMMON_STATUS_ENABLE,
+		Code:              code,
+		ServerConfigId:    form.ServerConfigId,
+		ExpiresAt:         form.ExpiresAt,
+		MaxUsage:          form.MaxUsage,
+		CreatedBy:         createdBy,
+		Status:            model.COMMON_STATUS_ENABLE,
+		Audience:          form.Audience,
+		ConfigCodeBinding: form.ConfigCodeBinding,
+		RevisionId:        form.RevisionId,
+	}
+	if err = AllService.ConfigSigningService.Sign(configCode); err != nil {
+		return nil, err
 	}
 
 	err = global.DB.Create(configCode).Error
@@ -275,6 +499,15 @@ func (s *ServerConfigService) BatchGenerateConfigCode(form *admin.ConfigCodeBatc
 		return nil, fmt.Errorf("server config not found")
 	}
 
+	if err := s.normalizeBinding(&form.ConfigCodeBinding); err != nil {
+		return nil, err
+	}
+
+	// 校验固定的修订属于该配置
+	if _, err := s.pinConfig(&serverConfig, form.RevisionId); err != nil {
+		return nil, err
+	}
+
 	var codes []*model.ConfigCode
 	for i := 0; i < form.Count; i++ {
 		code, err := s.generateUniqueCode()
@@ -283,12 +516,18 @@ func (s *ServerConfigService) BatchGenerateConfigCode(form *admin.ConfigCodeBatc
 		}
 
 		configCode := &model.ConfigCode{
-			Code:           code,
-			ServerConfigId: form.ServerConfigId,
-			ExpiresAt:      form.ExpiresAt,
-			MaxUsage:       form.MaxUsage,
-			CreatedBy:      createdBy,
-			Status:         model.COMMON_STATUS_ENABLE,
+			Code:              code,
+			ServerConfigId:    form.ServerConfigId,
+			ExpiresAt:         form.ExpiresAt,
+			MaxUsage:          form.MaxUsage,
+			CreatedBy:         createdBy,
+			Status:            model.COMMON_STATUS_ENABLE,
+			Audience:          form.Audience,
+			ConfigCodeBinding: form.ConfigCodeBinding,
+			RevisionId:        form.RevisionId,
+		}
+		if err := AllService.ConfigSigningService.Sign(configCode); err != nil {
+			return nil, err
 		}
 
 		if err := global.DB.Create(configCode).Error; err != nil {
@@ -390,9 +629,108 @@ func (s *ServerConfigService) GetConfigCodeStats() (map[string]interface{}, erro
 	global.DB.Model(&model.ConfigCodeUsage{}).Where("DATE(used_at) = ?", today).Count(&todayUsage)
 	stats["today_usage"] = todayUsage
 
+	// 服务器健康状态
+	health := map[string]int64{
+		model.ServerHealthUnknown:   0,
+		model.ServerHealthHealthy:   0,
+		model.ServerHealthUnhealthy: 0,
+	}
+	var healthRows []struct {
+		HealthStatus string
+		Count        int64
+	}
+	global.DB.Model(&model.ServerConfig{}).Where("is_enabled = ?", true).
+		Select("health_status, COUNT(*) AS count").Group("health_status").Scan(&healthRows)
+	for _, r := range healthRows {
+		health[r.HealthStatus] = r.Count
+	}
+	stats["server_health"] = health
+
+	// 关联服务器不可用的活跃配置码
+	var unavailableCodes int64
+	global.DB.Model(&model.ConfigCode{}).Where(
+		"status = ? AND (expires_at IS NULL OR expires_at > ?) AND server_config_id IN (?)",
+		model.COMMON_STATUS_ENABLE, now,
+		global.DB.Model(&model.ServerConfig{}).Select("id").Where("health_status = ?", model.ServerHealthUnhealthy),
+	).Count(&unavailableCodes)
+	stats["unavailable_codes"] = unavailableCodes
+
 	return stats, nil
 }
 
+// SelectForClient 按地域、用户组和优先级为客户端排序可用的服务器配置, 第一个为最佳
+// 排序依次为: 地域匹配, 限定用户组匹配, 默认配置, 优先级, ID
+func (s *ServerConfigService) SelectForClient(ip string, user *model.User) (region string, list []*model.ServerConfig) {
+	region = AllService.GeoService.Region(ip)
+	var configs []*model.ServerConfig
+	global.DB.Where("is_enabled = ? AND status = ?", true, model.COMMON_STATUS_ENABLE).Find(&configs)
+	var groupId uint
+	if user != nil {
+		groupId = user.GroupId
+	}
+	type ranked struct {
+		config      *model.ServerConfig
+		regionMatch bool
+		groupMatch  bool
+	}
+	rs := make([]*ranked, 0, len(configs))
+	for _, c := range configs {
+		if c.IsUnhealthy() {
+			continue
+		}
+		r := &ranked{config: c, regionMatch: region != "" && strings.EqualFold(c.Region, region)}
+		if len(c.GroupIds) > 0 {
+			for _, id := range c.GroupIds {
+				if groupId > 0 && id == groupId {
+					r.groupMatch = true
+				}
+			}
+			// 限定了用户组的配置只给组内用户
+			if !r.groupMatch {
+				continue
+			}
+		}
+		rs = append(rs, r)
+	}
+	sort.SliceStable(rs, func(i, j int) bool {
+		a, b := rs[i], rs[j]
+		if a.regionMatch != b.regionMatch {
+			return a.regionMatch
+		}
+		if a.groupMatch != b.groupMatch {
+			return a.groupMatch
+		}
+		ad := a.config.IsDefault != nil && *a.config.IsDefault
+		bd := b.config.IsDefault != nil && *b.config.IsDefault
+		if ad != bd {
+			return ad
+		}
+		if a.config.Priority != b.config.Priority {
+			return a.config.Priority > b.config.Priority
+		}
+		return a.config.Id < b.config.Id
+	})
+	list = make([]*model.ServerConfig, 0, len(rs))
+	for _, r := range rs {
+		list = append(list, r.config)
+	}
+	return
+}
+
+// ClientConfigFor 客户端的最佳配置, 没有可用的服务器配置时使用配置文件中的 rustdesk 配置
+func (s *ServerConfigService) ClientConfigFor(ip string, user *model.User) *model.ClientServerConfig {
+	_, list := s.SelectForClient(ip, user)
+	if len(list) > 0 {
+		return list[0].ToClientConfig()
+	}
+	return &model.ClientServerConfig{
+		IdServer:    global.Config.Rustdesk.IdServer,
+		RelayServer: global.Config.Rustdesk.RelayServer,
+		ApiServer:   global.Config.Rustdesk.ApiServer,
+		Key:         global.Config.Rustdesk.Key,
+	}
+}
+
 // 辅助方法
 
 // unsetAllDefault 取消所有默认配置
@@ -411,6 +749,18 @@ func (s *ServerConfigService) unsetAllDefaultWithTx(tx *gorm.DB) error {
 		Update("is_default", &isDefault).Error
 }
 
+// resolveCode 签名配置码校验签名后取出对应的短配置码
+func (s *ServerConfigService) resolveCode(code string) (string, error) {
+	if !configcode.IsSigned(code) {
+		return code, nil
+	}
+	claims, err := AllService.ConfigSigningService.Verify(code, "")
+	if err != nil {
+		return "", err
+	}
+	return claims.Jti, nil
+}
+
 // generateUniqueCode 生成唯一配置码
 func (s *ServerConfigService) generateUniqueCode() (string, error) {
 	for i := 0; i < 10; i++ { // 最多尝试10次
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"gorm.io/gorm"
+)
+
+// Revisions 服务器配置的修订历史
+func (s *ServerConfigService) Revisions(serverConfigId uint, page, pageSize uint) *model.ServerConfigRevisionList {
+	res := &model.ServerConfigRevisionList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := global.DB.Model(&model.ServerConfigRevision{}).Where("server_config_id = ?", serverConfigId)
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Order("revision desc").Find(&res.ServerConfigRevisions)
+	for _, r := range res.ServerConfigRevisions {
+		r.KeyFingerprint = model.KeyFingerprint(r.Key)
+	}
+	return res
+}
+
+// RevisionInfo 按ID查询修订
+func (s *ServerConfigService) RevisionInfo(id uint) *model.ServerConfigRevision {
+	r := &model.ServerConfigRevision{}
+	global.DB.Where("id = ?", id).First(r)
+	r.KeyFingerprint = model.KeyFingerprint(r.Key)
+	return r
+}
+
+// Rollback 回滚到指定修订, 回滚本身也生成一条新修订
+// 修订密钥与当前不同时按轮换处理, grace 内客户端配置同时下发新旧密钥
+func (s *ServerConfigService) Rollback(serverConfigId uint, revision int, grace time.Duration, authorId uint) (*model.ServerConfig, error) {
+	var config model.ServerConfig
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&config, serverConfigId).Error; err != nil {
+			return err
+		}
+		target := &model.ServerConfigRevision{}
+		tx.Where("server_config_id = ? AND revision = ?", serverConfigId, revision).First(target)
+		if target.Id == 0 {
+			return fmt.Errorf("revision not found")
+		}
+		target.ApplyTo(&config)
+		if target.Key != config.Key {
+			s.stageKey(&config, target.Key, grace)
+		}
+		if err := tx.Save(&config).Error; err != nil {
+			return err
+		}
+		return s.saveRevision(tx, &config, model.ServerConfigRevisionRollback, authorId)
+	})
+	return &config, err
+}
+
+// RotateKey 分阶段轮换密钥, grace 内客户端配置同时下发新旧密钥
+func (s *ServerConfigService) RotateKey(serverConfigId uint, key string, grace time.Duration, authorId uint) (*model.ServerConfig, error) {
+	var config model.ServerConfig
+	err := global.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&config, serverConfigId).Error; err != nil {
+			return err
+		}
+		if config.Key == key {
+			return fmt.Errorf("key not changed")
+		}
+		if err := s.seedRevision(tx, config.Id); err != nil {
+			return err
+		}
+		s.stageKey(&config, key, grace)
+		if err := tx.Save(&config).Error; err != nil {
+			return err
+		}
+		return s.saveRevision(tx, &config, model.ServerConfigRevisionRotateKey, authorId)
+	})
+	return &config, err
+}
+
+// stageKey 更换密钥并保留旧密钥到宽限期结束
+func (s *ServerConfigService) stageKey(config *model.ServerConfig, key string, grace time.Duration) {
+	if grace > 0 && config.Key != "" {
+		config.PreviousKey = config.Key
+		config.PreviousKeyUntil = time.Now().Add(grace).Unix()
+	} else {
+		config.PreviousKey = ""
+		config.PreviousKeyUntil = 0
+	}
+	config.Key = key
+}
+
+// seedRevision 配置还没有任何修订时, 先把数据库中的原内容记为第一条修订, 以便回滚第一次修改
+func (s *ServerConfigService) seedRevision(tx *gorm.DB, serverConfigId uint) error {
+	var count int64
+	if err := tx.Model(&model.ServerConfigRevision{}).Where("server_config_id = ?", serverConfigId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	stored := model.ServerConfig{}
+	if err := tx.First(&stored, serverConfigId).Error; err != nil {
+		return err
+	}
+	return s.saveRevision(tx, &stored, model.ServerConfigRevisionBaseline, 0)
+}
+
+// saveRevision 为配置当前内容生成新修订
+func (s *ServerConfigService) saveRevision(tx *gorm.DB, config *model.ServerConfig, action string, authorId uint) error {
+	prev := &model.ServerConfigRevision{}
+	tx.Where("server_config_id = ?", config.Id).Order("revision desc").First(prev)
+	rev := model.NewServerConfigRevision(config)
+	rev.Action = action
+	rev.AuthorId = authorId
+	rev.Revision = prev.Revision + 1
+	if prev.Id > 0 {
+		rev.DiffFrom(prev)
+	} else {
+		rev.DiffFrom(nil)
+	}
+	if err := tx.Create(rev).Error; err != nil {
+		return err
+	}
+	config.Revision = rev.Revision
+	return tx.Model(&model.ServerConfig{}).Where("id = ?", config.Id).Update("revision", rev.Revision).Error
+}
+
+// pinConfig 配置码固定了修订时, 用修订内容替换当前配置
+func (s *ServerConfigService) pinConfig(config *model.ServerConfig, revisionId uint) (*model.ServerConfig, error) {
+	if revisionId == 0 {
+		return config, nil
+	}
+	rev := s.RevisionInfo(revisionId)
+	if rev.Id == 0 || rev.ServerConfigId != config.Id {
+		return nil, fmt.Errorf("revision not found")
+	}
+	pinned := *config
+	rev.ApplyTo(&pinned)
+	pinned.Key = rev.Key
+	pinned.PreviousKey = ""
+	pinned.PreviousKeyUntil = 0
+	return &pinned, nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+func TestConfigCodeCheckBinding(t *testing.T) {
+	s := &ServerConfigService{}
+	cc := &model.ConfigCode{ConfigCodeBinding: model.ConfigCodeBinding{
+		BindDevice:      true,
+		AllowedGroupIds: []uint{2},
+		AllowedCidrs:    []string{"10.0.0.0/8"},
+	}}
+	user := &model.User{GroupId: 2}
+	user.Id = 5
+	ok := &ConfigCodeRedeemer{ClientIP: "10.1.2.3", Uuid: "u1", User: user}
+	if err := s.checkBinding(cc, ok); err != nil {
+		t.Fatalf("expected allowed, got %v", err)
+	}
+	cases := map[string]*ConfigCodeRedeemer{
+		"no uuid":    {ClientIP: "10.1.2.3", User: user},
+		"no user":    {ClientIP: "10.1.2.3", Uuid: "u1"},
+		"wrong cidr": {ClientIP: "192.168.1.1", Uuid: "u1", User: user},
+	}
+	for name, r := range cases {
+		if err := s.checkBinding(cc, r); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+	cc.BoundUuid = "u1"
+	if err := s.checkBinding(cc, &ConfigCodeRedeemer{ClientIP: "10.1.2.3", Uuid: "u2", User: user}); err == nil {
+		t.Fatal("expected bound device error")
+	}
+}
+
+func TestServerConfigStageKey(t *testing.T) {
+	s := &ServerConfigService{}
+	sc := &model.ServerConfig{Key: "old"}
+	s.stageKey(sc, "new", time.Hour)
+	if sc.Key != "new" || sc.PreviousKey != "old" || sc.PreviousKeyUntil <= time.Now().Unix() {
+		t.Fatalf("unexpected staged key %+v", sc)
+	}
+	if cc := sc.ToClientConfig(); cc.PreviousKey != "old" {
+		t.Fatalf("previous key not advertised: %+v", cc)
+	}
+	s.stageKey(sc, "newer", 0)
+	if sc.PreviousKey != "" || sc.PreviousKeyUntil != 0 {
+		t.Fatalf("expected immediate replacement %+v", sc)
+	}
+
+	prev := model.NewServerConfigRevision(&model.ServerConfig{Key: "a", GroupIds: []uint{1}})
+	rev := model.NewServerConfigRevision(&model.ServerConfig{Key: "b", GroupIds: []uint{1}})
+	rev.DiffFrom(prev)
+	if len(rev.Diff) != 1 || rev.Diff["key"][1] != model.KeyFingerprint("b") || rev.Diff["key"][0] == "a" {
+		t.Fatalf("unexpected diff %v", rev.Diff)
+	}
+	// 回滚时密钥走 stageKey, ApplyTo 不覆盖密钥
+	sc = &model.ServerConfig{Key: "b"}
+	prev.ApplyTo(sc)
+	if sc.Key != "b" {
+		t.Fatalf("ApplyTo must not replace key, got %q", sc.Key)
+	}
+}
+
+func TestConfigCodeQrContent(t *testing.T) {
+	s := &ServerConfigService{}
+	cc := &model.ConfigCode{Code: "ABC", ServerConfig: &model.ServerConfig{IdServer: "id.example.com", Key: "k"}}
+	text, err := s.qrContent(cc, ConfigCodeQrConfig)
+	if err != nil || !strings.HasPrefix(text, "config=") {
+		t.Fatalf("unexpected content %q %v", text, err)
+	}
+	// 导入字符串为反转的 base64url JSON
+	r := []byte(strings.TrimPrefix(text, "config="))
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	raw, err := base64.URLEncoding.DecodeString(string(r))
+	if err != nil || !strings.Contains(string(raw), `"host":"id.example.com"`) {
+		t.Fatalf("bad import string %s %v", raw, err)
+	}
+
+	cc.BindDevice = true
+	if _, err := s.qrContent(cc, ConfigCodeQrConfig); err == nil {
+		t.Fatal("restricted code must not expose server config")
+	}
+	if text, _ := s.qrContent(cc, ConfigCodeQrCode); text != "ABC" {
+		t.Fatalf("unexpected code content %q", text)
+	}
+	cc.BindDevice = false
+	if text, _ := s.qrContent(cc, ""); text != "ABC" {
+		t.Fatalf("default content must be the code, got %q", text)
+	}
+}
+
+func TestConfigCodeCheckIssuable(t *testing.T) {
+	s := &ServerConfigService{}
+	max := 1
+	past := time.Now().Add(-time.Hour)
+	now := time.Now()
+	cases := map[string]*model.ConfigCode{
+		"revoked":   {Status: model.COMMON_STATUS_ENABLE, RevokedAt: now.Unix()},
+		"disabled":  {Status: model.COMMON_STATUS_DISABLED},
+		"expired":   {Status: model.COMMON_STATUS_ENABLE, ExpiresAt: &past},
+		"exhausted": {Status: model.COMMON_STATUS_ENABLE, MaxUsage: &max, UsageCount: 1},
+	}
+	for name, cc := range cases {
+		if err := s.checkIssuable(cc); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+	if err := s.checkIssuable(&model.ConfigCode{Status: model.COMMON_STATUS_ENABLE, MaxUsage: &max}); err != nil {
+		t.Fatalf("expected issuable, got %v", err)
+	}
+}
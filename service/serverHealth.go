@@ -0,0 +1,183 @@
+package service
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/global"
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"gorm.io/gorm"
+)
+
+// ServerHealthService 定时探测 ServerConfig 的 ID、中继和 API 端口
+// 连续失败达到阈值的配置标记为 unhealthy, 不参与客户端选择和配置码兑换
+type ServerHealthService struct {
+}
+
+const serverHealthDialTimeout = 3 * time.Second
+
+// History 探测历史
+func (s *ServerHealthService) History(page, pageSize uint, where func(tx *gorm.DB)) (res *model.ServerHealthCheckList) {
+	res = &model.ServerHealthCheckList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := global.DB.Model(&model.ServerHealthCheck{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Find(&res.ServerHealthChecks)
+	return
+}
+
+// CheckAll 探测全部启用的配置
+func (s *ServerHealthService) CheckAll() {
+	var configs []*model.ServerConfig
+	global.DB.Where("is_enabled = ? AND status = ?", true, model.COMMON_STATUS_ENABLE).Find(&configs)
+	var wg sync.WaitGroup
+	for _, sc := range configs {
+		wg.Add(1)
+		go func(sc *model.ServerConfig) {
+			defer wg.Done()
+			s.Check(sc)
+		}(sc)
+	}
+	wg.Wait()
+}
+
+// Check 探测单个配置并更新健康状态
+func (s *ServerHealthService) Check(sc *model.ServerConfig) []*model.ServerHealthCheck {
+	checks := s.probe(sc, time.Now().Unix())
+	for _, c := range checks {
+		global.DB.Create(c)
+	}
+	fails := 0
+	if !allOk(checks) {
+		fails = sc.HealthFails + 1
+	}
+	data := map[string]interface{}{
+		"health_status":     healthStatus(fails, global.Config.Admin.ServerHealthFailThreshold),
+		"health_fails":      fails,
+		"health_error":      firstError(checks),
+		"health_checked_at": time.Now().Unix(),
+	}
+	if len(checks) > 0 {
+		data["health_latency_ms"] = checks[0].LatencyMs
+	}
+	global.DB.Model(&model.ServerConfig{}).Where("id = ?", sc.Id).Updates(data)
+	return checks
+}
+
+// Purge 清理早于 before 的探测记录
+func (s *ServerHealthService) Purge(before int64) {
+	global.DB.Where("checked_at < ?", before).Delete(&model.ServerHealthCheck{})
+}
+
+// StartProbe 定时探测, retention 大于0时同时清理过期记录
+func (s *ServerHealthService) StartProbe(interval, retention time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.CheckAll()
+			if retention > 0 {
+				s.Purge(time.Now().Add(-retention).Unix())
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// probe 探测配置中的各个端口, 不写库
+func (s *ServerHealthService) probe(sc *model.ServerConfig, now int64) []*model.ServerHealthCheck {
+	targets := []struct {
+		target string
+		addr   string
+	}{
+		{model.ServerHealthTargetId, hostPort(sc.IdServer, 21116)},
+		{model.ServerHealthTargetRelay, hostPort(sc.RelayServer, 21117)},
+		{model.ServerHealthTargetApi, apiHostPort(sc.ApiServer)},
+	}
+	checks := make([]*model.ServerHealthCheck, 0, len(targets))
+	for _, t := range targets {
+		if t.addr == "" {
+			continue
+		}
+		c := &model.ServerHealthCheck{ServerConfigId: sc.Id, Target: t.target, Addr: t.addr, CheckedAt: now}
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", t.addr, serverHealthDialTimeout)
+		c.LatencyMs = time.Since(start).Milliseconds()
+		if err != nil {
+			c.Error = err.Error()
+		} else {
+			c.Ok = true
+			conn.Close()
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+func allOk(checks []*model.ServerHealthCheck) bool {
+	for _, c := range checks {
+		if !c.Ok {
+			return false
+		}
+	}
+	return true
+}
+
+func firstError(checks []*model.ServerHealthCheck) string {
+	for _, c := range checks {
+		if !c.Ok {
+			return c.Target + ": " + c.Error
+		}
+	}
+	return ""
+}
+
+func healthStatus(fails, threshold int) string {
+	if threshold <= 0 {
+		threshold = 1
+	}
+	if fails >= threshold {
+		return model.ServerHealthUnhealthy
+	}
+	return model.ServerHealthHealthy
+}
+
+// hostPort 补全默认端口, 地址为空时返回空
+func hostPort(addr string, defaultPort int) string {
+	if addr == "" {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(addr, strconv.Itoa(defaultPort))
+}
+
+// apiHostPort 从 API 地址中取出 host:port
+func apiHostPort(api string) string {
+	if api == "" {
+		return ""
+	}
+	u, err := url.Parse(api)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
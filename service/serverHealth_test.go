@@ -0,0 +1,75 @@
+package service
+
+import (
+	"net"
+	"testing"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+func TestServerHealthProbe(t *testing.T) {
+	up, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer up.Close()
+	go func() {
+		for {
+			c, err := up.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	// 取一个端口后立即关闭, 作为不可达的地址
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downAddr := down.Addr().String()
+	down.Close()
+
+	s := &ServerHealthService{}
+	sc := &model.ServerConfig{IdServer: up.Addr().String(), ApiServer: "http://" + up.Addr().String()}
+	checks := s.probe(sc, 0)
+	if len(checks) != 2 || !allOk(checks) {
+		t.Fatalf("expected 2 ok checks, got %+v", checks)
+	}
+
+	sc.RelayServer = downAddr
+	checks = s.probe(sc, 0)
+	if len(checks) != 3 || allOk(checks) {
+		t.Fatalf("expected relay failure, got %+v", checks)
+	}
+	if firstError(checks) == "" {
+		t.Fatal("expected error message")
+	}
+}
+
+func TestServerHealthStatus(t *testing.T) {
+	if healthStatus(0, 2) != model.ServerHealthHealthy {
+		t.Fatal("0 fails should be healthy")
+	}
+	if healthStatus(1, 2) != model.ServerHealthHealthy {
+		t.Fatal("1 fail below threshold should be healthy")
+	}
+	if healthStatus(2, 2) != model.ServerHealthUnhealthy {
+		t.Fatal("2 fails should be unhealthy")
+	}
+}
+
+func TestHostPort(t *testing.T) {
+	cases := map[string]string{
+		hostPort("id.example.com", 21116):       "id.example.com:21116",
+		hostPort("id.example.com:1000", 21116):  "id.example.com:1000",
+		apiHostPort("https://api.example.com"):  "api.example.com:443",
+		apiHostPort("http://1.2.3.4:21114/api"): "1.2.3.4:21114",
+		hostPort("", 21116):                     "",
+	}
+	for got, want := range cases {
+		if got != want {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
@@ -25,6 +25,26 @@ type Service struct {
 	*LdapService
 	*AppService
 	*ServerConfigService
+	*IpBlockService
+	*RelayUsageService
+	*ConfigSigningService
+	*GeoService
+	*ServerHealthService
+	*EnrollmentService
+	*PeerInventoryService
+	*ClientVersionService
+	*DeviceGroupRuleService
+	*PeerAttributeService
+	*SmartCollectionService
+	*FieldEncryptionService
+	*AddressBookSyncService
+	*AddressBookChangeService
+	*AddressBookTransferService
+	*AddressBookAccessService
+	*NotificationService
+	*TagDefinitionService
+	*TagRuleService
+	*PeerMergeService
 }
 
 type Dependencies struct {
@@ -50,6 +70,7 @@ func New(c *config.Config, g *gorm.DB, l *log.Logger, j *jwt.Jwt, lo lock.Locker
 	Jwt = j
 	Lock = lo
 	AllService = new(Service)
+	Events = newEvents()
 	return AllService
 }
 
@@ -1,10 +1,25 @@
 package service
 
 import (
+	"errors"
+	"strings"
+	"time"
+
 	"github.com/lejianwen/rustdesk-api/v2/model"
 	"gorm.io/gorm"
 )
 
+var (
+	ErrShareNotFound  = errors.New("ShareNotFound")
+	ErrShareExpired   = errors.New("ShareExpired")
+	ErrShareRevoked   = errors.New("ShareRevoked")
+	ErrShareExhausted = errors.New("ShareExhausted")
+	ErrShareRecipient = errors.New("ShareRecipientMismatch")
+	ErrShareLogin     = errors.New("ShareRecipientLoginRequired")
+	// 接收人邮箱没有对应唯一的启用用户
+	ErrShareRecipientUnknown = errors.New("ShareRecipientNotFound")
+)
+
 type ShareRecordService struct {
 }
 
@@ -35,7 +50,12 @@ func (srs *ShareRecordService) Create(u *model.ShareRecord) error {
 	return res
 }
 func (srs *ShareRecordService) Delete(u *model.ShareRecord) error {
-	return DB.Delete(u).Error
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(u).Error; err != nil {
+			return err
+		}
+		return tx.Where("share_record_id = ?", u.Id).Delete(&model.ShareRecordUse{}).Error
+	})
 }
 
 // Update 更新
@@ -44,5 +64,135 @@ func (srs *ShareRecordService) Update(u *model.ShareRecord) error {
 }
 
 func (srs *ShareRecordService) BatchDelete(ids []uint) error {
-	return DB.Where("id in (?)", ids).Delete(&model.ShareRecord{}).Error
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id in (?)", ids).Delete(&model.ShareRecord{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("share_record_id in (?)", ids).Delete(&model.ShareRecordUse{}).Error
+	})
+}
+
+// Revoke 吊销分享链接, 已吊销的不处理
+func (srs *ShareRecordService) Revoke(u *model.ShareRecord) error {
+	if u.RevokedAt > 0 {
+		return nil
+	}
+	u.RevokedAt = time.Now().Unix()
+	return DB.Model(u).Where("revoked_at = 0").Update("revoked_at", u.RevokedAt).Error
+}
+
+// ListUses 访问记录
+func (srs *ShareRecordService) ListUses(page, pageSize uint, where func(tx *gorm.DB)) (res *model.ShareRecordUseList) {
+	res = &model.ShareRecordUseList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := DB.Model(&model.ShareRecordUse{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Order("id desc").Find(&res.ShareRecordUses)
+	return
+}
+
+// ResolveRecipient 接收人邮箱对应的用户, 邮箱必须唯一对应一个启用的用户
+// 邮箱可由注册用户自行填写, 只按邮箱比对无法确认接收人, 因此创建分享时绑定用户
+func (srs *ShareRecordService) ResolveRecipient(email string) (uint, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return 0, ErrShareRecipientUnknown
+	}
+	var ids []uint
+	DB.Model(&model.User{}).Where("lower(email) = ? and status = ?", strings.ToLower(email), model.COMMON_STATUS_ENABLE).Limit(2).Pluck("id", &ids)
+	if len(ids) != 1 {
+		return 0, ErrShareRecipientUnknown
+	}
+	return ids[0], nil
+}
+
+// checkShareRecord 检查分享链接是否可以使用, 返回访问结果, u 为当前登录用户, 未登录为 nil
+func checkShareRecord(sr *model.ShareRecord, u *model.User, now time.Time) (string, error) {
+	if sr.RevokedAt > 0 {
+		return model.ShareRecordUseRevoked, ErrShareRevoked
+	}
+	if sr.Expire != 0 && time.Time(sr.CreatedAt).Add(time.Second*time.Duration(sr.Expire)).Before(now) {
+		return model.ShareRecordUseExpired, ErrShareExpired
+	}
+	if sr.MaxUses > 0 && sr.UseCount >= sr.MaxUses {
+		return model.ShareRecordUseExhausted, ErrShareExhausted
+	}
+	if sr.RecipientEmail != "" {
+		if u == nil || u.Id == 0 {
+			return model.ShareRecordUseRecipient, ErrShareLogin
+		}
+		if sr.RecipientUserId == 0 || u.Id != sr.RecipientUserId {
+			return model.ShareRecordUseRecipient, ErrShareRecipient
+		}
+	}
+	return model.ShareRecordUseOk, nil
+}
+
+// Use 打开分享链接, 计数并记录访问, 成功后发布 EventShareRecordUsed
+// 计数用条件更新保证并发时不超过最大使用次数
+func (srs *ShareRecordService) Use(token, ip, userAgent string, u *model.User) (*model.ShareRecord, error) {
+	sr := &model.ShareRecord{}
+	DB.Where("share_token = ?", token).First(sr)
+	if sr.Id == 0 {
+		return nil, ErrShareNotFound
+	}
+	now := time.Now()
+	use := &model.ShareRecordUse{
+		ShareRecordId: sr.Id,
+		UserId:        sr.UserId,
+		PeerId:        sr.PeerId,
+		Ip:            ip,
+		UserAgent:     userAgent,
+	}
+	if u != nil {
+		use.Email = u.Email
+	}
+	if len(use.UserAgent) > 512 {
+		use.UserAgent = use.UserAgent[:512]
+	}
+	result, err := checkShareRecord(sr, u, now)
+	if err == nil {
+		updates := map[string]interface{}{
+			"use_count":    gorm.Expr("use_count + 1"),
+			"last_used_at": now.Unix(),
+		}
+		if sr.RevokeOnUse {
+			updates["revoked_at"] = now.Unix()
+		}
+		tx := DB.Model(&model.ShareRecord{}).Where("id = ? and revoked_at = 0", sr.Id)
+		if sr.MaxUses > 0 {
+			tx.Where("use_count < ?", sr.MaxUses)
+		}
+		res := tx.Updates(updates)
+		if res.Error != nil {
+			return nil, res.Error
+		}
+		if res.RowsAffected == 0 {
+			// 并发访问时已被其他请求用完或吊销
+			result, err = model.ShareRecordUseExhausted, ErrShareExhausted
+			if sr.RevokeOnUse {
+				result, err = model.ShareRecordUseRevoked, ErrShareRevoked
+			}
+		} else {
+			sr.UseCount++
+			sr.LastUsedAt = now.Unix()
+			if sr.RevokeOnUse {
+				sr.RevokedAt = now.Unix()
+			}
+		}
+	}
+	use.Result = result
+	if cerr := DB.Create(use).Error; cerr != nil {
+		Logger.Errorf("record share %d use: %v", sr.Id, cerr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	Events.Publish(EventShareRecordUsed, &ShareRecordUsedEvent{Record: sr, Use: use})
+	return sr, nil
 }
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/model/custom_types"
+)
+
+func TestCheckShareRecord(t *testing.T) {
+	now := time.Now()
+	created := custom_types.AutoTime(now.Add(-time.Hour))
+	recipient := &model.User{Email: "a@example.com"}
+	recipient.Id = 3
+	// 邮箱相同但不是绑定的用户
+	other := &model.User{Email: "A@Example.com"}
+	other.Id = 4
+	cases := []struct {
+		sr     model.ShareRecord
+		user   *model.User
+		result string
+	}{
+		{model.ShareRecord{}, nil, model.ShareRecordUseOk},
+		{model.ShareRecord{Expire: 7200}, nil, model.ShareRecordUseOk},
+		{model.ShareRecord{Expire: 60}, nil, model.ShareRecordUseExpired},
+		{model.ShareRecord{RevokedAt: 1, Expire: 60}, nil, model.ShareRecordUseRevoked},
+		{model.ShareRecord{MaxUses: 2, UseCount: 1}, nil, model.ShareRecordUseOk},
+		{model.ShareRecord{MaxUses: 2, UseCount: 2}, nil, model.ShareRecordUseExhausted},
+		{model.ShareRecord{RecipientEmail: "a@example.com", RecipientUserId: 3}, recipient, model.ShareRecordUseOk},
+		{model.ShareRecord{RecipientEmail: "a@example.com", RecipientUserId: 3}, other, model.ShareRecordUseRecipient},
+		{model.ShareRecord{RecipientEmail: "a@example.com", RecipientUserId: 3}, nil, model.ShareRecordUseRecipient},
+		{model.ShareRecord{RecipientEmail: "a@example.com"}, recipient, model.ShareRecordUseRecipient},
+	}
+	for i, c := range cases {
+		c.sr.CreatedAt = created
+		result, err := checkShareRecord(&c.sr, c.user, now)
+		if result != c.result || (err == nil) != (c.result == model.ShareRecordUseOk) {
+			t.Fatalf("case %d: %s %v", i, result, err)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/model/custom_types"
+	"gorm.io/gorm"
+)
+
+// SmartCollectionService 智能地址簿, 按保存的设备查询把匹配的设备同步为地址簿条目
+// 条目是普通的 AddressBook, 地址簿共享规则照常生效; 同步只增删条目并刷新主机名等设备信息, 别名、标签等用户修改保留
+type SmartCollectionService struct {
+}
+
+// Check 校验查询条件
+func (ss *SmartCollectionService) Check(q *model.PeerQuery) error {
+	if q.IsEmpty() {
+		return nil
+	}
+	if q.OnlineWithinDays < 0 {
+		return fmt.Errorf("online_within_days must not be negative")
+	}
+	if len(q.Attrs) == 0 {
+		return nil
+	}
+	_, err := AllService.PeerAttributeService.ParseFilters(q.Attrs)
+	return err
+}
+
+// Where 查询条件, 非管理员的地址簿只能包含自己的设备
+func (ss *SmartCollectionService) Where(q *model.PeerQuery, owner *model.User) (func(tx *gorm.DB), error) {
+	filters, err := AllService.PeerAttributeService.ParseFilters(q.Attrs)
+	if err != nil {
+		return nil, err
+	}
+	return func(tx *gorm.DB) {
+		if owner.IsAdmin == nil || !*owner.IsAdmin {
+			tx.Where("user_id = ?", owner.Id)
+		}
+		if len(q.DeviceGroupIds) > 0 {
+			tx.Where("group_id in ?", q.DeviceGroupIds)
+		}
+		if len(q.UserIds) > 0 {
+			tx.Where("user_id in ?", q.UserIds)
+		}
+		if q.Os != "" {
+			tx.Where("os like ?", "%"+q.Os+"%")
+		}
+		if q.Hostname != "" {
+			tx.Where("hostname like ?", "%"+q.Hostname+"%")
+		}
+		if q.OnlineWithinDays > 0 {
+			tx.Where("last_online_time >= ?", time.Now().AddDate(0, 0, -q.OnlineWithinDays).Unix())
+		}
+		if len(q.Labels) > 0 || len(filters) > 0 {
+			AllService.PeerAttributeService.Where(tx, q.Labels, filters)
+		}
+	}, nil
+}
+
+// Preview 预览查询匹配的设备
+func (ss *SmartCollectionService) Preview(q *model.PeerQuery, owner *model.User, page, pageSize uint) (*model.PeerList, error) {
+	if q.IsEmpty() {
+		return nil, fmt.Errorf("peer query is empty")
+	}
+	where, err := ss.Where(q, owner)
+	if err != nil {
+		return nil, err
+	}
+	return AllService.PeerService.List(page, pageSize, where), nil
+}
+
+// Sync 按查询同步地址簿条目
+func (ss *SmartCollectionService) Sync(col *model.AddressBookCollection) (*model.SmartCollectionSyncResult, error) {
+	res := &model.SmartCollectionSyncResult{CollectionId: col.Id}
+	if !col.IsSmart() {
+		return res, nil
+	}
+	owner := AllService.UserService.InfoById(col.UserId)
+	if owner.Id == 0 {
+		return nil, fmt.Errorf("owner of collection %d not found", col.Id)
+	}
+	where, err := ss.Where(col.PeerQuery, owner)
+	if err != nil {
+		return nil, err
+	}
+	var peers []*model.Peer
+	tx := DB.Model(&model.Peer{})
+	where(tx)
+	tx.Find(&peers)
+	res.Total = len(peers)
+
+	var abs []*model.AddressBook
+	DB.Where("user_id = ? and collection_id = ?", col.UserId, col.Id).Find(&abs)
+	existing := make(map[string]*model.AddressBook, len(abs))
+	for _, ab := range abs {
+		existing[ab.Id] = ab
+	}
+
+	//匹配的设备超出配额时整体失败, 不截断
+	ids := make(map[string]bool, len(peers))
+	for _, p := range peers {
+		ids[p.Id] = true
+	}
+	net := 0
+	for id := range ids {
+		if _, ok := existing[id]; !ok {
+			net++
+		}
+	}
+	for id := range existing {
+		if !ids[id] {
+			net--
+		}
+	}
+	actor := AllService.AddressBookChangeService.SystemActor(model.AddressBookChangeSourceSmart)
+	ms := AllService.TagRuleService.matchers()
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := AllService.AddressBookService.CheckQuota(tx, col.UserId, col.Id, net); err != nil {
+			return err
+		}
+		matched := make(map[string]bool, len(peers))
+		for _, p := range peers {
+			if matched[p.Id] {
+				continue
+			}
+			matched[p.Id] = true
+			n := AllService.AddressBookService.FromPeer(p)
+			if ab, ok := existing[p.Id]; ok {
+				if ab.Hostname == n.Hostname && ab.Username == n.Username && ab.Platform == n.Platform {
+					continue
+				}
+				before := *ab
+				if err := tx.Model(ab).Updates(map[string]interface{}{
+					"hostname": n.Hostname,
+					"username": n.Username,
+					"platform": n.Platform,
+				}).Error; err != nil {
+					return err
+				}
+				ab.Hostname, ab.Username, ab.Platform = n.Hostname, n.Username, n.Platform
+				if err := AllService.AddressBookChangeService.RecordPeer(tx, actor, &before, ab); err != nil {
+					return err
+				}
+				res.Updated++
+				continue
+			}
+			n.UserId = col.UserId
+			n.CollectionId = col.Id
+			n.Tags = custom_types.AutoJson("[]")
+			if err := AllService.TagRuleService.apply(tx, ms, n, actor); err != nil {
+				return err
+			}
+			if err := tx.Create(n).Error; err != nil {
+				return err
+			}
+			if err := AllService.AddressBookChangeService.RecordPeer(tx, actor, nil, n); err != nil {
+				return err
+			}
+			res.Added++
+		}
+		for id, ab := range existing {
+			if matched[id] {
+				continue
+			}
+			if err := tx.Delete(ab).Error; err != nil {
+				return err
+			}
+			if err := AllService.AddressBookChangeService.RecordPeer(tx, actor, ab, nil); err != nil {
+				return err
+			}
+			res.Removed++
+		}
+		col.SyncedAt = time.Now().Unix()
+		return tx.Model(col).Update("synced_at", col.SyncedAt).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// SyncIfStale 读取前同步超过 maxAge 未同步的智能地址簿, 普通地址簿不处理
+func (ss *SmartCollectionService) SyncIfStale(cid uint, maxAge time.Duration) {
+	if cid == 0 {
+		return
+	}
+	col := AllService.AddressBookService.CollectionInfoById(cid)
+	if !col.IsSmart() || time.Since(time.Unix(col.SyncedAt, 0)) < maxAge {
+		return
+	}
+	if _, err := ss.Sync(col); err != nil {
+		Logger.Warn("sync smart collection ", cid, " failed: ", err)
+	}
+}
+
+// SyncAll 同步所有智能地址簿
+func (ss *SmartCollectionService) SyncAll() {
+	var cols []*model.AddressBookCollection
+	DB.Where("peer_query is not null and peer_query <> '' and peer_query <> 'null'").Find(&cols)
+	for _, col := range cols {
+		if _, err := ss.Sync(col); err != nil {
+			Logger.Warn("sync smart collection ", col.Id, " failed: ", err)
+		}
+	}
+}
+
+// IsSmart 地址簿是否为智能地址簿, 其条目由同步维护
+func (ss *SmartCollectionService) IsSmart(cid uint) bool {
+	if cid == 0 {
+		return false
+	}
+	return AllService.AddressBookService.CollectionInfoById(cid).IsSmart()
+}
+
+// StartSync 定时同步智能地址簿, 新上线的设备和在线时间条件依赖定时同步
+func (ss *SmartCollectionService) StartSync(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ss.SyncAll()
+			<-ticker.C
+		}
+	}()
+}
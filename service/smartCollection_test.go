@@ -0,0 +1,28 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+func TestSmartCollectionCheck(t *testing.T) {
+	ss := &SmartCollectionService{}
+	if err := ss.Check(nil); err != nil {
+		t.Fatalf("nil query should be a static collection: %v", err)
+	}
+	if err := ss.Check(&model.PeerQuery{Os: "Windows", OnlineWithinDays: 7}); err != nil {
+		t.Fatalf("valid query rejected: %v", err)
+	}
+	if err := ss.Check(&model.PeerQuery{OnlineWithinDays: -1, Os: "Windows"}); err == nil {
+		t.Fatal("negative online_within_days accepted")
+	}
+	col := &model.AddressBookCollection{PeerQuery: &model.PeerQuery{}}
+	if col.IsSmart() {
+		t.Fatal("empty query should not make a smart collection")
+	}
+	col.PeerQuery.DeviceGroupIds = []uint{3}
+	if !col.IsSmart() {
+		t.Fatal("device group query should make a smart collection")
+	}
+}
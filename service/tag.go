@@ -1,13 +1,34 @@
 package service
 
 import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+
 	"github.com/lejianwen/rustdesk-api/v2/model"
+	"github.com/lejianwen/rustdesk-api/v2/model/custom_types"
 	"gorm.io/gorm"
 )
 
 type TagService struct {
 }
 
+var ErrTagScopeMismatch = errors.New("TagScopeMismatch")
+
+// TagScope 标签所在的地址簿, 为 nil 时表示所有地址簿
+type TagScope struct {
+	UserId       uint
+	CollectionId uint
+}
+
+func (sc *TagScope) apply(tx *gorm.DB) *gorm.DB {
+	if sc == nil {
+		return tx
+	}
+	return tx.Where("user_id = ? and collection_id = ?", sc.UserId, sc.CollectionId)
+}
+
 func (s *TagService) Info(id uint) *model.Tag {
 	p := &model.Tag{}
 	DB.Where("id = ?", id).First(p)
@@ -32,35 +53,6 @@ func (s *TagService) ListByUserIdAndCollectionId(userId, cid uint) (res *model.T
 	})
 	return
 }
-func (s *TagService) UpdateTags(userId uint, tags map[string]uint) {
-	tx := DB.Begin()
-	//先查询所有tag
-	var allTags []*model.Tag
-	tx.Where("user_id = ?", userId).Find(&allTags)
-	for _, t := range allTags {
-		if _, ok := tags[t.Name]; !ok {
-			//删除
-			tx.Delete(t)
-		} else {
-			if tags[t.Name] != t.Color {
-				//更新
-				t.Color = tags[t.Name]
-				tx.Save(t)
-			}
-			//移除
-			delete(tags, t.Name)
-		}
-	}
-	//新增
-	for tag, color := range tags {
-		t := &model.Tag{}
-		t.Name = tag
-		t.Color = color
-		t.UserId = userId
-		tx.Create(t)
-	}
-	tx.Commit()
-}
 
 // InfoById 根据用户id取用户信息
 func (s *TagService) InfoById(id uint) *model.Tag {
@@ -84,15 +76,210 @@ func (s *TagService) List(page, pageSize uint, where func(tx *gorm.DB)) (res *mo
 }
 
 // Create 创建
-func (s *TagService) Create(u *model.Tag) error {
-	res := DB.Create(u).Error
-	return res
+func (s *TagService) Create(u *model.Tag, actor *AddressBookActor) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(u).Error; err != nil {
+			return err
+		}
+		return AllService.AddressBookChangeService.RecordTag(tx, actor, nil, u)
+	})
+}
+func (s *TagService) Delete(u *model.Tag, actor *AddressBookActor) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		before := &model.Tag{}
+		tx.Where("id = ?", u.Id).First(before)
+		if err := tx.Delete(u).Error; err != nil {
+			return err
+		}
+		if before.Id == 0 {
+			return nil
+		}
+		return AllService.AddressBookChangeService.RecordTag(tx, actor, before, nil)
+	})
 }
-func (s *TagService) Delete(u *model.Tag) error {
-	return DB.Delete(u).Error
+
+// Update 更新, 改名时同步修改该地址簿中引用此标签的条目
+func (s *TagService) Update(u *model.Tag, actor *AddressBookActor) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		before := &model.Tag{}
+		tx.Where("id = ?", u.Id).First(before)
+		if err := tx.Model(u).Select("*").Omit("created_at").Updates(u).Error; err != nil {
+			return err
+		}
+		if before.Id == 0 {
+			return nil
+		}
+		if err := AllService.AddressBookChangeService.RecordTag(tx, actor, before, u); err != nil {
+			return err
+		}
+		if before.Name == u.Name || before.UserId != u.UserId || before.CollectionId != u.CollectionId {
+			return nil
+		}
+		_, err := s.renameInPeers(tx, &TagScope{UserId: u.UserId, CollectionId: u.CollectionId}, []string{before.Name}, u.Name, actor)
+		return err
+	})
 }
 
-// Update 更新
-func (s *TagService) Update(u *model.Tag) error {
-	return DB.Model(u).Select("*").Omit("created_at").Updates(u).Error
+// Rename 把 from 中的标签改名为 to, 地址簿中已有 to 时合并到 to 并删除 from
+// 同时替换引用这些标签的地址簿条目, scope 为 nil 时处理所有地址簿
+func (s *TagService) Rename(scope *TagScope, from []string, to string, actor *AddressBookActor) (*model.TagRenameResult, error) {
+	to = strings.TrimSpace(to)
+	if to == "" {
+		return nil, errors.New("ParamsError")
+	}
+	names := make([]string, 0, len(from))
+	for _, n := range from {
+		if n != to && n != "" {
+			names = append(names, n)
+		}
+	}
+	res := &model.TagRenameResult{}
+	if len(names) == 0 {
+		return res, nil
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var tags []*model.Tag
+		scope.apply(tx.Where("name in ?", append(names, to))).Order("id asc").Find(&tags)
+		targets := make(map[TagScope]bool)
+		for _, t := range tags {
+			if t.Name == to {
+				targets[TagScope{UserId: t.UserId, CollectionId: t.CollectionId}] = true
+			}
+		}
+		for _, t := range tags {
+			if t.Name == to {
+				continue
+			}
+			key := TagScope{UserId: t.UserId, CollectionId: t.CollectionId}
+			before := *t
+			if targets[key] {
+				if err := tx.Delete(t).Error; err != nil {
+					return err
+				}
+				if err := AllService.AddressBookChangeService.RecordTag(tx, actor, &before, nil); err != nil {
+					return err
+				}
+			} else {
+				//地址簿中还没有 to, 第一个标签改名, 保留颜色
+				targets[key] = true
+				t.Name = to
+				if err := tx.Model(t).Update("name", to).Error; err != nil {
+					return err
+				}
+				if err := AllService.AddressBookChangeService.RecordTag(tx, actor, &before, t); err != nil {
+					return err
+				}
+			}
+			res.Tags++
+		}
+		n, err := s.renameInPeers(tx, scope, names, to, actor)
+		res.Peers = n
+		return err
+	})
+	return res, err
+}
+
+func (s *TagService) ListByIds(ids []uint) (res []*model.Tag) {
+	DB.Where("id in ?", ids).Order("id asc").Find(&res)
+	return
+}
+
+// Merge 把同一地址簿中的 sources 合并到 target
+func (s *TagService) Merge(sources []*model.Tag, target *model.Tag, actor *AddressBookActor) (*model.TagRenameResult, error) {
+	names := make([]string, 0, len(sources))
+	for _, t := range sources {
+		if t.UserId != target.UserId || t.CollectionId != target.CollectionId {
+			return nil, ErrTagScopeMismatch
+		}
+		names = append(names, t.Name)
+	}
+	return s.Rename(&TagScope{UserId: target.UserId, CollectionId: target.CollectionId}, names, target.Name, actor)
+}
+
+// renameInPeers 替换条目中的标签, 返回修改的条目数
+func (s *TagService) renameInPeers(tx *gorm.DB, scope *TagScope, from []string, to string, actor *AddressBookActor) (int, error) {
+	//标签存在 json 中, 各数据库的 json 写法不同 (转义、文本或二进制), 逐条解析后比较
+	q := scope.apply(tx.Model(&model.AddressBook{}))
+	fromSet := make(map[string]bool, len(from))
+	for _, n := range from {
+		fromSet[n] = true
+	}
+	count := 0
+	var abs []*model.AddressBook
+	err := q.FindInBatches(&abs, 500, func(btx *gorm.DB, _ int) error {
+		for _, ab := range abs {
+			var tags []string
+			if err := json.Unmarshal(ab.Tags, &tags); err != nil {
+				continue
+			}
+			nt, changed := renameTags(tags, fromSet, to)
+			if !changed {
+				continue
+			}
+			before := *ab
+			tv, _ := json.Marshal(nt)
+			ab.Tags = custom_types.AutoJson(tv)
+			if err := tx.Model(&model.AddressBook{}).Where("row_id = ?", ab.RowId).Update("tags", ab.Tags).Error; err != nil {
+				return err
+			}
+			if err := AllService.AddressBookChangeService.RecordPeer(tx, actor, &before, ab); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	}).Error
+	return count, err
+}
+
+// renameTags 把 from 中的标签替换为 to, 保持顺序并去重
+func renameTags(tags []string, from map[string]bool, to string) ([]string, bool) {
+	res := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	changed := false
+	for _, t := range tags {
+		if from[t] {
+			t = to
+			changed = true
+		}
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		res = append(res, t)
+	}
+	return res, changed
+}
+
+// ensureTags 地址簿中没有的标签自动创建, 颜色优先使用全局定义
+func (s *TagService) ensureTags(tx *gorm.DB, userId, cid uint, names []string, actor *AddressBookActor) error {
+	if len(names) == 0 {
+		return nil
+	}
+	var exists []string
+	tx.Model(&model.Tag{}).Where("user_id = ? and collection_id = ? and name in ?", userId, cid, names).Pluck("name", &exists)
+	var defs []*model.TagDefinition
+	tx.Where("name in ?", names).Find(&defs)
+	colors := make(map[string]uint, len(defs))
+	for _, d := range defs {
+		colors[d.Name] = d.Color
+	}
+	for _, name := range names {
+		if slices.Contains(exists, name) {
+			continue
+		}
+		color, ok := colors[name]
+		if !ok {
+			color = model.TagDefaultColor
+		}
+		t := &model.Tag{Name: name, Color: color, UserId: userId, CollectionId: cid}
+		if err := tx.Create(t).Error; err != nil {
+			return err
+		}
+		if err := AllService.AddressBookChangeService.RecordTag(tx, actor, nil, t); err != nil {
+			return err
+		}
+		exists = append(exists, name)
+	}
+	return nil
 }
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"gorm.io/gorm"
+)
+
+// TagDefinitionService 全局标签定义
+type TagDefinitionService struct {
+}
+
+// TagPushOptions 推送目标, CollectionIds 为共享地址簿, UserIds 为用户的个人地址簿
+type TagPushOptions struct {
+	CollectionIds []uint
+	UserIds       []uint
+	// 地址簿中已有同名标签时覆盖颜色
+	Overwrite bool
+}
+
+func (ts *TagDefinitionService) List(page, pageSize uint, where func(tx *gorm.DB)) (res *model.TagDefinitionList) {
+	res = &model.TagDefinitionList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := DB.Model(&model.TagDefinition{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Order("name asc").Find(&res.TagDefinitions)
+	return
+}
+
+func (ts *TagDefinitionService) InfoById(id uint) *model.TagDefinition {
+	d := &model.TagDefinition{}
+	DB.Where("id = ?", id).First(d)
+	return d
+}
+
+func (ts *TagDefinitionService) InfoByName(name string) *model.TagDefinition {
+	d := &model.TagDefinition{}
+	DB.Where("name = ?", name).First(d)
+	return d
+}
+
+func (ts *TagDefinitionService) ListByIds(ids []uint) (res []*model.TagDefinition) {
+	DB.Where("id in ?", ids).Order("id asc").Find(&res)
+	return
+}
+
+func (ts *TagDefinitionService) Create(d *model.TagDefinition) error {
+	if ex := ts.InfoByName(d.Name); ex.Id > 0 {
+		return errors.New("ItemExists")
+	}
+	return DB.Create(d).Error
+}
+
+// Update 更新, 改名时所有地址簿中的同名标签及引用它的条目一起改名
+func (ts *TagDefinitionService) Update(d *model.TagDefinition, actor *AddressBookActor) (*model.TagRenameResult, error) {
+	before := ts.InfoById(d.Id)
+	if before.Id == 0 {
+		return nil, errors.New("ItemNotFound")
+	}
+	if ex := ts.InfoByName(d.Name); ex.Id > 0 && ex.Id != d.Id {
+		return nil, errors.New("ItemExists")
+	}
+	if err := DB.Model(d).Select("name", "color", "note").Updates(d).Error; err != nil {
+		return nil, err
+	}
+	if before.Name == d.Name {
+		return &model.TagRenameResult{}, nil
+	}
+	return AllService.TagService.Rename(nil, []string{before.Name}, d.Name, actor)
+}
+
+// Delete 删除定义, 地址簿中的标签保留
+func (ts *TagDefinitionService) Delete(d *model.TagDefinition) error {
+	return DB.Delete(d).Error
+}
+
+// Merge 把 sources 合并到 target, 所有地址簿中的同名标签及条目一起合并, 然后删除 sources
+func (ts *TagDefinitionService) Merge(sources []*model.TagDefinition, target *model.TagDefinition, actor *AddressBookActor) (*model.TagRenameResult, error) {
+	names := make([]string, 0, len(sources))
+	ids := make([]uint, 0, len(sources))
+	for _, d := range sources {
+		if d.Id == target.Id {
+			continue
+		}
+		names = append(names, d.Name)
+		ids = append(ids, d.Id)
+	}
+	res, err := AllService.TagService.Rename(nil, names, target.Name, actor)
+	if err != nil {
+		return res, err
+	}
+	if len(ids) > 0 {
+		err = DB.Where("id in ?", ids).Delete(&model.TagDefinition{}).Error
+	}
+	return res, err
+}
+
+// Push 把定义推送到地址簿, 没有的标签创建, 已有的按 Overwrite 决定是否覆盖颜色
+func (ts *TagDefinitionService) Push(defs []*model.TagDefinition, opts *TagPushOptions, actor *AddressBookActor) (*model.TagPushResult, error) {
+	slices.Sort(opts.CollectionIds)
+	opts.CollectionIds = slices.Compact(opts.CollectionIds)
+	slices.Sort(opts.UserIds)
+	opts.UserIds = slices.Compact(opts.UserIds)
+	scopes := make([]TagScope, 0, len(opts.CollectionIds)+len(opts.UserIds))
+	for _, c := range AllService.AddressBookService.ListCollectionByIds(opts.CollectionIds) {
+		scopes = append(scopes, TagScope{UserId: c.UserId, CollectionId: c.Id})
+	}
+	if len(opts.UserIds) > 0 {
+		for _, u := range AllService.UserService.ListByIds(opts.UserIds) {
+			scopes = append(scopes, TagScope{UserId: u.Id})
+		}
+	}
+	if len(scopes) != len(opts.CollectionIds)+len(opts.UserIds) {
+		return nil, errors.New("ItemNotFound")
+	}
+	res := &model.TagPushResult{}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for _, sc := range scopes {
+			for _, d := range defs {
+				t := &model.Tag{}
+				tx.Where("user_id = ? and collection_id = ? and name = ?", sc.UserId, sc.CollectionId, d.Name).First(t)
+				switch {
+				case t.Id == 0:
+					t = &model.Tag{Name: d.Name, Color: d.Color, UserId: sc.UserId, CollectionId: sc.CollectionId}
+					if err := tx.Create(t).Error; err != nil {
+						return err
+					}
+					if err := AllService.AddressBookChangeService.RecordTag(tx, actor, nil, t); err != nil {
+						return err
+					}
+					res.Created++
+				case opts.Overwrite && t.Color != d.Color:
+					before := *t
+					t.Color = d.Color
+					if err := tx.Model(t).Update("color", d.Color).Error; err != nil {
+						return err
+					}
+					if err := AllService.AddressBookChangeService.RecordTag(tx, actor, &before, t); err != nil {
+						return err
+					}
+					res.Updated++
+				default:
+					res.Skipped++
+				}
+			}
+		}
+		return nil
+	})
+	return res, err
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+	"gorm.io/gorm"
+)
+
+// TagRuleService 自动打标签规则
+type TagRuleService struct {
+}
+
+// tagRuleMatcher 预编译正则的规则
+type tagRuleMatcher struct {
+	rule     *model.TagRule
+	hostname *regexp.Regexp
+}
+
+// tagRuleSubject 待匹配的条目, 设备信息来自已入库的设备, 没有时使用条目上的信息
+type tagRuleSubject struct {
+	hostname string
+	os       string
+	groupId  uint
+}
+
+func (rs *TagRuleService) List(page, pageSize uint, where func(tx *gorm.DB)) (res *model.TagRuleList) {
+	res = &model.TagRuleList{}
+	res.Page = int64(page)
+	res.PageSize = int64(pageSize)
+	tx := DB.Model(&model.TagRule{})
+	if where != nil {
+		where(tx)
+	}
+	tx.Count(&res.Total)
+	tx.Scopes(Paginate(page, pageSize))
+	tx.Order("id asc").Find(&res.TagRules)
+	return
+}
+
+func (rs *TagRuleService) InfoById(id uint) *model.TagRule {
+	r := &model.TagRule{}
+	DB.Where("id = ?", id).First(r)
+	return r
+}
+
+func (rs *TagRuleService) Create(r *model.TagRule) error {
+	if err := rs.Check(r); err != nil {
+		return err
+	}
+	return DB.Create(r).Error
+}
+
+func (rs *TagRuleService) Update(r *model.TagRule) error {
+	if err := rs.Check(r); err != nil {
+		return err
+	}
+	return DB.Model(r).Select("*").Omit("created_at").Updates(r).Error
+}
+
+// Delete 删除规则, 已打上的标签保留
+func (rs *TagRuleService) Delete(r *model.TagRule) error {
+	return DB.Delete(r).Error
+}
+
+// Check 校验规则, 标签会去掉首尾空白并去重
+func (rs *TagRuleService) Check(r *model.TagRule) error {
+	if !r.HasCondition() {
+		return errors.New("at least one condition is required")
+	}
+	tags := make([]string, 0, len(r.Tags))
+	for _, t := range r.Tags {
+		t = strings.TrimSpace(t)
+		if t != "" && !slices.Contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	if len(tags) == 0 {
+		return errors.New("at least one tag is required")
+	}
+	r.Tags = tags
+	if r.DeviceGroupId > 0 && AllService.GroupService.DeviceGroupInfoById(r.DeviceGroupId).Id == 0 {
+		return errors.New("DeviceGroupNotFound")
+	}
+	if r.HostnameRegex != "" {
+		if _, err := regexp.Compile(r.HostnameRegex); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchers 启用的规则, 正则无效的规则跳过
+func (rs *TagRuleService) matchers() []*tagRuleMatcher {
+	var rules []*model.TagRule
+	DB.Where("status = ?", model.COMMON_STATUS_ENABLE).Order("id asc").Find(&rules)
+	ms := make([]*tagRuleMatcher, 0, len(rules))
+	for _, r := range rules {
+		if !r.HasCondition() || len(r.Tags) == 0 {
+			continue
+		}
+		m := &tagRuleMatcher{rule: r}
+		if r.HostnameRegex != "" {
+			re, err := regexp.Compile(r.HostnameRegex)
+			if err != nil {
+				Logger.Warn("tag rule ", r.Id, " has invalid hostname regex: ", err)
+				continue
+			}
+			m.hostname = re
+		}
+		ms = append(ms, m)
+	}
+	return ms
+}
+
+func (m *tagRuleMatcher) match(s *tagRuleSubject) bool {
+	r := m.rule
+	if m.hostname != nil && !m.hostname.MatchString(s.hostname) {
+		return false
+	}
+	if r.Os != "" && !strings.Contains(strings.ToLower(s.os), strings.ToLower(r.Os)) {
+		return false
+	}
+	if r.DeviceGroupId > 0 && s.groupId != r.DeviceGroupId {
+		return false
+	}
+	return true
+}
+
+// matchTags 命中规则的标签, 按规则顺序去重
+func matchTags(ms []*tagRuleMatcher, s *tagRuleSubject) []string {
+	var res []string
+	seen := make(map[string]bool)
+	for _, m := range ms {
+		if !m.match(s) {
+			continue
+		}
+		for _, t := range m.rule.Tags {
+			if !seen[t] {
+				seen[t] = true
+				res = append(res, t)
+			}
+		}
+	}
+	return res
+}
+
+// apply 创建条目前按规则补充标签, 并在地址簿中创建缺少的标签
+func (rs *TagRuleService) apply(tx *gorm.DB, ms []*tagRuleMatcher, ab *model.AddressBook, actor *AddressBookActor) error {
+	if len(ms) == 0 {
+		return nil
+	}
+	s := &tagRuleSubject{hostname: ab.Hostname, os: ab.Platform}
+	peer := &model.Peer{}
+	if ab.Id != "" {
+		tx.Where("id = ?", ab.Id).First(peer)
+	}
+	if peer.RowId > 0 {
+		if peer.Hostname != "" {
+			s.hostname = peer.Hostname
+		}
+		if peer.Os != "" {
+			s.os = peer.Os
+		}
+		s.groupId = peer.GroupId
+	}
+	add := matchTags(ms, s)
+	if len(add) == 0 {
+		return nil
+	}
+	var tags []string
+	_ = json.Unmarshal(ab.Tags, &tags)
+	added := false
+	for _, t := range add {
+		if !slices.Contains(tags, t) {
+			tags = append(tags, t)
+			added = true
+		}
+	}
+	if added {
+		ab.Tags, _ = json.Marshal(tags)
+	}
+	return AllService.TagService.ensureTags(tx, ab.UserId, ab.CollectionId, add, actor)
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/lejianwen/rustdesk-api/v2/model"
+)
+
+func TestRenameTags(t *testing.T) {
+	from := map[string]bool{"dev": true, "Dev": true}
+	res, changed := renameTags([]string{"ops", "dev", "prod", "Dev"}, from, "develop")
+	if !changed || !reflect.DeepEqual(res, []string{"ops", "develop", "prod"}) {
+		t.Fatalf("got %v %v", res, changed)
+	}
+	// 已有目标标签时合并去重
+	res, _ = renameTags([]string{"develop", "dev"}, from, "develop")
+	if !reflect.DeepEqual(res, []string{"develop"}) {
+		t.Fatalf("got %v", res)
+	}
+	res, changed = renameTags([]string{"ops"}, from, "develop")
+	if changed || !reflect.DeepEqual(res, []string{"ops"}) {
+		t.Fatalf("got %v %v", res, changed)
+	}
+}
+
+func TestMatchTags(t *testing.T) {
+	ms := []*tagRuleMatcher{
+		{rule: &model.TagRule{Tags: []string{"windows"}, Os: "windows"}},
+		{rule: &model.TagRule{Tags: []string{"lab", "windows"}, HostnameRegex: "^lab-"}, hostname: regexp.MustCompile("^lab-")},
+		{rule: &model.TagRule{Tags: []string{"branch"}, DeviceGroupId: 3, Os: "linux"}},
+	}
+	cases := []struct {
+		s    *tagRuleSubject
+		want []string
+	}{
+		{&tagRuleSubject{hostname: "lab-01", os: "Windows 11"}, []string{"windows", "lab"}},
+		{&tagRuleSubject{hostname: "office", os: "Linux / Ubuntu", groupId: 3}, []string{"branch"}},
+		{&tagRuleSubject{hostname: "office", os: "Linux", groupId: 2}, nil},
+	}
+	for _, c := range cases {
+		if got := matchTags(ms, c.s); !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("%+v: got %v, want %v", c.s, got, c.want)
+		}
+	}
+}
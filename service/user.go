@@ -256,6 +256,24 @@ func (us *UserService) Delete(u *model.User) error {
 		tx.Rollback()
 		return err
 	}
+	//  删除申请人或所有者为该用户的访问申请
+	if err := tx.Where("user_id = ? or owner_id = ?", u.Id, u.Id).Delete(&model.AddressBookAccessRequest{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	//  删除分享记录、访问记录和通知
+	if err := tx.Where("user_id = ?", u.Id).Delete(&model.ShareRecord{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("user_id = ?", u.Id).Delete(&model.ShareRecordUse{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("user_id = ?", u.Id).Delete(&model.Notification{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
 	tx.Commit()
 	// 删除关联的peer
 	if err := AllService.PeerService.EraseUserId(u.Id); err != nil {
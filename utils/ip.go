@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+// ParseCidr 解析CIDR, 单个IP按 /32 或 /128 处理
+func ParseCidr(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("empty cidr")
+	}
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, errors.New("invalid ip: " + s)
+		}
+		if v4 := ip.To4(); v4 != nil {
+			return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// NormalizeCidr 规范化CIDR, 单个IP返回IP本身
+func NormalizeCidr(s string) (string, error) {
+	n, err := ParseCidr(s)
+	if err != nil {
+		return "", err
+	}
+	ones, bits := n.Mask.Size()
+	if ones == bits {
+		return n.IP.String(), nil
+	}
+	return n.String(), nil
+}
+
+// CidrContains 判断ip是否在cidr中
+func CidrContains(cidr string, ip string) bool {
+	n, err := ParseCidr(cidr)
+	if err != nil {
+		return false
+	}
+	p := net.ParseIP(ip)
+	if p == nil {
+		return false
+	}
+	return n.Contains(p)
+}
+
+// ExpandCidr 展开CIDR中的所有IP, 数量超过max时返回错误
+func ExpandCidr(cidr string, max int) ([]string, error) {
+	n, err := ParseCidr(cidr)
+	if err != nil {
+		return nil, err
+	}
+	ones, bits := n.Mask.Size()
+	if bits-ones >= 31 || 1<<(bits-ones) > max {
+		return nil, errors.New("cidr too large to expand: " + cidr)
+	}
+	ips := make([]string, 0, 1<<(bits-ones))
+	ip := make(net.IP, len(n.IP))
+	copy(ip, n.IP)
+	for ; n.Contains(ip); ip = nextIp(ip) {
+		ips = append(ips, ip.String())
+		if len(ips) == 1<<(bits-ones) {
+			break
+		}
+	}
+	return ips, nil
+}
+
+func nextIp(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
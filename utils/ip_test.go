@@ -0,0 +1,50 @@
+package utils
+
+import "testing"
+
+func TestNormalizeCidr(t *testing.T) {
+	cases := map[string]string{
+		"1.2.3.4":        "1.2.3.4",
+		" 10.0.0.1/24 ":  "10.0.0.0/24",
+		"2001:db8::1":    "2001:db8::1",
+		"2001:db8::/32":  "2001:db8::/32",
+		"192.168.1.1/32": "192.168.1.1",
+	}
+	for in, want := range cases {
+		got, err := NormalizeCidr(in)
+		if err != nil {
+			t.Fatalf("NormalizeCidr(%q) error: %v", in, err)
+		}
+		if got != want {
+			t.Errorf("NormalizeCidr(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if _, err := NormalizeCidr("not-an-ip"); err == nil {
+		t.Error("invalid input should fail")
+	}
+}
+
+func TestCidrContains(t *testing.T) {
+	if !CidrContains("10.0.0.0/8", "10.1.2.3") {
+		t.Error("10.1.2.3 should be in 10.0.0.0/8")
+	}
+	if CidrContains("10.0.0.0/8", "11.1.2.3") {
+		t.Error("11.1.2.3 should not be in 10.0.0.0/8")
+	}
+	if !CidrContains("1.2.3.4", "1.2.3.4") {
+		t.Error("single ip should match itself")
+	}
+}
+
+func TestExpandCidr(t *testing.T) {
+	ips, err := ExpandCidr("192.168.0.0/30", 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ips) != 4 || ips[0] != "192.168.0.0" || ips[3] != "192.168.0.3" {
+		t.Errorf("unexpected expand result: %v", ips)
+	}
+	if _, err = ExpandCidr("10.0.0.0/8", 256); err == nil {
+		t.Error("large cidr should not be expanded")
+	}
+}
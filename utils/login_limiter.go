@@ -44,6 +44,7 @@ type LoginLimiter struct {
 	captchas    map[string]CaptchaMeta
 	bannedIPs   map[string]BanRecord
 	provider    CaptchaProvider
+	banHandler  func(ip string, record BanRecord)
 	cleanupStop chan struct{}
 }
 
@@ -81,6 +82,21 @@ func (ll *LoginLimiter) RegisterProvider(p CaptchaProvider) {
 	ll.provider = p
 }
 
+// RegisterBanHandler 注册封禁回调, 封禁IP时异步调用
+func (ll *LoginLimiter) RegisterBanHandler(h func(ip string, record BanRecord)) {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+	ll.banHandler = h
+}
+
+// Unban 解除封禁
+func (ll *LoginLimiter) Unban(ip string) {
+	ll.mu.Lock()
+	defer ll.mu.Unlock()
+	delete(ll.bannedIPs, ip)
+	delete(ll.attempts, ip)
+}
+
 // isDisabled 检查是否禁用登录限制
 func (ll *LoginLimiter) isDisabled() bool {
 	return ll.policy.CaptchaThreshold < 0 && ll.policy.BanThreshold == 0
@@ -240,12 +256,16 @@ func (ll *LoginLimiter) isBanned(ip string) (bool, BanRecord) {
 }
 
 func (ll *LoginLimiter) banIP(ip, reason string) {
-	ll.bannedIPs[ip] = BanRecord{
+	record := BanRecord{
 		ExpiresAt: time.Now().Add(ll.policy.BanDuration),
 		Reason:    reason,
 	}
+	ll.bannedIPs[ip] = record
 	delete(ll.attempts, ip)
 	delete(ll.captchas, ip)
+	if ll.banHandler != nil {
+		go ll.banHandler(ip, record)
+	}
 }
 
 func (ll *LoginLimiter) pruneAttempts(ip string, cutoff time.Time) []time.Time {
@@ -288,3 +288,32 @@ func TestB64CaptchaFlow(t *testing.T) {
 		t.Error("验证成功后应该重置状态")
 	}
 }
+
+func TestBanHandlerAndUnban(t *testing.T) {
+	policy := SecurityPolicy{CaptchaThreshold: -1, BanThreshold: 2}
+	limiter := NewLoginLimiter(policy)
+	ip := "10.0.0.2"
+	banned := make(chan BanRecord, 1)
+	limiter.RegisterBanHandler(func(bip string, record BanRecord) {
+		if bip == ip {
+			banned <- record
+		}
+	})
+
+	limiter.RecordFailedAttempt(ip)
+	limiter.RecordFailedAttempt(ip)
+
+	select {
+	case record := <-banned:
+		if record.ExpiresAt.Before(time.Now()) {
+			t.Error("ban record should expire in the future")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ban handler should be called")
+	}
+
+	limiter.Unban(ip)
+	if isBanned, _ := limiter.CheckSecurityStatus(ip); isBanned {
+		t.Error("should not be banned after unban")
+	}
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CompareVersion 按语义化版本比较 a 和 b, 返回 -1, 0, 1
+// 允许前缀 v, 缺省的段视为 0, 带预发布标识的版本低于对应正式版本, 构建元数据忽略
+func CompareVersion(a, b string) int {
+	ac, ap := splitVersion(a)
+	bc, bp := splitVersion(b)
+	for i := 0; i < len(ac) || i < len(bc); i++ {
+		if c := compareIdent(partAt(ac, i), partAt(bc, i)); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(ap) == 0 && len(bp) == 0:
+		return 0
+	case len(ap) == 0:
+		return 1
+	case len(bp) == 0:
+		return -1
+	}
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		if c := compareIdent(ap[i], bp[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(ap), len(bp))
+}
+
+// IsVersion 是否为可比较的版本号, 至少以数字开头
+func IsVersion(v string) bool {
+	core, _ := splitVersion(v)
+	if len(core) == 0 {
+		return false
+	}
+	_, err := strconv.Atoi(core[0])
+	return err == nil
+}
+
+func splitVersion(v string) (core, pre []string) {
+	v = strings.TrimSpace(v)
+	v = strings.TrimPrefix(strings.TrimPrefix(v, "v"), "V")
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i]
+	}
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		pre = strings.Split(v[i+1:], ".")
+		v = v[:i]
+	}
+	if v != "" {
+		core = strings.Split(v, ".")
+	}
+	return
+}
+
+func partAt(parts []string, i int) string {
+	if i < len(parts) {
+		return parts[i]
+	}
+	return "0"
+}
+
+// compareIdent 数字按数值比较, 数字低于非数字, 非数字按字典序
+func compareIdent(a, b string) int {
+	ai, aerr := strconv.Atoi(a)
+	bi, berr := strconv.Atoi(b)
+	switch {
+	case aerr == nil && berr == nil:
+		return compareInt(ai, bi)
+	case aerr == nil:
+		return -1
+	case berr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
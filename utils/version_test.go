@@ -0,0 +1,36 @@
+package utils
+
+import "testing"
+
+func TestCompareVersion(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.3.0", "1.3.0", 0},
+		{"v1.3.0", "1.3", 0},
+		{"1.2.9", "1.3.0", -1},
+		{"1.10.0", "1.9.0", 1},
+		{"1.3.0-beta", "1.3.0", -1},
+		{"1.3.0-beta.2", "1.3.0-beta.10", -1},
+		{"1.3.0-alpha", "1.3.0-beta", -1},
+		{"1.3.0+build5", "1.3.0", 0},
+		{"1.4.0-rc1", "1.3.9", 1},
+	}
+	for _, c := range cases {
+		if got := CompareVersion(c.a, c.b); got != c.want {
+			t.Errorf("CompareVersion(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+		if got := CompareVersion(c.b, c.a); got != -c.want {
+			t.Errorf("CompareVersion(%q, %q) = %d, want %d", c.b, c.a, got, -c.want)
+		}
+	}
+}
+
+func TestIsVersion(t *testing.T) {
+	for v, want := range map[string]bool{"1.3.0": true, "v2": true, "": false, "nightly": false} {
+		if got := IsVersion(v); got != want {
+			t.Errorf("IsVersion(%q) = %v, want %v", v, got, want)
+		}
+	}
+}